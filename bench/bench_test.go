@@ -3,6 +3,7 @@ package bench
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -10,6 +11,9 @@ import (
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
 
 	lb "github.com/TFMV/lockbox/pkg/lockbox"
 )
@@ -87,3 +91,324 @@ func BenchmarkReadLarge(b *testing.B) {
 		rec.Release()
 	}
 }
+
+// textRecord builds a text-heavy record resembling log lines.
+func textRecord(rows int) arrow.Record {
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	nameb := array.NewStringBuilder(mem)
+	for i := 0; i < rows; i++ {
+		idb.Append(int64(i))
+		nameb.Append(fmt.Sprintf("%d INFO request handled path=/api/v1/users/%d status=200 latency_ms=%d", i, i%5000, i%250))
+	}
+	idArr := idb.NewArray()
+	nameArr := nameb.NewArray()
+	idb.Release()
+	nameb.Release()
+	rec := array.NewRecord(schema, []arrow.Array{idArr, nameArr}, int64(rows))
+	idArr.Release()
+	nameArr.Release()
+	return rec
+}
+
+// Benchmark write throughput and file size for each compression setting.
+// The bytes/row metric shows the ratio gained for the extra CPU.
+func BenchmarkWriteCompression(b *testing.B) {
+	rows := 100000
+	cases := []struct {
+		name  string
+		codec string
+		level int
+	}{
+		{"none", "none", 0},
+		{"zstd-default", "zstd", 0},
+		{"zstd-19", "zstd", 19},
+		{"lz4", "lz4", 0},
+		{"snappy", "snappy", 0},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			var size int64
+			for i := 0; i < b.N; i++ {
+				tmp := filepath.Join(os.TempDir(), fmt.Sprintf("bench_compress_%s_%d.lbx", c.name, i))
+				lbx, err := lb.Create(tmp, schema, lb.WithPassword("bench"))
+				if err != nil {
+					b.Fatalf("create: %v", err)
+				}
+				record := textRecord(rows)
+				err = lbx.Write(context.Background(), record, lb.WithPassword("bench"),
+					lb.WithCompression(c.codec), lb.WithCompressionLevel(c.level))
+				if err != nil {
+					b.Fatalf("write: %v", err)
+				}
+				lbx.Close()
+				if st, err := os.Stat(tmp); err == nil {
+					size = st.Size()
+				}
+				os.Remove(tmp)
+			}
+			b.ReportMetric(float64(size)/float64(rows), "bytes/row")
+		})
+	}
+}
+
+// wideRecord builds a record with cols float64 columns.
+func wideRecord(rows, cols int) arrow.Record {
+	fields := make([]arrow.Field, cols)
+	for i := range fields {
+		fields[i] = arrow.Field{Name: fmt.Sprintf("c%03d", i), Type: arrow.PrimitiveTypes.Float64}
+	}
+	wide := arrow.NewSchema(fields, nil)
+
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, wide)
+	defer b.Release()
+	for c := 0; c < cols; c++ {
+		fb := b.Field(c).(*array.Float64Builder)
+		for r := 0; r < rows; r++ {
+			fb.Append(float64(r * c))
+		}
+	}
+	return b.NewRecord()
+}
+
+// Benchmark reading 3 of 200 columns against reading them all. Only the
+// projected column blocks are decrypted and decoded.
+func BenchmarkReadProjection(b *testing.B) {
+	rows, cols := 10000, 200
+	tmp := filepath.Join(os.TempDir(), "bench_projection.lbx")
+	record := wideRecord(rows, cols)
+	lbx, err := lb.Create(tmp, record.Schema(), lb.WithPassword("bench"))
+	if err != nil {
+		b.Fatalf("create: %v", err)
+	}
+	defer func() {
+		lbx.Close()
+		os.Remove(tmp)
+	}()
+	if err := lbx.Write(context.Background(), record, lb.WithPassword("bench")); err != nil {
+		b.Fatalf("write: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		columns []string
+	}{
+		{"all", nil},
+		{"3-of-200", []string{"c000", "c100", "c199"}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				rec, err := lbx.Read(context.Background(), lb.WithPassword("bench"), lb.WithColumns(c.columns...))
+				if err != nil {
+					b.Fatalf("read: %v", err)
+				}
+				rec.Release()
+			}
+		})
+	}
+}
+
+// Benchmark write throughput as more column blocks are compressed and
+// encrypted at once. Scaling levels off at the number of cores or columns.
+func BenchmarkWriteParallelism(b *testing.B) {
+	rows, cols := 20000, 32
+	record := wideRecord(rows, cols)
+	defer record.Release()
+
+	for _, p := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism-%d", p), func(b *testing.B) {
+			// Create and unlock outside the timer; key derivation would
+			// otherwise dominate
+			tmp := filepath.Join(os.TempDir(), fmt.Sprintf("bench_parallel_%d.lbx", p))
+			lbx, err := lb.Create(tmp, record.Schema(), lb.WithPassword("bench"))
+			if err != nil {
+				b.Fatalf("create: %v", err)
+			}
+			defer func() {
+				lbx.Close()
+				os.Remove(tmp)
+			}()
+			record.Retain()
+			if err := lbx.Write(context.Background(), record, lb.WithPassword("bench")); err != nil {
+				b.Fatalf("write: %v", err)
+			}
+
+			b.SetBytes(int64(rows * cols * 8))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				record.Retain()
+				err := lbx.Write(context.Background(), record, lb.WithPassword("bench"),
+					lb.WithCompression("zstd"), lb.WithParallelism(p))
+				if err != nil {
+					b.Fatalf("write: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// Benchmark random-access segment reads with and without WithMmap. Raise
+// segments to build a multi-GB file; each segment holds about 8MB.
+func BenchmarkReadMmap(b *testing.B) {
+	rows, cols, segments := 100000, 10, 16
+	tmp := filepath.Join(os.TempDir(), "bench_mmap.lbx")
+	record := wideRecord(rows, cols)
+	defer record.Release()
+
+	lbx, err := lb.Create(tmp, record.Schema(), lb.WithPassword("bench"))
+	if err != nil {
+		b.Fatalf("create: %v", err)
+	}
+	defer os.Remove(tmp)
+	for i := 0; i < segments; i++ {
+		record.Retain()
+		if err := lbx.Write(context.Background(), record, lb.WithPassword("bench")); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+	}
+	lbx.Close()
+
+	cases := []struct {
+		name string
+		opts []lb.Option
+	}{
+		{"buffered", []lb.Option{lb.WithPassword("bench")}},
+		{"mmap", []lb.Option{lb.WithPassword("bench"), lb.WithMmap()}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			lbx, err := lb.Open(tmp, c.opts...)
+			if err != nil {
+				b.Fatalf("open: %v", err)
+			}
+			defer lbx.Close()
+
+			rng := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec, err := lbx.ReadSegment(context.Background(), rng.Intn(segments), lb.WithPassword("bench"))
+				if err != nil {
+					b.Fatalf("read segment: %v", err)
+				}
+				rec.Release()
+			}
+		})
+	}
+}
+
+// Benchmark the text-heavy dataset at several block sizes: writing it,
+// reading one segment back and counting rows that match a filter on id.
+// Smaller blocks add per-block overhead to writes and file size but let
+// segment reads and filters touch fewer rows; bytes/row and the read
+// timings show where the balance lies.
+func BenchmarkBlockSize(b *testing.B) {
+	rows := 512 * 1024
+	record := textRecord(rows)
+	defer record.Release()
+
+	// create writes the dataset once to a new file in blocks of size rows
+	create := func(b *testing.B, name string, size int) *lb.Lockbox {
+		tmp := filepath.Join(os.TempDir(), name)
+		lbx, err := lb.Create(tmp, schema, lb.WithPassword("bench"), lb.WithBlockSize(size))
+		if err != nil {
+			b.Fatalf("create: %v", err)
+		}
+		b.Cleanup(func() {
+			lbx.Close()
+			os.Remove(tmp)
+		})
+		record.Retain()
+		if err := lbx.Write(context.Background(), record, lb.WithPassword("bench"), lb.WithCompression("zstd")); err != nil {
+			b.Fatalf("write: %v", err)
+		}
+		return lbx
+	}
+
+	for _, size := range []int{1024, 16 * 1024, 256 * 1024} {
+		b.Run(fmt.Sprintf("write-%d", size), func(b *testing.B) {
+			lbx := create(b, fmt.Sprintf("bench_block_write_%d.lbx", size), size)
+			if st, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("bench_block_write_%d.lbx", size))); err == nil {
+				b.ReportMetric(float64(st.Size())/float64(rows), "bytes/row")
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				record.Retain()
+				if err := lbx.Write(context.Background(), record, lb.WithPassword("bench"), lb.WithCompression("zstd")); err != nil {
+					b.Fatalf("write: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("read-%d", size), func(b *testing.B) {
+			lbx := create(b, fmt.Sprintf("bench_block_read_%d.lbx", size), size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rec, err := lbx.ReadSegment(context.Background(), 0, lb.WithPassword("bench"))
+				if err != nil {
+					b.Fatalf("read segment: %v", err)
+				}
+				rec.Release()
+			}
+		})
+
+		b.Run(fmt.Sprintf("filter-%d", size), func(b *testing.B) {
+			lbx := create(b, fmt.Sprintf("bench_block_filter_%d.lbx", size), size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n, err := lbx.Count(context.Background(), lb.WithPassword("bench"), lb.WithFilter("id", "<", int64(100)))
+				if err != nil {
+					b.Fatalf("count: %v", err)
+				}
+				if n != 100 {
+					b.Fatalf("expected 100 matching rows, got %d", n)
+				}
+			}
+		})
+	}
+}
+
+// Benchmark loading a Parquet file of 50 row groups with LoadParquet
+// decoding 1 to 8 row groups at once. Rows keep their order either way.
+func BenchmarkLoadParquetThreads(b *testing.B) {
+	rowGroups, rowsPerGroup := 50, 20000
+	record := largeRecord(rowGroups * rowsPerGroup)
+	defer record.Release()
+
+	tmp := filepath.Join(os.TempDir(), "bench_row_groups.parquet")
+	f, err := os.Create(tmp)
+	if err != nil {
+		b.Fatalf("create: %v", err)
+	}
+	defer os.Remove(tmp)
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(int64(rowsPerGroup)),
+		parquet.WithCompression(compress.Codecs.Zstd))
+	w, err := pqarrow.NewFileWriter(schema, f, props, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		b.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(record); err != nil {
+		b.Fatalf("parquet write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		b.Fatalf("parquet close: %v", err)
+	}
+
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads-%d", threads), func(b *testing.B) {
+			in, err := os.Open(tmp)
+			if err != nil {
+				b.Fatalf("open: %v", err)
+			}
+			defer in.Close()
+			for i := 0; i < b.N; i++ {
+				rec, err := lb.LoadParquet(context.Background(), in, lb.ReadOptions{Threads: threads})
+				if err != nil {
+					b.Fatalf("load: %v", err)
+				}
+				rec.Release()
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	debugAllocator bool
+
+	// checkedAllocator tracks loader allocations under --debug-allocator
+	checkedAllocator *memory.CheckedAllocator
+)
+
+// commandAllocator returns the allocator a command threads through every
+// loader, so all input records of one ingest share a single instance.
+// Under --debug-allocator every allocation is tracked so leaks can be
+// reported when the command exits.
+func commandAllocator() memory.Allocator {
+	if !debugAllocator {
+		return memory.DefaultAllocator
+	}
+	if checkedAllocator == nil {
+		checkedAllocator = memory.NewCheckedAllocator(memory.NewGoAllocator())
+	}
+	return checkedAllocator
+}
+
+// checkAllocations fails if the checked allocator still holds memory,
+// logging the allocation site of every leaked buffer
+func checkAllocations() error {
+	if checkedAllocator == nil {
+		return nil
+	}
+	if n := checkedAllocator.CurrentAlloc(); n != 0 {
+		checkedAllocator.AssertSize(leakLogger{}, 0)
+		return fmt.Errorf("memory leak: %d bytes still allocated at exit", n)
+	}
+	log.Debug().Msg("No outstanding allocations")
+	return nil
+}
+
+// leakLogger reports checked allocator failures through the logger
+type leakLogger struct{}
+
+func (leakLogger) Errorf(format string, args ...interface{}) {
+	log.Error().Msgf(format, args...)
+}
+
+func (leakLogger) Helper() {}
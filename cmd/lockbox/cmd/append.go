@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/spf13/cobra"
+)
+
+var appendCmd = &cobra.Command{
+	Use:   "append [lockbox-file]",
+	Short: "Append records to an existing lockbox file",
+	Long: `Append records to an existing lockbox file without rewriting it.
+
+The new rows are encrypted into additional row groups after the existing
+data. The append is atomic: if encryption or the write fails, the file is
+left exactly as it was.
+
+Input whose schema differs from the lockbox schema is coerced when possible,
+reading naive timestamps as wall clock times in --timezone (default UTC).
+Use --if-schema-matches to refuse the append on any schema drift instead.
+Parquet columns are checked against the lockbox schema before any data is
+read, reporting every missing, misplaced or unconvertible column at once;
+--lenient skips the check and coerces batch by batch.
+
+With --evolve-schema columns are matched by name instead. New nullable
+columns are added to the schema, reading as null in existing rows, and
+missing nullable columns are filled with nulls. A column that changes type
+or a missing non-nullable column is still an error. CSV and JSON input is
+read with the lockbox schema unless --schema describes its columns. Each
+upgrade bumps the schema version shown by lockbox info.
+
+Supported input formats:
+- CSV files
+- JSON files
+- Parquet files, optionally limited to --columns and --row-groups
+- Arrow IPC streams and files (Feather v2), with --format arrow
+- Avro object container files, with --format avro
+
+CSV and JSON input may be gzip or zstd compressed; see --input-compression.
+
+CSV columns are matched to schema fields by header name, in any order:
+extra input columns are ignored and missing nullable fields are filled
+with nulls. A header naming unexpected columns or lacking schema fields
+logs a warning, which --strict-header turns into an error.
+--strict-columns matches columns by position instead, as --no-header does.
+
+Avro files may use the null, deflate, snappy and zstandard codecs. ["null",
+T] unions become nullable fields and the date, time, timestamp and decimal
+logical types their Arrow equivalents; other unions and the duration type
+are rejected.
+
+--threads N decodes N Parquet row groups at once, keeping row order, and a
+--row-groups index past the end of the file is an error. --progress
+reports rows, bytes read and rows/sec on stderr.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		inputFile, _ := cmd.Flags().GetString("input")
+		format, _ := cmd.Flags().GetString("format")
+		password, _ := cmd.Flags().GetString("password")
+		strict, _ := cmd.Flags().GetBool("if-schema-matches")
+		evolve, _ := cmd.Flags().GetBool("evolve-schema")
+		schemaFile, _ := cmd.Flags().GetString("schema")
+
+		if inputFile == "" {
+			return fmt.Errorf("--input must be specified")
+		}
+		if format != "parquet" && (cmd.Flags().Changed("columns") || cmd.Flags().Changed("row-groups")) {
+			return fmt.Errorf("--columns and --row-groups only apply to --format parquet")
+		}
+		writeOpts, err := compressionOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		parallelism, _ := cmd.Flags().GetInt("parallelism")
+		writeOpts = append(writeOpts, lockbox.WithParallelism(parallelism))
+		writeOpts = append(writeOpts, blockSizeOptions(cmd)...)
+		writeOpts = append(writeOpts, lockbox.WithTool(cmd.CommandPath()))
+		inputCompression, err := inputCompressionFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		_, zone, err := timestampFlags(cmd)
+		if err != nil {
+			return err
+		}
+		writeOpts = append(writeOpts, lockbox.WithTimestampTimezone(zone))
+		if err := checkStdinPassword(cmd, password, inputFile); err != nil {
+			return err
+		}
+
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		// Open the lockbox
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadWrite, creds...)...)
+		if err != nil {
+			return openError(filename, err)
+		}
+		defer lb.Close()
+
+		schema := lb.Schema()
+		if schemaFile != "" {
+			if schema, err = loadSchemaFromFile(schemaFile); err != nil {
+				return fmt.Errorf("failed to load schema: %w", err)
+			}
+		}
+		ctx := cmd.Context()
+		appended := false
+		defer func() {
+			if !appended && ctx.Err() != nil {
+				reportInterrupted(filename, false, 0)
+			}
+		}()
+		mem := commandAllocator()
+		writeOpts = append(writeOpts, lockbox.WithAllocator(mem))
+		p := progressFromFlags(cmd)
+		defer p.finish()
+
+		var record arrow.Record
+		switch format {
+		case "csv":
+			var csvOpts lockbox.CSVReadOptions
+			csvOpts, err = csvOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			var errLog *os.File
+			errLog, err = openErrorLog(cmd)
+			if err != nil {
+				return err
+			}
+			if errLog != nil {
+				defer errLog.Close()
+				csvOpts.ErrorLog = errLog
+			}
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadCSV(ctx, mem, p.reader(r), schema, csvOpts, p)
+			})
+		case "json":
+			var jsonOpts lockbox.JSONReadOptions
+			jsonOpts, err = jsonOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadJSON(ctx, mem, p.reader(r), schema, jsonOpts, p)
+			})
+		case "parquet":
+			var pqOpts lockbox.ReadOptions
+			pqOpts, err = parquetOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			// Report every incompatible column before reading any data
+			if lenient, _ := cmd.Flags().GetBool("lenient"); !lenient && !evolve {
+				if err := checkParquetSchema(inputFile, lb.Schema(), pqOpts.Columns); err != nil {
+					return err
+				}
+			}
+			record, err = loadParquetFile(ctx, mem, inputFile, pqOpts, p)
+		case "arrow", "feather":
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadArrow(ctx, mem, p.reader(r), p)
+			})
+		case "avro":
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadAvro(ctx, mem, p.reader(r), p)
+			})
+		default:
+			return fmt.Errorf("unsupported format %q (expected csv, json, parquet, arrow or avro)", format)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load data from file: %w", err)
+		}
+
+		if evolve {
+			writeOpts = append(writeOpts, lockbox.WithSchemaEvolution(true))
+		} else if diff := lockbox.SchemaDiff(lb.Schema(), record.Schema()); len(diff) > 0 {
+			if strict {
+				record.Release()
+				return fmt.Errorf("schema drift, refusing to append: %w: %s", lockbox.ErrSchemaMismatch, strings.Join(diff, "; "))
+			}
+			coerced, err := conformRecord(lb.Schema(), record, true, false, zone)
+			record.Release()
+			if err != nil {
+				return fmt.Errorf("failed to coerce input: %w", err)
+			}
+			record = coerced
+		}
+
+		rows := record.NumRows()
+		if err := lb.Write(ctx, record, append(writeOpts, creds...)...); err != nil {
+			record.Release()
+			return fmt.Errorf("failed to append data: %w", err)
+		}
+
+		if err := lb.Close(); err != nil {
+			return fmt.Errorf("failed to close lockbox: %w", err)
+		}
+		appended = true
+		p.finish()
+		infof("Successfully appended %d rows to %s\n", rows, filename)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(appendCmd)
+
+	appendCmd.Flags().StringP("input", "i", "", "Input data file (CSV, JSON, Parquet, Arrow IPC)")
+	appendCmd.Flags().StringP("format", "f", "csv", "Input data format (csv, json, parquet, arrow, avro)")
+	appendCmd.Flags().StringP("password", "p", "", "Password for encryption")
+	addCredentialFlags(appendCmd)
+	addInputCompressionFlag(appendCmd)
+	appendCmd.Flags().String("delimiter", ",", "CSV field delimiter (single character, \\t for tab)")
+	appendCmd.Flags().Bool("no-header", false, "CSV input has no header row; columns map to schema fields by position")
+	appendCmd.Flags().Bool("strict-columns", false, "Map CSV columns to schema fields by position, not by header name")
+	appendCmd.Flags().Bool("strict-header", false, "Fail when the CSV header does not match the schema field names, instead of warning")
+	addNullStringFlags(appendCmd)
+	appendCmd.Flags().String("compression", "none", "Block compression codec (none, zstd, lz4, snappy)")
+	appendCmd.Flags().Int("compression-level", 0, "Zstandard compression level 1-19 (0 for the codec default)")
+	appendCmd.Flags().StringArray("column-compression", []string{}, "Per-column compression codec col=codec")
+	appendCmd.Flags().Int("parallelism", 0, "Column blocks to compress and encrypt at once (0 for GOMAXPROCS)")
+	appendCmd.Flags().Int("threads", 1, "Parquet row groups to decode at once, keeping row order")
+	appendCmd.Flags().StringSlice("columns", nil, "Only load these Parquet columns, in this order (comma separated)")
+	appendCmd.Flags().IntSlice("row-groups", nil, "Only load these Parquet row groups, numbered from 0 (comma separated)")
+	appendCmd.Flags().Bool("lenient", false, "Skip the upfront check of Parquet columns against the lockbox schema and coerce batch by batch")
+	addBlockSizeFlag(appendCmd, "Rows per segment for this append (default: the file's block size, else one segment)")
+	addRowWindowFlags(appendCmd)
+	addTimestampFlags(appendCmd)
+	addBinaryEncodingFlag(appendCmd)
+	addCSVErrorFlags(appendCmd)
+	addProgressFlag(appendCmd)
+	appendCmd.Flags().Bool("if-schema-matches", false, "Refuse to append when the input schema differs instead of coercing")
+	appendCmd.Flags().Bool("evolve-schema", false, "Match input columns by name, adding new nullable columns to the schema and filling missing ones with nulls")
+	appendCmd.Flags().StringP("schema", "s", "", "JSON schema file describing CSV or JSON input (default: the lockbox schema)")
+	appendCmd.MarkFlagsMutuallyExclusive("if-schema-matches", "evolve-schema")
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+// addBinaryEncodingFlag registers --binary-encoding
+func addBinaryEncodingFlag(cmd *cobra.Command) {
+	cmd.Flags().String("binary-encoding", "", "Text encoding of binary values in CSV and JSON: hex or base64 (default base64, hex for fixed-size binary)")
+}
+
+// binaryEncodingFromFlags reads and validates --binary-encoding
+func binaryEncodingFromFlags(cmd *cobra.Command) (lockbox.BinaryEncoding, error) {
+	name, _ := cmd.Flags().GetString("binary-encoding")
+	switch enc := lockbox.BinaryEncoding(name); enc {
+	case "", lockbox.BinaryHex, lockbox.BinaryBase64:
+		return enc, nil
+	}
+	return "", fmt.Errorf("invalid --binary-encoding %q, expected hex or base64", name)
+}
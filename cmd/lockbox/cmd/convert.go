@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert [input] [output]",
+	Short: "Convert data between CSV, JSON, Parquet, Arrow, Avro and ORC",
+	Long: `Convert a data file from one format to another in memory, without
+writing an encrypted file.
+
+Formats come from the file extensions (.csv, .json/.ndjson, .parquet,
+.arrow/.feather, .avro, .orc, .lbx) unless --from or --to is given. Use -
+as the input or output for stdin or stdout (CSV, JSON and Arrow only); a
+lockbox can also be written to stdout.
+
+CSV and JSON input need a schema: pass --schema with a JSON schema file, or
+let CSV files be inferred from their first --infer-rows rows. Parquet,
+Arrow and Avro input carry their own schema; Avro is input only. ORC input
+is converted with pyarrow.
+
+With --encrypt (or a .lbx output) the output is a new lockbox file,
+encrypted with a password and optionally shared with --recipient keys.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input, output := args[0], args[1]
+
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		encrypt, _ := cmd.Flags().GetBool("encrypt")
+
+		if from == "" {
+			from = formatFromPath(input)
+		}
+		if to == "" {
+			to = formatFromPath(output)
+		}
+		if encrypt {
+			to = "lockbox"
+		}
+		if from == "" {
+			return fmt.Errorf("cannot tell the format of %s; pass --from", input)
+		}
+		if to == "" {
+			return fmt.Errorf("cannot tell the format of %s; pass --to", output)
+		}
+
+		var export func(io.Writer, array.RecordReader) error
+		if to != "lockbox" {
+			binary, err := binaryEncodingFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			if export, err = exporterFor(to, output, binary); err != nil {
+				return err
+			}
+		}
+
+		mem := commandAllocator()
+		record, err := loadConvertInput(cmd, mem, input, from)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", input, err)
+		}
+		defer record.Release()
+
+		if to == "lockbox" {
+			return encryptConverted(cmd, output, record)
+		}
+
+		rr, err := array.NewRecordReader(record.Schema(), []arrow.Record{record})
+		if err != nil {
+			return err
+		}
+		defer rr.Release()
+		if err := exportTo(output, rr, export); err != nil {
+			return err
+		}
+
+		log.Info().Int64("rows", record.NumRows()).Str("from", from).Str("to", to).Msg("Converted data")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().String("from", "", "Input format (csv, json, parquet, arrow, avro, orc); default from the extension")
+	convertCmd.Flags().String("to", "", "Output format (csv, json, parquet, arrow); default from the extension")
+	convertCmd.Flags().StringP("schema", "s", "", "JSON schema file for CSV or JSON input")
+	convertCmd.Flags().Int("infer-rows", 100, "Number of CSV rows sampled for schema inference")
+	convertCmd.Flags().String("delimiter", ",", "CSV field delimiter (single character, \\t for tab)")
+	convertCmd.Flags().Bool("no-header", false, "CSV input has no header row; columns map to schema fields by position")
+	convertCmd.Flags().Bool("strict-columns", false, "Map CSV columns to schema fields by position, not by header name")
+	convertCmd.Flags().Bool("strict-header", false, "Fail when the CSV header does not match the schema field names, instead of warning")
+	addNullStringFlags(convertCmd)
+	addInputCompressionFlag(convertCmd)
+	addTimestampFlags(convertCmd)
+	addBinaryEncodingFlag(convertCmd)
+	convertCmd.Flags().Bool("encrypt", false, "Write a lockbox file instead of a plain format")
+	convertCmd.Flags().StringP("password", "p", "", "Password for --encrypt")
+	addPasswordSourceFlags(convertCmd)
+	convertCmd.Flags().StringArray("recipient", []string{}, "Public key allowed to open the --encrypt output (repeatable)")
+	addKDFFlags(convertCmd)
+	addCipherFlag(convertCmd)
+}
+
+// formatFromPath maps a file extension to a convert format, ignoring a
+// trailing .gz or .zst. It returns "" when the extension is unknown.
+func formatFromPath(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" || ext == ".gzip" || ext == ".zst" || ext == ".zstd" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+	}
+	switch ext {
+	case ".csv", ".tsv":
+		return "csv"
+	case ".json", ".ndjson", ".jsonl":
+		return "json"
+	case ".parquet", ".pq":
+		return "parquet"
+	case ".arrow", ".arrows", ".feather", ".ipc":
+		return "arrow"
+	case ".avro":
+		return "avro"
+	case ".orc":
+		return "orc"
+	case ".lbx":
+		return "lockbox"
+	}
+	return ""
+}
+
+// loadConvertInput loads the whole input into one record using the loader
+// for its format
+func loadConvertInput(cmd *cobra.Command, mem memory.Allocator, input, from string) (arrow.Record, error) {
+	compression, err := inputCompressionFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := cmd.Context()
+	switch from {
+	case "csv", "json":
+		schema, err := convertSchema(cmd, input, from, compression)
+		if err != nil {
+			return nil, err
+		}
+		if from == "json" {
+			jsonOpts, err := jsonOptionsFromFlags(cmd)
+			if err != nil {
+				return nil, err
+			}
+			return loadInput(input, compression, func(r io.Reader) (arrow.Record, error) {
+				return loadJSON(ctx, mem, r, schema, jsonOpts, nil)
+			})
+		}
+		csvOpts, err := csvOptionsFromFlags(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return loadInput(input, compression, func(r io.Reader) (arrow.Record, error) {
+			return loadCSV(ctx, mem, r, schema, csvOpts, nil)
+		})
+	case "parquet":
+		return loadParquetFile(ctx, mem, input, lockbox.ReadOptions{}, nil)
+	case "arrow", "feather":
+		return loadInput(input, compression, func(r io.Reader) (arrow.Record, error) {
+			return loadArrow(ctx, mem, r, nil)
+		})
+	case "avro":
+		return loadInput(input, compression, func(r io.Reader) (arrow.Record, error) {
+			return loadAvro(ctx, mem, r, nil)
+		})
+	case "orc":
+		if err := ensurePyarrowInstalled(); err != nil {
+			return nil, fmt.Errorf("could not ensure pyarrow is installed: %w", err)
+		}
+		tmp, err := os.CreateTemp("", "lockbox-convert-*.parquet")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if err := convertORCtoParquet(input, tmp.Name()); err != nil {
+			return nil, fmt.Errorf("conversion failed: %w", err)
+		}
+		return loadParquetFile(ctx, mem, tmp.Name(), lockbox.ReadOptions{}, nil)
+	}
+	return nil, fmt.Errorf("unsupported input format %q (expected csv, json, parquet, arrow, avro or orc)", from)
+}
+
+// convertSchema returns the --schema file, or infers one from a plain local
+// CSV file
+func convertSchema(cmd *cobra.Command, input, from, compression string) (*arrow.Schema, error) {
+	if schemaFile, _ := cmd.Flags().GetString("schema"); schemaFile != "" {
+		return loadSchemaFromFile(schemaFile)
+	}
+
+	plain := input != stdinPath && (compression == "none" || (compression == "auto" && compressionFromExt(input) == "auto"))
+	delimiter, _ := cmd.Flags().GetString("delimiter")
+	noHeader, _ := cmd.Flags().GetBool("no-header")
+	if from != "csv" || !plain || delimiter != "," || noHeader {
+		return nil, fmt.Errorf("--schema is required for %s input unless it is a plain comma separated CSV file with a header", from)
+	}
+
+	rows, _ := cmd.Flags().GetInt("infer-rows")
+	schema, err := lockbox.DetectCSVSchema(input, rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer schema: %w", err)
+	}
+	return schema, nil
+}
+
+// encryptConverted writes record to a new lockbox file at output, or to
+// stdout for -
+func encryptConverted(cmd *cobra.Command, output string, record arrow.Record) error {
+	password, _ := cmd.Flags().GetString("password")
+	recipientArgs, _ := cmd.Flags().GetStringArray("recipient")
+
+	pwOpts, err := passwordOptions(cmd, password)
+	if err != nil {
+		return err
+	}
+	if len(pwOpts) == 0 {
+		return fmt.Errorf("--password, --key-file or --password-env is required with --encrypt")
+	}
+	opts := append(kdfOptions(cmd), cipherOptions(cmd)...)
+	opts = append(opts, pwOpts...)
+	opts = append(opts, aadOptions(cmd)...)
+	for _, arg := range recipientArgs {
+		recipient, err := crypto.ParseRecipient(arg)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, lockbox.WithRecipient(recipient))
+	}
+
+	var lb *lockbox.Lockbox
+	if output == stdoutPath {
+		lb, err = lockbox.CreateTo(os.Stdout, record.Schema(), opts...)
+	} else {
+		lb, err = lockbox.Create(output, record.Schema(), lockOptions(lockbox.ReadWrite, opts...)...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create lockbox: %w", err)
+	}
+
+	record.Retain()
+	if err := lb.Write(cmd.Context(), record, append(opts, lockbox.WithTool(cmd.CommandPath()))...); err != nil {
+		record.Release()
+		// Closing a stdout lockbox would still emit its empty committed state
+		if output != stdoutPath {
+			lb.Close()
+			os.Remove(output)
+		}
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+	if err := lb.Close(); err != nil {
+		return fmt.Errorf("failed to close lockbox: %w", err)
+	}
+
+	infof("Encrypted %d rows to %s\n", record.NumRows(), output)
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	cases := map[string]string{
+		"data.csv":        "csv",
+		"data.CSV.gz":     "csv",
+		"events.ndjson":   "json",
+		"events.json.zst": "json",
+		"table.parquet":   "parquet",
+		"table.feather":   "arrow",
+		"table.orc":       "orc",
+		"events.avro":     "avro",
+		"secret.lbx":      "lockbox",
+		"notes.txt":       "",
+	}
+	for path, want := range cases {
+		if got := formatFromPath(path); got != want {
+			t.Errorf("formatFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestConvertCSVToParquet(t *testing.T) {
+	input := "/tmp/test_convert.csv"
+	output := "/tmp/test_convert.parquet"
+	defer os.Remove(input)
+	defer os.Remove(output)
+
+	if err := os.WriteFile(input, []byte("id,name\n1,Alice\n2,Bob\n3,\n"), 0o644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	convertCmd.SetContext(context.Background())
+	if err := convertCmd.RunE(convertCmd, []string{input, output}); err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+
+	rec, err := loadParquetFile(context.Background(), memory.NewGoAllocator(), output, lockbox.ReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load parquet: %v", err)
+	}
+	defer rec.Release()
+
+	if rec.NumRows() != 3 || rec.NumCols() != 2 {
+		t.Fatalf("got %d rows and %d columns, want 3 and 2", rec.NumRows(), rec.NumCols())
+	}
+	names, ok := rec.Column(1).(*array.String)
+	if !ok {
+		t.Fatalf("name column is %s, want string", rec.Column(1).DataType())
+	}
+	if names.Value(1) != "Bob" {
+		t.Fatalf("name[1] = %q, want Bob", names.Value(1))
+	}
+}
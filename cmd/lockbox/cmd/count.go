@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+var countCmd = &cobra.Command{
+	Use:   "count [lockbox-file]",
+	Short: "Print the number of rows in a lockbox file",
+	Long: `Print the number of rows as a single integer on stdout.
+
+The count comes from the encrypted statistics footer when the file has one,
+so no data block is decrypted. Older files without a footer are streamed
+segment by segment. With --where only matching rows are counted, e.g.
+--where "age>=18"; segments ruled out by the footer are skipped.
+
+The command exits non-zero if the file cannot be decrypted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		password, _ := cmd.Flags().GetString("password")
+		where, _ := cmd.Flags().GetStringArray("where")
+
+		filters, err := whereOptions(where)
+		if err != nil {
+			return err
+		}
+
+		// Prompt on stderr so stdout holds only the count
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadOnly, creds...)...)
+		if err != nil {
+			return fmt.Errorf("failed to open lockbox: %w", err)
+		}
+		defer lb.Close()
+
+		rows, err := lb.Count(cmd.Context(), append(creds, filters...)...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(rows)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+
+	countCmd.Flags().StringP("password", "p", "", "Password for decryption")
+	countCmd.Flags().StringArray("where", nil, `Count only rows matching a condition, e.g. "age>=18" (repeatable)`)
+	addCredentialFlags(countCmd)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/TFMV/lockbox/pkg/crypto"
 	"github.com/TFMV/lockbox/pkg/lockbox"
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/rs/zerolog/log"
@@ -16,27 +17,91 @@ var createCmd = &cobra.Command{
 	Short: "Create a new lockbox file",
 	Long: `Create a new lockbox file with the specified schema.
 
-The schema can be provided as a JSON file or generated from sample data.`,
+The schema can be provided as a JSON file or inferred from a CSV file with
+--infer-schema. Inferred string columns with few distinct values are
+dictionary encoded; tune this with --dictionary-threshold, or name columns
+to encode with --dictionary-encode (it also applies to --schema files and the
+default schema). Arrow IPC files
+(.arrow, .arrows, .feather, .ipc) passed to --infer-schema supply their
+schema as is, and Avro files (.avro) their schema mapped to Arrow.
+
+Pass --recipient (from lockbox keygen) to let holders of the matching
+identity open the file. Without --password only recipients can open it.
+
+The password is stretched with PBKDF2 unless a --kdf-* flag is given, which
+selects Argon2id with that memory, time and parallelism cost. The cost is
+stored in the file, so opening it needs no extra flags.
+
+--block-size N records the rows per segment that later writes default to,
+shown by lockbox info; without it each write is one segment. Smaller
+blocks let segment reads and --where touch fewer rows, larger ones
+compress better; 1k to 1M rows is typical.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filename := args[0]
 
 		schemaFile, _ := cmd.Flags().GetString("schema")
+		inferFrom, _ := cmd.Flags().GetString("infer-schema")
+		inferRows, _ := cmd.Flags().GetInt("infer-rows")
+		dictThreshold, _ := cmd.Flags().GetInt("dictionary-threshold")
+		dictColumns, _ := cmd.Flags().GetStringSlice("dictionary-encode")
+		headerCase, _ := cmd.Flags().GetString("header-case")
+		renameArgs, _ := cmd.Flags().GetStringArray("rename")
 		password, _ := cmd.Flags().GetString("password")
+		recipientArgs, _ := cmd.Flags().GetStringArray("recipient")
 		createdBy, _ := cmd.Flags().GetString("created-by")
 
-		if password == "" {
-			return fmt.Errorf("password is required")
+		pwOpts, err := passwordOptions(cmd, password)
+		if err != nil {
+			return err
+		}
+		if len(pwOpts) == 0 && len(recipientArgs) == 0 {
+			return fmt.Errorf("--password, --key-file, --password-env or at least one --recipient is required")
+		}
+
+		opts := append(kdfOptions(cmd), cipherOptions(cmd)...)
+		opts = append(opts, lockbox.WithCreatedBy(createdBy))
+		opts = append(opts, blockSizeOptions(cmd)...)
+		opts = append(opts, pwOpts...)
+		opts = append(opts, aadOptions(cmd)...)
+		for _, arg := range recipientArgs {
+			recipient, err := crypto.ParseRecipient(arg)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, lockbox.WithRecipient(recipient))
 		}
 
 		var schema *arrow.Schema
-		var err error
+
+		if schemaFile != "" && inferFrom != "" {
+			return fmt.Errorf("--schema and --infer-schema are mutually exclusive")
+		}
 
 		if schemaFile != "" {
 			schema, err = loadSchemaFromFile(schemaFile)
 			if err != nil {
 				return fmt.Errorf("failed to load schema: %w", err)
 			}
+		} else if inferFrom != "" {
+			if dictThreshold < 0 {
+				return fmt.Errorf("--dictionary-threshold must not be negative")
+			}
+			if isArrowPath(inferFrom) {
+				schema, err = loadArrowSchema(inferFrom)
+			} else if isAvroPath(inferFrom) {
+				schema, err = loadAvroSchema(inferFrom)
+			} else {
+				schema, err = lockbox.DetectCSVSchemaWithDictionary(inferFrom, inferRows, dictThreshold)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to infer schema: %w", err)
+			}
+			schema, err = lockbox.RenameFields(schema, headerCase, parseKeyValueArgs(renameArgs))
+			if err != nil {
+				return fmt.Errorf("failed to rename fields: %w", err)
+			}
+			log.Info().Str("input", inferFrom).Msg("Inferred schema")
 		} else {
 			// Default schema for demonstration
 			schema = arrow.NewSchema([]arrow.Field{
@@ -48,22 +113,27 @@ The schema can be provided as a JSON file or generated from sample data.`,
 			log.Info().Msg("Using default schema (id, name, email, age)")
 		}
 
+		schema, err = lockbox.DictionaryEncode(schema, dictColumns...)
+		if err != nil {
+			return err
+		}
+
 		// Create the lockbox
-		lb, err := lockbox.Create(
-			filename,
-			schema,
-			lockbox.WithPassword(password),
-			lockbox.WithCreatedBy(createdBy),
-		)
+		lb, err := lockbox.Create(filename, schema, lockOptions(lockbox.ReadWrite, opts...)...)
 		if err != nil {
 			return fmt.Errorf("failed to create lockbox: %w", err)
 		}
-		defer lb.Close()
+		if err := lb.Close(); err != nil {
+			return fmt.Errorf("failed to close lockbox: %w", err)
+		}
 
-		fmt.Printf("Successfully created lockbox: %s\n", filename)
-		fmt.Printf("Schema fields: %d\n", len(schema.Fields()))
+		infof("Successfully created lockbox: %s\n", filename)
+		if len(recipientArgs) > 0 {
+			infof("Recipients: %d\n", len(recipientArgs))
+		}
+		infof("Schema fields: %d\n", len(schema.Fields()))
 		for i, field := range schema.Fields() {
-			fmt.Printf("  %d. %s (%s)\n", i+1, field.Name, field.Type)
+			infof("  %d. %s (%s)\n", i+1, field.Name, field.Type)
 		}
 
 		return nil
@@ -74,12 +144,36 @@ func init() {
 	rootCmd.AddCommand(createCmd)
 
 	createCmd.Flags().StringP("schema", "s", "", "JSON schema file")
-	createCmd.Flags().StringP("password", "p", "", "Password for encryption (required)")
+	createCmd.Flags().String("infer-schema", "", "Infer the schema from a CSV file, or read it from an Arrow IPC file")
+	createCmd.Flags().Int("infer-rows", 100, "Number of CSV rows sampled for schema inference")
+	createCmd.Flags().String("header-case", "none", "Case transform for inferred field names (none, lower, upper)")
+	createCmd.Flags().StringArray("rename", []string{}, "Rename an inferred field, old=new (repeatable)")
+	createCmd.Flags().Int("dictionary-threshold", 16, "Infer dictionary encoding for string columns with at most this many distinct values (0 disables)")
+	createCmd.Flags().StringSlice("dictionary-encode", []string{}, "Dictionary encode these string columns (comma separated)")
+	createCmd.Flags().StringP("password", "p", "", "Password for encryption")
+	addPasswordSourceFlags(createCmd)
+	createCmd.Flags().StringArray("recipient", []string{}, "Public key allowed to open the file, from keygen (repeatable)")
 	createCmd.Flags().String("created-by", "system", "Creator name")
+	addBlockSizeFlag(createCmd, "Rows per segment that writes to the file default to (default: one segment per write)")
+	addKDFFlags(createCmd)
+	addCipherFlag(createCmd)
+}
 
-	if err := createCmd.MarkFlagRequired("password"); err != nil {
-		log.Fatal().Err(err).Msg("Failed to mark password flag as required")
-	}
+// SchemaField is one field of the simple JSON schema format
+type SchemaField struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Nullable   bool   `json:"nullable"`
+	Mime       string `json:"mime,omitempty"`
+	Precision  int32  `json:"precision,omitempty"`
+	Scale      int32  `json:"scale,omitempty"`
+	ByteWidth  int    `json:"byte_width,omitempty"`
+	Dictionary bool   `json:"dictionary,omitempty"`
+}
+
+// SchemaJSON is the simple JSON schema format read by create --schema
+type SchemaJSON struct {
+	Fields []SchemaField `json:"fields"`
 }
 
 // loadSchemaFromFile loads an Arrow schema from a JSON file
@@ -89,18 +183,6 @@ func loadSchemaFromFile(filename string) (*arrow.Schema, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Simple JSON schema format
-	type SchemaField struct {
-		Name     string `json:"name"`
-		Type     string `json:"type"`
-		Nullable bool   `json:"nullable"`
-		Mime     string `json:"mime,omitempty"`
-	}
-
-	type SchemaJSON struct {
-		Fields []SchemaField `json:"fields"`
-	}
-
 	var schemaJSON SchemaJSON
 	if err := json.Unmarshal(data, &schemaJSON); err != nil {
 		return nil, fmt.Errorf("failed to parse schema JSON: %w", err)
@@ -115,6 +197,18 @@ func loadSchemaFromFile(filename string) (*arrow.Schema, error) {
 			dataType = arrow.PrimitiveTypes.Int64
 		case "int32":
 			dataType = arrow.PrimitiveTypes.Int32
+		case "int16":
+			dataType = arrow.PrimitiveTypes.Int16
+		case "int8":
+			dataType = arrow.PrimitiveTypes.Int8
+		case "uint64":
+			dataType = arrow.PrimitiveTypes.Uint64
+		case "uint32":
+			dataType = arrow.PrimitiveTypes.Uint32
+		case "uint16":
+			dataType = arrow.PrimitiveTypes.Uint16
+		case "uint8":
+			dataType = arrow.PrimitiveTypes.Uint8
 		case "float64":
 			dataType = arrow.PrimitiveTypes.Float64
 		case "float32":
@@ -133,10 +227,32 @@ func loadSchemaFromFile(filename string) (*arrow.Schema, error) {
 			dataType = arrow.FixedWidthTypes.Duration_s
 		case "bool":
 			dataType = arrow.FixedWidthTypes.Boolean
+		case "decimal", "decimal128":
+			if field.Precision < 1 || field.Precision > 38 {
+				return nil, fmt.Errorf("field %s: decimal128 precision must be between 1 and 38", field.Name)
+			}
+			dataType = &arrow.Decimal128Type{Precision: field.Precision, Scale: field.Scale}
+		case "decimal256":
+			if field.Precision < 1 || field.Precision > 76 {
+				return nil, fmt.Errorf("field %s: decimal256 precision must be between 1 and 76", field.Name)
+			}
+			dataType = &arrow.Decimal256Type{Precision: field.Precision, Scale: field.Scale}
+		case "fixed_size_binary":
+			if field.ByteWidth < 1 {
+				return nil, fmt.Errorf("field %s: fixed_size_binary needs a positive byte_width", field.Name)
+			}
+			dataType = &arrow.FixedSizeBinaryType{ByteWidth: field.ByteWidth}
 		default:
 			return nil, fmt.Errorf("unsupported type: %s", field.Type)
 		}
 
+		if field.Dictionary {
+			if !arrow.TypeEqual(dataType, arrow.BinaryTypes.String) {
+				return nil, fmt.Errorf("field %s: only string fields can be dictionary encoded", field.Name)
+			}
+			dataType = lockbox.DictionaryStringType
+		}
+
 		var md arrow.Metadata
 		if field.Mime != "" {
 			md = arrow.NewMetadata([]string{"mime"}, []string{field.Mime})
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// addCredentialFlags registers --identity and the password source flags.
+// Call it after the command's --password flag is defined.
+func addCredentialFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("identity", []string{}, "Identity file holding a private key to open the file (repeatable)")
+	addPasswordSourceFlags(cmd)
+}
+
+// addPasswordSourceFlags registers --key-file and --password-env as
+// alternatives to --password and the interactive prompt
+func addPasswordSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("key-file", "", "Read the password from a file (one trailing newline is ignored)")
+	cmd.Flags().String("password-env", "", "Read the password from this environment variable, e.g. LOCKBOX_PASSWORD")
+	cmd.MarkFlagsMutuallyExclusive("password", "key-file", "password-env")
+	addAADFlag(cmd)
+}
+
+// addAADFlag registers --aad, the associated data a file is bound to
+func addAADFlag(cmd *cobra.Command) {
+	cmd.Flags().String("aad", "", "Associated data such as a tenant ID that the file is bound to at creation and must be opened with")
+}
+
+// aadOptions returns WithAAD for --aad, or nil without it
+func aadOptions(cmd *cobra.Command) []lockbox.Option {
+	aad, _ := cmd.Flags().GetString("aad")
+	if aad == "" {
+		return nil
+	}
+	return []lockbox.Option{lockbox.WithAAD([]byte(aad))}
+}
+
+// addKDFFlags registers the Argon2id cost flags
+func addKDFFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint32("kdf-memory", 64*1024, "Argon2id memory cost in KiB")
+	cmd.Flags().Uint32("kdf-iterations", 3, "Argon2id time cost")
+	cmd.Flags().Uint32("kdf-parallelism", 4, "Argon2id parallelism")
+}
+
+// kdfOptions returns WithKDFParams when any --kdf-* flag was set, so the
+// password key is derived with Argon2id. Unset flags keep their defaults.
+func kdfOptions(cmd *cobra.Command) []lockbox.Option {
+	flags := cmd.Flags()
+	if !flags.Changed("kdf-memory") && !flags.Changed("kdf-iterations") && !flags.Changed("kdf-parallelism") {
+		return nil
+	}
+	memory, _ := flags.GetUint32("kdf-memory")
+	iterations, _ := flags.GetUint32("kdf-iterations")
+	parallelism, _ := flags.GetUint32("kdf-parallelism")
+	return []lockbox.Option{lockbox.WithKDFParams(memory, iterations, parallelism)}
+}
+
+// addCipherFlag registers --cipher for commands that create files
+func addCipherFlag(cmd *cobra.Command) {
+	cmd.Flags().String("cipher", crypto.DefaultCipher, "AEAD cipher for column data ("+strings.Join(crypto.Ciphers(), ", ")+")")
+}
+
+// cipherOptions returns WithCipher for --cipher
+func cipherOptions(cmd *cobra.Command) []lockbox.Option {
+	name, _ := cmd.Flags().GetString("cipher")
+	return []lockbox.Option{lockbox.WithCipher(name)}
+}
+
+// passwordOptions returns the option for --password, --key-file or
+// --password-env, whichever was given, or nil for none of them
+func passwordOptions(cmd *cobra.Command, password string) ([]lockbox.Option, error) {
+	keyFile, _ := cmd.Flags().GetString("key-file")
+	passwordEnv, _ := cmd.Flags().GetString("password-env")
+
+	switch {
+	case keyFile != "":
+		return []lockbox.Option{lockbox.WithKeyFile(keyFile)}, nil
+	case passwordEnv != "":
+		password = os.Getenv(passwordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", passwordEnv)
+		}
+	}
+	if password == "" {
+		return nil, nil
+	}
+	return []lockbox.Option{lockbox.WithPassword(password)}, nil
+}
+
+// hasPasswordSource reports whether credentials were given by flag, so no
+// prompt is needed
+func hasPasswordSource(cmd *cobra.Command, password string) bool {
+	if password != "" {
+		return true
+	}
+	for _, name := range []string{"key-file", "password-env"} {
+		if v, _ := cmd.Flags().GetString(name); v != "" {
+			return true
+		}
+	}
+	identities, _ := cmd.Flags().GetStringArray("identity")
+	return len(identities) > 0
+}
+
+// credentialOptions returns lockbox options for the password source and any
+// --identity keys. The password is prompted for on prompt only when none
+// of them was given.
+func credentialOptions(cmd *cobra.Command, password string, prompt io.Writer) ([]lockbox.Option, error) {
+	return credentials(cmd, password, prompt, readPassword)
+}
+
+// newCredentialOptions is credentialOptions for a file about to be created:
+// a prompted password must be typed twice
+func newCredentialOptions(cmd *cobra.Command, password string, prompt io.Writer) ([]lockbox.Option, error) {
+	return credentials(cmd, password, prompt, readNewPassword)
+}
+
+func credentials(cmd *cobra.Command, password string, prompt io.Writer, read func(io.Writer, string, string) (string, error)) ([]lockbox.Option, error) {
+	paths, _ := cmd.Flags().GetStringArray("identity")
+
+	var opts []lockbox.Option
+	for _, path := range paths {
+		ids, err := loadIdentities(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			opts = append(opts, lockbox.WithIdentity(id))
+		}
+	}
+
+	pwOpts, err := passwordOptions(cmd, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get password if not provided
+	if len(pwOpts) == 0 && len(opts) == 0 {
+		if password, err = read(prompt, "Enter password: ", "--password, --password-env or --key-file"); err != nil {
+			return nil, err
+		}
+		pwOpts = []lockbox.Option{lockbox.WithPassword(password)}
+	}
+	opts = append(opts, pwOpts...)
+	return append(opts, aadOptions(cmd)...), nil
+}
+
+// stdin is where passwords are read from; tests replace it
+var stdin = os.Stdin
+
+// readPassword prints label on prompt and reads a password from the
+// terminal. Without a terminal it fails at once, naming the flags that
+// supply the password instead.
+func readPassword(prompt io.Writer, label, flags string) (string, error) {
+	fd := int(stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%w: stdin is not a terminal, pass %s", lockbox.ErrPasswordRequired, flags)
+	}
+	fmt.Fprint(prompt, label)
+	passwordBytes, err := term.ReadPassword(fd)
+	fmt.Fprintln(prompt) // New line after password input
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(passwordBytes), nil
+}
+
+// passwordAttempts is how often readNewPassword asks before giving up
+const passwordAttempts = 3
+
+// promptPassword reads one masked password; tests replace it
+var promptPassword = readPassword
+
+// readNewPassword reads a password and its confirmation, asking again
+// while the two differ
+func readNewPassword(prompt io.Writer, label, flags string) (string, error) {
+	for range passwordAttempts {
+		password, err := promptPassword(prompt, label, flags)
+		if err != nil {
+			return "", err
+		}
+		confirm, err := promptPassword(prompt, "Confirm password: ", flags)
+		if err != nil {
+			return "", err
+		}
+		if password == confirm {
+			return password, nil
+		}
+		fmt.Fprintln(prompt, "Passwords do not match, try again")
+	}
+	return "", fmt.Errorf("passwords did not match after %d attempts", passwordAttempts)
+}
+
+// loadIdentities reads every identity in a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func loadIdentities(path string) ([]*crypto.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer f.Close()
+
+	var ids []*crypto.Identity
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := crypto.ParseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%s: no identities found", path)
+	}
+	return ids, nil
+}
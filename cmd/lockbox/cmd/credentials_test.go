@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+func TestCredentialOptionsWithoutTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	// A password on the pipe must not be read as if typed
+	if _, err := w.WriteString("piped\n"); err != nil {
+		t.Fatalf("Failed to write to pipe: %v", err)
+	}
+	defer func(orig *os.File) { stdin = orig }(stdin)
+	stdin = r
+
+	newCmd := func(args ...string) *cobra.Command {
+		c := &cobra.Command{Use: "read"}
+		c.Flags().String("password", "", "")
+		addCredentialFlags(c)
+		if err := c.Flags().Parse(args); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		return c
+	}
+
+	_, err = credentialOptions(newCmd(), "", io.Discard)
+	if !errors.Is(err, lockbox.ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "--password-env") {
+		t.Fatalf("expected the error to name the password flags, got %v", err)
+	}
+
+	// Flags need no terminal
+	t.Setenv("TEST_LOCKBOX_PASSWORD", "secret")
+	opts, err := credentialOptions(newCmd("--password-env", "TEST_LOCKBOX_PASSWORD"), "", io.Discard)
+	if err != nil || len(opts) != 1 {
+		t.Fatalf("expected one option from --password-env, got %d (%v)", len(opts), err)
+	}
+}
+
+func TestReadNewPassword(t *testing.T) {
+	defer func(orig func(io.Writer, string, string) (string, error)) { promptPassword = orig }(promptPassword)
+	answer := func(typed ...string) {
+		promptPassword = func(io.Writer, string, string) (string, error) {
+			if len(typed) == 0 {
+				t.Fatalf("prompted more often than expected")
+			}
+			next := typed[0]
+			typed = typed[1:]
+			return next, nil
+		}
+	}
+
+	answer("secret", "secret")
+	if pw, err := readNewPassword(io.Discard, "Enter password: ", ""); err != nil || pw != "secret" {
+		t.Fatalf("expected secret, got %q (%v)", pw, err)
+	}
+
+	// A mismatch asks again
+	answer("secret", "secrte", "again", "again")
+	if pw, err := readNewPassword(io.Discard, "Enter password: ", ""); err != nil || pw != "again" {
+		t.Fatalf("expected again after a mismatch, got %q (%v)", pw, err)
+	}
+
+	answer("a", "b", "c", "d", "e", "f")
+	if _, err := readNewPassword(io.Discard, "Enter password: ", ""); err == nil {
+		t.Fatalf("expected an error after %d mismatches", passwordAttempts)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete [lockbox-file]",
+	Short: "Remove the rows matching a condition",
+	Long: `Remove every row matching all --where conditions, for example
+
+  lockbox delete events.lbx --where "created<'2020-01-01'"
+
+--where takes the same conditions as export, such as "username='bob'" or
+"score<10", and is required, so a file is never emptied by accident.
+
+The file is decrypted, filtered and re-encrypted to a temporary file next
+to it that replaces the original once complete, like compact: an
+interrupted delete leaves the file as it was.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		password, _ := cmd.Flags().GetString("password")
+		where, _ := cmd.Flags().GetStringArray("where")
+
+		opts, err := whereOptions(where)
+		if err != nil {
+			return err
+		}
+
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+		report, err := lockbox.Delete(cmd.Context(), filename, lockOptions(lockbox.ReadWrite, append(opts, creds...)...)...)
+		if err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", filename, err)
+		}
+
+		infof("Deleted %d rows from %s, %d rows left\n", report.Matched, filename, report.Rows)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().StringP("password", "p", "", "Password for the lockbox")
+	deleteCmd.Flags().StringArray("where", nil, `Delete rows matching a condition, e.g. "id=42" (repeatable)`)
+	deleteCmd.MarkFlagRequired("where")
+	addCredentialFlags(deleteCmd)
+}
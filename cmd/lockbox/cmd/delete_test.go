@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeleteWhereString(t *testing.T) {
+	tmpFile := "/tmp/test_delete_string.lbx"
+	csvFile := "/tmp/test_delete_string.csv"
+	os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+	defer os.Remove(csvFile)
+
+	csv := "id,name,email,age\n1,bob,bob@example.com,30\n2,alice,alice@example.com,41\n3,bob,,52\n4,,carol@example.com,23\n"
+	if err := os.WriteFile(csvFile, []byte(csv), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	run := func(args ...string) string {
+		stdout, _ := captureOutput(t, func() {
+			rootCmd.SetArgs(args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("%s: %v", args[0], err)
+			}
+		})
+		return stdout
+	}
+	defer rootCmd.SetArgs(nil)
+
+	run("create", tmpFile, "--password", "delete", "--kdf-memory", "8192")
+	run("write", tmpFile, "--input", csvFile, "--format", "csv", "--password", "delete")
+	run("delete", tmpFile, "--where", "name='bob'", "--password", "delete")
+
+	if got := strings.TrimSpace(run("count", tmpFile, "--password", "delete")); got != "2" {
+		t.Fatalf("expected 2 rows left, got %q", got)
+	}
+	// The null name matches neither = nor !=
+	if got := strings.TrimSpace(run("count", tmpFile, "--where", "name!='bob'", "--password", "delete")); got != "1" {
+		t.Fatalf("expected 1 row with a name other than bob, got %q", got)
+	}
+}
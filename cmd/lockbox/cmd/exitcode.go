@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the lockbox command, so scripts can tell failures apart
+const (
+	ExitOK             = 0
+	ExitFailure        = 1
+	ExitWrongPassword  = 2
+	ExitCorrupt        = 3
+	ExitSchemaMismatch = 4
+	// ExitInterrupted is the shell convention for death by SIGINT
+	ExitInterrupted = 130
+	// ExitUsage follows sysexits.h EX_USAGE
+	ExitUsage = 64
+)
+
+// runError marks an error returned once a command started running, as
+// opposed to one cobra raised while parsing and validating the command line
+type runError struct {
+	err error
+}
+
+func (e *runError) Error() string { return e.err.Error() }
+
+func (e *runError) Unwrap() error { return e.err }
+
+// ExitCode maps an error returned by Execute to the process exit code
+func ExitCode(err error) int {
+	var run *runError
+	switch {
+	case err == nil:
+		return ExitOK
+	case !errors.As(err, &run):
+		return ExitUsage
+	case errors.Is(err, lockbox.ErrWrongPassword), errors.Is(err, lockbox.ErrWrongAAD), errors.Is(err, lockbox.ErrNoMatchingIdentity), errors.Is(err, format.ErrPasswordDisabled),
+		errors.Is(err, lockbox.ErrPasswordRequired):
+		return ExitWrongPassword
+	case errors.Is(err, lockbox.ErrCorrupt):
+		return ExitCorrupt
+	case errors.Is(err, lockbox.ErrSchemaMismatch):
+		return ExitSchemaMismatch
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	}
+	return ExitFailure
+}
+
+// markRunErrors wraps the run hooks of c and its subcommands so their
+// errors are told apart from command line errors
+func markRunErrors(c *cobra.Command) {
+	c.RunE = wrapRunError(c.RunE)
+	c.PersistentPostRunE = wrapRunError(c.PersistentPostRunE)
+	for _, sub := range c.Commands() {
+		markRunErrors(sub)
+	}
+}
+
+func wrapRunError(fn func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	if fn == nil {
+		return nil
+	}
+	return func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd, args); err != nil {
+			return &runError{err: err}
+		}
+		return nil
+	}
+}
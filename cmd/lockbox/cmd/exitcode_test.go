@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+func TestExitCode(t *testing.T) {
+	// run executes a fresh command tree, since cobra keeps parsed flags
+	run := func(runErr error, args ...string) int {
+		root := &cobra.Command{Use: "root", SilenceErrors: true, SilenceUsage: true}
+		sub := &cobra.Command{
+			Use:  "sub [file]",
+			Args: cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error { return runErr },
+		}
+		sub.Flags().String("input", "", "")
+		sub.MarkFlagRequired("input")
+		root.AddCommand(sub)
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		markRunErrors(root)
+		root.SetArgs(args)
+		return ExitCode(root.Execute())
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		args []string
+		want int
+	}{
+		{"success", nil, []string{"sub", "f", "--input", "x"}, ExitOK},
+		{"generic", errors.New("boom"), []string{"sub", "f", "--input", "x"}, ExitFailure},
+		{"wrong password", fmt.Errorf("failed to open: %w", lockbox.ErrWrongPassword), []string{"sub", "f", "--input", "x"}, ExitWrongPassword},
+		{"wrong aad", fmt.Errorf("failed to open: %w", lockbox.ErrWrongAAD), []string{"sub", "f", "--input", "x"}, ExitWrongPassword},
+		{"no password", fmt.Errorf("failed to read: %w", lockbox.ErrPasswordRequired), []string{"sub", "f", "--input", "x"}, ExitWrongPassword},
+		{"no identity", fmt.Errorf("failed to open: %w", lockbox.ErrNoMatchingIdentity), []string{"sub", "f", "--input", "x"}, ExitWrongPassword},
+		{"corrupt", fmt.Errorf("failed to read: %w", lockbox.ErrCorrupt), []string{"sub", "f", "--input", "x"}, ExitCorrupt},
+		{"schema mismatch", fmt.Errorf("failed to write: %w", lockbox.ErrSchemaMismatch), []string{"sub", "f", "--input", "x"}, ExitSchemaMismatch},
+		{"interrupted", fmt.Errorf("failed to load: %w", context.Canceled), []string{"sub", "f", "--input", "x"}, ExitInterrupted},
+		{"missing required flag", errors.New("unreached"), []string{"sub", "f"}, ExitUsage},
+		{"wrong arguments", errors.New("unreached"), []string{"sub", "--input", "x"}, ExitUsage},
+		{"unknown flag", errors.New("unreached"), []string{"sub", "f", "--input", "x", "--bogus"}, ExitUsage},
+	}
+	for _, tt := range tests {
+		if got := run(tt.err, tt.args...); got != tt.want {
+			t.Fatalf("%s: expected exit code %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
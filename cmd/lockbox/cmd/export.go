@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/spf13/cobra"
+)
+
+// stdoutPath selects stdout as the export destination
+const stdoutPath = "-"
+
+var exportCmd = &cobra.Command{
+	Use:     "export [lockbox-file]",
+	Aliases: []string{"read"},
+	Short:   "Decrypt a lockbox file to CSV, JSON, Parquet or Arrow",
+	Long: `Decrypt a lockbox file and write its rows to CSV, JSON, Parquet or Arrow.
+
+This is the inverse of write. Segments are decrypted and written one at a
+time, so large files are never held in memory.
+
+- csv: header row, nulls as empty fields, timestamps as RFC3339
+- json: one object per line (NDJSON), nulls as null, timestamps as RFC3339,
+  decimals as strings, binary as base64, lists as arrays, maps and structs
+  as objects
+- parquet: the Arrow schema, including nullability, is stored in the file,
+  and the Parquet logical types carry timestamp units and time zones,
+  decimal precision and scale, so DuckDB and Spark read the same types
+- arrow (or feather): an Arrow IPC file with the exact schema and types, one
+  record batch per segment
+
+Use --output - (the default) to write CSV or JSON to stdout.
+
+CSV and JSON hold binary values as base64 and fixed-size binary values as
+hex; --binary-encoding hex or base64 uses one encoding for both, matching
+the flag of the same name on write.
+
+--duckdb-view sales prints a statement such as
+  CREATE VIEW "sales" AS SELECT * FROM read_parquet('/data/sales.parquet');
+after a Parquet export, ready to paste into DuckDB.
+
+--where keeps only rows matching a comparison such as "age>=18",
+"ts<2024-01-01T00:00:00Z" or "status='open'". Integer, float and timestamp
+columns take =, !=, <, <=, > and >=; string columns take = and != only.
+Nulls never match. Repeat it to combine conditions with AND. Segments whose
+stored min/max rule out a match are skipped without being decrypted.
+
+--head N stops after the first N rows. --tail N keeps the last N rows: the
+segment row counts in the metadata locate them, so earlier segments are not
+decrypted. Combined with --where, --tail reads every candidate segment and
+keeps only the last matches in memory.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		to, _ := cmd.Flags().GetString("to")
+		output, _ := cmd.Flags().GetString("output")
+		password, _ := cmd.Flags().GetString("password")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		where, _ := cmd.Flags().GetStringArray("where")
+		head, _ := cmd.Flags().GetInt64("head")
+		tail, _ := cmd.Flags().GetInt64("tail")
+		view, _ := cmd.Flags().GetString("duckdb-view")
+		if view != "" && to != "parquet" {
+			return fmt.Errorf("--duckdb-view needs --to parquet")
+		}
+
+		filters, err := whereOptions(where)
+		if err != nil {
+			return err
+		}
+		readOpts := append(filters, lockbox.WithColumns(columns...))
+		if cmd.Flags().Changed("head") {
+			readOpts = append(readOpts, lockbox.WithHead(head))
+		}
+		if cmd.Flags().Changed("tail") {
+			readOpts = append(readOpts, lockbox.WithTail(tail))
+		}
+
+		binary, err := binaryEncodingFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		export, err := exporterFor(to, output, binary)
+		if err != nil {
+			return err
+		}
+
+		// Prompt on stderr so stdout stays clean
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadOnly, creds...)...)
+		if err != nil {
+			return fmt.Errorf("failed to open lockbox: %w", err)
+		}
+		defer lb.Close()
+
+		rr, err := lb.NewReader(append(creds, readOpts...)...)
+		if err != nil {
+			return err
+		}
+		defer rr.Release()
+
+		if err := exportTo(output, rr, export); err != nil {
+			return err
+		}
+		if view != "" {
+			stmt, err := duckDBView(view, output)
+			if err != nil {
+				return err
+			}
+			fmt.Println(stmt)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().String("to", "csv", "Output format (csv, json, parquet, arrow)")
+	exportCmd.Flags().StringP("output", "o", stdoutPath, "Output file, or - for stdout")
+	exportCmd.Flags().StringP("password", "p", "", "Password for decryption")
+	exportCmd.Flags().StringSlice("columns", []string{}, "Only decrypt these columns (comma separated)")
+	exportCmd.Flags().StringArray("where", nil, `Keep rows matching a condition, e.g. "age>=18" (repeatable)`)
+	exportCmd.Flags().Int64("head", 0, "Only export the first N rows")
+	exportCmd.Flags().Int64("tail", 0, "Only export the last N rows")
+	exportCmd.MarkFlagsMutuallyExclusive("head", "tail")
+	exportCmd.Flags().String("duckdb-view", "", "With --to parquet, print a DuckDB CREATE VIEW statement with this name over the output")
+	addBinaryEncodingFlag(exportCmd)
+	addCredentialFlags(exportCmd)
+}
+
+// exporterFor returns the exporter for an output format, writing binary
+// values of CSV and JSON output in binary. Parquet cannot be streamed to
+// stdout.
+func exporterFor(to, output string, binary lockbox.BinaryEncoding) (func(io.Writer, array.RecordReader) error, error) {
+	switch to {
+	case "csv":
+		return func(w io.Writer, rr array.RecordReader) error { return exportCSV(w, rr, binary) }, nil
+	case "json":
+		return func(w io.Writer, rr array.RecordReader) error { return exportJSON(w, rr, binary) }, nil
+	case "parquet":
+		if output == stdoutPath {
+			return nil, fmt.Errorf("parquet export needs a file; pass --output")
+		}
+		return exportParquet, nil
+	case "arrow", "feather":
+		return exportArrow, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q (expected csv, json, parquet or arrow)", to)
+}
+
+// exportTo runs export into output, or stdout for "-". A failed export
+// removes the partial file.
+func exportTo(output string, rr array.RecordReader, export func(io.Writer, array.RecordReader) error) error {
+	if output == stdoutPath {
+		return export(os.Stdout, rr)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := export(f, rr); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	// The parquet writer closes the file itself
+	if err := f.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// duckDBView returns a DuckDB statement creating view name over the Parquet
+// file at output, by absolute path so it works from any directory
+func duckDBView(name, output string) (string, error) {
+	path, err := filepath.Abs(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve output path: %w", err)
+	}
+	return fmt.Sprintf("CREATE VIEW \"%s\" AS SELECT * FROM read_parquet('%s');",
+		strings.ReplaceAll(name, `"`, `""`), strings.ReplaceAll(path, "'", "''")), nil
+}
+
+// whereOptions turns --where conditions into reader filters
+func whereOptions(exprs []string) ([]lockbox.Option, error) {
+	var opts []lockbox.Option
+	for _, expr := range exprs {
+		f, err := lockbox.ParseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lockbox.WithFilter(f.Column, f.Op, f.Value))
+	}
+	return opts, nil
+}
+
+// exportCSV writes every record from rr as CSV with a header row
+func exportCSV(w io.Writer, rr array.RecordReader, binary lockbox.BinaryEncoding) error {
+	cw := csv.NewWriter(w)
+
+	schema := rr.Schema()
+	header := make([]string, schema.NumFields())
+	for i, f := range schema.Fields() {
+		header[i] = f.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+
+	row := make([]string, schema.NumFields())
+	for rr.Next() {
+		rec := rr.Record()
+		for r := 0; r < int(rec.NumRows()); r++ {
+			for c, col := range rec.Columns() {
+				row[c] = exportString(col, r, binary)
+			}
+			if err := cw.Write(row); err != nil {
+				return fmt.Errorf("failed to write csv row: %w", err)
+			}
+		}
+	}
+	if err := rr.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// exportJSON writes every record from rr as newline-delimited JSON objects
+func exportJSON(w io.Writer, rr array.RecordReader, binary lockbox.BinaryEncoding) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	fields := rr.Schema().Fields()
+	for rr.Next() {
+		rec := rr.Record()
+		for r := 0; r < int(rec.NumRows()); r++ {
+			obj := make(map[string]interface{}, len(fields))
+			for c, col := range rec.Columns() {
+				obj[fields[c].Name] = exportJSONValue(col, r, binary)
+			}
+			if err := enc.Encode(obj); err != nil {
+				return fmt.Errorf("failed to write json row: %w", err)
+			}
+		}
+	}
+	if err := rr.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// exportParquet writes every record from rr to a Parquet file, storing the
+// Arrow schema so nullability and types survive the round trip. Readers
+// that ignore the stored schema, such as DuckDB, rely on the Parquet
+// logical types: timestamps keep their unit (format 2.6 is needed for
+// nanoseconds) and are UTC-adjusted when the column has a time zone,
+// decimals keep precision and scale, and non-nullable columns are required.
+func exportParquet(w io.Writer, rr array.RecordReader) error {
+	pw, err := pqarrow.NewFileWriter(rr.Schema(), w,
+		parquet.NewWriterProperties(parquet.WithVersion(parquet.V2_6)),
+		pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	for rr.Next() {
+		if err := pw.Write(rr.Record()); err != nil {
+			pw.Close()
+			return fmt.Errorf("failed to write parquet: %w", err)
+		}
+	}
+	if err := rr.Err(); err != nil {
+		pw.Close()
+		return err
+	}
+
+	return pw.Close()
+}
+
+// exportArrow writes every record from rr to an Arrow IPC file, keeping
+// types the text formats would flatten
+func exportArrow(w io.Writer, rr array.RecordReader) error {
+	fw, err := ipc.NewFileWriter(w, ipc.WithSchema(rr.Schema()))
+	if err != nil {
+		return fmt.Errorf("failed to create arrow writer: %w", err)
+	}
+
+	for rr.Next() {
+		if err := fw.Write(rr.Record()); err != nil {
+			fw.Close()
+			return fmt.Errorf("failed to write arrow: %w", err)
+		}
+	}
+	if err := rr.Err(); err != nil {
+		fw.Close()
+		return err
+	}
+
+	return fw.Close()
+}
+
+// exportString formats a value the way the CSV loader reads it back
+func exportString(col arrow.Array, row int, binary lockbox.BinaryEncoding) string {
+	if col.IsNull(row) {
+		return ""
+	}
+	switch c := col.(type) {
+	case *array.Timestamp:
+		return exportTime(c, row)
+	case *array.Binary:
+		return binary.Encode(c.Value(row))
+	case *array.FixedSizeBinary:
+		return binary.EncodeFixed(c.Value(row))
+	case *array.Dictionary:
+		return c.Dictionary().ValueStr(c.GetValueIndex(row))
+	default:
+		return col.ValueStr(row)
+	}
+}
+
+// exportJSONValue converts a value to the JSON type the JSON loader expects
+func exportJSONValue(col arrow.Array, row int, binary lockbox.BinaryEncoding) interface{} {
+	if col.IsNull(row) {
+		return nil
+	}
+	switch c := col.(type) {
+	case *array.Int64:
+		return c.Value(row)
+	case *array.Int32:
+		return c.Value(row)
+	case *array.Int16:
+		return c.Value(row)
+	case *array.Int8:
+		return c.Value(row)
+	case *array.Uint64:
+		// Beyond 2^53 a JSON number loses precision, so use a string
+		return strconv.FormatUint(c.Value(row), 10)
+	case *array.Uint32:
+		return c.Value(row)
+	case *array.Uint16:
+		return c.Value(row)
+	case *array.Uint8:
+		return c.Value(row)
+	case *array.Float64:
+		return c.Value(row)
+	case *array.Float32:
+		return c.Value(row)
+	case *array.Boolean:
+		return c.Value(row)
+	case *array.String:
+		return c.Value(row)
+	case *array.Binary:
+		return binary.Encode(c.Value(row))
+	case *array.Map:
+		start, end := c.ValueOffsets(row)
+		obj := make(map[string]interface{}, end-start)
+		for j := start; j < end; j++ {
+			key := fmt.Sprint(exportJSONValue(c.Keys(), int(j), binary))
+			obj[key] = exportJSONValue(c.Items(), int(j), binary)
+		}
+		return obj
+	case *array.List:
+		start, end := c.ValueOffsets(row)
+		items := make([]interface{}, 0, end-start)
+		for j := start; j < end; j++ {
+			items = append(items, exportJSONValue(c.ListValues(), int(j), binary))
+		}
+		return items
+	case *array.Struct:
+		typ := c.DataType().(*arrow.StructType)
+		obj := make(map[string]interface{}, c.NumField())
+		for j := 0; j < c.NumField(); j++ {
+			obj[typ.Field(j).Name] = exportJSONValue(c.Field(j), row, binary)
+		}
+		return obj
+	default:
+		return exportString(col, row, binary)
+	}
+}
+
+// exportTime formats a timestamp as RFC3339, keeping sub-second precision
+func exportTime(c *array.Timestamp, row int) string {
+	typ := c.DataType().(*arrow.TimestampType)
+	tm := c.Value(row).ToTime(typ.Unit)
+	if typ.TimeZone != "" {
+		if loc, err := time.LoadLocation(typ.TimeZone); err == nil {
+			tm = tm.In(loc)
+		}
+	}
+	return tm.Format(time.RFC3339Nano)
+}
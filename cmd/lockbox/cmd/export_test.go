@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	amountType := &arrow.Decimal128Type{Precision: 10, Scale: 2}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "seen", Type: arrow.FixedWidthTypes.Timestamp_ms, Nullable: true},
+		{Name: "amount", Type: amountType, Nullable: true},
+	}, nil)
+
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	seen := time.Date(2024, 3, 1, 12, 30, 0, 250_000_000, time.UTC)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"Alice, Jr.", ""}, []bool{true, false})
+	b.Field(2).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{arrow.Timestamp(seen.UnixMilli()), 0}, []bool{true, false})
+	b.Field(3).(*array.Decimal128Builder).AppendValues([]decimal128.Num{decimal128.FromI64(1050), {}}, []bool{true, false})
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	tmpFile := "/tmp/test_export.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec.Retain()
+	if err := lb.Write(context.Background(), rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	export := func(fn func(io.Writer, array.RecordReader) error) []byte {
+		rr, err := lb.NewReader(lockbox.WithPassword(password))
+		if err != nil {
+			t.Fatalf("reader: %v", err)
+		}
+		defer rr.Release()
+		var buf bytes.Buffer
+		if err := fn(&buf, rr); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	csvOut := export(func(w io.Writer, rr array.RecordReader) error { return exportCSV(w, rr, "") })
+	got, err := loadCSV(context.Background(), memory.NewGoAllocator(), bytes.NewReader(csvOut), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("reload csv: %v\n%s", err, csvOut)
+	}
+	if !array.RecordEqual(rec, got) {
+		t.Fatalf("csv round trip mismatch:\n%s", csvOut)
+	}
+	got.Release()
+
+	jsonOut := export(func(w io.Writer, rr array.RecordReader) error { return exportJSON(w, rr, "") })
+	got, err = loadJSON(context.Background(), memory.NewGoAllocator(), bytes.NewReader(jsonOut), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("reload json: %v\n%s", err, jsonOut)
+	}
+	if !array.RecordEqual(rec, got) {
+		t.Fatalf("json round trip mismatch:\n%s", jsonOut)
+	}
+	got.Release()
+
+	pqOut := export(exportParquet)
+	pf, err := file.NewParquetReader(bytes.NewReader(pqOut))
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, mem)
+	if err != nil {
+		t.Fatalf("parquet reader: %v", err)
+	}
+	pqSchema, err := fr.Schema()
+	if err != nil {
+		t.Fatalf("parquet schema: %v", err)
+	}
+	for i, f := range schema.Fields() {
+		pf := pqSchema.Field(i)
+		if pf.Name != f.Name || pf.Nullable != f.Nullable || !arrow.TypeEqual(pf.Type, f.Type) {
+			t.Fatalf("parquet field %d: expected %v, got %v", i, f, pf)
+		}
+	}
+
+	// Arrow files and streams both load back exactly
+	arrowOut := export(exportArrow)
+	var stream bytes.Buffer
+	sw := ipc.NewWriter(&stream, ipc.WithSchema(schema))
+	if err := sw.Write(rec); err != nil {
+		t.Fatalf("write stream: %v", err)
+	}
+	sw.Close()
+	for name, data := range map[string][]byte{"file": arrowOut, "stream": stream.Bytes()} {
+		got, err = loadArrow(context.Background(), memory.NewGoAllocator(), bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("reload arrow %s: %v", name, err)
+		}
+		if !got.Schema().Equal(schema) || !array.RecordEqual(rec, got) {
+			t.Fatalf("arrow %s round trip mismatch", name)
+		}
+		got.Release()
+	}
+}
+
+func TestBinaryEncodingRoundTrip(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "payload", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		{Name: "digest", Type: &arrow.FixedSizeBinaryType{ByteWidth: 4}, Nullable: true},
+	}, nil)
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	// base64 is the default for binary and hex for fixed-size binary
+	rec, err := loadCSV(ctx, mem, strings.NewReader("id,payload,digest\n1,AP8Kbm8=,deadbeef\n2,,\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	defer rec.Release()
+	if got := rec.Column(1).(*array.Binary).Value(0); !bytes.Equal(got, []byte{0x00, 0xff, '\n', 'n', 'o'}) {
+		t.Fatalf("unexpected payload %x", got)
+	}
+	if !rec.Column(1).IsNull(1) {
+		t.Fatalf("expected a null payload in row 2")
+	}
+
+	fromHex, err := loadJSON(ctx, mem, strings.NewReader(`{"id": 1, "payload": "00ff0a6e6f", "digest": "deadbeef"}
+{"id": 2}
+`), schema, lockbox.JSONReadOptions{Binary: lockbox.BinaryHex}, nil)
+	if err != nil {
+		t.Fatalf("load hex json: %v", err)
+	}
+	defer fromHex.Release()
+	if !array.RecordEqual(rec, fromHex) {
+		t.Fatalf("hex json mismatch:\n%v\n%v", rec, fromHex)
+	}
+
+	for _, to := range []string{"csv", "json"} {
+		for _, enc := range []lockbox.BinaryEncoding{"", lockbox.BinaryHex, lockbox.BinaryBase64} {
+			rr, err := array.NewRecordReader(schema, []arrow.Record{rec})
+			if err != nil {
+				t.Fatalf("reader: %v", err)
+			}
+			export, err := exporterFor(to, stdoutPath, enc)
+			if err != nil {
+				t.Fatalf("exporter: %v", err)
+			}
+			var buf bytes.Buffer
+			err = export(&buf, rr)
+			rr.Release()
+			if err != nil {
+				t.Fatalf("export %s: %v", to, err)
+			}
+
+			var got arrow.Record
+			if to == "csv" {
+				got, err = loadCSV(ctx, mem, &buf, schema, lockbox.CSVReadOptions{Binary: enc}, nil)
+			} else {
+				got, err = loadJSON(ctx, mem, &buf, schema, lockbox.JSONReadOptions{Binary: enc}, nil)
+			}
+			if err != nil {
+				t.Fatalf("reload %s with %q: %v", to, enc, err)
+			}
+			if !array.RecordEqual(rec, got) {
+				t.Fatalf("%s round trip with %q mismatch:\n%v", to, enc, got)
+			}
+			got.Release()
+		}
+	}
+
+	if _, err := loadJSON(ctx, mem, strings.NewReader(`{"id": 1, "payload": 12}`), schema, lockbox.JSONReadOptions{}, nil); err == nil {
+		t.Fatalf("expected an error for a numeric binary value")
+	}
+	if _, err := loadCSV(ctx, mem, strings.NewReader("id,payload,digest\n1,zz,\n"), schema, lockbox.CSVReadOptions{Binary: lockbox.BinaryHex}, nil); err == nil {
+		t.Fatalf("expected an error for invalid hex")
+	}
+}
+
+func TestExportParquetLogicalTypes(t *testing.T) {
+	// Without the stored Arrow schema, as DuckDB reads the file
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: false},
+		{Name: "day", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+		{Name: "ts_ms", Type: &arrow.TimestampType{Unit: arrow.Millisecond}, Nullable: true},
+		{Name: "ts_us_utc", Type: &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, Nullable: true},
+		{Name: "ts_ns", Type: arrow.FixedWidthTypes.Timestamp_ns, Nullable: false},
+		{Name: "price", Type: &arrow.Decimal128Type{Precision: 9, Scale: 2}, Nullable: true},
+		{Name: "total", Type: &arrow.Decimal128Type{Precision: 30, Scale: 6}, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	b.Field(0).(*array.Int32Builder).Append(1)
+	b.Field(1).(*array.Date32Builder).AppendNull()
+	b.Field(2).(*array.TimestampBuilder).Append(1_700_000_000_000)
+	b.Field(3).(*array.TimestampBuilder).Append(1_700_000_000_000_000)
+	b.Field(4).(*array.TimestampBuilder).Append(1_700_000_000_000_000_123)
+	b.Field(5).(*array.Decimal128Builder).Append(decimal128.FromI64(1999))
+	b.Field(6).(*array.Decimal128Builder).Append(decimal128.FromI64(123_456_789))
+	b.Field(7).(*array.StringBuilder).Append("widget")
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	rr, err := array.NewRecordReader(schema, []arrow.Record{rec})
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	defer rr.Release()
+	var buf bytes.Buffer
+	if err := exportParquet(&buf, rr); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	got, err := pqarrow.FromParquet(pf.MetaData().Schema, &pqarrow.ArrowReadProperties{}, nil)
+	if err != nil {
+		t.Fatalf("parquet schema: %v", err)
+	}
+	if got.NumFields() != schema.NumFields() {
+		t.Fatalf("expected %d parquet fields, got %d", schema.NumFields(), got.NumFields())
+	}
+	for i, f := range schema.Fields() {
+		pf := got.Field(i)
+		if pf.Name != f.Name || pf.Nullable != f.Nullable || !arrow.TypeEqual(pf.Type, f.Type) {
+			t.Fatalf("parquet field %d: expected %v, got %v", i, f, pf)
+		}
+	}
+}
+
+func TestDuckDBView(t *testing.T) {
+	got, err := duckDBView(`my "view"`, "/data/o'brien.parquet")
+	if err != nil {
+		t.Fatalf("duckDBView: %v", err)
+	}
+	want := `CREATE VIEW "my ""view""" AS SELECT * FROM read_parquet('/data/o''brien.parquet');`
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
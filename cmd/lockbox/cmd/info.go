@@ -2,12 +2,16 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"syscall"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/TFMV/lockbox/pkg/format"
 	"github.com/TFMV/lockbox/pkg/lockbox"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 var infoCmd = &cobra.Command{
@@ -17,45 +21,71 @@ var infoCmd = &cobra.Command{
 - Schema information
 - Metadata details
 - Creation and modification timestamps
-- Block information
-- Access audit logs`,
+- Row, segment and block counts
+- Cipher, key derivation and compression settings
+- Properties stored with write --meta (shown as stored; lockbox verify
+  authenticates them)
+
+Only the plaintext header and metadata are read, so no password is needed.
+
+With --stats the encrypted statistics footer is decrypted as well, adding
+per-column null counts and min/max values without scanning any data. Files
+written before the footer existed can be repaired with --recompute-stats,
+which decrypts every segment once and stores the footer.
+
+With --history the provenance log is shown: one entry per write with its
+time, row count, user and tool. The log is authenticated with the file key,
+so it needs the password too and fails if entries were altered or removed.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filename := args[0]
 
-		password, _ := cmd.Flags().GetString("password")
 		outputFormat, _ := cmd.Flags().GetString("output")
-
-		// Get password if not provided
-		if password == "" {
-			fmt.Print("Enter password: ")
-			passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
-			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
-			}
-			password = string(passwordBytes)
-			fmt.Println() // New line after password input
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			outputFormat = "json"
 		}
 
-		// Open the lockbox
-		lb, err := lockbox.Open(filename, lockbox.WithPassword(password))
-		if err != nil {
-			return fmt.Errorf("failed to open lockbox: %w", err)
-		}
-		defer lb.Close()
+		showStats, _ := cmd.Flags().GetBool("stats")
+		recompute, _ := cmd.Flags().GetBool("recompute-stats")
+		showHistory, _ := cmd.Flags().GetBool("history")
 
 		// Get file info
-		info, err := lb.Info()
+		info, err := lockbox.ReadInfo(filename)
 		if err != nil {
 			return fmt.Errorf("failed to get file info: %w", err)
 		}
 
+		password, _ := cmd.Flags().GetString("password")
+		var stats *lockbox.Stats
+		if showStats || recompute {
+			stats, err = readStats(cmd, filename, password, recompute)
+			if err != nil {
+				return err
+			}
+		}
+		var history []lockbox.ProvenanceEntry
+		if showHistory {
+			history, err = readHistory(cmd, filename, password)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Display information
 		switch outputFormat {
 		case "json":
-			return displayInfoJSON(info)
+			return displayInfoJSON(info, stats, history)
 		default:
-			return displayInfoTable(info, filename)
+			if err := displayInfoTable(info, filename); err != nil {
+				return err
+			}
+			if stats != nil {
+				displayStatsTable(stats, info)
+			}
+			if showHistory {
+				displayHistoryTable(history)
+			}
+			return nil
 		}
 	},
 }
@@ -63,8 +93,98 @@ var infoCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(infoCmd)
 
-	infoCmd.Flags().StringP("password", "p", "", "Password for decryption")
+	infoCmd.Flags().StringP("password", "p", "", "Password for --stats and --history")
 	infoCmd.Flags().StringP("output", "o", "table", "Output format (table, json)")
+	infoCmd.Flags().Bool("json", false, "Shorthand for --output json")
+	infoCmd.Flags().Bool("stats", false, "Decrypt and show the column statistics footer")
+	infoCmd.Flags().Bool("recompute-stats", false, "Rebuild the statistics footer by decrypting every segment")
+	infoCmd.Flags().Bool("history", false, "Authenticate and show the provenance log of writes")
+	addCredentialFlags(infoCmd)
+}
+
+// readStats unlocks the file and decrypts its statistics footer, first
+// rebuilding it when recompute is set
+func readStats(cmd *cobra.Command, filename, password string, recompute bool) (*lockbox.Stats, error) {
+	creds, err := credentialOptions(cmd, password, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recomputing rewrites the footer, so it needs the exclusive lock
+	mode := lockbox.ReadOnly
+	if recompute {
+		mode = lockbox.ReadWrite
+	}
+	lb, err := lockbox.Open(filename, lockOptions(mode, creds...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockbox: %w", err)
+	}
+	defer lb.Close()
+
+	if recompute {
+		if err := lb.RecomputeStats(creds...); err != nil {
+			return nil, err
+		}
+	}
+
+	stats, err := lb.Stats(creds...)
+	if errors.Is(err, format.ErrNoStats) {
+		return nil, fmt.Errorf("%s has no statistics footer; run info --recompute-stats", filename)
+	}
+	return stats, err
+}
+
+// readHistory unlocks the file and returns its authenticated provenance log
+func readHistory(cmd *cobra.Command, filename, password string) ([]lockbox.ProvenanceEntry, error) {
+	creds, err := credentialOptions(cmd, password, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadOnly, creds...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockbox: %w", err)
+	}
+	defer lb.Close()
+
+	history, err := lb.History(creds...)
+	if err == nil && history == nil {
+		// Report an empty log rather than omitting it from JSON output
+		history = []lockbox.ProvenanceEntry{}
+	}
+	return history, err
+}
+
+func displayHistoryTable(history []lockbox.ProvenanceEntry) {
+	fmt.Printf("\nHistory\n")
+	fmt.Printf("-------\n")
+	if len(history) == 0 {
+		fmt.Printf("No writes recorded\n")
+		return
+	}
+	for _, e := range history {
+		fmt.Printf("%s  %d rows  user=%s  tool=%s\n", e.Timestamp.Format(time.RFC3339), e.Rows, e.User, e.Tool)
+	}
+}
+
+func displayStatsTable(stats *lockbox.Stats, info *lockbox.Info) {
+	fmt.Printf("\nStatistics\n")
+	fmt.Printf("----------\n")
+	fmt.Printf("Rows: %d\n", stats.Rows)
+	if info.Schema == nil {
+		return
+	}
+	for _, field := range info.Schema.Fields() {
+		cs, ok := stats.Columns[field.Name]
+		if !ok {
+			continue
+		}
+		if cs.Min != nil {
+			fmt.Printf("  %s: nulls=%d min=%v max=%v\n", field.Name, cs.Nulls, cs.Min, cs.Max)
+		} else {
+			fmt.Printf("  %s: nulls=%d\n", field.Name, cs.Nulls)
+		}
+	}
 }
 
 func displayInfoTable(info *lockbox.Info, filename string) error {
@@ -77,13 +197,49 @@ func displayInfoTable(info *lockbox.Info, filename string) error {
 	fmt.Printf("Created At: %v\n", info.CreatedAt)
 	fmt.Printf("Modified By: %s\n", info.ModifiedBy)
 	fmt.Printf("Modified At: %v\n", info.ModifiedAt)
+	fmt.Printf("Row Count: %d\n", info.RowCount)
+	fmt.Printf("Segment Count: %d\n", info.SegmentCount)
 	fmt.Printf("Block Count: %d\n", info.BlockCount)
+	if info.BlockSize > 0 {
+		fmt.Printf("Block Size: %d rows\n", info.BlockSize)
+	}
 	fmt.Printf("Access Count: %d\n", info.AccessCount)
 
+	fmt.Printf("\nEncryption\n")
+	fmt.Printf("----------\n")
+	fmt.Printf("Algorithm: %s\n", info.Algorithm)
+	if info.PasswordSlot && info.KDFMemory > 0 {
+		fmt.Printf("Key Derivation: %s (%d KiB, %d iterations, parallelism %d)\n",
+			info.KeyDerivation, info.KDFMemory, info.KDFIterations, info.KDFLanes)
+	} else if info.PasswordSlot {
+		fmt.Printf("Key Derivation: %s (%d iterations)\n", info.KeyDerivation, info.KDFIterations)
+	} else {
+		fmt.Printf("Key Derivation: none (password disabled)\n")
+	}
+	fmt.Printf("Recipients: %d\n", info.Recipients)
+	fmt.Printf("Compression: %s\n", info.Compression)
+
+	if len(info.Metadata) > 0 {
+		fmt.Printf("\nMetadata\n")
+		fmt.Printf("--------\n")
+		keys := make([]string, 0, len(info.Metadata))
+		for k := range info.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s: %s\n", k, info.Metadata[k])
+		}
+	}
+
 	fmt.Printf("\nSchema Information\n")
 	fmt.Printf("------------------\n")
 
 	if info.Schema != nil {
+		fmt.Printf("Version: %d\n", info.SchemaVersion)
+		if len(info.SortOrder) > 0 {
+			fmt.Printf("Sorted By: %s\n", strings.Join(info.SortOrder, ", "))
+		}
 		fmt.Printf("Fields: %d\n", len(info.Schema.Fields()))
 		for i, field := range info.Schema.Fields() {
 			nullable := ""
@@ -99,7 +255,7 @@ func displayInfoTable(info *lockbox.Info, filename string) error {
 	return nil
 }
 
-func displayInfoJSON(info *lockbox.Info) error {
+func displayInfoJSON(info *lockbox.Info, stats *lockbox.Stats, history []lockbox.ProvenanceEntry) error {
 	// Convert schema to a JSON-serializable format
 	type SchemaField struct {
 		Name     string `json:"name"`
@@ -119,18 +275,41 @@ func displayInfoJSON(info *lockbox.Info) error {
 	}
 
 	output := map[string]interface{}{
-		"version":     info.Version,
-		"createdBy":   info.CreatedBy,
-		"createdAt":   info.CreatedAt,
-		"modifiedBy":  info.ModifiedBy,
-		"modifiedAt":  info.ModifiedAt,
-		"blockCount":  info.BlockCount,
-		"accessCount": info.AccessCount,
+		"version":      info.Version,
+		"createdBy":    info.CreatedBy,
+		"createdAt":    info.CreatedAt,
+		"modifiedBy":   info.ModifiedBy,
+		"modifiedAt":   info.ModifiedAt,
+		"rowCount":     info.RowCount,
+		"segmentCount": info.SegmentCount,
+		"blockCount":   info.BlockCount,
+		"blockSize":    info.BlockSize,
+		"accessCount":  info.AccessCount,
+		"encryption": map[string]interface{}{
+			"algorithm":      info.Algorithm,
+			"keyDerivation":  info.KeyDerivation,
+			"kdfIterations":  info.KDFIterations,
+			"kdfMemoryKiB":   info.KDFMemory,
+			"kdfParallelism": info.KDFLanes,
+			"recipients":     info.Recipients,
+			"passwordSlot":   info.PasswordSlot,
+		},
+		"compression": info.Compression,
+		"metadata":    info.Metadata,
 		"schema": map[string]interface{}{
-			"fields": fields,
+			"version":   info.SchemaVersion,
+			"sortOrder": info.SortOrder,
+			"fields":    fields,
 		},
 	}
 
+	if stats != nil {
+		output["stats"] = stats
+	}
+	if history != nil {
+		output["history"] = history
+	}
+
 	jsonData, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+)
+
+// Magic bytes at the start of compressed streams
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// addInputCompressionFlag registers --input-compression on commands that
+// read CSV or JSON input
+func addInputCompressionFlag(cmd *cobra.Command) {
+	cmd.Flags().String("input-compression", "auto", "Input file compression (auto, gzip, zstd, none)")
+}
+
+// inputCompressionFromFlags reads and validates --input-compression
+func inputCompressionFromFlags(cmd *cobra.Command) (string, error) {
+	compression, _ := cmd.Flags().GetString("input-compression")
+	switch compression {
+	case "auto", "gzip", "zstd", "none":
+		return compression, nil
+	}
+	return "", fmt.Errorf("unsupported input compression %q (expected auto, gzip, zstd or none)", compression)
+}
+
+// decompressInput wraps r in a streaming decoder so compressed input is
+// never held in memory. With "auto" the codec is chosen from the file
+// extension, falling back to the leading magic bytes so compressed stdin is
+// recognized too.
+func decompressInput(r io.Reader, path, compression string) (io.ReadCloser, error) {
+	if compression == "auto" {
+		compression = compressionFromExt(path)
+	}
+	if compression == "auto" {
+		br := bufio.NewReader(r)
+		compression = sniffCompression(br)
+		r = br
+	}
+
+	switch compression {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip input: %w", err)
+		}
+		return zr, nil
+	case "zstd":
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zstd input: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// compressionFromExt maps a compressed file extension to its codec, or
+// returns "auto" when the extension says nothing
+func compressionFromExt(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	}
+	return "auto"
+}
+
+// sniffCompression inspects the first bytes of br without consuming them
+func sniffCompression(br *bufio.Reader) string {
+	head, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(head, zstdMagic):
+		return "zstd"
+	}
+	return "none"
+}
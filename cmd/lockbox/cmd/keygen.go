@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/spf13/cobra"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an identity for public-key encryption",
+	Long: `Generate an X25519 identity (private key) and print its recipient
+(public key).
+
+Share the recipient with whoever creates lockbox files for you
+(create --recipient); keep the identity file secret and pass it to
+--identity to open those files.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+
+		id, err := crypto.GenerateIdentity()
+		if err != nil {
+			return err
+		}
+		recipient := id.Recipient().String()
+		contents := fmt.Sprintf("# recipient: %s\n%s\n", recipient, id)
+
+		if output == "" {
+			fmt.Print(contents)
+			fmt.Fprintf(os.Stderr, "Recipient: %s\n", recipient)
+			return nil
+		}
+
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create identity file: %w", err)
+		}
+		if _, err := f.WriteString(contents); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write identity file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write identity file: %w", err)
+		}
+
+		fmt.Printf("Recipient: %s\n", recipient)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keygenCmd)
+
+	keygenCmd.Flags().StringP("output", "o", "", "Write the identity to this file (default stdout)")
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+)
+
+// lockOptions returns opts followed by the options that open a file in
+// mode, taking no lock while --no-lock or LOCKBOX_NO_LOCK=1 is in effect
+func lockOptions(mode lockbox.Mode, opts ...lockbox.Option) []lockbox.Option {
+	out := append([]lockbox.Option{}, opts...)
+	out = append(out, lockbox.WithMode(mode))
+	if noLock || os.Getenv("LOCKBOX_NO_LOCK") == "1" {
+		out = append(out, lockbox.WithNoLock())
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [output] [input...]",
+	Short: "Combine several lockbox files into one",
+	Long: `Combine several lockbox files into a new encrypted file.
+
+Every input must have the schema of the first one; pass --coerce to convert
+inputs whose schema differs but is convertible. The inputs are decrypted
+one segment at a time and each segment is re-encrypted into the output as
+it is read, so no input is ever held in memory in full.
+
+--password opens every input and encrypts the output. Give inputs their own
+password with --password-for in1.lbx=secret (repeatable); --identity keys
+are tried on every input. The output accepts the create flags --recipient,
+--cipher and --kdf-*.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, inputs := args[0], args[1:]
+
+		password, _ := cmd.Flags().GetString("password")
+		passwordFor, _ := cmd.Flags().GetStringArray("password-for")
+		recipientArgs, _ := cmd.Flags().GetStringArray("recipient")
+		coerce, _ := cmd.Flags().GetBool("coerce")
+		createdBy, _ := cmd.Flags().GetString("created-by")
+
+		if _, err := os.Stat(output); !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("output %s already exists", output)
+		}
+		perFile := make(map[string]string, len(passwordFor))
+		for _, arg := range passwordFor {
+			file, pw, ok := strings.Cut(arg, "=")
+			if !ok || file == "" {
+				return fmt.Errorf("invalid --password-for %q, expected file=password", arg)
+			}
+			if !slices.Contains(inputs, file) {
+				return fmt.Errorf("--password-for names %s, which is not an input", file)
+			}
+			perFile[file] = pw
+		}
+
+		schema, err := mergeSchema(inputs, coerce)
+		if err != nil {
+			return err
+		}
+
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+		pwOpts, err := passwordOptions(cmd, password)
+		if err != nil {
+			return err
+		}
+		credsFor := func(file string) []lockbox.Option {
+			if pw, ok := perFile[file]; ok {
+				return append(append([]lockbox.Option(nil), creds...), lockbox.WithPassword(pw))
+			}
+			return creds
+		}
+		// Without --password, --key-file or --password-env the output uses
+		// the prompted password
+		outCreds := pwOpts
+		if len(outCreds) == 0 {
+			outCreds = creds
+		}
+
+		opts := append(kdfOptions(cmd), cipherOptions(cmd)...)
+		opts = append(opts, lockbox.WithCreatedBy(createdBy))
+		opts = append(opts, outCreds...)
+		opts = append(opts, aadOptions(cmd)...)
+		for _, arg := range recipientArgs {
+			recipient, err := crypto.ParseRecipient(arg)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, lockbox.WithRecipient(recipient))
+		}
+
+		out, err := lockbox.Create(output, schema, lockOptions(lockbox.ReadWrite, opts...)...)
+		if err != nil {
+			return fmt.Errorf("failed to create lockbox: %w", err)
+		}
+		writeOpts := append([]lockbox.Option{lockbox.WithCoerce(coerce), lockbox.WithTool(cmd.CommandPath())}, outCreds...)
+		rows, err := mergeLockboxes(cmd.Context(), out, inputs, credsFor, writeOpts)
+		if err == nil {
+			err = out.Close()
+		} else {
+			out.Close()
+		}
+		if err != nil {
+			os.Remove(output)
+			if cmd.Context().Err() != nil {
+				reportInterrupted(output, true, 0)
+			}
+			return err
+		}
+
+		infof("Merged %d rows from %d files into %s\n", rows, len(inputs), output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringP("password", "p", "", "Password for the inputs and the output")
+	addCredentialFlags(mergeCmd)
+	mergeCmd.Flags().StringArray("password-for", []string{}, "Password for one input, file=password (repeatable)")
+	mergeCmd.Flags().StringArray("recipient", []string{}, "Public key allowed to open the output, from keygen (repeatable)")
+	mergeCmd.Flags().Bool("coerce", false, "Convert inputs whose schema differs from the first input's instead of rejecting them")
+	mergeCmd.Flags().String("created-by", "system", "Creator name")
+	addKDFFlags(mergeCmd)
+	addCipherFlag(mergeCmd)
+}
+
+// mergeSchema returns the schema of the first input after checking the
+// others match it. The schemas are stored in plaintext, so no password is
+// needed.
+func mergeSchema(inputs []string, coerce bool) (*arrow.Schema, error) {
+	var schema *arrow.Schema
+	for _, input := range inputs {
+		info, err := lockbox.ReadInfo(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", input, err)
+		}
+		if schema == nil {
+			schema = info.Schema
+			continue
+		}
+		if diff := lockbox.SchemaDiff(schema, info.Schema); len(diff) > 0 && !coerce {
+			return nil, fmt.Errorf("schema of %s differs from %s (pass --coerce to convert it): %w: %s", input, inputs[0], lockbox.ErrSchemaMismatch, strings.Join(diff, "; "))
+		}
+	}
+	return schema, nil
+}
+
+// mergeLockboxes streams every segment of each input into out, returning the
+// number of rows written. credsFor gives the options that open an input and
+// writeOpts those that write to out.
+func mergeLockboxes(ctx context.Context, out *lockbox.Lockbox, inputs []string, credsFor func(string) []lockbox.Option, writeOpts []lockbox.Option) (int64, error) {
+	var total int64
+	for _, input := range inputs {
+		rows, err := mergeLockbox(ctx, out, input, credsFor(input), writeOpts)
+		if err != nil {
+			return total, fmt.Errorf("failed to merge %s: %w", input, err)
+		}
+		log.Info().Str("input", input).Int64("rows", rows).Msg("Merged lockbox")
+		total += rows
+	}
+	return total, nil
+}
+
+// mergeLockbox copies one input into out segment by segment
+func mergeLockbox(ctx context.Context, out *lockbox.Lockbox, input string, creds []lockbox.Option, writeOpts []lockbox.Option) (int64, error) {
+	in, err := lockbox.Open(input, lockOptions(lockbox.ReadOnly, creds...)...)
+	if err != nil {
+		return 0, openError(input, err)
+	}
+	defer in.Close()
+
+	rr, err := in.NewReader(creds...)
+	if err != nil {
+		return 0, err
+	}
+	defer rr.Release()
+
+	var rows int64
+	for rr.Next() {
+		rec := rr.Record()
+		rec.Retain()
+		n := rec.NumRows()
+		if err := out.Write(ctx, rec, writeOpts...); err != nil {
+			rec.Release()
+			return rows, err
+		}
+		rows += n
+	}
+	return rows, rr.Err()
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// infof prints an informational message, such as a success line, to
+// stderr unless --quiet is set. Stdout is kept for data, so commands can be
+// piped.
+func infof(format string, args ...interface{}) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
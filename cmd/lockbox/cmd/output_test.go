@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureOutput runs fn with os.Stdout and os.Stderr redirected to files
+// and returns what was written to each
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	outFile, err := os.CreateTemp("", "test_stdout_*")
+	if err != nil {
+		t.Fatalf("create stdout file: %v", err)
+	}
+	defer os.Remove(outFile.Name())
+	errFile, err := os.CreateTemp("", "test_stderr_*")
+	if err != nil {
+		t.Fatalf("create stderr file: %v", err)
+	}
+	defer os.Remove(errFile.Name())
+
+	savedOut, savedErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outFile, errFile
+	defer func() { os.Stdout, os.Stderr = savedOut, savedErr }()
+	fn()
+	outFile.Close()
+	errFile.Close()
+
+	out, _ := os.ReadFile(outFile.Name())
+	errOut, _ := os.ReadFile(errFile.Name())
+	return string(out), string(errOut)
+}
+
+func TestInfofQuiet(t *testing.T) {
+	defer func() { quiet = false }()
+
+	stdout, stderr := captureOutput(t, func() { infof("Wrote %d rows\n", 3) })
+	if stdout != "" || stderr != "Wrote 3 rows\n" {
+		t.Fatalf("expected the message on stderr only, got stdout %q and stderr %q", stdout, stderr)
+	}
+
+	quiet = true
+	stdout, stderr = captureOutput(t, func() { infof("Wrote %d rows\n", 3) })
+	if stdout != "" || stderr != "" {
+		t.Fatalf("expected no output with --quiet, got stdout %q and stderr %q", stdout, stderr)
+	}
+}
+
+func TestOutputStreams(t *testing.T) {
+	tmpFile := "/tmp/test_output_streams.lbx"
+	os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+
+	run := func(args ...string) (string, string) {
+		return captureOutput(t, func() {
+			rootCmd.SetArgs(args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("%s: %v", args[0], err)
+			}
+		})
+	}
+	defer rootCmd.SetArgs(nil)
+
+	// Success lines go to stderr
+	stdout, stderr := run("create", tmpFile, "--password", "streams", "--kdf-memory", "8192")
+	if stdout != "" || !strings.Contains(stderr, "Successfully created lockbox") {
+		t.Fatalf("expected the success line on stderr only, got stdout %q and stderr %q", stdout, stderr)
+	}
+	stdout, stderr = run("write", tmpFile, "--sample", "--sample-rows", "3", "--password", "streams")
+	if stdout != "" {
+		t.Fatalf("expected nothing on stdout from write, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "Successfully wrote 3 rows") {
+		t.Fatalf("expected the success line on stderr, got %q", stderr)
+	}
+
+	// Exported rows go to stdout alone
+	stdout, stderr = run("export", tmpFile, "--password", "streams", "--columns", "id")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); len(lines) != 4 || lines[0] != "id" {
+		t.Fatalf("expected a header and 3 rows on stdout, got %q", stdout)
+	}
+	if stderr != "" {
+		t.Fatalf("expected nothing on stderr from export, got %q", stderr)
+	}
+}
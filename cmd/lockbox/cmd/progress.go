@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Update intervals for the redrawn bar and for plain log lines
+const (
+	progressBarInterval = 200 * time.Millisecond
+	progressLogInterval = 5 * time.Second
+)
+
+// progress reports rows processed, bytes read and throughput on stderr while
+// input loads. A nil *progress is valid and reports nothing, so loaders can
+// call it unconditionally.
+type progress struct {
+	rows  atomic.Int64
+	bytes atomic.Int64
+
+	out   io.Writer
+	tty   bool
+	start time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// addProgressFlag registers --progress on commands that load input
+func addProgressFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("progress", false, "Report rows, bytes read and rows/sec on stderr while loading")
+}
+
+// progressFromFlags starts a reporter when --progress is set without
+// --quiet, or returns nil
+func progressFromFlags(cmd *cobra.Command) *progress {
+	if enabled, _ := cmd.Flags().GetBool("progress"); !enabled || quiet {
+		return nil
+	}
+	return startProgress(os.Stderr, term.IsTerminal(int(os.Stderr.Fd())))
+}
+
+// startProgress begins periodic reports to out. On a terminal the line is
+// redrawn in place; otherwise a log line is emitted every few seconds.
+func startProgress(out io.Writer, tty bool) *progress {
+	p := &progress{out: out, tty: tty, start: time.Now(), stop: make(chan struct{})}
+	interval := progressLogInterval
+	if tty {
+		interval = progressBarInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastRows, lastTime := int64(0), p.start
+		for {
+			select {
+			case <-p.stop:
+				return
+			case now := <-ticker.C:
+				rows := p.rows.Load()
+				rate := float64(rows-lastRows) / now.Sub(lastTime).Seconds()
+				p.report(rows, rate, false)
+				lastRows, lastTime = rows, now
+			}
+		}
+	}()
+	return p
+}
+
+// reader counts the bytes read through r
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &p.bytes}
+}
+
+// addRows records n more rows processed
+func (p *progress) addRows(n int64) {
+	if p != nil {
+		p.rows.Add(n)
+	}
+}
+
+// finish stops the updates and reports the totals with the average rate.
+// Calls after the first do nothing.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+
+		rows := p.rows.Load()
+		p.report(rows, float64(rows)/time.Since(p.start).Seconds(), true)
+	})
+}
+
+// report writes one update. rate is rows per second.
+func (p *progress) report(rows int64, rate float64, final bool) {
+	bytes := p.bytes.Load()
+	if !p.tty {
+		log.Info().Int64("rows", rows).Int64("bytes", bytes).Float64("rows_per_sec", rate).Bool("done", final).Msg("Load progress")
+		return
+	}
+
+	end := ""
+	if final {
+		end = "\n"
+	}
+	// \r returns to the start of the line and \x1b[K clears what is left
+	fmt.Fprintf(p.out, "\r%d rows  %s read  %.0f rows/s\x1b[K%s", rows, formatBytes(bytes), rate, end)
+}
+
+// countingReader adds the size of every read to n
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestProgressCountsLoadedRows(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	input := "id\n1\n2\n3\n"
+
+	var out bytes.Buffer
+	p := startProgress(&out, true)
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), p.reader(strings.NewReader(input)), schema, lockbox.CSVReadOptions{}, p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	rec.Release()
+	p.finish()
+	p.finish()
+
+	if got := p.rows.Load(); got != 3 {
+		t.Fatalf("counted %d rows, want 3", got)
+	}
+	if got := p.bytes.Load(); got != int64(len(input)) {
+		t.Fatalf("counted %d bytes, want %d", got, len(input))
+	}
+	if !strings.Contains(out.String(), "3 rows  9 B read") || !strings.HasSuffix(out.String(), "\n") {
+		t.Fatalf("unexpected final report %q", out.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:       "0 B",
+		1023:    "1023 B",
+		1536:    "1.5 KiB",
+		5 << 20: "5.0 MiB",
+	}
+	for n, want := range cases {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -1,245 +1,144 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
-	"syscall"
-	"time"
 
 	"github.com/TFMV/lockbox/pkg/lockbox"
-	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 var queryCmd = &cobra.Command{
 	Use:   "query [lockbox-file]",
 	Short: "Query data from a lockbox file",
-	Long: `Query data from a lockbox file using SQL-like syntax.
+	Long: `Query data from a lockbox file using SQL-like syntax:
 
-This command provides basic querying capabilities to retrieve and filter data
-from encrypted lockbox files.`,
+  SELECT * | col, ... | AGG(col), ... [FROM name]
+      [WHERE cond [AND cond ...]]
+      [ORDER BY col [ASC|DESC], ...] [LIMIT n]
+
+Keywords are case-insensitive; column names and values are not. FROM is
+optional and its name ignored, since a query covers one file. Conditions
+take the form of --where on export (=, != on string columns, and =, !=, <,
+<=, >, >= on integer, float and timestamp columns), and quoted values may
+contain spaces. Nulls never match.
+
+Plain queries stream through the file like export: only the selected and
+filtered columns are decrypted, WHERE skips segments whose stored min/max
+rule out a match, and LIMIT stops reading once n rows are found.
+
+The aggregates COUNT(*), COUNT(col), SUM, AVG, MIN and MAX are computed
+over the filtered rows one segment at a time and cannot be mixed with
+plain columns. ORDER BY reads the filtered rows of the needed columns into
+memory and sorts them, with nulls last in either direction.
+
+--to selects the output: table (the default), csv, json, parquet or arrow,
+with --output and --binary-encoding as on export.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		filename := args[0]
 
 		sqlQuery, _ := cmd.Flags().GetString("sql")
-		columnsFlag, _ := cmd.Flags().GetString("columns")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
 		password, _ := cmd.Flags().GetString("password")
+		to, _ := cmd.Flags().GetString("to")
 		output, _ := cmd.Flags().GetString("output")
 
-		if columnsFlag != "" {
-			cols := strings.Split(columnsFlag, ",")
-			for i, c := range cols {
-				cols[i] = strings.TrimSpace(c)
-			}
-			if sqlQuery == "" || sqlQuery == "SELECT * FROM data" {
-				sqlQuery = fmt.Sprintf("SELECT %s FROM data", strings.Join(cols, ", "))
+		q, err := lockbox.ParseQuery(sqlQuery)
+		if err != nil {
+			return err
+		}
+		if len(columns) > 0 {
+			if len(q.Columns) > 0 || len(q.Aggregates) > 0 {
+				return fmt.Errorf("--columns only applies to SELECT *")
 			}
+			q.Columns = columns
 		}
 
-		// Get password if not provided
-		if password == "" {
-			fmt.Print("Enter password: ")
-			passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
-			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
-			}
-			password = string(passwordBytes)
-			fmt.Println() // New line after password input
+		binary, err := binaryEncodingFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		export, err := queryExporter(to, output, binary)
+		if err != nil {
+			return err
 		}
 
-		// Open the lockbox
-		lb, err := lockbox.Open(filename, lockbox.WithPassword(password))
+		// Prompt on stderr so stdout stays clean
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadOnly, creds...)...)
 		if err != nil {
 			return fmt.Errorf("failed to open lockbox: %w", err)
 		}
 		defer lb.Close()
 
-		ctx := context.Background()
-
-		// Execute query
-		result, err := lb.Query(ctx, sqlQuery, lockbox.WithPassword(password))
+		rr, err := lb.NewQueryReader(cmd.Context(), q, creds...)
 		if err != nil {
 			return fmt.Errorf("failed to execute query: %w", err)
 		}
-		defer result.Release()
-
-		// Output results
-		switch output {
-		case "json":
-			return outputJSON(result)
-		case "csv":
-			return outputCSV(result)
-		case "table":
-			return outputTable(result)
-		default:
-			return outputTable(result)
-		}
+		defer rr.Release()
+
+		return exportTo(output, rr, export)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(queryCmd)
 
-	queryCmd.Flags().StringP("sql", "q", "SELECT * FROM data", "SQL query to execute")
-	queryCmd.Flags().String("columns", "", "Column projection shorthand")
+	queryCmd.Flags().StringP("sql", "q", "SELECT *", "SQL query to execute")
+	queryCmd.Flags().StringSlice("columns", []string{}, "Column projection shorthand for SELECT * (comma separated)")
 	queryCmd.Flags().StringP("password", "p", "", "Password for decryption")
-	queryCmd.Flags().StringP("output", "o", "table", "Output format (table, json, csv)")
+	queryCmd.Flags().String("to", "table", "Output format (table, csv, json, parquet, arrow)")
+	queryCmd.Flags().StringP("output", "o", stdoutPath, "Output file, or - for stdout")
+	addBinaryEncodingFlag(queryCmd)
+	addCredentialFlags(queryCmd)
 }
 
-func outputTable(rec arrow.Record) error {
-	schema := rec.Schema()
-
-	// Print header
-	for i, field := range schema.Fields() {
-		if i > 0 {
-			fmt.Print("\t")
-		}
-		fmt.Print(field.Name)
+// queryExporter returns the exporter for a query output format, adding
+// table to the formats of export
+func queryExporter(to, output string, binary lockbox.BinaryEncoding) (func(io.Writer, array.RecordReader) error, error) {
+	if to == "table" {
+		return func(w io.Writer, rr array.RecordReader) error { return exportTable(w, rr, binary) }, nil
 	}
-	fmt.Println()
-
-	// Print separator
-	for i, field := range schema.Fields() {
-		if i > 0 {
-			fmt.Print("\t")
-		}
-		for range len(field.Name) {
-			fmt.Print("-")
-		}
-	}
-	fmt.Println()
-
-	// Print data rows
-	for i := int64(0); i < rec.NumRows(); i++ {
-		for j, col := range rec.Columns() {
-			if j > 0 {
-				fmt.Print("\t")
-			}
-			fmt.Printf("%v", getValue(col, int(i))) // ⬅️ THIS LINE is mandatory!
-		}
-		fmt.Println()
-	}
-
-	return nil
+	return exporterFor(to, output, binary)
 }
 
-// func outputTable(rec arrow.Record) error {
-// 	schema := rec.Schema()
-
-// 	// Print header
-// 	for i, field := range schema.Fields() {
-// 		if i > 0 {
-// 			fmt.Print("\t")
-// 		}
-// 		fmt.Print(field.Name)
-// 	}
-// 	fmt.Println()
-
-// 	// Print separator
-// 	for i, field := range schema.Fields() {
-// 		if i > 0 {
-// 			fmt.Print("\t")
-// 		}
-// 		for range len(field.Name) {
-// 			fmt.Print("-")
-// 		}
-// 	}
-// 	fmt.Println()
-
-// 	// Print data rows
-// 	for i := int64(0); i < rec.NumRows(); i++ {
-// 		for j, col := range rec.Columns() {
-// 			if j > 0 {
-// 				fmt.Print("\t")
-// 			}
-// 			fmt.Printf("%v", getValue(col, int(i)))
-// 		}
-// 		fmt.Println()
-// 	}
-
-// 	return nil
-// }
-
-func outputJSON(rec arrow.Record) error {
-	schema := rec.Schema()
-	fmt.Print("[")
-	for i := int64(0); i < rec.NumRows(); i++ {
-		if i > 0 {
-			fmt.Print(",")
-		}
-		fmt.Print("{")
-		for j, col := range rec.Columns() {
-			if j > 0 {
-				fmt.Print(",")
-			}
-			fmt.Printf("\"%s\":\"%v\"", schema.Field(j).Name, getValue(col, int(i)))
-		}
-		fmt.Print("}")
+// exportTable writes every record from rr as tab separated rows under a
+// header, with nulls as NULL
+func exportTable(w io.Writer, rr array.RecordReader, binary lockbox.BinaryEncoding) error {
+	fields := rr.Schema().Fields()
+	header := make([]string, len(fields))
+	rule := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.Name
+		rule[i] = strings.Repeat("-", len(f.Name))
 	}
-	fmt.Println("]")
-
-	return nil
-}
-
-func outputCSV(rec arrow.Record) error {
-	schema := rec.Schema()
-
-	// Print header
-	for i, field := range schema.Fields() {
-		if i > 0 {
-			fmt.Print(",")
-		}
-		fmt.Print(field.Name)
+	if _, err := fmt.Fprintf(w, "%s\n%s\n", strings.Join(header, "\t"), strings.Join(rule, "\t")); err != nil {
+		return err
 	}
-	fmt.Println()
 
-	// Print data - simplified for MVP
-	for i := int64(0); i < rec.NumRows(); i++ {
-		for j, col := range rec.Columns() {
-			if j > 0 {
-				fmt.Print(",")
+	row := make([]string, len(fields))
+	for rr.Next() {
+		rec := rr.Record()
+		for r := 0; r < int(rec.NumRows()); r++ {
+			for c, col := range rec.Columns() {
+				if col.IsNull(r) {
+					row[c] = "NULL"
+				} else {
+					row[c] = exportString(col, r, binary)
+				}
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+				return err
 			}
-			fmt.Printf("%v", getValue(col, int(i)))
-		}
-		fmt.Println()
-	}
-
-	return nil
-}
-
-func getValue(col arrow.Array, row int) interface{} {
-	if col.IsNull(row) {
-		return "NULL"
-	}
-	switch c := col.(type) {
-	case *array.Int64:
-		val := c.Value(row)
-		return val
-	case *array.Float64:
-		val := c.Value(row)
-		return val
-	case *array.String:
-		val := c.Value(row)
-		return val
-	case *array.Timestamp:
-		ts := c.Value(row)
-		switch typ := c.DataType().(*arrow.TimestampType); typ.Unit {
-		case arrow.Second:
-			return time.Unix(int64(ts), 0).UTC().Format(time.RFC3339)
-		case arrow.Millisecond:
-			return time.UnixMilli(int64(ts)).UTC().Format(time.RFC3339)
-		case arrow.Microsecond:
-			return time.UnixMicro(int64(ts)).UTC().Format(time.RFC3339)
-		case arrow.Nanosecond:
-			return time.Unix(0, int64(ts)).UTC().Format(time.RFC3339)
-		default:
-			return ts
 		}
-	default:
-		return "NULL"
 	}
+	return rr.Err()
 }
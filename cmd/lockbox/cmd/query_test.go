@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestQueryCommand(t *testing.T) {
+	tmpFile := "/tmp/test_query_command.lbx"
+	csvFile := "/tmp/test_query_command.csv"
+	os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+	defer os.Remove(csvFile)
+
+	csv := "id,name,email,age\n1,bob,bob@example.com,30\n2,alice,alice@example.com,\n3,bob smith,,52\n4,carol,carol@example.com,23\n"
+	if err := os.WriteFile(csvFile, []byte(csv), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	run := func(args ...string) string {
+		stdout, _ := captureOutput(t, func() {
+			rootCmd.SetArgs(args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("%s: %v", strings.Join(args, " "), err)
+			}
+		})
+		return stdout
+	}
+	defer rootCmd.SetArgs(nil)
+
+	run("create", tmpFile, "--password", "query", "--kdf-memory", "8192")
+	// Flags keep their values between Execute calls, so turn off the
+	// --sample an earlier test may have set
+	run("write", tmpFile, "--input", csvFile, "--format", "csv", "--sample=false", "--password", "query")
+
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT COUNT(*)", "count\n4\n"},
+		{"select max(age) from people where age >= 25 and id > 1", "max_age\n52\n"},
+		{"SELECT name WHERE age>=25 ORDER BY age", "name\nbob\nbob smith\n"},
+		{"SELECT id, age ORDER BY age DESC", "id,age\n3,52\n1,30\n4,23\n2,\n"},
+		{"SELECT id WHERE name = 'bob smith'", "id\n3\n"},
+	}
+	for _, tt := range tests {
+		if got := run("query", tmpFile, "--sql", tt.sql, "--to", "csv", "--password", "query"); got != tt.want {
+			t.Fatalf("%s: got %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
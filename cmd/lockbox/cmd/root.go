@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
 	"github.com/rs/zerolog"
@@ -10,8 +11,11 @@ import (
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile  string
+	verbose  bool
+	quiet    bool
+	noPython bool
+	noLock   bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -22,21 +26,42 @@ var rootCmd = &cobra.Command{
 zero-copy columnar data structures with enterprise-grade encryption.
 
 It provides developers with a "fast data, under lock and key" paradigm 
-that doesn't compromise on performance, security, or developer experience.`,
+that doesn't compromise on performance, security, or developer experience.
+
+Exit codes:
+  0   success
+  1   any other failure
+  2   wrong or missing password, or no identity matches a recipient
+  3   the file is corrupt or was tampered with
+  4   the input schema does not match the lockbox schema
+  64  invalid command line: unknown command or flag, wrong arguments or a
+      missing required flag
+  130 interrupted by Ctrl-C or SIGTERM`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		// Configure logging level
-		if verbose {
+		switch {
+		case verbose:
 			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		} else {
+		case quiet:
+			zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		default:
 			zerolog.SetGlobalLevel(zerolog.InfoLevel)
 		}
 	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		return checkAllocations()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Pass the error to ExitCode for the process exit code. The commands run
+// with a context that is cancelled on SIGINT or SIGTERM.
 func Execute() error {
-	return rootCmd.Execute()
+	markRunErrors(rootCmd)
+	ctx, stop := interruptContext(context.Background())
+	defer stop()
+	return rootCmd.ExecuteContext(ctx)
 }
 
 func init() {
@@ -45,6 +70,11 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.lockbox.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "suppress informational output and progress; warnings and errors are still logged")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	rootCmd.PersistentFlags().BoolVar(&noPython, "no-python", false, "never invoke python3 or pip (also LOCKBOX_NO_PYTHON=1)")
+	rootCmd.PersistentFlags().BoolVar(&noLock, "no-lock", false, "take no file locks, for network filesystems where they are unreliable (also LOCKBOX_NO_LOCK=1)")
+	rootCmd.PersistentFlags().BoolVar(&debugAllocator, "debug-allocator", false, "track Arrow allocations and fail on leaks at exit")
 
 	// Bind flags to viper
 	if err := viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose")); err != nil {
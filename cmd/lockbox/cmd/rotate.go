@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key [lockbox-file]",
+	Short: "Change the password of a lockbox file",
+	Long: `Change the password of a lockbox file without re-encrypting it.
+
+The file's data key is unwrapped with the old password and sealed again
+under the new one. Only the key slot in the metadata is rewritten, so
+rotation is fast even for large files. The file is left unchanged if the
+old password is wrong. Pass --kdf-* flags to move the new password to
+Argon2id or change its cost.
+
+Rotation does not change the data key itself: anyone who kept a copy of the
+file from before the rotation can still open that copy with the old password.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		oldPassword, _ := cmd.Flags().GetString("old-password")
+		newPassword, _ := cmd.Flags().GetString("new-password")
+
+		var err error
+		if oldPassword == "" {
+			if oldPassword, err = readPassword(os.Stderr, "Enter old password: ", "--old-password"); err != nil {
+				return err
+			}
+		}
+		if newPassword == "" {
+			if newPassword, err = readPassword(os.Stderr, "Enter new password: ", "--new-password"); err != nil {
+				return err
+			}
+		}
+		if newPassword == "" {
+			return fmt.Errorf("new password must not be empty")
+		}
+
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadWrite, append(aadOptions(cmd), lockbox.WithPassword(oldPassword))...)...)
+		if err != nil {
+			return fmt.Errorf("failed to open lockbox: %w", err)
+		}
+		defer lb.Close()
+
+		newOpts := append(kdfOptions(cmd), lockbox.WithPassword(newPassword))
+		if err := lb.RotateKey(lockbox.WithPassword(oldPassword), newOpts...); err != nil {
+			return err
+		}
+
+		if err := lb.Close(); err != nil {
+			return fmt.Errorf("failed to close lockbox: %w", err)
+		}
+		infof("Rotated password for %s\n", filename)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateKeyCmd)
+
+	rotateKeyCmd.Flags().String("old-password", "", "Current password")
+	rotateKeyCmd.Flags().String("new-password", "", "New password")
+	addKDFFlags(rotateKeyCmd)
+	addAADFlag(rotateKeyCmd)
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [lockbox-file]",
+	Short: "Print the schema of a lockbox file",
+	Long: `Print the schema a lockbox file expects, without a password.
+
+The schema is read from the file's metadata; no data is decrypted. The
+metadata is not encrypted or authenticated, so run verify before trusting it
+for anything security relevant.
+
+Output formats:
+- tree: human readable field list (default)
+- json: the JSON schema format accepted by create --schema
+- csv: a CSV header line, ready to prepend to data for write`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		var printSchema func(io.Writer, *arrow.Schema) error
+		switch format {
+		case "tree":
+			printSchema = printSchemaTree
+		case "json":
+			printSchema = printSchemaJSON
+		case "csv":
+			printSchema = printSchemaCSV
+		default:
+			return fmt.Errorf("unsupported format %q (expected tree, json or csv)", format)
+		}
+
+		info, err := lockbox.ReadInfo(filename)
+		if err != nil {
+			return err
+		}
+		if info.Schema == nil {
+			return fmt.Errorf("%s has no schema", filename)
+		}
+
+		if output == "" || output == stdoutPath {
+			return printSchema(os.Stdout, info.Schema)
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		if err := printSchema(f, info.Schema); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+
+	schemaCmd.Flags().StringP("format", "f", "tree", "Output format (tree, json, csv)")
+	schemaCmd.Flags().StringP("output", "o", "", "Write the schema to a file instead of stdout")
+}
+
+// printSchemaTree writes one line per field
+func printSchemaTree(w io.Writer, schema *arrow.Schema) error {
+	fmt.Fprintf(w, "schema (%d fields)\n", schema.NumFields())
+	for i, f := range schema.Fields() {
+		branch := "├──"
+		if i == schema.NumFields()-1 {
+			branch = "└──"
+		}
+		nullable := ""
+		if f.Nullable {
+			nullable = " (nullable)"
+		}
+		mime := ""
+		if m, ok := f.Metadata.GetValue("mime"); ok {
+			mime = fmt.Sprintf(" [mime: %s]", m)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s: %s%s%s\n", branch, f.Name, f.Type, nullable, mime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printSchemaJSON writes the schema in the format read by loadSchemaFromFile
+func printSchemaJSON(w io.Writer, schema *arrow.Schema) error {
+	out := SchemaJSON{Fields: make([]SchemaField, 0, schema.NumFields())}
+	for _, f := range schema.Fields() {
+		sf := SchemaField{Name: f.Name, Nullable: f.Nullable}
+		sf.Mime, _ = f.Metadata.GetValue("mime")
+
+		typ := f.Type
+		if dict, ok := typ.(*arrow.DictionaryType); ok {
+			sf.Dictionary = true
+			typ = dict.ValueType
+		}
+		sf.Type = schemaTypeName(typ)
+		switch t := typ.(type) {
+		case *arrow.Decimal128Type:
+			sf.Precision, sf.Scale = t.Precision, t.Scale
+		case *arrow.Decimal256Type:
+			sf.Precision, sf.Scale = t.Precision, t.Scale
+		case *arrow.FixedSizeBinaryType:
+			sf.ByteWidth = t.ByteWidth
+		}
+		out.Fields = append(out.Fields, sf)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// printSchemaCSV writes the field names as a CSV header line
+func printSchemaCSV(w io.Writer, schema *arrow.Schema) error {
+	names := make([]string, schema.NumFields())
+	for i, f := range schema.Fields() {
+		names[i] = f.Name
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(names); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// schemaTypeName returns the create --schema name for typ. Types that format
+// has no name for fall back to Arrow's own name.
+func schemaTypeName(typ arrow.DataType) string {
+	switch {
+	case arrow.TypeEqual(typ, arrow.PrimitiveTypes.Int64):
+		return "int64"
+	case arrow.TypeEqual(typ, arrow.PrimitiveTypes.Int32):
+		return "int32"
+	case arrow.TypeEqual(typ, arrow.PrimitiveTypes.Float64):
+		return "float64"
+	case arrow.TypeEqual(typ, arrow.PrimitiveTypes.Float32):
+		return "float32"
+	case arrow.TypeEqual(typ, arrow.BinaryTypes.String):
+		return "string"
+	case arrow.TypeEqual(typ, arrow.BinaryTypes.Binary):
+		return "binary"
+	case arrow.TypeEqual(typ, arrow.FixedWidthTypes.Date32):
+		return "date"
+	case arrow.TypeEqual(typ, arrow.FixedWidthTypes.Timestamp_s):
+		return "timestamp"
+	case arrow.TypeEqual(typ, arrow.FixedWidthTypes.Time32ms):
+		return "time"
+	case arrow.TypeEqual(typ, arrow.FixedWidthTypes.Duration_s):
+		return "duration"
+	case arrow.TypeEqual(typ, arrow.FixedWidthTypes.Boolean):
+		return "bool"
+	}
+	switch typ.(type) {
+	case *arrow.Decimal128Type:
+		return "decimal128"
+	case *arrow.Decimal256Type:
+		return "decimal256"
+	case *arrow.FixedSizeBinaryType:
+		return "fixed_size_binary"
+	}
+	return typ.String()
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+func TestSchemaJSONRoundTrip(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "status", Type: lockbox.DictionaryStringType, Nullable: true},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 12, Scale: 2}, Nullable: true},
+		{Name: "photo", Type: arrow.BinaryTypes.Binary, Nullable: true,
+			Metadata: arrow.NewMetadata([]string{"mime"}, []string{"image/png"})},
+	}, nil)
+
+	var buf bytes.Buffer
+	if err := printSchemaJSON(&buf, schema); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+
+	tmpFile := "/tmp/test_schema.json"
+	defer os.Remove(tmpFile)
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got, err := loadSchemaFromFile(tmpFile)
+	if err != nil {
+		t.Fatalf("load: %v\n%s", err, buf.String())
+	}
+	if !got.Equal(schema) {
+		t.Fatalf("schema mismatch:\nwant %v\ngot  %v", schema, got)
+	}
+
+	buf.Reset()
+	if err := printSchemaCSV(&buf, schema); err != nil {
+		t.Fatalf("print csv: %v", err)
+	}
+	if got := buf.String(); got != "id,status,amount,photo\n" {
+		t.Fatalf("unexpected csv header %q", got)
+	}
+}
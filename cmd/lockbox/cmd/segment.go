@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/spf13/cobra"
+)
+
+var segmentCmd = &cobra.Command{
+	Use:   "segment [lockbox-file]",
+	Short: "Decrypt and emit a single stored segment",
+	Long: `Decrypt and emit exactly one stored segment (row group) of a lockbox file.
+
+Each write or append stores its rows as a separate segment. This command
+exposes that physical layout for debugging: the selected segment is emitted
+as-is, without concatenation or row-level slicing.
+
+Output formats:
+- arrow: Arrow IPC stream (default)
+- table: tab separated rows`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		index, _ := cmd.Flags().GetInt("index")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		password, _ := cmd.Flags().GetString("password")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+
+		if format != "arrow" && format != "table" {
+			return fmt.Errorf("unsupported format %q (expected arrow or table)", format)
+		}
+
+		// Prompt on stderr so stdout stays clean
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		// Open the lockbox
+		lb, err := lockbox.Open(filename, lockOptions(lockbox.ReadOnly, creds...)...)
+		if err != nil {
+			return fmt.Errorf("failed to open lockbox: %w", err)
+		}
+		defer lb.Close()
+
+		rec, err := lb.ReadSegment(cmd.Context(), index, append(creds, lockbox.WithColumns(columns...))...)
+		if err != nil {
+			return err
+		}
+		defer rec.Release()
+
+		export := func(w io.Writer, rr array.RecordReader) error {
+			if !rr.Next() {
+				return rr.Err()
+			}
+			return writeArrowStream(w, rr.Record())
+		}
+		if format == "table" {
+			export = func(w io.Writer, rr array.RecordReader) error { return exportTable(w, rr, "") }
+		}
+		rr, err := array.NewRecordReader(rec.Schema(), []arrow.Record{rec})
+		if err != nil {
+			return err
+		}
+		defer rr.Release()
+		if output == "" {
+			output = stdoutPath
+		}
+		return exportTo(output, rr, export)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(segmentCmd)
+
+	segmentCmd.Flags().Int("index", 0, "Zero-based index of the segment to emit")
+	segmentCmd.Flags().String("format", "arrow", "Output format (arrow, table)")
+	segmentCmd.Flags().StringP("output", "o", "", "Output file (default stdout)")
+	segmentCmd.Flags().StringP("password", "p", "", "Password for decryption")
+	segmentCmd.Flags().StringSlice("columns", []string{}, "Only decrypt these columns (comma separated)")
+	addCredentialFlags(segmentCmd)
+}
+
+// writeArrowStream writes rec to w as an Arrow IPC stream
+func writeArrowStream(w io.Writer, rec arrow.Record) error {
+	writer := ipc.NewWriter(w, ipc.WithSchema(rec.Schema()))
+	if err := writer.Write(rec); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write arrow stream: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close arrow stream: %w", err)
+	}
+	return nil
+}
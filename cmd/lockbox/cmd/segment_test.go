@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestSegmentArrowStream(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_segment.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	segments := [][]int64{{1, 2, 3}, {10, 20}}
+	for _, ids := range segments {
+		b := array.NewInt64Builder(mem)
+		b.AppendValues(ids, nil)
+		arr := b.NewArray()
+		rec := array.NewRecord(schema, []arrow.Array{arr}, int64(len(ids)))
+		arr.Release()
+		b.Release()
+		if err := lb.Write(ctx, rec, lockbox.WithPassword(password)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	if lb.SegmentCount() != 2 {
+		t.Fatalf("expected 2 segments, got %d", lb.SegmentCount())
+	}
+
+	seg, err := lb.ReadSegment(ctx, 1, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	defer seg.Release()
+
+	var buf bytes.Buffer
+	if err := writeArrowStream(&buf, seg); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+
+	rdr, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("ipc reader: %v", err)
+	}
+	defer rdr.Release()
+
+	if !rdr.Next() {
+		t.Fatalf("expected a batch in the stream")
+	}
+	got := rdr.Record().Column(0).(*array.Int64).Int64Values()
+	if len(got) != 2 || got[0] != 10 || got[1] != 20 {
+		t.Fatalf("unexpected segment rows %v", got)
+	}
+	if rdr.Next() {
+		t.Fatalf("expected exactly one batch")
+	}
+
+	if _, err := lb.ReadSegment(ctx, 2, lockbox.WithPassword(password)); err == nil {
+		t.Fatalf("expected out of range error")
+	}
+}
+
+func TestSegmentTableOutput(t *testing.T) {
+	tmpFile := "/tmp/test_segment_table.lbx"
+	outFile := "/tmp/test_segment_table.txt"
+	os.Remove(tmpFile)
+	defer os.Remove(tmpFile)
+	defer os.Remove(outFile)
+
+	run := func(args ...string) string {
+		stdout, _ := captureOutput(t, func() {
+			rootCmd.SetArgs(args)
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("%s: %v", args[0], err)
+			}
+		})
+		return stdout
+	}
+	defer rootCmd.SetArgs(nil)
+
+	run("create", tmpFile, "--password", "segment", "--kdf-memory", "8192")
+	run("write", tmpFile, "--sample", "--sample-rows", "3", "--password", "segment")
+
+	stdout := run("segment", tmpFile, "--format", "table", "--output", outFile, "--columns", "id", "--password", "segment")
+	if stdout != "" {
+		t.Fatalf("expected nothing on stdout with --output, got %q", stdout)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 5 || lines[0] != "id" {
+		t.Fatalf("expected a header, separator and 3 rows in the output file, got %q", data)
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/flightserver"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve lockbox files over Arrow Flight",
+	Long: `Start an Arrow Flight server exposing the lockbox files under --root.
+
+Files are addressed by PATH descriptors relative to the root, e.g. the path
+["sales", "2024.lbx"] for sales/2024.lbx; paths never leave the root.
+ListFlights lists every .lbx file, and GetFlightInfo and GetSchema read the
+plaintext metadata without a password. DoGet streams the decrypted record
+batches of the file its ticket names, one segment at a time.
+
+Every call must carry the header "authorization: Bearer <token>", with the
+token read from --token-file or the environment variable named by
+--token-env. DoGet also needs the file password in the lockbox-password
+header; the server keeps no passwords. Use --tls-cert and --tls-key outside
+a trusted network, since otherwise tokens and passwords travel in plaintext.
+
+The server stops on Ctrl-C after the running streams finish.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, _ := cmd.Flags().GetString("addr")
+		root, _ := cmd.Flags().GetString("root")
+		tlsCert, _ := cmd.Flags().GetString("tls-cert")
+		tlsKey, _ := cmd.Flags().GetString("tls-key")
+
+		token, err := serveToken(cmd)
+		if err != nil {
+			return err
+		}
+
+		srv, err := flightserver.New(flightserver.Config{
+			Root:    root,
+			Token:   token,
+			TLSCert: tlsCert,
+			TLSKey:  tlsKey,
+			NoLock:  noLock || os.Getenv("LOCKBOX_NO_LOCK") == "1",
+		})
+		if err != nil {
+			return err
+		}
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		if tlsCert == "" {
+			log.Warn().Msg("Serving without TLS; tokens and passwords are sent in plaintext")
+		}
+		log.Info().Str("addr", lis.Addr().String()).Str("root", root).Msg("Serving lockbox files over Arrow Flight")
+
+		return srv.Serve(cmd.Context(), lis)
+	},
+}
+
+// serveToken reads the client token from --token-file or --token-env
+func serveToken(cmd *cobra.Command) (string, error) {
+	tokenFile, _ := cmd.Flags().GetString("token-file")
+	tokenEnv, _ := cmd.Flags().GetString("token-env")
+
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+		token := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return token, nil
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s is not set; a client token is required", tokenEnv)
+	}
+	return token, nil
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("addr", "localhost:8815", "Address to listen on")
+	serveCmd.Flags().String("root", ".", "Directory whose lockbox files are served")
+	serveCmd.Flags().String("token-env", "LOCKBOX_FLIGHT_TOKEN", "Read the client token from this environment variable")
+	serveCmd.Flags().String("token-file", "", "Read the client token from a file (one trailing newline is ignored)")
+	serveCmd.Flags().String("tls-cert", "", "PEM certificate for TLS")
+	serveCmd.Flags().String("tls-key", "", "PEM private key for TLS")
+	serveCmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestServeToken(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		c := &cobra.Command{Use: "serve"}
+		c.Flags().String("token-env", "TEST_LOCKBOX_FLIGHT_TOKEN", "")
+		c.Flags().String("token-file", "", "")
+		if err := c.Flags().Parse(args); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		return c
+	}
+
+	t.Setenv("TEST_LOCKBOX_FLIGHT_TOKEN", "")
+	if _, err := serveToken(newCmd()); err == nil {
+		t.Fatalf("expected an error without a token")
+	}
+
+	t.Setenv("TEST_LOCKBOX_FLIGHT_TOKEN", "from-env")
+	if token, err := serveToken(newCmd()); err != nil || token != "from-env" {
+		t.Fatalf("expected token from-env, got %q (%v)", token, err)
+	}
+
+	tokenFile := "/tmp/test_serve_token"
+	defer os.Remove(tokenFile)
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	if token, err := serveToken(newCmd("--token-file", tokenFile)); err != nil || token != "from-file" {
+		t.Fatalf("expected token from-file, got %q (%v)", token, err)
+	}
+}
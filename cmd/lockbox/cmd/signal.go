@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM, so a running command stops at its next consistent point and
+// rolls back. A second signal exits at once with ExitInterrupted. Call stop
+// to restore the default signal handling.
+func interruptContext(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		log.Warn().Msg("Interrupted, stopping after the current block; press Ctrl-C again to exit at once")
+		cancel()
+		select {
+		case <-signals:
+			log.Error().Msg("Interrupted again, exiting without cleaning up")
+			os.Exit(ExitInterrupted)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// reportInterrupted tells the user what an interrupted write left behind.
+// A file created for the write is removed; otherwise only the chunks
+// committed before the interrupt remain.
+func reportInterrupted(filename string, created bool, committed int64) {
+	switch {
+	case created:
+		log.Warn().Str("file", filename).Msg("Interrupted; removed the partially written new file")
+	case committed > 0:
+		log.Warn().Str("file", filename).Int64("rows", committed).Msg("Interrupted; kept the committed chunks, rerun with --resume to write the rest")
+	default:
+		log.Warn().Str("file", filename).Msg("Interrupted; rolled back, the file is unchanged")
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// addTimestampFlags registers --timestamp-format and --timezone
+func addTimestampFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("timestamp-format", []string{time.RFC3339}, "Go layout for timestamp values, e.g. \"2006-01-02 15:04:05\" (repeatable, tried in order)")
+	cmd.Flags().String("timezone", "UTC", "Time zone for timestamps without an offset, in text input and naive columns when coercing, e.g. Europe/London")
+}
+
+// timestampFlags reads the layouts of --timestamp-format and the location of
+// --timezone
+func timestampFlags(cmd *cobra.Command) ([]string, *time.Location, error) {
+	layouts, _ := cmd.Flags().GetStringArray("timestamp-format")
+	zone, _ := cmd.Flags().GetString("timezone")
+
+	loc := time.UTC
+	if zone != "" {
+		var err error
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return nil, nil, fmt.Errorf("invalid --timezone %q: %w", zone, err)
+		}
+	}
+	return layouts, loc, nil
+}
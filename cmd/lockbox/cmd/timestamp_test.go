@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestLoadCSVTimestampFormat(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ts", Type: arrow.FixedWidthTypes.Timestamp_s, Nullable: false},
+	}, nil)
+	opts := lockbox.CSVReadOptions{TimestampLayouts: []string{"2006-01-02 15:04:05"}}
+
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("ts\n2024-03-04 05:06:07\n"), schema, opts, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	want := arrow.Timestamp(time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix())
+	if got := rec.Column(0).(*array.Timestamp).Value(0); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// The default only accepts RFC3339
+	if _, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("ts\n2024-03-04 05:06:07\n"), schema, lockbox.CSVReadOptions{}, nil); err == nil {
+		t.Fatalf("expected the default layout to reject a naive timestamp")
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:     "update [lockbox-file]",
+	Aliases: []string{"edit"},
+	Short:   "Set column values in the rows matching a condition",
+	Long: `Set columns to new values in the rows matching every --where condition,
+for example
+
+  lockbox update orders.lbx --set status=closed --where id=42
+
+--set col=value is repeatable; values are parsed for the column type, and
+quotes around them are removed. --where takes the same conditions as
+export, such as "status='open'"; without it every row is updated.
+
+Blocks cannot be changed in place, so the file is decrypted and rewritten
+to a temporary file next to it that replaces the original once complete,
+like compact: an interrupted update leaves the file as it was.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename := args[0]
+
+		password, _ := cmd.Flags().GetString("password")
+		sets, _ := cmd.Flags().GetStringArray("set")
+		where, _ := cmd.Flags().GetStringArray("where")
+
+		values, err := parseAssignments(sets)
+		if err != nil {
+			return err
+		}
+		opts, err := whereOptions(where)
+		if err != nil {
+			return err
+		}
+
+		creds, err := credentialOptions(cmd, password, os.Stderr)
+		if err != nil {
+			return err
+		}
+		report, err := lockbox.Update(cmd.Context(), filename, values, lockOptions(lockbox.ReadWrite, append(opts, creds...)...)...)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", filename, err)
+		}
+
+		infof("Updated %d of %d rows in %s\n", report.Matched, report.Rows, filename)
+		return nil
+	},
+}
+
+// parseAssignments splits --set arguments such as "status=closed" into
+// column names and values. Quotes around a value are removed.
+func parseAssignments(args []string) (map[string]string, error) {
+	values := make(map[string]string, len(args))
+	for _, arg := range args {
+		col, value, ok := strings.Cut(arg, "=")
+		col = strings.TrimSpace(col)
+		if !ok || col == "" {
+			return nil, fmt.Errorf("invalid --set %q, expected column=value", arg)
+		}
+		if _, dup := values[col]; dup {
+			return nil, fmt.Errorf("column %s is set more than once", col)
+		}
+		values[col] = strings.Trim(strings.TrimSpace(value), `'"`)
+	}
+	return values, nil
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+
+	updateCmd.Flags().StringP("password", "p", "", "Password for the lockbox")
+	updateCmd.Flags().StringArray("set", nil, "Set a column in matching rows, e.g. status=closed (repeatable)")
+	updateCmd.Flags().StringArray("where", nil, `Only update rows matching a condition, e.g. "id=42" (repeatable)`)
+	updateCmd.MarkFlagRequired("set")
+	addCredentialFlags(updateCmd)
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import "testing"
+
+func TestParseAssignments(t *testing.T) {
+	values, err := parseAssignments([]string{"status='closed'", " note = a=b "})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if values["status"] != "closed" || values["note"] != "a=b" {
+		t.Fatalf("unexpected values %v", values)
+	}
+
+	for _, args := range [][]string{{"status"}, {"=closed"}, {"a=1", "a=2"}} {
+		if _, err := parseAssignments(args); err == nil {
+			t.Fatalf("expected error for %q", args)
+		}
+	}
+}
@@ -2,31 +2,37 @@ package cmd
 
 import (
 	"context"
-	"encoding/csv"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"github.com/TFMV/lockbox/pkg/format"
 	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/TFMV/lockbox/pkg/store"
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
 	"github.com/apache/arrow-go/v18/arrow/memory"
-	"github.com/apache/arrow-go/v18/parquet/file"
-	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
-
-	"golang.org/x/term"
 )
 
 var writeCmd = &cobra.Command{
-	Use:   "write [lockbox-file]",
+	Use:   "write [lockbox-file] [-]",
 	Short: "Write data to a lockbox file",
 	Long: `Write data to a lockbox file from various input sources.
 
@@ -34,80 +40,470 @@ Supported input formats:
 - CSV files
 - JSON files  
 - Parquet files (future)
-- Sample data generation`,
-	Args: cobra.ExactArgs(1),
+- Arrow IPC streams and files (Feather v2), converted to the lockbox schema
+- Avro object container files, converted to the lockbox schema
+- Sample data generation
+
+Use "-" as the input (--input - or a trailing "-" argument) to read CSV or
+JSON from stdin. JSON is either an array of objects or newline-delimited
+objects (NDJSON), told apart by the first byte; both are decoded one object
+at a time, so the input is never held in memory as Go values.
+
+Gzip and zstd compressed CSV or JSON (e.g. data.csv.gz, data.json.zst) is
+decompressed while streaming. The codec is detected from the extension or
+the leading magic bytes; use --input-compression to force it.
+
+--blob doc=scan.pdf fills the doc column with the file's contents. Alone it
+writes a single row (--format blob is optional); with --input, every input
+row gets the blob and the input supplies the other columns. --blob takes
+precedence: CSV, JSON and ORC input is read without the blob columns, and
+an Arrow column with the same name is replaced.
+
+--blob-dir doc=scans/ stores each file in the directory as its own row,
+with the file's contents in doc and its name in the --blob-name-field
+column (default filename). Filter the files with --blob-glob '*.pdf'.
+
+--create creates the file first when it does not exist, from --schema or
+from the schema of a local CSV (inferred from --infer-rows rows), Arrow or
+Avro input, accepting the create flags --dictionary-encode, --created-by,
+--cipher and --kdf-*. An existing file is opened as usual.
+
+--meta source=crm stores a property with the file, merged with the ones
+already there. Properties are shown by lockbox info. They are not
+encrypted, but they are authenticated with the file key, so lockbox verify
+reports any change made without it.
+
+--chunk-rows N writes the input N rows at a time. Each chunk is committed
+with a record of the rows written so far, so if the write is interrupted,
+rerunning it with --resume skips the committed rows and continues. A crash
+never leaves a partial chunk in the file: uncommitted data is ignored by
+readers and removed the next time the file is opened for writing.
+
+--sort-by date,id sorts the input before it is encrypted, so each segment
+holds a contiguous range of keys: it compresses better and --where skips
+more segments. With --chunk-rows each chunk is sorted on its own; add
+--spill-dir to sort the whole input across chunks, using sorted runs of
+--chunk-rows rows spilled to that directory and merged. CSV input is read
+a run at a time, so it need not fit in memory, and the runs are encrypted
+with a key that is never stored. The sort order is recorded in the file
+and shown by lockbox info while every segment is sorted by it.
+
+A file that already holds rows is only written with --append (or
+--force), so rerunning an ingest by mistake does not add its rows twice;
+--resume continues an interrupted chunked write without either.
+
+--shards 4 --output-pattern 'out-%03d.lbx' splits the input into 4 new
+lockbox files instead of writing one. Shard i holds the i-th contiguous
+range of rows, of nearly equal size, so merging the shards in index order
+restores the input; each opens on its own and records its index and the
+shard count in the shard and shards properties. The schema comes from
+--schema or the input as with --create, and no shard file may exist yet.
+
+--dry-run loads and checks the whole input against the lockbox schema,
+reporting the row count or the first problem, without encrypting or
+writing anything. It reads the schema from the file, so no password is
+needed.
+
+--coerce converts input whose schema differs from the lockbox schema,
+matching columns by position: numeric columns are cast, strings convert
+to and from dictionaries, timestamps convert between zones and units
+keeping each instant, nullable columns without nulls become non-nullable
+and extra input columns are dropped. Naive timestamps are wall clock times
+in --timezone (default UTC). Each change
+is logged with --verbose; lossy ones (narrowing, float truncation, dropped
+columns) are always logged as warnings, and --strict-coerce rejects them.
+
+CSV and JSON input can be narrowed with --skip-rows and --limit-rows, which
+stops reading once the limit is reached. --max-errors N skips up to N
+invalid CSV rows, and --error-log records each one's line, column, value
+and expected type. --null-string NA reads matching CSV fields as null, with
+--trim ignoring surrounding whitespace. --timestamp-format adds Go layouts
+for timestamp values; values without an offset are read in the column's
+time zone, or else --timezone.
+
+--block-size N splits the input into segments of N rows, committed
+together; with --create it is also recorded as the file's block size.
+--parallelism bounds how many column blocks are compressed and encrypted
+at once.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// --output-pattern names the files, so only "-" may be given
+		if pattern, _ := cmd.Flags().GetString("output-pattern"); pattern != "" {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		filename := args[0]
+		ctx := cmd.Context()
 
 		inputFile, _ := cmd.Flags().GetString("input")
 		password, _ := cmd.Flags().GetString("password")
 		sampleData, _ := cmd.Flags().GetBool("sample")
 		format, _ := cmd.Flags().GetString("format")
 		blobArgs, _ := cmd.Flags().GetStringArray("blob")
-
-		// Make sure pyarrow is installed
-		if err := ensurePyarrowInstalled(); err != nil {
-			return fmt.Errorf("could not ensure pyarrow is installed: %v", err)
+		blobDir, _ := cmd.Flags().GetString("blob-dir")
+		shards, _ := cmd.Flags().GetInt("shards")
+		pattern, _ := cmd.Flags().GetString("output-pattern")
+
+		// With --shards the files come from --output-pattern, which also
+		// stands in for the file name in messages
+		filename := pattern
+		if pattern == "" {
+			filename, args = args[0], args[1:]
+		}
+		if len(args) == 1 {
+			if args[0] != stdinPath || inputFile != "" {
+				return fmt.Errorf("unexpected argument %q; use --input for files", args[0])
+			}
+			inputFile = stdinPath
+		}
+		var shardFiles []string
+		if shards > 0 || pattern != "" {
+			if shards < 1 || pattern == "" {
+				return fmt.Errorf("--shards and --output-pattern must be given together")
+			}
+			for _, name := range []string{"chunk-rows", "resume", "spill-dir"} {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s cannot be combined with --shards", name)
+				}
+			}
+			files, err := shardPaths(pattern, shards)
+			if err != nil {
+				return err
+			}
+			shardFiles = files
+		}
+		writeOpts, err := compressionOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		parallelism, _ := cmd.Flags().GetInt("parallelism")
+		writeOpts = append(writeOpts, lockbox.WithParallelism(parallelism))
+		writeOpts = append(writeOpts, blockSizeOptions(cmd)...)
+		writeOpts = append(writeOpts, lockbox.WithTool(cmd.CommandPath()))
+		var meta map[string]string
+		if metaArgs, _ := cmd.Flags().GetStringArray("meta"); len(metaArgs) > 0 {
+			for _, arg := range metaArgs {
+				if k, _, ok := strings.Cut(arg, "="); !ok || k == "" {
+					return fmt.Errorf("invalid --meta %q, expected key=value", arg)
+				}
+			}
+			meta = parseKeyValueArgs(metaArgs)
+			writeOpts = append(writeOpts, lockbox.WithMetadata(meta))
+		}
+		sortBy, _ := cmd.Flags().GetStringSlice("sort-by")
+		spillDir, _ := cmd.Flags().GetString("spill-dir")
+		if len(sortBy) > 0 {
+			writeOpts = append(writeOpts, lockbox.WithSortBy(sortBy...))
+		}
+		inputCompression, err := inputCompressionFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		coerce, _ := cmd.Flags().GetBool("coerce")
+		strictCoerce, _ := cmd.Flags().GetBool("strict-coerce")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		_, zone, err := timestampFlags(cmd)
+		if err != nil {
+			return err
+		}
+		writeOpts = append(writeOpts, lockbox.WithTimestampTimezone(zone))
+
+		// With --create a missing file is created from --schema or a schema
+		// inferred from the input
+		var newSchema *arrow.Schema
+		if shards > 0 {
+			if newSchema, err = writeCreateSchema(cmd, inputFile, format); err != nil {
+				return err
+			}
+		} else if create, _ := cmd.Flags().GetBool("create"); create {
+			if store.IsRemote(filename) {
+				return fmt.Errorf("--create needs a local file; use lockbox create for %s", filename)
+			}
+			if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+				if newSchema, err = writeCreateSchema(cmd, inputFile, format); err != nil {
+					return err
+				}
+			}
 		}
 
-		// Get password if not provided
-		if password == "" {
-			fmt.Print("Enter password: ")
-			passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+		var (
+			lb      *lockbox.Lockbox
+			creds   []lockbox.Option
+			schema  *arrow.Schema
+			written bool
+			// committed counts the rows of chunks written before a failure
+			committed int64
+		)
+		if dryRun && newSchema != nil {
+			schema = newSchema
+		} else if dryRun {
+			// The schema is stored in plaintext, so validating input needs
+			// no password
+			info, err := lockbox.ReadInfo(filename)
+			if err != nil {
+				return err
+			}
+			schema = info.Schema
+		} else if shards > 0 {
+			if err := checkStdinPassword(cmd, password, append(blobArgs, inputFile)...); err != nil {
+				return err
+			}
+			if creds, err = newCredentialOptions(cmd, password, os.Stderr); err != nil {
+				return err
+			}
+			// The shards are created once the input is loaded
+			schema = newSchema
+		} else {
+			if err := checkStdinPassword(cmd, password, append(blobArgs, inputFile)...); err != nil {
+				return err
+			}
+			if newSchema != nil {
+				creds, err = newCredentialOptions(cmd, password, os.Stderr)
+			} else {
+				creds, err = credentialOptions(cmd, password, os.Stderr)
+			}
 			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
+				return err
 			}
-			password = string(passwordBytes)
-			fmt.Println() // New line after password input
+
+			if newSchema != nil {
+				lb, err = lockbox.Create(filename, newSchema, lockOptions(lockbox.ReadWrite, append(writeCreateOptions(cmd), creds...)...)...)
+				if err != nil {
+					return fmt.Errorf("failed to create lockbox: %w", err)
+				}
+				log.Info().Str("file", filename).Int("fields", len(newSchema.Fields())).Msg("Created lockbox")
+				// Do not leave an empty file behind if loading or writing fails
+				defer func() {
+					if !written {
+						lb.Close()
+						os.Remove(filename)
+					}
+				}()
+			} else {
+				lb, err = lockbox.Open(filename, lockOptions(lockbox.ReadWrite, creds...)...)
+				if err != nil {
+					return openError(filename, err)
+				}
+			}
+			defer lb.Close()
+			defer func() {
+				if !written && ctx.Err() != nil {
+					reportInterrupted(filename, newSchema != nil, committed)
+				}
+			}()
+			schema = lb.Schema()
 		}
 
-		// Open the lockbox
-		lb, err := lockbox.Open(filename, lockbox.WithPassword(password))
-		if err != nil {
-			return fmt.Errorf("failed to open lockbox: %w", err)
+		// Chunked ingests record their progress so --resume can continue
+		// after the last committed chunk
+		chunkRows, _ := cmd.Flags().GetInt("chunk-rows")
+		resume, _ := cmd.Flags().GetBool("resume")
+		if chunkRows < 0 {
+			return fmt.Errorf("--chunk-rows must not be negative, got %d", chunkRows)
+		}
+		var fingerprint string
+		var resumeFrom int64
+		if chunkRows > 0 || resume {
+			if inputFile == "" || inputFile == stdinPath || store.IsRemote(inputFile) {
+				return fmt.Errorf("--chunk-rows and --resume need a local --input file")
+			}
+			if fingerprint, err = ingestFingerprint(inputFile); err != nil {
+				return err
+			}
+		}
+		if spillDir != "" {
+			if len(sortBy) == 0 || chunkRows == 0 {
+				return fmt.Errorf("--spill-dir needs --sort-by and --chunk-rows")
+			}
+			// Chunks of a globally sorted input only line up on resume if
+			// it is sorted the same way
+			fingerprint = sortedFingerprint(fingerprint, sortBy)
+		}
+		if resume && lb != nil {
+			state, ok := lb.IngestState()
+			if !ok || state.Fingerprint != fingerprint {
+				return fmt.Errorf("no interrupted ingest of %s to resume in %s", inputFile, filename)
+			}
+			if state.Complete {
+				written = true
+				infof("%s was already fully written to %s\n", inputFile, filename)
+				return nil
+			}
+			resumeFrom = state.Rows
+			log.Info().Int64("rows", resumeFrom).Msg("Resuming after committed rows")
+		} else if lb != nil {
+			appendRows, _ := cmd.Flags().GetBool("append")
+			force, _ := cmd.Flags().GetBool("force")
+			if err := checkWriteTarget(filename, lb, appendRows || force); err != nil {
+				return err
+			}
 		}
-		defer lb.Close()
 
-		blobMap := parseBlobArgs(blobArgs)
+		blobMap := parseKeyValueArgs(blobArgs)
+		blobs := make(map[string]io.Reader, len(blobMap))
+		for field, path := range blobMap {
+			in, err := openInput(path)
+			if err != nil {
+				return fmt.Errorf("read blob %s: %w", field, err)
+			}
+			defer in.Close()
+			blobs[field] = in
+		}
 
-		ctx := context.Background()
+		// With --input, blob fields come from --blob and the input supplies
+		// the rest
+		inputSchema := schema
+		if inputFile != "" && len(blobs) > 0 {
+			inputSchema = withoutFields(schema, blobMap)
+		}
+
+		mem := commandAllocator()
+		writeOpts = append(writeOpts, lockbox.WithAllocator(mem))
+		p := progressFromFlags(cmd)
+		defer p.finish()
+
+		// writeSpilled writes the runs merged for --spill-dir, each record
+		// committed as one chunk
+		writeSpilled := func(sorted array.RecordReader) error {
+			rows, err := writeSorted(ctx, lb, sorted, resumeFrom, fingerprint, append(writeOpts, creds...))
+			sorted.Release()
+			committed = rows
+			if err != nil {
+				return err
+			}
+			if err := lb.Close(); err != nil {
+				return fmt.Errorf("failed to close lockbox: %w", err)
+			}
+			written = true
+			p.finish()
+			infof("Successfully wrote %d rows to %s\n", rows, filename)
+			return nil
+		}
 
 		var record arrow.Record
 
 		if sampleData {
 			// Generate sample data
-			record, err = generateSampleData(lb.Schema())
+			sampleOpts, err := sampleOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			record, err = generateSampleData(mem, schema, sampleOpts)
 			if err != nil {
 				return fmt.Errorf("failed to generate sample data: %w", err)
 			}
-		} else if len(blobMap) > 0 && format == "blob" {
-			record, err = loadBlobRecord(blobMap, lb.Schema())
+		} else if len(blobs) > 0 && inputFile == "" {
+			record, err = lockbox.LoadBlobRecord(blobs, schema, lockbox.ReadOptions{Allocator: mem})
 			if err != nil {
 				return fmt.Errorf("failed to load blob data: %w", err)
 			}
+		} else if blobDir != "" {
+			field, dir, ok := strings.Cut(blobDir, "=")
+			if !ok || field == "" || dir == "" {
+				return fmt.Errorf("--blob-dir must be field=directory, got %q", blobDir)
+			}
+			glob, _ := cmd.Flags().GetString("blob-glob")
+			nameField, _ := cmd.Flags().GetString("blob-name-field")
+			record, err = loadBlobDir(ctx, mem, schema, blobDirOptions{Field: field, Dir: dir, Glob: glob, NameField: nameField})
+			if err != nil {
+				return fmt.Errorf("failed to load blob directory: %w", err)
+			}
 		} else if inputFile != "" && format == "csv" {
 			// Load data from file
-			record, err = loadDataFromFile(inputFile, lb.Schema())
+			csvOpts, err := csvOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			errLog, err := openErrorLog(cmd)
+			if err != nil {
+				return err
+			}
+			if errLog != nil {
+				defer errLog.Close()
+				csvOpts.ErrorLog = errLog
+			}
+			if spillDir != "" && !dryRun && len(blobs) == 0 {
+				// The runs are spilled as the input is read, so it is
+				// never loaded whole
+				var sorted array.RecordReader
+				_, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+					csvOpts.Allocator = mem
+					csvOpts.OnRows = p.addRows
+					rr, err := lockbox.NewCSVReader(ctx, p.reader(r), inputSchema, csvOpts)
+					if err != nil {
+						return nil, err
+					}
+					defer rr.Release()
+					sorted, err = lockbox.SortSpilled(ctx, rr, sortBy, chunkRows, spillDir, lockbox.WithAllocator(mem))
+					return nil, err
+				})
+				if err != nil {
+					return fmt.Errorf("failed to sort input: %w", err)
+				}
+				return writeSpilled(sorted)
+			}
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadCSV(ctx, mem, p.reader(r), inputSchema, csvOpts, p)
+			})
 			if err != nil {
 				return fmt.Errorf("failed to load data from file: %w", err)
 			}
 		} else if inputFile != "" && format == "json" {
+			jsonOpts, err := jsonOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
 			// Load data from file
-			record, err = loadDataFromJSON(inputFile, lb.Schema())
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadJSON(ctx, mem, p.reader(r), inputSchema, jsonOpts, p)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to load data from file: %w", err)
+			}
+		} else if inputFile != "" && (format == "arrow" || format == "feather") {
+			// Arrow input carries its own schema; convert it to the lockbox's
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadArrow(ctx, mem, p.reader(r), p)
+			})
 			if err != nil {
 				return fmt.Errorf("failed to load data from file: %w", err)
 			}
+			coerce = true
+		} else if inputFile != "" && format == "avro" {
+			// Avro input carries its own schema too
+			record, err = loadInput(inputFile, inputCompression, func(r io.Reader) (arrow.Record, error) {
+				return loadAvro(ctx, mem, p.reader(r), p)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to load data from file: %w", err)
+			}
+			coerce = true
 		} else if inputFile != "" && format == "orc" {
+			// Make sure pyarrow is installed
+			if err := ensurePyarrowInstalled(); err != nil {
+				return fmt.Errorf("could not ensure pyarrow is installed: %w", err)
+			}
+
 			outputfile := strings.TrimSuffix(inputFile, ".orc") + ".parquet"
 
 			// Convert ORC to Parquet using Python script
 			// Note: This requires a Python script `orc2parquet.py` that uses pyarrow to convert ORC to Parquet
 			if err := convertORCtoParquet(inputFile, outputfile); err != nil {
-				return fmt.Errorf("conversion failed: %v", err)
+				return fmt.Errorf("conversion failed: %w", err)
+			}
+
+			if lenient, _ := cmd.Flags().GetBool("lenient"); !lenient {
+				if err := checkParquetSchema(outputfile, inputSchema, nil); err != nil {
+					return err
+				}
 			}
 
 			// Load data from parquet file
-			record, err = loadDataFromORCToParquet(outputfile, lb.Schema())
+			threads, _ := cmd.Flags().GetInt("threads")
+			if threads < 1 {
+				return fmt.Errorf("--threads must be at least 1")
+			}
+			record, err = loadDataFromORCToParquet(ctx, mem, outputfile, inputSchema, threads, zone, p)
 			if err != nil {
 				return fmt.Errorf("failed to load data from file: %w", err)
 			}
@@ -116,14 +512,87 @@ Supported input formats:
 			return fmt.Errorf("either --input or --sample must be specified")
 		}
 
-		// Write the data
-		if err := lb.Write(ctx, record, lockbox.WithPassword(password)); err != nil {
+		if inputFile != "" && len(blobs) > 0 {
+			withBlobs, err := addBlobColumns(mem, schema, record, blobs)
 			record.Release()
-			return fmt.Errorf("failed to write data: %w", err)
+			if err != nil {
+				return fmt.Errorf("failed to add blob columns: %w", err)
+			}
+			record = withBlobs
+		}
+
+		if dryRun {
+			defer record.Release()
+			if err := checkRecordSchema(schema, record, coerce, strictCoerce, zone); err != nil {
+				return err
+			}
+			p.finish()
+			infof("Dry run: %d rows validated against the schema of %s; nothing was written\n", record.NumRows(), filename)
+			return nil
 		}
 
+		// Write the data, converted to the lockbox schema
+		conformed, err := conformRecord(schema, record, coerce, strictCoerce, zone)
 		record.Release()
-		fmt.Printf("Successfully wrote %d rows to %s\n", record.NumRows(), filename)
+		if err != nil {
+			return err
+		}
+		record = conformed
+		if shards > 0 {
+			n := record.NumRows()
+			err := writeShards(ctx, record, schema, shardFiles, append(writeCreateOptions(cmd), creds...), append(writeOpts, creds...), meta)
+			record.Release()
+			if err != nil {
+				if ctx.Err() != nil {
+					reportInterrupted(pattern, true, 0)
+				}
+				return err
+			}
+			p.finish()
+			infof("Successfully wrote %d rows to %d shards %s\n", n, shards, pattern)
+			return nil
+		}
+		if spillDir != "" {
+			rr, err := array.NewRecordReader(record.Schema(), []arrow.Record{record})
+			record.Release()
+			if err != nil {
+				return err
+			}
+			sorted, err := lockbox.SortSpilled(ctx, rr, sortBy, chunkRows, spillDir, lockbox.WithAllocator(mem))
+			rr.Release()
+			if err != nil {
+				return fmt.Errorf("failed to sort input: %w", err)
+			}
+			return writeSpilled(sorted)
+		}
+		if fingerprint != "" {
+			rows, err := writeChunks(ctx, lb, record, resumeFrom, chunkRows, fingerprint, append(writeOpts, creds...))
+			record.Release()
+			committed = rows
+			if err != nil {
+				return err
+			}
+			if err := lb.Close(); err != nil {
+				return fmt.Errorf("failed to close lockbox: %w", err)
+			}
+			written = true
+			p.finish()
+			infof("Successfully wrote %d rows to %s\n", rows, filename)
+			return nil
+		}
+		if err := lb.Write(ctx, record, append(writeOpts, creds...)...); err != nil {
+			record.Release()
+			return fmt.Errorf("failed to write data: %w", err)
+		}
+
+		// Close before reporting success: for object store URIs this uploads
+		// the file
+		if err := lb.Close(); err != nil {
+			return fmt.Errorf("failed to close lockbox: %w", err)
+		}
+		written = true
+		p.finish()
+		infof("Successfully wrote %d rows to %s\n", record.NumRows(), filename)
 
 		return nil
 	},
@@ -132,34 +601,386 @@ Supported input formats:
 func init() {
 	rootCmd.AddCommand(writeCmd)
 
-	writeCmd.Flags().StringP("input", "i", "", "Input data file (CSV, JSON)")
-	writeCmd.Flags().StringP("format", "f", "", "Input data format (csv, json)")
+	writeCmd.Flags().StringP("input", "i", "", "Input data file (CSV, JSON), or - for stdin")
+	writeCmd.Flags().StringP("format", "f", "", "Input data format (csv, json, arrow, avro)")
 	writeCmd.Flags().StringP("password", "p", "", "Password for encryption")
+	addCredentialFlags(writeCmd)
 	writeCmd.Flags().Bool("sample", false, "Generate sample data")
+	writeCmd.Flags().Int("sample-rows", 5, "Number of rows to generate with --sample")
+	writeCmd.Flags().Int64("sample-seed", 0, "Random seed for --sample (default: time-based)")
 	writeCmd.Flags().StringArray("blob", []string{}, "Blob field mapping field=file")
+	writeCmd.Flags().String("blob-dir", "", "Load one row per file in a directory, field=dir/")
+	writeCmd.Flags().String("blob-glob", "*", "Only load --blob-dir files matching this pattern, e.g. '*.pdf'")
+	writeCmd.Flags().String("blob-name-field", "filename", "String field that receives each --blob-dir file name")
+	addInputCompressionFlag(writeCmd)
+	writeCmd.Flags().String("delimiter", ",", "CSV field delimiter (single character, \\t for tab)")
+	writeCmd.Flags().Bool("no-header", false, "CSV input has no header row; columns map to schema fields by position")
+	writeCmd.Flags().Bool("strict-columns", false, "Map CSV columns to schema fields by position, not by header name")
+	writeCmd.Flags().Bool("strict-header", false, "Fail when the CSV header does not match the schema field names, instead of warning")
+	addNullStringFlags(writeCmd)
+	writeCmd.Flags().String("compression", "none", "Block compression codec (none, zstd, lz4, snappy)")
+	writeCmd.Flags().Int("compression-level", 0, "Zstandard compression level 1-19 (0 for the codec default)")
+	writeCmd.Flags().StringArray("column-compression", []string{}, "Per-column compression codec col=codec")
+	writeCmd.Flags().Int("parallelism", 0, "Column blocks to compress and encrypt at once (0 for GOMAXPROCS)")
+	writeCmd.Flags().Int("threads", 1, "Parquet row groups to decode at once for ORC input")
+	writeCmd.Flags().Bool("lenient", false, "Skip the upfront check of ORC input columns against the schema and coerce batch by batch")
+	addBlockSizeFlag(writeCmd, "Rows per segment for this write, also recorded by --create (default: the file's block size, else one segment)")
+	addRowWindowFlags(writeCmd)
+	addTimestampFlags(writeCmd)
+	addBinaryEncodingFlag(writeCmd)
+	addCSVErrorFlags(writeCmd)
+	addProgressFlag(writeCmd)
+	writeCmd.Flags().Bool("coerce", false, "Convert input whose schema differs from the lockbox schema instead of rejecting it")
+	writeCmd.Flags().Bool("strict-coerce", false, "Reject conversions that can lose data, such as narrowing or float truncation")
+	writeCmd.Flags().Bool("dry-run", false, "Load and validate the whole input against the schema without encrypting or writing")
+	writeCmd.Flags().Int("chunk-rows", 0, "Write the input in chunks of this many rows, committing progress after each (0 writes it at once)")
+	writeCmd.Flags().Bool("resume", false, "Continue an interrupted chunked write of the same input after its last committed chunk")
+	writeCmd.Flags().StringSlice("sort-by", []string{}, "Sort the input by these columns before encrypting, e.g. date,id")
+	writeCmd.Flags().String("spill-dir", "", "Sort the whole chunked input with sorted runs spilled to this directory (needs --sort-by and --chunk-rows)")
+	writeCmd.Flags().StringArray("meta", []string{}, "Store a key=value property such as source=crm with the file (repeatable, authenticated but not encrypted)")
+	writeCmd.Flags().Int("shards", 0, "Split the input into this many new lockbox files of nearly equal row counts (needs --output-pattern)")
+	writeCmd.Flags().String("output-pattern", "", "File name pattern for --shards with one integer verb for the shard index, e.g. out-%03d.lbx")
+	writeCmd.Flags().Bool("create", false, "Create the lockbox first if it does not exist")
+	writeCmd.Flags().Bool("append", false, "Add the rows to a lockbox that already holds rows")
+	writeCmd.Flags().Bool("force", false, "Write even if the lockbox already holds rows (same as --append)")
+	writeCmd.Flags().StringP("schema", "s", "", "JSON schema file for --create (default: inferred from CSV or Arrow input)")
+	writeCmd.Flags().Int("infer-rows", 100, "Number of CSV rows sampled to infer the --create schema")
+	writeCmd.Flags().StringSlice("dictionary-encode", []string{}, "Dictionary encode these string columns of the --create schema")
+	writeCmd.Flags().String("created-by", "system", "Creator name recorded by --create")
+	addKDFFlags(writeCmd)
+	addCipherFlag(writeCmd)
+}
+
+// checkWriteTarget refuses to write to a lockbox that already holds rows
+// unless allowed
+func checkWriteTarget(filename string, lb *lockbox.Lockbox, allowed bool) error {
+	info, err := lb.Info()
+	if err != nil {
+		return err
+	}
+	if info.RowCount > 0 && !allowed {
+		return fmt.Errorf("%s already holds %d rows; pass --append to add to them, or use lockbox append", filename, info.RowCount)
+	}
+	return nil
+}
+
+// writeChunks writes the rows of record from start on, chunkRows at a time
+// (the rest at once when zero). Each chunk commits the ingest progress with
+// its blocks, so an interrupted write can be resumed after the last chunk.
+// It returns the number of rows written.
+func writeChunks(ctx context.Context, lb *lockbox.Lockbox, record arrow.Record, start int64, chunkRows int, fingerprint string, opts []lockbox.Option) (int64, error) {
+	n := record.NumRows()
+	size := int64(chunkRows)
+	if size <= 0 {
+		size = n - start
+	}
+
+	var written int64
+	for off := start; off < n; off += size {
+		end := min(off+size, n)
+		state := lockbox.IngestState{Fingerprint: fingerprint, Rows: end, Complete: end == n}
+		chunkOpts := append([]lockbox.Option{lockbox.WithIngestState(state)}, opts...)
+		chunk := record.NewSlice(off, end)
+		if err := lb.Write(ctx, chunk, chunkOpts...); err != nil {
+			chunk.Release()
+			return written, fmt.Errorf("failed to write rows %d-%d: %w", off+1, end, err)
+		}
+		written += end - off
+		log.Debug().Int64("rows", end).Int64("total", n).Msg("Committed chunk")
+	}
+	return written, nil
+}
+
+// writeSorted writes the records of sorted from row start on. Each record
+// is committed as one chunk with the ingest progress, like writeChunks;
+// the next record is read before a chunk is written so the last one can be
+// marked complete. It returns the number of rows written.
+func writeSorted(ctx context.Context, lb *lockbox.Lockbox, sorted array.RecordReader, start int64, fingerprint string, opts []lockbox.Option) (int64, error) {
+	var off, written int64
+	var prev arrow.Record
+	defer func() {
+		if prev != nil {
+			prev.Release()
+		}
+	}()
+	// commit writes prev, the last record of the input when last is set
+	commit := func(last bool) error {
+		rec := prev
+		prev = nil
+		defer rec.Release()
+		end := off + rec.NumRows()
+		if end > start {
+			from := max(start-off, 0)
+			state := lockbox.IngestState{Fingerprint: fingerprint, Rows: end, Complete: last}
+			chunkOpts := append([]lockbox.Option{lockbox.WithIngestState(state)}, opts...)
+			chunk := rec.NewSlice(from, rec.NumRows())
+			if err := lb.Write(ctx, chunk, chunkOpts...); err != nil {
+				chunk.Release()
+				return fmt.Errorf("failed to write rows %d-%d: %w", off+from+1, end, err)
+			}
+			written += end - off - from
+			log.Debug().Int64("rows", end).Msg("Committed chunk")
+		}
+		off = end
+		return nil
+	}
+	for sorted.Next() {
+		if prev != nil {
+			if err := commit(false); err != nil {
+				return written, err
+			}
+		}
+		prev = sorted.Record()
+		prev.Retain()
+	}
+	if err := sorted.Err(); err != nil {
+		return written, err
+	}
+	if prev != nil {
+		if err := commit(true); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// sortedFingerprint ties an ingest fingerprint to the sort order of the
+// input
+func sortedFingerprint(fingerprint string, sortBy []string) string {
+	sum := sha256.Sum256([]byte(fingerprint + "\x00" + strings.Join(sortBy, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ingestFingerprint identifies an input by its absolute path, size and
+// modification time, so --resume only continues an ingest of the same,
+// unchanged file
+func ingestFingerprint(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat input: %w", err)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", abs, st.Size(), st.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// writeCreateSchema returns the schema for write --create: the --schema
+// file, or one inferred from a local CSV, Arrow or Avro input file
+func writeCreateSchema(cmd *cobra.Command, inputFile, format string) (*arrow.Schema, error) {
+	schemaFile, _ := cmd.Flags().GetString("schema")
+	dictColumns, _ := cmd.Flags().GetStringSlice("dictionary-encode")
+
+	var schema *arrow.Schema
+	var err error
+	switch {
+	case schemaFile != "":
+		schema, err = loadSchemaFromFile(schemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load schema: %w", err)
+		}
+	case inputFile != "" && inputFile != stdinPath && (format == "arrow" || format == "feather"):
+		schema, err = loadArrowSchema(inputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to infer schema: %w", err)
+		}
+	case inputFile != "" && inputFile != stdinPath && format == "avro":
+		schema, err = loadAvroSchema(inputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to infer schema: %w", err)
+		}
+	case inputFile != "" && inputFile != stdinPath && format == "csv" && compressionFromExt(inputFile) == "auto":
+		rows, _ := cmd.Flags().GetInt("infer-rows")
+		schema, err = lockbox.DetectCSVSchema(inputFile, rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to infer schema: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("--create needs --schema unless the input is a local uncompressed CSV, Arrow or Avro file")
+	}
+	return lockbox.DictionaryEncode(schema, dictColumns...)
+}
+
+// writeCreateOptions returns the create flags of write as lockbox options
+func writeCreateOptions(cmd *cobra.Command) []lockbox.Option {
+	createdBy, _ := cmd.Flags().GetString("created-by")
+	opts := append(kdfOptions(cmd), cipherOptions(cmd)...)
+	opts = append(opts, lockbox.WithCreatedBy(createdBy))
+	return append(opts, blockSizeOptions(cmd)...)
+}
+
+// Properties that record a file's place in a write --shards split
+const (
+	shardProperty  = "shard"
+	shardsProperty = "shards"
+)
+
+// shardPaths returns the n file names from an --output-pattern, which must
+// number them with one integer verb. Existing files are refused, since the
+// shards are created from scratch.
+func shardPaths(pattern string, n int) ([]string, error) {
+	if store.IsRemote(pattern) {
+		return nil, fmt.Errorf("--shards needs local files; got %s", pattern)
+	}
+	first := fmt.Sprintf(pattern, 0)
+	if strings.Contains(first, "%!") || first == fmt.Sprintf(pattern, 1) {
+		return nil, fmt.Errorf("--output-pattern %q must contain one integer verb for the shard index, e.g. out-%%03d.lbx", pattern)
+	}
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = fmt.Sprintf(pattern, i)
+		if _, err := os.Stat(paths[i]); !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("shard %s already exists", paths[i])
+		}
+	}
+	return paths, nil
+}
+
+// writeShards splits record into len(paths) contiguous row ranges of nearly
+// equal size and writes range i to a new lockbox at paths[i], so merging the
+// shards in order restores the input. Each shard's properties hold meta
+// plus its index and the shard count. If any shard fails, the ones already
+// created are removed.
+func writeShards(ctx context.Context, record arrow.Record, schema *arrow.Schema, paths []string, createOpts, writeOpts []lockbox.Option, meta map[string]string) (err error) {
+	var created []string
+	defer func() {
+		if err != nil {
+			for _, path := range created {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	n, count := record.NumRows(), int64(len(paths))
+	for i, path := range paths {
+		props := maps.Clone(meta)
+		if props == nil {
+			props = map[string]string{}
+		}
+		props[shardProperty] = strconv.Itoa(i)
+		props[shardsProperty] = strconv.Itoa(len(paths))
+
+		lb, err := lockbox.Create(path, schema, lockOptions(lockbox.ReadWrite, createOpts...)...)
+		if err != nil {
+			return fmt.Errorf("failed to create shard %s: %w", path, err)
+		}
+		created = append(created, path)
+		lo, hi := n*int64(i)/count, n*int64(i+1)/count
+		shard := record.NewSlice(lo, hi)
+		err = lb.Write(ctx, shard, append(writeOpts, lockbox.WithMetadata(props))...)
+		if err == nil {
+			err = lb.Close()
+		} else {
+			shard.Release()
+			lb.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write shard %s: %w", path, err)
+		}
+		log.Info().Str("file", path).Int64("rows", hi-lo).Msg("Wrote shard")
+	}
+	return nil
+}
+
+// openError explains why an existing lockbox could not be opened
+func openError(filename string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("lockbox %s does not exist; create it with lockbox create or pass --create: %w", filename, err)
+	case errors.Is(err, lockbox.ErrWrongPassword):
+		return fmt.Errorf("failed to open lockbox %s: the password or key is wrong; change it with lockbox rotate-key: %w", filename, err)
+	}
+	return fmt.Errorf("failed to open lockbox: %w", err)
+}
+
+// checkRecordSchema reports whether Write would accept record: its schema
+// must match, or be convertible when coerce is set, without loss when
+// strict is set
+func checkRecordSchema(schema *arrow.Schema, record arrow.Record, coerce, strict bool, zone *time.Location) error {
+	conformed, err := conformRecord(schema, record, coerce, strict, zone)
+	if err != nil {
+		return err
+	}
+	conformed.Release()
+	return nil
+}
+
+// conformRecord returns record converted to schema, reading naive
+// timestamps in zone and logging each conversion. Without coerce any
+// difference is an error, and with strict so is a lossy conversion.
+func conformRecord(schema *arrow.Schema, record arrow.Record, coerce, strict bool, zone *time.Location) (arrow.Record, error) {
+	diff := lockbox.SchemaDiff(schema, record.Schema())
+	if len(diff) == 0 {
+		record.Retain()
+		return record, nil
+	}
+	if !coerce {
+		return nil, fmt.Errorf("%w: %s", lockbox.ErrSchemaMismatch, strings.Join(diff, "; "))
+	}
+	coerced, notes, err := lockbox.CoerceRecordVerbose(schema, record, lockbox.WithTimestampTimezone(zone))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", lockbox.ErrSchemaMismatch, err)
+	}
+	var lossy []string
+	for _, note := range notes {
+		if note.Lossy {
+			lossy = append(lossy, note.String())
+			log.Warn().Str("column", note.Column).Str("change", note.Change).Msg("Lossy coercion")
+		} else {
+			log.Debug().Str("column", note.Column).Str("change", note.Change).Msg("Coerced column")
+		}
+	}
+	if strict && len(lossy) > 0 {
+		coerced.Release()
+		return nil, fmt.Errorf("%w: lossy coercion refused by --strict-coerce: %s", lockbox.ErrSchemaMismatch, strings.Join(lossy, "; "))
+	}
+	return coerced, nil
+}
+
+// execCommand is swapped out in tests to observe external process use.
+var execCommand = exec.Command
+
+// errPythonDisabled is returned when a code path would shell out to Python
+// while --no-python or LOCKBOX_NO_PYTHON=1 is in effect.
+var errPythonDisabled = errors.New("python execution disabled by --no-python; convert the file to Parquet and use 'lockbox append --format parquet' instead")
+
+// pythonAllowed reports whether external python3/pip invocations are permitted.
+func pythonAllowed() error {
+	if noPython || os.Getenv("LOCKBOX_NO_PYTHON") == "1" {
+		return errPythonDisabled
+	}
+	return nil
 }
 
 func convertORCtoParquet(orcFile, parquetFile string) error {
-	cmd := exec.Command("python3", "orc2parquet.py", orcFile, parquetFile)
+	if err := pythonAllowed(); err != nil {
+		return err
+	}
+	cmd := execCommand("python3", "orc2parquet.py", orcFile, parquetFile)
 	out, err := cmd.CombinedOutput()
-	fmt.Printf("Python conversion output: %s\n", string(out))
 	if err != nil {
-		return fmt.Errorf("ORC to Parquet conversion failed: %w", err)
+		return fmt.Errorf("ORC to Parquet conversion failed: %w: %s", err, strings.TrimSpace(string(out)))
 	}
+	log.Debug().Str("output", string(out)).Msg("Converted ORC to Parquet with Python")
 	return nil
 }
 
 // Check and install pyarrow if not present
 func ensurePyarrowInstalled() error {
+	if err := pythonAllowed(); err != nil {
+		return err
+	}
 	// Try to import pyarrow.orc, fail if not available
-	checkCmd := exec.Command("python3", "-c", "import pyarrow.orc, pyarrow.parquet")
+	checkCmd := execCommand("python3", "-c", "import pyarrow.orc, pyarrow.parquet")
 	if err := checkCmd.Run(); err == nil {
 		return nil // Already installed!
 	}
-	fmt.Println("pyarrow not found. Installing pyarrow with pip...")
+	log.Info().Msg("pyarrow not found, installing it with pip")
 
 	// Try pip3 first
-	installCmd := exec.Command("pip3", "install", "--user", "pyarrow")
+	installCmd := execCommand("pip3", "install", "--user", "pyarrow")
 	installCmd.Stdout = nil // or os.Stdout if you want to show output
 	installCmd.Stderr = nil
 	if err := installCmd.Run(); err == nil {
@@ -167,559 +988,746 @@ func ensurePyarrowInstalled() error {
 	}
 
 	// Fallback to pip if pip3 fails
-	installCmd = exec.Command("pip", "install", "--user", "pyarrow")
+	installCmd = execCommand("pip", "install", "--user", "pyarrow")
 	if err := installCmd.Run(); err != nil {
 		return fmt.Errorf("failed to install pyarrow: %w", err)
 	}
 	return nil
 }
 
-func concatRecords(mem memory.Allocator, schema *arrow.Schema, records ...arrow.Record) (arrow.Record, error) {
-	if len(records) == 0 {
-		return nil, nil
+// sampleNullEvery controls how often nullable sample fields are null; on
+// average one row in sampleNullEvery is null.
+const sampleNullEvery = 4
+
+// sampleOptions controls generated sample data
+type sampleOptions struct {
+	// Rows is the number of rows to generate
+	Rows int
+	// Seed drives the random source, making output reproducible
+	Seed int64
+}
+
+// generateSampleData creates sample Arrow data matching the schema
+func generateSampleData(mem memory.Allocator, schema *arrow.Schema, opts sampleOptions) (arrow.Record, error) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	// Create arrays for each field
+	var arrays []arrow.Array
+	release := func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
 	}
 
-	numFields := len(schema.Fields())
-	concatArrays := make([]arrow.Array, numFields)
+	numRows := opts.Rows
 
-	for i := 0; i < numFields; i++ {
-		var arraysToConcat []arrow.Array
-		for _, rec := range records {
-			arraysToConcat = append(arraysToConcat, rec.Column(i))
+	for _, field := range schema.Fields() {
+		if _, ok := field.Type.(*arrow.DictionaryType); !ok && !isSampleType(field.Type) {
+			release()
+			return nil, fmt.Errorf("unsupported sample type %s for %s", field.Type, field.Name)
 		}
-		out, err := array.Concatenate(arraysToConcat, mem)
-		if err != nil {
-			// Release any arrays already created
-			for _, arr := range concatArrays {
-				if arr != nil {
-					arr.Release()
-				}
+		builder := array.NewBuilder(mem, field.Type)
+
+		for i := 0; i < numRows; i++ {
+			if field.Nullable && rng.Intn(sampleNullEvery) == 0 {
+				builder.AppendNull()
+				continue
+			}
+			if err := appendSampleValue(builder, field, rng); err != nil {
+				builder.Release()
+				release()
+				return nil, fmt.Errorf("sample value for %s: %w", field.Name, err)
 			}
-			return nil, err
 		}
-		concatArrays[i] = out
+		arrays = append(arrays, builder.NewArray())
+		builder.Release()
 	}
+	record := array.NewRecord(schema, arrays, int64(numRows))
 
-	// Count total rows
-	var totalRows int64
-	for _, rec := range records {
-		totalRows += rec.NumRows()
+	// Release individual arrays
+	release()
+
+	return record, nil
+}
+
+// isSampleType reports whether appendSampleValue has a dedicated generator for typ
+func isSampleType(typ arrow.DataType) bool {
+	switch typ.(type) {
+	case *arrow.Int64Type, *arrow.Int32Type, *arrow.Int16Type, *arrow.Int8Type,
+		*arrow.Uint64Type, *arrow.Uint32Type, *arrow.Uint16Type, *arrow.Uint8Type,
+		*arrow.StringType, *arrow.Float64Type, *arrow.Float32Type, *arrow.Decimal128Type,
+		*arrow.Decimal256Type, *arrow.FixedSizeBinaryType, *arrow.BinaryType,
+		*arrow.BooleanType, *arrow.TimestampType, *arrow.Date32Type:
+		return true
 	}
+	return false
+}
 
-	rec := array.NewRecord(schema, concatArrays, totalRows)
-	for _, arr := range concatArrays {
-		arr.Release()
+// appendSampleValue appends one random value for field to builder
+func appendSampleValue(builder array.Builder, field arrow.Field, rng *rand.Rand) error {
+	switch b := builder.(type) {
+	case *array.Int64Builder:
+		b.Append(rng.Int63n(1000000) + 1)
+
+	case *array.Int32Builder:
+		b.Append(int32(18 + rng.Intn(63)))
+
+	case *array.Int16Builder:
+		b.Append(int16(rng.Intn(math.MaxInt16)))
+
+	case *array.Int8Builder:
+		b.Append(int8(rng.Intn(math.MaxInt8)))
+
+	case *array.Uint64Builder:
+		b.Append(rng.Uint64())
+
+	case *array.Uint32Builder:
+		b.Append(rng.Uint32())
+
+	case *array.Uint16Builder:
+		b.Append(uint16(rng.Intn(math.MaxUint16 + 1)))
+
+	case *array.Uint8Builder:
+		b.Append(uint8(rng.Intn(math.MaxUint8 + 1)))
+
+	case *array.StringBuilder:
+		n := rng.Intn(10000)
+		if field.Name == "name" {
+			b.Append(fmt.Sprintf("User%d", n))
+		} else if field.Name == "email" {
+			b.Append(fmt.Sprintf("user%d@example.com", n))
+		} else {
+			b.Append(fmt.Sprintf("sample_%s_%d", field.Name, n))
+		}
+
+	case *array.Float64Builder:
+		b.Append(float64(rng.Intn(100000)) / 100)
+
+	case *array.Float32Builder:
+		b.Append(float32(rng.Intn(10000)) / 100)
+
+	case *array.Decimal128Builder:
+		typ := field.Type.(*arrow.Decimal128Type)
+		b.Append(decimal128.FromI64(rng.Int63n(sampleDecimalBound(typ.Precision))))
+
+	case *array.Decimal256Builder:
+		typ := field.Type.(*arrow.Decimal256Type)
+		b.Append(decimal256.FromI64(rng.Int63n(sampleDecimalBound(typ.Precision))))
+
+	case *array.FixedSizeBinaryBuilder:
+		value := make([]byte, field.Type.(*arrow.FixedSizeBinaryType).ByteWidth)
+		rng.Read(value)
+		b.Append(value)
+
+	case *array.BinaryBuilder:
+		value := make([]byte, 8)
+		rng.Read(value)
+		b.Append(value)
+
+	case *array.BooleanBuilder:
+		b.Append(rng.Intn(2) == 0)
+
+	case *array.TimestampBuilder:
+		ts, err := arrow.TimestampFromTime(sampleTime(rng), field.Type.(*arrow.TimestampType).Unit)
+		if err != nil {
+			return err
+		}
+		b.Append(ts)
+
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(sampleTime(rng)))
+
+	case *array.BinaryDictionaryBuilder:
+		typ := field.Type.(*arrow.DictionaryType)
+		if typ.ValueType.ID() != arrow.STRING {
+			return fmt.Errorf("unsupported dictionary value type: %v", typ.ValueType)
+		}
+		return b.AppendString(fmt.Sprintf("%s_%d", field.Name, rng.Intn(2)))
+
+	default:
+		return fmt.Errorf("unsupported sample type: %v", field.Type)
 	}
-	return rec, nil
+	return nil
 }
 
-// generateSampleData creates sample Arrow data matching the schema
-func generateSampleData(schema *arrow.Schema) (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
+// sampleTime returns a random time in 2024, to the second
+func sampleTime(rng *rand.Rand) time.Time {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return start.Add(time.Duration(rng.Int63n(366*24*3600)) * time.Second)
+}
 
-	// Create arrays for each field
-	var arrays []arrow.Array
+// sampleDecimalBound returns an exclusive bound for unscaled sample values
+// that always fits within precision digits.
+func sampleDecimalBound(precision int32) int64 {
+	bound := int64(1)
+	for i := int32(0); i < precision && i < 6; i++ {
+		bound *= 10
+	}
+	return bound
+}
 
-	numRows := 5 // Generate 5 sample rows
+// sampleOptionsFromFlags builds sampleOptions from the --sample-rows and
+// --sample-seed flags. Without an explicit seed, output varies per run.
+func sampleOptionsFromFlags(cmd *cobra.Command) (sampleOptions, error) {
+	rows, _ := cmd.Flags().GetInt("sample-rows")
+	seed, _ := cmd.Flags().GetInt64("sample-seed")
 
-	for _, field := range schema.Fields() {
-		switch field.Type {
-		case arrow.PrimitiveTypes.Int64:
-			builder := array.NewInt64Builder(mem)
-			for i := 0; i < numRows; i++ {
-				builder.Append(int64(i + 1))
-			}
-			arrays = append(arrays, builder.NewArray())
-			builder.Release()
-
-		case arrow.PrimitiveTypes.Int32:
-			builder := array.NewInt32Builder(mem)
-			for i := 0; i < numRows; i++ {
-				builder.Append(int32(20 + i))
-			}
-			arrays = append(arrays, builder.NewArray())
-			builder.Release()
-
-		case arrow.BinaryTypes.String:
-			builder := array.NewStringBuilder(mem)
-			for i := 0; i < numRows; i++ {
-				if field.Name == "name" {
-					builder.Append(fmt.Sprintf("User%d", i+1))
-				} else if field.Name == "email" {
-					builder.Append(fmt.Sprintf("user%d@example.com", i+1))
-				} else {
-					builder.Append(fmt.Sprintf("sample_%s_%d", field.Name, i+1))
-				}
-			}
-			arrays = append(arrays, builder.NewArray())
-			builder.Release()
+	if rows <= 0 {
+		return sampleOptions{}, fmt.Errorf("--sample-rows must be positive, got %d", rows)
+	}
+	if !cmd.Flags().Changed("sample-seed") {
+		seed = time.Now().UnixNano()
+	}
+	return sampleOptions{Rows: rows, Seed: seed}, nil
+}
 
-		case arrow.PrimitiveTypes.Float64:
-			builder := array.NewFloat64Builder(mem)
-			for i := 0; i < numRows; i++ {
-				builder.Append(float64(i) * 1.5)
-			}
-			arrays = append(arrays, builder.NewArray())
-			builder.Release()
+// compressionOptionsFromFlags validates --compression, --compression-level
+// and --column-compression and returns the matching write options.
+func compressionOptionsFromFlags(cmd *cobra.Command) ([]lockbox.Option, error) {
+	codec, _ := cmd.Flags().GetString("compression")
+	level, _ := cmd.Flags().GetInt("compression-level")
+	columnArgs, _ := cmd.Flags().GetStringArray("column-compression")
 
-		default:
-			// Default to string for unsupported types
-			builder := array.NewStringBuilder(mem)
-			for i := 0; i < numRows; i++ {
-				builder.Append(fmt.Sprintf("default_%d", i+1))
-			}
-			arrays = append(arrays, builder.NewArray())
-			builder.Release()
+	if err := format.ValidateCodec(codec); err != nil {
+		return nil, err
+	}
+	if err := format.ValidateCompressionLevel(level); err != nil {
+		return nil, err
+	}
+	columns := make(map[string]string, len(columnArgs))
+	for _, arg := range columnArgs {
+		col, c, ok := strings.Cut(arg, "=")
+		if !ok || col == "" {
+			return nil, fmt.Errorf("invalid --column-compression %q, expected col=codec", arg)
 		}
+		if err := format.ValidateCodec(c); err != nil {
+			return nil, fmt.Errorf("column %s: %w", col, err)
+		}
+		columns[col] = c
 	}
-	record := array.NewRecord(schema, arrays, int64(numRows))
+	if level != 0 && codec != format.CodecZstd && !containsValue(columns, format.CodecZstd) {
+		return nil, fmt.Errorf("--compression-level only applies to zstd")
+	}
+	return []lockbox.Option{
+		lockbox.WithCompression(codec),
+		lockbox.WithCompressionLevel(level),
+		lockbox.WithColumnCompression(columns),
+	}, nil
+}
 
-	// Release individual arrays
-	for _, arr := range arrays {
-		arr.Release()
+// addBlockSizeFlag registers --block-size with the given usage
+func addBlockSizeFlag(cmd *cobra.Command, usage string) {
+	cmd.Flags().Int("block-size", 0, usage)
+}
+
+// blockSizeOptions returns WithBlockSize for --block-size, or nil when it
+// was not given
+func blockSizeOptions(cmd *cobra.Command) []lockbox.Option {
+	if !cmd.Flags().Changed("block-size") {
+		return nil
 	}
+	rows, _ := cmd.Flags().GetInt("block-size")
+	return []lockbox.Option{lockbox.WithBlockSize(rows)}
+}
 
-	return record, nil
+// containsValue reports whether any value in m equals v
+func containsValue(m map[string]string, v string) bool {
+	for _, val := range m {
+		if val == v {
+			return true
+		}
+	}
+	return false
 }
 
-// loadDataFromFile loads data from various file formats
-// This is a simplified implementation for MVP
-func loadDataFromFile(filename string, schema *arrow.Schema) (arrow.Record, error) {
-	// For MVP, we'll just generate sample data regardless of input file
-	// In a full implementation, this would parse CSV, JSON, Parquet, etc.
-	mem := memory.NewGoAllocator()
-	numFields := len(schema.Fields())
-
-	// Create array builders for each column
-	builders := make([]array.Builder, numFields)
-	for i, field := range schema.Fields() {
-		switch typ := field.Type.(type) {
-		case *arrow.Int64Type:
-			builders[i] = array.NewInt64Builder(mem)
-		case *arrow.Int32Type:
-			builders[i] = array.NewInt32Builder(mem)
-		case *arrow.Float64Type:
-			builders[i] = array.NewFloat64Builder(mem)
-		case *arrow.StringType:
-			builders[i] = array.NewStringBuilder(mem)
-		case *arrow.TimestampType:
-			builders[i] = array.NewTimestampBuilder(mem, typ)
-		default:
-			return nil, fmt.Errorf("unsupported type: %v", field.Type)
-		}
-	}
-
-	f, err := os.Open(filename)
+// csvOptionsFromFlags maps the --delimiter, --no-header, --strict-columns,
+// --strict-header, row window, error, timestamp, null and binary flags to
+// lockbox.CSVReadOptions
+func csvOptionsFromFlags(cmd *cobra.Command) (lockbox.CSVReadOptions, error) {
+	delimiter, _ := cmd.Flags().GetString("delimiter")
+	noHeader, _ := cmd.Flags().GetBool("no-header")
+	strictColumns, _ := cmd.Flags().GetBool("strict-columns")
+	strictHeader, _ := cmd.Flags().GetBool("strict-header")
+	if noHeader && strictHeader {
+		return lockbox.CSVReadOptions{}, fmt.Errorf("--strict-header needs a header row; drop --no-header")
+	}
+
+	maxErrors, _ := cmd.Flags().GetInt("max-errors")
+
+	comma, err := parseDelimiter(delimiter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return lockbox.CSVReadOptions{}, err
 	}
-	defer f.Close()
+	if maxErrors < 0 {
+		return lockbox.CSVReadOptions{}, fmt.Errorf("--max-errors must not be negative, got %d", maxErrors)
+	}
+	skip, limit, err := rowWindowFromFlags(cmd)
+	if err != nil {
+		return lockbox.CSVReadOptions{}, err
+	}
+	layouts, loc, err := timestampFlags(cmd)
+	if err != nil {
+		return lockbox.CSVReadOptions{}, err
+	}
+	nullStrings, _ := cmd.Flags().GetStringArray("null-string")
+	trim, _ := cmd.Flags().GetBool("trim")
+	binary, err := binaryEncodingFromFlags(cmd)
+	if err != nil {
+		return lockbox.CSVReadOptions{}, err
+	}
+	return lockbox.CSVReadOptions{
+		Delimiter:        comma,
+		NoHeader:         noHeader,
+		StrictColumns:    strictColumns,
+		StrictHeader:     strictHeader,
+		SkipRows:         skip,
+		LimitRows:        limit,
+		MaxErrors:        maxErrors,
+		TimestampLayouts: layouts,
+		Location:         loc,
+		NullStrings:      nullStrings,
+		TrimNulls:        trim,
+		Binary:           binary,
+	}, nil
+}
+
+// addNullStringFlags registers --null-string and --trim
+func addNullStringFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("null-string", nil, "Read CSV fields equal to this string as null, e.g. NA or \\N (repeatable)")
+	cmd.Flags().Bool("trim", false, "Ignore surrounding whitespace when matching --null-string")
+}
+
+// jsonOptionsFromFlags maps the row window, timestamp and binary flags to
+// lockbox.JSONReadOptions
+func jsonOptionsFromFlags(cmd *cobra.Command) (lockbox.JSONReadOptions, error) {
+	skip, limit, err := rowWindowFromFlags(cmd)
+	if err != nil {
+		return lockbox.JSONReadOptions{}, err
+	}
+	layouts, loc, err := timestampFlags(cmd)
+	if err != nil {
+		return lockbox.JSONReadOptions{}, err
+	}
+	binary, err := binaryEncodingFromFlags(cmd)
+	if err != nil {
+		return lockbox.JSONReadOptions{}, err
+	}
+	return lockbox.JSONReadOptions{SkipRows: skip, LimitRows: limit, TimestampLayouts: layouts, Location: loc, Binary: binary}, nil
+}
 
-	rdr := csv.NewReader(f)
+// addRowWindowFlags registers --skip-rows and --limit-rows
+func addRowWindowFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("skip-rows", 0, "Skip this many data rows (after any header) before loading")
+	cmd.Flags().Int("limit-rows", 0, "Load at most this many rows, stopping early (0 for all)")
+}
+
+// rowWindowFromFlags reads and validates --skip-rows and --limit-rows
+func rowWindowFromFlags(cmd *cobra.Command) (skip, limit int, err error) {
+	skip, _ = cmd.Flags().GetInt("skip-rows")
+	limit, _ = cmd.Flags().GetInt("limit-rows")
+	if skip < 0 || limit < 0 {
+		return 0, 0, fmt.Errorf("--skip-rows and --limit-rows must not be negative")
+	}
+	return skip, limit, nil
+}
 
-	// skip the header row
-	_, err = rdr.Read()
+// addCSVErrorFlags registers --max-errors and --error-log
+func addCSVErrorFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("max-errors", 0, "Skip up to this many invalid CSV rows instead of failing on the first")
+	cmd.Flags().String("error-log", "", "Write each invalid CSV row's line, column, value and expected type to this file")
+}
+
+// openErrorLog creates the --error-log file, or returns nil when the flag
+// is unset
+func openErrorLog(cmd *cobra.Command) (*os.File, error) {
+	path, _ := cmd.Flags().GetString("error-log")
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Create(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		return nil, fmt.Errorf("failed to create error log: %w", err)
 	}
+	return f, nil
+}
 
-	for rowNum := 2; ; rowNum++ { // Start from 2 since header was row 1
-		row, err := rdr.Read()
+// parseDelimiter validates a delimiter flag value. It must be exactly one
+// character; the escape sequence \t is accepted for tab-separated files.
+func parseDelimiter(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("delimiter must be exactly one character, got %q", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r, nil
+}
+
+// stdinPath is the input name that selects standard input
+const stdinPath = "-"
+
+// openInput opens a named input, treating "-" as stdin and streaming object
+// store URIs such as s3://bucket/key
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdinPath {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if store.IsRemote(path) {
+		s, key, err := store.Resolve(context.Background(), path)
 		if err != nil {
-			if errors.Is(err, io.EOF) { // EOF check
-				break
-			}
-			return nil, fmt.Errorf("error reading row %d: %w", rowNum, err)
-		}
-		if len(row) != numFields {
-			return nil, fmt.Errorf("row %d: expected %d fields, got %d", rowNum, numFields, len(row))
+			return nil, err
 		}
-
-		for i, val := range row {
-			field := schema.Field(i)
-			switch typ := field.Type.(type) {
-			case *arrow.Int64Type:
-				if val == "" && field.Nullable {
-					builders[i].(*array.Int64Builder).AppendNull()
-					continue
-				}
-				v, err := strconv.ParseInt(val, 10, 64)
-				if err != nil {
-					return nil, fmt.Errorf("row %d, col %s: invalid int64: %s", rowNum, field.Name, val)
-				}
-				builders[i].(*array.Int64Builder).Append(v)
-			case *arrow.Int32Type:
-				if val == "" && field.Nullable {
-					builders[i].(*array.Int32Builder).AppendNull()
-					continue
-				}
-				v, err := strconv.ParseInt(val, 10, 32)
-				if err != nil {
-					return nil, fmt.Errorf("row %d, col %s: invalid int32: %s", rowNum, field.Name, val)
-				}
-				builders[i].(*array.Int32Builder).Append(int32(v))
-			case *arrow.Float64Type:
-				if val == "" && field.Nullable {
-					builders[i].(*array.Float64Builder).AppendNull()
-					continue
-				}
-				v, err := strconv.ParseFloat(val, 64)
-				if err != nil {
-					return nil, fmt.Errorf("row %d, col %s: invalid float64: %s", rowNum, field.Name, val)
-				}
-				builders[i].(*array.Float64Builder).Append(v)
-			case *arrow.StringType:
-				if val == "" && field.Nullable {
-					builders[i].(*array.StringBuilder).AppendNull()
-					continue
-				}
-				builders[i].(*array.StringBuilder).Append(val)
-			case *arrow.TimestampType:
-				if val == "" && field.Nullable {
-					builders[i].(*array.TimestampBuilder).AppendNull()
-					continue
-				}
-				tm, err := time.Parse(time.RFC3339, val)
-				if err != nil {
-					return nil, fmt.Errorf("row %d, col %s: invalid timestamp: %s", rowNum, field.Name, val)
-				}
-				var epoch int64
-				switch typ.Unit {
-				case arrow.Second:
-					epoch = tm.Unix()
-				case arrow.Millisecond:
-					epoch = tm.UnixMilli()
-				case arrow.Microsecond:
-					epoch = tm.UnixMicro()
-				case arrow.Nanosecond:
-					epoch = tm.UnixNano()
-				default:
-					return nil, fmt.Errorf("unknown timestamp unit: %v", typ.Unit)
-				}
-				builders[i].(*array.TimestampBuilder).Append(arrow.Timestamp(epoch))
-			default:
-				return nil, fmt.Errorf("unsupported type in row %d, col %s: %v", rowNum, field.Name, field.Type)
-			}
+		r, err := s.Reader(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
 		}
+		return r, nil
 	}
-
-	// Build Arrow arrays and record
-	arrays := make([]arrow.Array, numFields)
-	for i, b := range builders {
-		arrays[i] = b.NewArray()
-		b.Release()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	return f, nil
+}
 
-	numRows := int64(arrays[0].Len())
-	record := array.NewRecord(schema, arrays, numRows)
+// loadInput opens path (or stdin for "-"), decompresses it as selected by
+// compression and hands the stream to load
+func loadInput(path, compression string, load func(io.Reader) (arrow.Record, error)) (arrow.Record, error) {
+	in, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	r, err := decompressInput(in, path, compression)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return load(r)
+}
 
-	// Clean up arrays
-	for _, arr := range arrays {
-		arr.Release()
+// checkStdinPassword rejects an interactive password prompt when any input
+// is read from stdin, since the prompt would consume the data
+func checkStdinPassword(cmd *cobra.Command, password string, inputs ...string) error {
+	if hasPasswordSource(cmd, password) {
+		return nil
 	}
+	for _, in := range inputs {
+		if in == stdinPath || strings.HasSuffix(in, "="+stdinPath) {
+			return fmt.Errorf("--password, --key-file, --password-env or --identity is required when reading input from stdin")
+		}
+	}
+	return nil
+}
 
-	return record, nil
+// loadCSV loads CSV input with lockbox.LoadCSV, allocating from mem and
+// counting rows on p
+func loadCSV(ctx context.Context, mem memory.Allocator, r io.Reader, schema *arrow.Schema, opts lockbox.CSVReadOptions, p *progress) (arrow.Record, error) {
+	opts.Allocator = mem
+	opts.OnRows = p.addRows
+	return lockbox.LoadCSV(ctx, r, schema, opts)
 }
 
-func loadDataFromJSON(filename string, schema *arrow.Schema) (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
-	numFields := len(schema.Fields())
+// loadJSON loads JSON input with lockbox.LoadJSON, allocating from mem and
+// counting rows on p
+func loadJSON(ctx context.Context, mem memory.Allocator, r io.Reader, schema *arrow.Schema, opts lockbox.JSONReadOptions, p *progress) (arrow.Record, error) {
+	opts.Allocator = mem
+	opts.OnRows = p.addRows
+	return lockbox.LoadJSON(ctx, r, schema, opts)
+}
 
-	// Create builders for each column
-	builders := make([]array.Builder, numFields)
-	for i, field := range schema.Fields() {
-		switch typ := field.Type.(type) {
-		case *arrow.Int64Type:
-			builders[i] = array.NewInt64Builder(mem)
-		case *arrow.Int32Type:
-			builders[i] = array.NewInt32Builder(mem)
-		case *arrow.Float64Type:
-			builders[i] = array.NewFloat64Builder(mem)
-		case *arrow.StringType:
-			builders[i] = array.NewStringBuilder(mem)
-		case *arrow.TimestampType:
-			builders[i] = array.NewTimestampBuilder(mem, typ)
-		default:
-			return nil, fmt.Errorf("unsupported type: %v", field.Type)
+// parseKeyValueArgs parses repeated key=value flag values into a map,
+// ignoring entries without an equals sign.
+func parseKeyValueArgs(args []string) map[string]string {
+	m := make(map[string]string)
+	for _, a := range args {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
 		}
 	}
+	return m
+}
+
+// blobDirOptions selects the files loaded by loadBlobDir
+type blobDirOptions struct {
+	// Field receives each file's contents
+	Field string
+	// Dir is searched for files matching Glob, without recursing
+	Dir  string
+	Glob string
+	// NameField receives each file's base name
+	NameField string
+}
+
+// loadBlobDir builds one row per regular file in opts.Dir that matches
+// opts.Glob, in name order. Fields other than the blob and name are null.
+func loadBlobDir(ctx context.Context, mem memory.Allocator, schema *arrow.Schema, opts blobDirOptions) (arrow.Record, error) {
+	blobIdx, nameIdx := schema.FieldIndices(opts.Field), schema.FieldIndices(opts.NameField)
+	if len(blobIdx) == 0 {
+		return nil, fmt.Errorf("blob field %q is not in the schema", opts.Field)
+	}
+	if len(nameIdx) == 0 {
+		return nil, fmt.Errorf("filename field %q is not in the schema; add a string field or pass --blob-name-field", opts.NameField)
+	}
+	if id := schema.Field(blobIdx[0]).Type.ID(); id != arrow.BINARY && id != arrow.LARGE_BINARY && id != arrow.STRING {
+		return nil, fmt.Errorf("blob field %q must be binary or string, not %v", opts.Field, schema.Field(blobIdx[0]).Type)
+	}
+	if schema.Field(nameIdx[0]).Type.ID() != arrow.STRING {
+		return nil, fmt.Errorf("filename field %q must be a string, not %v", opts.NameField, schema.Field(nameIdx[0]).Type)
+	}
 
-	// Open JSON file
-	f, err := os.Open(filename)
+	glob := opts.Glob
+	if glob == "" {
+		glob = "*"
+	}
+	matches, err := filepath.Glob(filepath.Join(opts.Dir, glob))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("invalid --blob-glob %q: %w", glob, err)
+	}
+	var files []string
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in %s match %s", opts.Dir, glob)
 	}
-	defer f.Close()
 
-	// Read JSON: try as array, else NDJSON fallback
-	dec := json.NewDecoder(f)
-	var records []map[string]interface{}
-	// Try to decode as array of objects
-	if err := dec.Decode(&records); err != nil {
-		// Reset file pointer and try NDJSON (one object per line)
-		if _, err2 := f.Seek(0, io.SeekStart); err2 != nil {
-			return nil, fmt.Errorf("invalid JSON format, and seek failed: %w", err)
-		}
-		dec = json.NewDecoder(f)
-		records = []map[string]interface{}{}
-		for {
-			var row map[string]interface{}
-			if err := dec.Decode(&row); err != nil {
-				if err == io.EOF {
-					break
-				}
-				return nil, fmt.Errorf("JSON decode error: %w", err)
-			}
-			records = append(records, row)
+	builders := make([]array.Builder, len(schema.Fields()))
+	defer func() {
+		for _, b := range builders {
+			b.Release()
 		}
+	}()
+	for i, f := range schema.Fields() {
+		builders[i] = array.NewBuilder(mem, f.Type)
 	}
 
-	// Process records
-	for rowNum, rec := range records {
-		for i, field := range schema.Fields() {
-			val, ok := rec[field.Name]
-			if !ok || val == nil {
-				if field.Nullable {
-					builders[i].AppendNull()
-					continue
-				}
-				return nil, fmt.Errorf("row %d: missing non-nullable field '%s'", rowNum+1, field.Name)
-			}
-			switch typ := field.Type.(type) {
-			case *arrow.Int64Type:
-				switch v := val.(type) {
-				case float64: // json.Unmarshal converts numbers to float64
-					builders[i].(*array.Int64Builder).Append(int64(v))
-				case string:
-					if v == "" && field.Nullable {
-						builders[i].(*array.Int64Builder).AppendNull()
-					} else {
-						num, err := strconv.ParseInt(v, 10, 64)
-						if err != nil {
-							return nil, fmt.Errorf("row %d, col %s: invalid int64: %v", rowNum+1, field.Name, v)
-						}
-						builders[i].(*array.Int64Builder).Append(num)
-					}
-				default:
-					return nil, fmt.Errorf("row %d, col %s: expected int64, got %T", rowNum+1, field.Name, val)
-				}
-			case *arrow.Int32Type:
-				switch v := val.(type) {
-				case float64:
-					builders[i].(*array.Int32Builder).Append(int32(v))
-				case string:
-					if v == "" && field.Nullable {
-						builders[i].(*array.Int32Builder).AppendNull()
-					} else {
-						num, err := strconv.ParseInt(v, 10, 32)
-						if err != nil {
-							return nil, fmt.Errorf("row %d, col %s: invalid int32: %v", rowNum+1, field.Name, v)
-						}
-						builders[i].(*array.Int32Builder).Append(int32(num))
-					}
-				default:
-					return nil, fmt.Errorf("row %d, col %s: expected int32, got %T", rowNum+1, field.Name, val)
-				}
-			case *arrow.Float64Type:
-				switch v := val.(type) {
-				case float64:
-					builders[i].(*array.Float64Builder).Append(v)
-				case string:
-					if v == "" && field.Nullable {
-						builders[i].(*array.Float64Builder).AppendNull()
-					} else {
-						num, err := strconv.ParseFloat(v, 64)
-						if err != nil {
-							return nil, fmt.Errorf("row %d, col %s: invalid float64: %v", rowNum+1, field.Name, v)
-						}
-						builders[i].(*array.Float64Builder).Append(num)
-					}
-				default:
-					return nil, fmt.Errorf("row %d, col %s: expected float64, got %T", rowNum+1, field.Name, val)
-				}
-			case *arrow.StringType:
-				switch v := val.(type) {
-				case string:
-					if v == "" && field.Nullable {
-						builders[i].(*array.StringBuilder).AppendNull()
-					} else {
-						builders[i].(*array.StringBuilder).Append(v)
-					}
-				default:
-					builders[i].(*array.StringBuilder).Append(fmt.Sprintf("%v", val))
-				}
-			case *arrow.TimestampType:
-				switch v := val.(type) {
-				case string:
-					if v == "" && field.Nullable {
-						builders[i].(*array.TimestampBuilder).AppendNull()
-						continue
-					}
-					tm, err := time.Parse(time.RFC3339, v)
-					if err != nil {
-						return nil, fmt.Errorf("row %d, col %s: invalid timestamp: %v", rowNum+1, field.Name, v)
-					}
-					var epoch int64
-					switch typ.Unit {
-					case arrow.Second:
-						epoch = tm.Unix()
-					case arrow.Millisecond:
-						epoch = tm.UnixMilli()
-					case arrow.Microsecond:
-						epoch = tm.UnixMicro()
-					case arrow.Nanosecond:
-						epoch = tm.UnixNano()
-					default:
-						return nil, fmt.Errorf("unknown timestamp unit: %v", typ.Unit)
-					}
-					builders[i].(*array.TimestampBuilder).Append(arrow.Timestamp(epoch))
-				default:
-					return nil, fmt.Errorf("row %d, col %s: invalid timestamp type: %T", rowNum+1, field.Name, val)
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read blob %s: %w", path, err)
+		}
+		for i := range builders {
+			switch i {
+			case blobIdx[0]:
+				switch b := builders[i].(type) {
+				case *array.BinaryBuilder:
+					b.Append(data)
+				case *array.StringBuilder:
+					b.Append(string(data))
 				}
+			case nameIdx[0]:
+				builders[i].(*array.StringBuilder).Append(filepath.Base(path))
 			default:
-				return nil, fmt.Errorf("unsupported type: %v", field.Type)
+				builders[i].AppendNull()
 			}
 		}
 	}
 
-	// Build Arrow arrays and record
-	arrays := make([]arrow.Array, numFields)
+	arrays := make([]arrow.Array, len(builders))
 	for i, b := range builders {
 		arrays[i] = b.NewArray()
-		b.Release()
 	}
-	numRows := int64(arrays[0].Len())
-	record := array.NewRecord(schema, arrays, numRows)
+	rec := array.NewRecord(schema, arrays, int64(len(files)))
 	for _, arr := range arrays {
 		arr.Release()
 	}
-
-	return record, nil
+	return rec, nil
 }
 
-func parseBlobArgs(args []string) map[string]string {
-	m := make(map[string]string)
-	for _, a := range args {
-		parts := strings.SplitN(a, "=", 2)
-		if len(parts) == 2 {
-			m[parts[0]] = parts[1]
+// withoutFields returns schema minus the fields named in names
+func withoutFields(schema *arrow.Schema, names map[string]string) *arrow.Schema {
+	var fields []arrow.Field
+	for _, f := range schema.Fields() {
+		if _, ok := names[f.Name]; !ok {
+			fields = append(fields, f)
 		}
 	}
-	return m
+	md := schema.Metadata()
+	return arrow.NewSchema(fields, &md)
 }
 
-func loadBlobRecord(blobs map[string]string, schema *arrow.Schema) (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
-
-	builders := make([]array.Builder, len(schema.Fields()))
-	for i, f := range schema.Fields() {
-		switch f.Type.(type) {
-		case *arrow.BinaryType:
-			builders[i] = array.NewBinaryBuilder(mem, arrow.BinaryTypes.Binary)
-		case *arrow.LargeBinaryType:
-			builders[i] = array.NewBinaryBuilder(mem, arrow.BinaryTypes.LargeBinary)
-		case *arrow.StringType:
-			builders[i] = array.NewStringBuilder(mem)
-		default:
-			builders[i] = array.NewStringBuilder(mem)
+// addBlobColumns lays out rec's columns in schema order, filling each field
+// in blobs with that blob's contents on every row. Input columns with a
+// blob field's name are replaced.
+func addBlobColumns(mem memory.Allocator, schema *arrow.Schema, rec arrow.Record, blobs map[string]io.Reader) (arrow.Record, error) {
+	for name := range blobs {
+		if !schema.HasField(name) {
+			return nil, fmt.Errorf("blob field %q is not in the schema", name)
 		}
 	}
 
-	for i, f := range schema.Fields() {
-		if path, ok := blobs[f.Name]; ok {
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return nil, fmt.Errorf("read blob %s: %w", f.Name, err)
+	fields := make([]arrow.Field, 0, len(schema.Fields()))
+	cols := make([]arrow.Array, 0, len(schema.Fields()))
+	defer func() {
+		for _, col := range cols {
+			col.Release()
+		}
+	}()
+	for _, f := range schema.Fields() {
+		r, ok := blobs[f.Name]
+		if !ok {
+			idx := rec.Schema().FieldIndices(f.Name)
+			if len(idx) == 0 {
+				return nil, fmt.Errorf("input has no column %q", f.Name)
 			}
-			switch b := builders[i].(type) {
+			col := rec.Column(idx[0])
+			col.Retain()
+			fields = append(fields, rec.Schema().Field(idx[0]))
+			cols = append(cols, col)
+			continue
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read blob %s: %w", f.Name, err)
+		}
+		b := array.NewBuilder(mem, f.Type)
+		for i := int64(0); i < rec.NumRows(); i++ {
+			switch b := b.(type) {
 			case *array.BinaryBuilder:
 				b.Append(data)
 			case *array.StringBuilder:
 				b.Append(string(data))
+			default:
+				b.Release()
+				return nil, fmt.Errorf("blob field %q must be binary or string, not %v", f.Name, f.Type)
 			}
-		} else {
-			builders[i].AppendNull()
 		}
-	}
-
-	arrays := make([]arrow.Array, len(schema.Fields()))
-	for i, b := range builders {
-		arrays[i] = b.NewArray()
+		fields = append(fields, f)
+		cols = append(cols, b.NewArray())
 		b.Release()
 	}
 
-	rec := array.NewRecord(schema, arrays, 1)
-	for _, arr := range arrays {
-		arr.Release()
+	md := schema.Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &md), cols, rec.NumRows()), nil
+}
+
+// readOptions returns the loader options allocating from mem and counting
+// rows on p
+func readOptions(mem memory.Allocator, p *progress) lockbox.ReadOptions {
+	return lockbox.ReadOptions{Allocator: mem, OnRows: p.addRows}
+}
+
+// loadDataFromORCToParquet loads the Parquet file converted from ORC input,
+// coerced to schema with naive timestamps read in zone
+func loadDataFromORCToParquet(ctx context.Context, mem memory.Allocator, parquetPath string, schema *arrow.Schema, threads int, zone *time.Location, p *progress) (arrow.Record, error) {
+	rec, err := loadParquetFile(ctx, mem, parquetPath, lockbox.ReadOptions{Threads: threads}, p)
+	if err != nil {
+		return nil, err
 	}
-	return rec, nil
+	if rec.Schema().Equal(schema) {
+		return rec, nil
+	}
+	defer rec.Release()
+	return lockbox.CoerceRecord(schema, rec, lockbox.WithTimestampTimezone(zone))
 }
 
-// Loads all data from a Parquet file into a single Arrow Record, matching the given schema
-func loadDataFromORCToParquet(parquetPath string, schema *arrow.Schema) (arrow.Record, error) {
+// loadParquetFile loads a local Parquet file with lockbox.LoadParquet,
+// allocating from mem and counting rows on p
+func loadParquetFile(ctx context.Context, mem memory.Allocator, parquetPath string, opts lockbox.ReadOptions, p *progress) (arrow.Record, error) {
 	f, err := os.Open(parquetPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open parquet file: %w", err)
 	}
 	defer f.Close()
+	opts.Allocator = mem
+	opts.OnRows = p.addRows
+	return lockbox.LoadParquet(ctx, f, opts)
+}
 
-	pf, err := file.NewParquetReader(f)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read parquet file: %w", err)
+// parquetOptionsFromFlags maps --threads, --columns and --row-groups to
+// lockbox.ReadOptions
+func parquetOptionsFromFlags(cmd *cobra.Command) (lockbox.ReadOptions, error) {
+	threads, _ := cmd.Flags().GetInt("threads")
+	if threads < 1 {
+		return lockbox.ReadOptions{}, fmt.Errorf("--threads must be at least 1")
 	}
-	defer pf.Close()
-
-	mem := memory.NewGoAllocator()
+	columns, _ := cmd.Flags().GetStringSlice("columns")
+	rowGroups, _ := cmd.Flags().GetIntSlice("row-groups")
+	return lockbox.ReadOptions{Threads: threads, Columns: columns, RowGroups: rowGroups}, nil
+}
 
-	// Parquet → Arrow reader
-	pqReader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1024}, mem)
+// checkParquetSchema fails, before any data is read, when columns of the
+// Parquet file at path, or only those named in columns, cannot be coerced
+// to schema, listing all of them
+func checkParquetSchema(path string, schema *arrow.Schema, columns []string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+		return fmt.Errorf("failed to open parquet file: %w", err)
 	}
-
-	// Make sure the Parquet file has the needed columns (validate schema)
-	_, err = pqReader.Schema()
+	defer f.Close()
+	pqSchema, err := lockbox.ParquetSchema(f)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get parquet schema: %w", err)
+		return err
 	}
+	if len(columns) > 0 {
+		fields := make([]arrow.Field, 0, len(columns))
+		for _, name := range columns {
+			at := pqSchema.FieldIndices(name)
+			if len(at) == 0 {
+				return fmt.Errorf("parquet file has no column %s", name)
+			}
+			fields = append(fields, pqSchema.Field(at[0]))
+		}
+		pqSchema = arrow.NewSchema(fields, nil)
+	}
+	if err := lockbox.CheckCoercible(schema, pqSchema); err != nil {
+		return fmt.Errorf("input does not fit the lockbox schema (--lenient coerces batch by batch instead): %w", err)
+	}
+	return nil
+}
 
-	// Optionally: Validate or coerce schemas
-	// (See your `coerceRecord` logic for stricter mapping)
+// loadArrow loads Arrow IPC input with lockbox.LoadArrow
+func loadArrow(ctx context.Context, mem memory.Allocator, r io.Reader, p *progress) (arrow.Record, error) {
+	return lockbox.LoadArrow(ctx, r, readOptions(mem, p))
+}
 
-	// Read all rows from the Parquet file
-	ctx := context.Background()
-	recReader, err := pqReader.GetRecordReader(ctx, nil, nil)
+// loadArrowSchema reads only the schema of an Arrow IPC stream or file
+func loadArrowSchema(path string) (*arrow.Schema, error) {
+	in, err := openInput(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get record reader: %w", err)
+		return nil, err
 	}
-	defer recReader.Release()
+	defer in.Close()
+	return lockbox.ArrowSchema(in)
+}
 
-	// Accumulate all batches into a single record (if needed)
-	var allBatches []arrow.Record
-	for recReader.Next() {
-		rec := recReader.Record()
-		// Coerce to match target schema (if needed)
-		if !rec.Schema().Equal(schema) {
-			coerced, err := lockbox.CoerceRecord(schema, rec)
-			if err != nil {
-				rec.Release()
-				return nil, err
-			}
-			rec.Release()
-			rec = coerced
-		} else {
-			rec.Retain()
-		}
-		allBatches = append(allBatches, rec)
-	}
-	if len(allBatches) == 0 {
-		return nil, fmt.Errorf("no data found in Parquet file")
+// loadAvro loads an Avro Object Container File with lockbox.LoadAvro
+func loadAvro(ctx context.Context, mem memory.Allocator, r io.Reader, p *progress) (arrow.Record, error) {
+	return lockbox.LoadAvro(ctx, r, readOptions(mem, p))
+}
+
+// loadAvroSchema reads the Arrow schema of an Avro file from its header
+func loadAvroSchema(path string) (*arrow.Schema, error) {
+	in, err := openInput(path)
+	if err != nil {
+		return nil, err
 	}
+	defer in.Close()
+	return lockbox.AvroSchema(in)
+}
+
+// isAvroPath reports whether a file name has the Avro extension
+func isAvroPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".avro")
+}
 
-	// Concatenate batches into one (if more than one)
-	result, err := concatRecords(mem, schema, allBatches...)
-	for _, rec := range allBatches {
-		rec.Release()
+// isArrowPath reports whether a file name has an Arrow IPC extension
+func isArrowPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".arrow", ".arrows", ".feather", ".ipc":
+		return true
 	}
-	return result, nil
+	return false
 }
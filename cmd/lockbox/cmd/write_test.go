@@ -0,0 +1,1426 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecimalRoundTrip(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}, Nullable: true},
+	}, nil)
+
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("id,amount\n1,0.1\n2,0.2\n3,\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+
+	tmpFile := "/tmp/test_decimal.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password), lockbox.WithCreatedBy("test"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	ctx := context.Background()
+	if err := lb.Write(ctx, rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	lb.Close()
+
+	lb2, err := lockbox.Open(tmpFile, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lb2.Close()
+
+	out, err := lb2.Read(ctx, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer out.Release()
+
+	col := out.Column(1).(*array.Decimal128)
+	sum := col.Value(0).Add(col.Value(1))
+	if got := sum.ToString(2); got != "0.30" {
+		t.Fatalf("expected 0.1 + 0.2 = 0.30, got %s", got)
+	}
+	if !col.IsNull(2) {
+		t.Fatalf("expected null in row 3")
+	}
+}
+
+func TestFloat32RoundTrip(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ratio", Type: arrow.PrimitiveTypes.Float32, Nullable: true},
+	}, nil)
+	mem := memory.NewGoAllocator()
+
+	rec, err := loadCSV(context.Background(), mem, strings.NewReader("ratio\n0.1\n3.4028235e38\n\"\"\n-1.5\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+
+	tmpFile := "/tmp/test_float32.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password), lockbox.WithCreatedBy("test"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	ctx := context.Background()
+	if err := lb.Write(ctx, rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	lb.Close()
+
+	lb2, err := lockbox.Open(tmpFile, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lb2.Close()
+	out, err := lb2.Read(ctx, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer out.Release()
+
+	want := []float32{0.1, math.MaxFloat32, 0, -1.5}
+	col := out.Column(0).(*array.Float32)
+	for i, v := range want {
+		if i == 2 {
+			if !col.IsNull(i) {
+				t.Fatalf("expected null in row 3")
+			}
+			continue
+		}
+		if col.Value(i) != v {
+			t.Fatalf("row %d: expected %v, got %v", i+1, v, col.Value(i))
+		}
+	}
+
+	// JSON export and reload keeps the exact values
+	rr, err := array.NewRecordReader(schema, []arrow.Record{out})
+	if err != nil {
+		t.Fatalf("record reader: %v", err)
+	}
+	defer rr.Release()
+	var buf bytes.Buffer
+	if err := exportJSON(&buf, rr, ""); err != nil {
+		t.Fatalf("export json: %v", err)
+	}
+	back, err := loadJSON(ctx, mem, &buf, schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	defer back.Release()
+	if !array.Equal(back.Column(0), col) {
+		t.Fatalf("json round trip changed values: %v != %v", back.Column(0), col)
+	}
+
+	_, err = loadCSV(ctx, mem, strings.NewReader("ratio\n3.5e38\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "value 3.5e38 overflows float32") {
+		t.Fatalf("expected a float32 overflow, got %v", err)
+	}
+}
+
+func TestFixedSizeBinaryRoundTrip(t *testing.T) {
+	uuid := &arrow.FixedSizeBinaryType{ByteWidth: 16}
+	hash := &arrow.FixedSizeBinaryType{ByteWidth: 32}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: uuid, Nullable: false},
+		{Name: "sha256", Type: hash, Nullable: true},
+	}, nil)
+	sum := sha256.Sum256([]byte("lockbox"))
+
+	// UUIDs are read with or without dashes
+	input := "id,sha256\n" +
+		"123e4567-e89b-12d3-a456-426614174000," + hex.EncodeToString(sum[:]) + "\n" +
+		"00112233445566778899aabbccddeeff,\n"
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	defer rec.Release()
+	ids := rec.Column(0).(*array.FixedSizeBinary)
+	if got := hex.EncodeToString(ids.Value(0)); got != "123e4567e89b12d3a456426614174000" {
+		t.Fatalf("unexpected uuid %s", got)
+	}
+	hashes := rec.Column(1).(*array.FixedSizeBinary)
+	if !bytes.Equal(hashes.Value(0), sum[:]) || !hashes.IsNull(1) {
+		t.Fatalf("unexpected hashes: %v", hashes)
+	}
+
+	tmpFile := "/tmp/test_fixed_size_binary.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec.Retain()
+	if err := lb.Write(context.Background(), rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// CSV and JSON export write hex, which reloads the same
+	exports := []struct {
+		to   string
+		load func(io.Reader) (arrow.Record, error)
+	}{
+		{"csv", func(r io.Reader) (arrow.Record, error) {
+			return loadCSV(context.Background(), memory.NewGoAllocator(), r, schema, lockbox.CSVReadOptions{}, nil)
+		}},
+		{"json", func(r io.Reader) (arrow.Record, error) {
+			return loadJSON(context.Background(), memory.NewGoAllocator(), r, schema, lockbox.JSONReadOptions{}, nil)
+		}},
+	}
+	for _, e := range exports {
+		export, err := exporterFor(e.to, stdoutPath, "")
+		if err != nil {
+			t.Fatalf("exporter: %v", err)
+		}
+		rr, err := lb.NewReader(lockbox.WithPassword(password))
+		if err != nil {
+			t.Fatalf("reader: %v", err)
+		}
+		var buf strings.Builder
+		err = export(&buf, rr)
+		rr.Release()
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		again, err := e.load(strings.NewReader(buf.String()))
+		if err != nil {
+			t.Fatalf("reload: %v\n%s", err, buf.String())
+		}
+		if !array.RecordEqual(rec, again) {
+			t.Fatalf("round trip mismatch:\n%s", buf.String())
+		}
+		again.Release()
+	}
+
+	// base64 on request
+	b64 := `{"id": "` + base64.StdEncoding.EncodeToString(ids.Value(0)) + `"}`
+	fromB64, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(b64), schema, lockbox.JSONReadOptions{Binary: lockbox.BinaryBase64}, nil)
+	if err != nil {
+		t.Fatalf("load base64 json: %v", err)
+	}
+	defer fromB64.Release()
+	if !bytes.Equal(fromB64.Column(0).(*array.FixedSizeBinary).Value(0), ids.Value(0)) {
+		t.Fatalf("base64 uuid mismatch")
+	}
+
+	for _, bad := range []string{
+		"id,sha256\n0011,\n",
+		"id,sha256\nnot-hex-at-all-not-hex-at-all-00,\n",
+		"id,sha256\n00112233445566778899aabbccddeeff,00ff\n",
+	} {
+		if _, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(bad), schema, lockbox.CSVReadOptions{}, nil); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	sample, err := generateSampleData(memory.NewGoAllocator(), schema, sampleOptions{Rows: 4, Seed: 1})
+	if err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	defer sample.Release()
+	if !sample.Schema().Equal(schema) {
+		t.Fatalf("expected sample schema %s, got %s", schema, sample.Schema())
+	}
+}
+
+func TestLoadTSVWithoutHeader(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	delim, err := parseDelimiter(`\t`)
+	if err != nil {
+		t.Fatalf("parse delimiter: %v", err)
+	}
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("1\tAlice, Jr.\n2\tBob\n"), schema, lockbox.CSVReadOptions{Delimiter: delim, NoHeader: true}, nil)
+	if err != nil {
+		t.Fatalf("load tsv: %v", err)
+	}
+	defer rec.Release()
+
+	if rec.NumRows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", rec.NumRows())
+	}
+	if got := rec.Column(1).(*array.String).Value(0); got != "Alice, Jr." {
+		t.Fatalf("unexpected name %q", got)
+	}
+
+	for _, bad := range []string{"", "ab", `"`, "\n"} {
+		if _, err := parseDelimiter(bad); err == nil {
+			t.Fatalf("expected error for delimiter %q", bad)
+		}
+	}
+}
+
+func TestLoadCSVExtraColumns(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	// source is not in the schema and score is missing from the input
+	input := "id,source,name\n1,crm,Alice\n2,web,\n"
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	defer rec.Release()
+	names := rec.Column(1).(*array.String)
+	if rec.NumRows() != 2 || names.Value(0) != "Alice" || !names.IsNull(1) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+	if rec.Column(2).NullN() != 2 {
+		t.Fatalf("expected a null score column, got %v", rec.Column(2))
+	}
+
+	// Positional matching rejects the same input
+	if _, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{StrictColumns: true}, nil); err == nil {
+		t.Fatalf("expected an error with StrictColumns")
+	}
+
+	for _, bad := range []string{"name,score\nAlice,1\n", "id,id,name\n1,2,Alice\n"} {
+		if _, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(bad), schema, lockbox.CSVReadOptions{}, nil); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCSVShuffledColumns(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "created", Type: &arrow.TimestampType{Unit: arrow.Second}, Nullable: false},
+	}, nil)
+
+	input := "score,created,name,id\n1.5,2024-01-02T03:04:05Z,Alice,7\n,2024-02-03T04:05:06Z,Bob,8\n"
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	defer rec.Release()
+	if !rec.Schema().Equal(schema) {
+		t.Fatalf("expected schema %s, got %s", schema, rec.Schema())
+	}
+	ids := rec.Column(0).(*array.Int64)
+	names := rec.Column(1).(*array.String)
+	scores := rec.Column(2).(*array.Float64)
+	if ids.Value(0) != 7 || ids.Value(1) != 8 || names.Value(0) != "Alice" || names.Value(1) != "Bob" {
+		t.Fatalf("unexpected rows: %v %v", ids, names)
+	}
+	if scores.Value(0) != 1.5 || !scores.IsNull(1) {
+		t.Fatalf("unexpected scores: %v", scores)
+	}
+	created := rec.Column(3).(*array.Timestamp)
+	if created.Value(0).ToTime(arrow.Second) != time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) {
+		t.Fatalf("unexpected created: %v", created)
+	}
+
+	// Errors name the field at its input position
+	_, err = loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("name,id,created\nAlice,x,2024-01-02T03:04:05Z\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2, column 7 (id)") {
+		t.Fatalf("expected an id error at line 2, column 7, got %v", err)
+	}
+
+	// Only missing non-nullable fields are an error, and all are named
+	_, err = loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("name,score\nAlice,1\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "id, created") {
+		t.Fatalf("expected id and created to be missing, got %v", err)
+	}
+}
+
+func TestLoadCSVErrorLine(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "note", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "age", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+	}, nil)
+
+	// The quoted note spans lines 2-4, so the bad age is on line 5
+	input := "note,age\n\"first\nsecond\nthird\",1\nok,x\n"
+	_, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil {
+		t.Fatalf("expected a parse error")
+	}
+	if !strings.Contains(err.Error(), "line 5, column 4 (age)") {
+		t.Fatalf("expected error at line 5, column 4, got %v", err)
+	}
+}
+
+func TestLoadIntegerWidths(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "small", Type: arrow.PrimitiveTypes.Int8, Nullable: false},
+		{Name: "count", Type: arrow.PrimitiveTypes.Uint32, Nullable: false},
+		{Name: "big", Type: arrow.PrimitiveTypes.Uint64, Nullable: false},
+	}, nil)
+	mem := memory.NewGoAllocator()
+
+	rec, err := loadCSV(context.Background(), mem, strings.NewReader("small,count,big\n-128,4294967295,18446744073709551615\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	defer rec.Release()
+	if rec.Column(0).(*array.Int8).Value(0) != -128 || rec.Column(1).(*array.Uint32).Value(0) != math.MaxUint32 ||
+		rec.Column(2).(*array.Uint64).Value(0) != math.MaxUint64 {
+		t.Fatalf("unexpected values: %v", rec)
+	}
+
+	_, err = loadCSV(context.Background(), mem, strings.NewReader("small,count,big\n1,4294967296,1\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2, column 3 (count): value 4294967296 overflows uint32") {
+		t.Fatalf("expected a uint32 overflow, got %v", err)
+	}
+	_, err = loadCSV(context.Background(), mem, strings.NewReader("small,count,big\n1,-1,1\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "value -1 overflows uint32") {
+		t.Fatalf("expected a negative uint32 to overflow, got %v", err)
+	}
+
+	_, err = loadJSON(context.Background(), mem, strings.NewReader(`[{"small": 200, "count": 1, "big": 1}]`), schema, lockbox.JSONReadOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "value 200 overflows int8") || !strings.Contains(err.Error(), "small") {
+		t.Fatalf("expected an int8 overflow naming the column, got %v", err)
+	}
+}
+
+func TestLoadCSVNullStrings(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "note", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	mem := memory.NewGoAllocator()
+	input := "id,score,note\n1,NA,\\N\n2, NA ,NULL\n"
+
+	// Without --trim " NA " is not a sentinel and fails to parse as float
+	opts := lockbox.CSVReadOptions{NullStrings: []string{"NA", "NULL", "\\N"}}
+	if _, err := loadCSV(context.Background(), mem, strings.NewReader(input), schema, opts, nil); err == nil {
+		t.Fatalf("expected an exact match to reject \" NA \"")
+	}
+
+	opts.TrimNulls = true
+	rec, err := loadCSV(context.Background(), mem, strings.NewReader(input), schema, opts, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	if rec.Column(1).NullN() != 2 || rec.Column(2).NullN() != 2 {
+		t.Fatalf("expected every sentinel to be null, got %v", rec)
+	}
+
+	_, err = loadCSV(context.Background(), mem, strings.NewReader("id,score,note\nNA,1,x\n"), schema, opts, nil)
+	if err == nil || !strings.Contains(err.Error(), `column 1 (id): null value "NA" for non-nullable field`) {
+		t.Fatalf("expected a null sentinel in a non-nullable column to fail, got %v", err)
+	}
+}
+
+func TestLoadCSVMaxErrors(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "age", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+	}, nil)
+	input := "id,age\n1,30\n2,old\n3\n4,41\n"
+
+	var errLog bytes.Buffer
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{MaxErrors: 2, ErrorLog: &errLog}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	ids := rec.Column(0).(*array.Int64)
+	if rec.NumRows() != 2 || ids.Value(0) != 1 || ids.Value(1) != 4 {
+		t.Fatalf("expected rows 1 and 4, got %v", ids)
+	}
+	ages := rec.Column(1).(*array.Int32)
+	if ages.Value(1) != 41 {
+		t.Fatalf("rejected row left values behind: %v", ages)
+	}
+
+	lines := strings.Split(strings.TrimSpace(errLog.String()), "\n")
+	if len(lines) != 3 || lines[1] != "3,age,old,int32,\"line 3, column 3 (age): invalid int32: old\"" || !strings.HasPrefix(lines[2], "4,,,2 fields,") {
+		t.Fatalf("unexpected error log:\n%s", errLog.String())
+	}
+
+	_, err = loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.CSVReadOptions{MaxErrors: 1}, nil)
+	if err == nil || !strings.Contains(err.Error(), "more than 1 invalid rows") {
+		t.Fatalf("expected error budget failure, got %v", err)
+	}
+}
+
+func TestLoadRowWindow(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	// Reading past the selected rows hits this error, so passing proves the
+	// loaders stop early
+	tail := iotest.ErrReader(errors.New("read past the limit"))
+
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), io.MultiReader(strings.NewReader("1\n2\n3\n4\n"), tail), schema, lockbox.CSVReadOptions{NoHeader: true, SkipRows: 1, LimitRows: 2}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	ids := rec.Column(0).(*array.Int64)
+	if rec.NumRows() != 2 || ids.Value(0) != 2 || ids.Value(1) != 3 {
+		t.Fatalf("expected csv rows 2 and 3, got %v", ids)
+	}
+	rec.Release()
+
+	for _, input := range []string{
+		"{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n{\"id\": 4}\n",
+		`[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, `,
+	} {
+		rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), io.MultiReader(strings.NewReader(input), tail), schema, lockbox.JSONReadOptions{SkipRows: 1, LimitRows: 2}, nil)
+		if err != nil {
+			t.Fatalf("load json %q: %v", input, err)
+		}
+		ids := rec.Column(0).(*array.Int64)
+		if rec.NumRows() != 2 || ids.Value(0) != 2 || ids.Value(1) != 3 {
+			t.Fatalf("expected json rows 2 and 3 from %q, got %v", input, ids)
+		}
+		rec.Release()
+	}
+}
+
+func TestNoPythonGuard(t *testing.T) {
+	origExec := execCommand
+	defer func() { execCommand = origExec }()
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		t.Fatalf("unexpected exec of %s under --no-python", name)
+		return nil
+	}
+
+	noPython = true
+	err := convertORCtoParquet("/tmp/test_guard.orc", "/tmp/test_guard.parquet")
+	noPython = false
+	if !errors.Is(err, errPythonDisabled) {
+		t.Fatalf("expected errPythonDisabled, got %v", err)
+	}
+
+	t.Setenv("LOCKBOX_NO_PYTHON", "1")
+	if err := ensurePyarrowInstalled(); !errors.Is(err, errPythonDisabled) {
+		t.Fatalf("expected errPythonDisabled from env guard, got %v", err)
+	}
+}
+
+func TestGenerateSampleDataNulls(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 4, Scale: 2}, Nullable: true},
+	}, nil)
+
+	opts := sampleOptions{Rows: 200, Seed: 42}
+	rec, err := generateSampleData(memory.NewGoAllocator(), schema, opts)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	defer rec.Release()
+
+	if rec.NumRows() != 200 {
+		t.Fatalf("expected 200 rows, got %d", rec.NumRows())
+	}
+	if n := rec.Column(0).NullN(); n != 0 {
+		t.Fatalf("non-nullable column has %d nulls", n)
+	}
+	for i := 1; i < 3; i++ {
+		if rec.Column(i).NullN() == 0 {
+			t.Fatalf("expected nulls in nullable column %s", schema.Field(i).Name)
+		}
+	}
+
+	again, err := generateSampleData(memory.NewGoAllocator(), schema, opts)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	defer again.Release()
+	if !array.RecordEqual(rec, again) {
+		t.Fatalf("same seed produced different sample data")
+	}
+}
+
+func TestGenerateSampleDataTypes(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "active", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}},
+		{Name: "day", Type: arrow.FixedWidthTypes.Date32},
+		{Name: "raw", Type: arrow.BinaryTypes.Binary},
+	}, nil)
+	rec, err := generateSampleData(memory.NewGoAllocator(), schema, sampleOptions{Rows: 5, Seed: 1})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	defer rec.Release()
+	if !rec.Schema().Equal(schema) {
+		t.Fatalf("expected sample schema %s, got %s", schema, rec.Schema())
+	}
+	for i, col := range rec.Columns() {
+		if !arrow.TypeEqual(col.DataType(), schema.Field(i).Type) {
+			t.Fatalf("column %s: expected %s, got %s", schema.Field(i).Name, schema.Field(i).Type, col.DataType())
+		}
+	}
+
+	unsupported := arrow.NewSchema([]arrow.Field{{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)}}, nil)
+	if _, err := generateSampleData(memory.NewGoAllocator(), unsupported, sampleOptions{Rows: 1}); err == nil || !strings.Contains(err.Error(), "unsupported sample type") {
+		t.Fatalf("expected an unsupported sample type error, got %v", err)
+	}
+}
+
+func TestLoadJSONFromPipe(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	for _, input := range []string{
+		`[{"id": 1, "name": "a"}, {"id": 2}]`,
+		"\n\t [{\"id\": 1, \"name\": \"a\"}, {\"id\": 2}]",
+		"{\"id\": 1, \"name\": \"a\"}\n{\"id\": 2}\n",
+	} {
+		pr, pw := io.Pipe()
+		go func() {
+			io.WriteString(pw, input)
+			pw.Close()
+		}()
+
+		rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), pr, schema, lockbox.JSONReadOptions{}, nil)
+		if err != nil {
+			t.Fatalf("load %q: %v", input, err)
+		}
+		if rec.NumRows() != 2 || !rec.Column(1).IsNull(1) {
+			t.Fatalf("unexpected record for %q: %v", input, rec)
+		}
+		rec.Release()
+	}
+}
+
+func TestLoadJSONLargeInt64(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "ratio", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+	}, nil)
+
+	// 2^53 + 1 has no exact float64 representation
+	rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(`[{"id": 9007199254740993, "ratio": 0.5}]`), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	if got := rec.Column(0).(*array.Int64).Value(0); got != 9007199254740993 {
+		t.Fatalf("expected 9007199254740993, got %d", got)
+	}
+	if got := rec.Column(1).(*array.Float64).Value(0); got != 0.5 {
+		t.Fatalf("expected 0.5, got %v", got)
+	}
+}
+
+func TestLoadJSONDictionary(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "status", Type: lockbox.DictionaryStringType, Nullable: true},
+	}, nil)
+
+	input := `{"status": "open"}` + "\n" + `{"status": null}` + "\n" + `{"status": "open"}` + "\n"
+	rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+
+	col := rec.Column(0).(*array.Dictionary)
+	if col.Len() != 3 || col.Dictionary().Len() != 1 || !col.IsNull(1) {
+		t.Fatalf("unexpected dictionary column %v", col)
+	}
+}
+
+func TestLoadJSONRejectsScalar(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	if _, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader("  42\n"), schema, lockbox.JSONReadOptions{}, nil); err == nil {
+		t.Fatalf("expected error for scalar JSON input")
+	}
+}
+
+func TestLoadJSONNested(t *testing.T) {
+	// orders: list<struct<sku, tags: list<string>>>; address: struct<city, geo: struct<lat, lon>>
+	item := arrow.StructOf(
+		arrow.Field{Name: "sku", Type: arrow.BinaryTypes.String, Nullable: false},
+		arrow.Field{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+	)
+	geo := arrow.StructOf(
+		arrow.Field{Name: "lat", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+		arrow.Field{Name: "lon", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+	)
+	address := arrow.StructOf(
+		arrow.Field{Name: "city", Type: arrow.BinaryTypes.String, Nullable: true},
+		arrow.Field{Name: "geo", Type: geo, Nullable: true},
+	)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "orders", Type: arrow.ListOf(item), Nullable: true},
+		{Name: "address", Type: address, Nullable: true},
+	}, nil)
+
+	input := `[
+		{"id": 1, "orders": [{"sku": "a1", "tags": ["x", null, "y"]}, {"sku": "b2"}],
+		 "address": {"city": "Oslo", "geo": {"lat": 59.9, "lon": 10.7}}},
+		{"id": 2, "orders": [], "address": {"geo": null}},
+		{"id": 3}
+	]`
+	rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load nested json: %v", err)
+	}
+	defer rec.Release()
+
+	orders := rec.Column(1).(*array.List)
+	if orders.IsNull(0) || orders.IsNull(1) || !orders.IsNull(2) {
+		t.Fatalf("unexpected list validity: %v", orders)
+	}
+	if start, end := orders.ValueOffsets(0); end-start != 2 {
+		t.Fatalf("expected 2 orders in row 1, got %d", end-start)
+	}
+	tags := orders.ListValues().(*array.Struct).Field(1).(*array.List)
+	if !tags.ListValues().IsNull(1) || !tags.IsNull(1) {
+		t.Fatalf("unexpected nested tags: %v", tags)
+	}
+	addr := rec.Column(2).(*array.Struct)
+	if lat := addr.Field(1).(*array.Struct).Field(0).(*array.Float64).Value(0); lat != 59.9 {
+		t.Fatalf("expected lat 59.9, got %v", lat)
+	}
+	if !addr.Field(0).IsNull(1) || !addr.Field(1).IsNull(1) || !addr.IsNull(2) {
+		t.Fatalf("unexpected struct nulls: %v", addr)
+	}
+
+	// Round trip through an encrypted file and back out as JSON
+	tmpFile := "/tmp/test_json_nested.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec.Retain()
+	if err := lb.Write(context.Background(), rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	out, err := lb.Read(context.Background(), lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(rec, out) {
+		t.Fatalf("nested round trip mismatch:\n%v\n%v", rec, out)
+	}
+
+	rr, err := lb.NewReader(lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	defer rr.Release()
+	var buf strings.Builder
+	if err := exportJSON(&buf, rr, ""); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	again, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(buf.String()), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("reload exported json: %v\n%s", err, buf.String())
+	}
+	defer again.Release()
+	if !array.RecordEqual(rec, again) {
+		t.Fatalf("json export round trip mismatch:\n%s", buf.String())
+	}
+
+	for _, bad := range []string{
+		`[{"id": 1, "orders": {"sku": "a"}}]`,
+		`[{"id": 1, "orders": [{"tags": []}]}]`,
+		`[{"id": 1, "address": {"geo": {"lat": 1}}}]`,
+	} {
+		if _, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(bad), schema, lockbox.JSONReadOptions{}, nil); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestLoadJSONMap(t *testing.T) {
+	// scores: map<string, list<int64>>; labels: map<int32, string>
+	scores := arrow.MapOf(arrow.BinaryTypes.String, arrow.ListOf(arrow.PrimitiveTypes.Int64))
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "scores", Type: scores, Nullable: true},
+		{Name: "labels", Type: arrow.MapOf(arrow.PrimitiveTypes.Int32, arrow.BinaryTypes.String), Nullable: true},
+	}, nil)
+
+	input := `{"id": 1, "scores": {"math": [90, 85], "art": [], "gym": null}, "labels": {"2": "two", "1": "one"}}
+{"id": 2, "scores": {}}
+{"id": 3, "scores": null, "labels": {"7": null}}
+`
+	rec, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(input), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load map json: %v", err)
+	}
+	defer rec.Release()
+
+	m := rec.Column(1).(*array.Map)
+	if m.IsNull(0) || m.IsNull(1) || !m.IsNull(2) {
+		t.Fatalf("unexpected map validity: %v", m)
+	}
+	if start, end := m.ValueOffsets(1); end != start {
+		t.Fatalf("expected an empty map in row 2, got %d entries", end-start)
+	}
+	// Entries are in key order
+	keys := m.Keys().(*array.String)
+	if keys.Value(0) != "art" || keys.Value(1) != "gym" || keys.Value(2) != "math" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	items := m.Items().(*array.List)
+	if items.IsNull(0) || !items.IsNull(1) {
+		t.Fatalf("unexpected item validity: %v", items)
+	}
+	if start, end := items.ValueOffsets(2); end-start != 2 || items.ListValues().(*array.Int64).Value(int(start)) != 90 {
+		t.Fatalf("unexpected math scores: %v", items)
+	}
+	labels := rec.Column(2).(*array.Map)
+	if k := labels.Keys().(*array.Int32); k.Value(0) != 1 || k.Value(1) != 2 || k.Value(2) != 7 {
+		t.Fatalf("unexpected label keys: %v", k)
+	}
+	if !labels.IsNull(1) || !labels.Items().IsNull(2) {
+		t.Fatalf("unexpected label nulls: %v", labels)
+	}
+
+	// Round trip through an encrypted file and back out as JSON
+	tmpFile := "/tmp/test_json_map.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec.Retain()
+	if err := lb.Write(context.Background(), rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	rr, err := lb.NewReader(lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	defer rr.Release()
+	var buf strings.Builder
+	if err := exportJSON(&buf, rr, ""); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	again, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(buf.String()), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("reload exported json: %v\n%s", err, buf.String())
+	}
+	defer again.Release()
+	if !array.RecordEqual(rec, again) {
+		t.Fatalf("json export round trip mismatch:\n%s", buf.String())
+	}
+
+	for _, bad := range []string{
+		`{"id": 1, "scores": [1, 2]}`,
+		`{"id": 1, "scores": "math"}`,
+		`{"id": 1, "scores": {"math": 90}}`,
+		`{"id": 1, "labels": {"one": "1"}}`,
+	} {
+		_, err := loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(bad), schema, lockbox.JSONReadOptions{}, nil)
+		if err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+	_, err = loadJSON(context.Background(), memory.NewGoAllocator(), strings.NewReader(`{"id": 1, "scores": [1]}`), schema, lockbox.JSONReadOptions{}, nil)
+	if !strings.Contains(err.Error(), "expected object for map") {
+		t.Fatalf("expected a map error, got %v", err)
+	}
+}
+
+func TestLoadersReleaseAllocations(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	rec, err := loadCSV(context.Background(), mem, strings.NewReader("id,name\n1,a\n2,\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	rec.Release()
+
+	rec, err = loadJSON(context.Background(), mem, strings.NewReader(`[{"id": 1, "name": "a"}, {"id": 2}]`), schema, lockbox.JSONReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	rec.Release()
+
+	// Failed loads must not leak their partially built columns
+	if _, err := loadCSV(context.Background(), mem, strings.NewReader("id,name\n1,a\nx,b\n"), schema, lockbox.CSVReadOptions{}, nil); err == nil {
+		t.Fatalf("expected csv error")
+	}
+	if _, err := loadJSON(context.Background(), mem, strings.NewReader(`[{"id": 1, "name": "a"}, {"id": "x"}]`), schema, lockbox.JSONReadOptions{}, nil); err == nil {
+		t.Fatalf("expected json error")
+	}
+
+	// Parquet batches are coerced to the schema, and released when the
+	// coercion fails
+	pqSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), pqSchema)
+	b.Field(0).(*array.Int32Builder).AppendValues([]int32{1, 2, 3}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "", "c"}, []bool{true, false, true})
+	pqRec := b.NewRecord()
+	b.Release()
+	path := "/tmp/test_loaders_release.parquet"
+	defer os.Remove(path)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create parquet: %v", err)
+	}
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(1))
+	w, err := pqarrow.NewFileWriter(pqSchema, f, props, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		t.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(pqRec); err != nil {
+		t.Fatalf("parquet write: %v", err)
+	}
+	pqRec.Release()
+	if err := w.Close(); err != nil {
+		t.Fatalf("parquet close: %v", err)
+	}
+
+	for _, threads := range []int{1, 2} {
+		rec, err = loadDataFromORCToParquet(context.Background(), mem, path, schema, threads, time.UTC, nil)
+		if err != nil {
+			t.Fatalf("load parquet: %v", err)
+		}
+		if rec.NumRows() != 3 || !rec.Schema().Equal(schema) {
+			t.Fatalf("unexpected record %v", rec)
+		}
+		rec.Release()
+
+		wider := arrow.NewSchema(append(schema.Fields(), arrow.Field{Name: "extra", Type: arrow.PrimitiveTypes.Int64}), nil)
+		if _, err := loadDataFromORCToParquet(context.Background(), mem, path, wider, threads, time.UTC, nil); err == nil {
+			t.Fatalf("expected a coercion error")
+		}
+	}
+}
+
+func TestCheckParquetSchema(t *testing.T) {
+	pqSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), pqSchema)
+	b.Field(0).(*array.StringBuilder).Append("1")
+	b.Field(1).(*array.StringBuilder).Append("a")
+	rec := b.NewRecord()
+	b.Release()
+	path := "/tmp/test_check_parquet_schema.parquet"
+	defer os.Remove(path)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create parquet: %v", err)
+	}
+	w, err := pqarrow.NewFileWriter(pqSchema, f, nil, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		t.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("parquet write: %v", err)
+	}
+	rec.Release()
+	if err := w.Close(); err != nil {
+		t.Fatalf("parquet close: %v", err)
+	}
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "age", Type: arrow.PrimitiveTypes.Int32},
+	}, nil)
+	err = checkParquetSchema(path, schema, nil)
+	if !errors.Is(err, lockbox.ErrSchemaMismatch) || !strings.Contains(err.Error(), "column id: cannot convert utf8 to int64") || !strings.Contains(err.Error(), "missing column age") {
+		t.Fatalf("expected both problems in one error, got %v", err)
+	}
+	if err := checkParquetSchema(path, arrow.NewSchema(schema.Fields()[1:2], nil), nil); err == nil {
+		t.Fatalf("expected a misplaced column error")
+	}
+	if err := checkParquetSchema(path, pqSchema, nil); err != nil {
+		t.Fatalf("expected a matching schema to pass, got %v", err)
+	}
+}
+
+func TestLoadCancelled(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	input := "id\n" + strings.Repeat("1\n", 10240)
+	if _, err := loadCSV(ctx, mem, strings.NewReader(input), schema, lockbox.CSVReadOptions{}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected csv load to be cancelled, got %v", err)
+	}
+	objects := strings.Repeat(`{"id": 1}`+"\n", 10240)
+	if _, err := loadJSON(ctx, mem, strings.NewReader(objects), schema, lockbox.JSONReadOptions{}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected json load to be cancelled, got %v", err)
+	}
+
+	tmpFile := "/tmp/test_write_cancelled.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("id\n1\n2\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	if _, err := writeChunks(ctx, lb, rec, 0, 1, "input", []lockbox.Option{lockbox.WithPassword(password)}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected write to be cancelled, got %v", err)
+	}
+	if lb.SegmentCount() != 0 {
+		t.Fatalf("expected no segments after a cancelled write, got %d", lb.SegmentCount())
+	}
+}
+
+func TestSampleAndBlobLoadersUseAllocator(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "doc", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	rec, err := generateSampleData(mem, schema, sampleOptions{Rows: 10, Seed: 1})
+	if err != nil {
+		t.Fatalf("sample: %v", err)
+	}
+	if mem.CurrentAlloc() == 0 {
+		t.Fatalf("sample data was not built from the given allocator")
+	}
+	rec.Release()
+
+	blobSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "doc", Type: arrow.BinaryTypes.Binary, Nullable: true},
+	}, nil)
+	rec, err = lockbox.LoadBlobRecord(map[string]io.Reader{"doc": strings.NewReader("payload")}, blobSchema, lockbox.ReadOptions{Allocator: mem})
+	if err != nil {
+		t.Fatalf("blob: %v", err)
+	}
+	if mem.CurrentAlloc() == 0 {
+		t.Fatalf("blob record was not built from the given allocator")
+	}
+	rec.Release()
+}
+
+func TestAddBlobColumns(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "doc", Type: arrow.BinaryTypes.Binary, Nullable: false},
+		{Name: "title", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	mem := memory.NewGoAllocator()
+	blobFields := map[string]string{"doc": "scan.pdf"}
+
+	meta, err := loadCSV(context.Background(), mem, strings.NewReader("id,title\n1,first\n2,second\n"), withoutFields(schema, blobFields), lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer meta.Release()
+
+	rec, err := addBlobColumns(mem, schema, meta, map[string]io.Reader{"doc": strings.NewReader("%PDF")})
+	if err != nil {
+		t.Fatalf("add blobs: %v", err)
+	}
+	defer rec.Release()
+	if err := checkRecordSchema(schema, rec, false, false, time.UTC); err != nil {
+		t.Fatalf("mixed record does not match the schema: %v", err)
+	}
+	docs := rec.Column(1).(*array.Binary)
+	if rec.NumRows() != 2 || string(docs.Value(0)) != "%PDF" || string(docs.Value(1)) != "%PDF" {
+		t.Fatalf("expected the blob on every row, got %v", docs)
+	}
+	if rec.Column(2).(*array.String).Value(1) != "second" {
+		t.Fatalf("input columns were not kept: %v", rec)
+	}
+
+	if _, err := addBlobColumns(mem, schema, meta, map[string]io.Reader{"missing": strings.NewReader("")}); err == nil {
+		t.Fatalf("expected an error for an unknown blob field")
+	}
+}
+
+func TestLoadBlobDir(t *testing.T) {
+	dir := "/tmp/test_blobdir"
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir+"/nested.pdf", 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, data := range map[string]string{"b.pdf": "second", "a.pdf": "first", "notes.txt": "skip"} {
+		if err := os.WriteFile(dir+"/"+name, []byte(data), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "filename", Type: arrow.BinaryTypes.String, Nullable: false},
+		{Name: "doc", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		{Name: "tag", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	opts := blobDirOptions{Field: "doc", Dir: dir, Glob: "*.pdf", NameField: "filename"}
+	rec, err := loadBlobDir(context.Background(), memory.NewGoAllocator(), schema, opts)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+
+	names, docs := rec.Column(0).(*array.String), rec.Column(1).(*array.Binary)
+	if rec.NumRows() != 2 || names.Value(0) != "a.pdf" || names.Value(1) != "b.pdf" {
+		t.Fatalf("expected a.pdf and b.pdf, got %v", names)
+	}
+	if string(docs.Value(0)) != "first" || string(docs.Value(1)) != "second" || rec.Column(2).NullN() != 2 {
+		t.Fatalf("unexpected row contents: %v", rec)
+	}
+
+	opts.NameField = "path"
+	if _, err := loadBlobDir(context.Background(), memory.NewGoAllocator(), schema, opts); err == nil {
+		t.Fatalf("expected an error for a missing filename field")
+	}
+}
+
+func TestLoadCompressedInput(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	data := "id,name\n1,a\n2,b\n"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(data))
+	gw.Close()
+
+	var zs bytes.Buffer
+	zw, err := zstd.NewWriter(&zs)
+	if err != nil {
+		t.Fatalf("zstd writer: %v", err)
+	}
+	zw.Write([]byte(data))
+	zw.Close()
+
+	load := func(r io.Reader) (arrow.Record, error) {
+		return loadCSV(context.Background(), memory.NewGoAllocator(), r, schema, lockbox.CSVReadOptions{Delimiter: ','}, nil)
+	}
+	for _, tc := range []struct {
+		path        string
+		compression string
+		content     []byte
+	}{
+		{"/tmp/test_input.csv.gz", "auto", gz.Bytes()},
+		{"/tmp/test_input.csv.zst", "auto", zs.Bytes()},
+		{"/tmp/test_input_gz.csv", "auto", gz.Bytes()},
+		{"/tmp/test_input_zst.csv", "auto", zs.Bytes()},
+		{"/tmp/test_input_forced.csv", "zstd", zs.Bytes()},
+		{"/tmp/test_input_plain.csv", "auto", []byte(data)},
+		{"/tmp/test_input_plain.csv.gz", "none", []byte(data)},
+	} {
+		if err := os.WriteFile(tc.path, tc.content, 0o600); err != nil {
+			t.Fatalf("write %s: %v", tc.path, err)
+		}
+		rec, err := loadInput(tc.path, tc.compression, load)
+		os.Remove(tc.path)
+		if err != nil {
+			t.Fatalf("load %s (%s): %v", tc.path, tc.compression, err)
+		}
+		if rec.NumRows() != 2 {
+			t.Fatalf("%s: expected 2 rows, got %d", tc.path, rec.NumRows())
+		}
+		rec.Release()
+	}
+
+	path := "/tmp/test_input_bad.csv"
+	os.WriteFile(path, []byte(data), 0o600)
+	defer os.Remove(path)
+	if _, err := loadInput(path, "gzip", load); err == nil {
+		t.Fatalf("expected error for plain input read as gzip")
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	_, err := lockbox.Open("/tmp/test_missing.lbx", lockbox.WithPassword("pw"))
+	if err := openError("/tmp/test_missing.lbx", err); !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected a missing file error, got %v", err)
+	}
+
+	tmpFile := "/tmp/test_open_error.lbx"
+	defer os.Remove(tmpFile)
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword("right"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lb.Close()
+
+	_, err = lockbox.Open(tmpFile, lockbox.WithPassword("wrong"))
+	if err := openError(tmpFile, err); !strings.Contains(err.Error(), "password or key is wrong") {
+		t.Fatalf("expected a wrong password error, got %v", err)
+	}
+}
+
+func TestCheckWriteTarget(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	tmpFile := "/tmp/test_write_target.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	if err := checkWriteTarget(tmpFile, lb, false); err != nil {
+		t.Fatalf("expected an empty file to need no flag, got %v", err)
+	}
+
+	rec, err := loadCSV(context.Background(), memory.NewGoAllocator(), strings.NewReader("id\n1\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := lb.Write(context.Background(), rec, lockbox.WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := checkWriteTarget(tmpFile, lb, false); err == nil || !strings.Contains(err.Error(), "append") {
+		t.Fatalf("expected a file with rows to need --append, got %v", err)
+	}
+	if err := checkWriteTarget(tmpFile, lb, true); err != nil {
+		t.Fatalf("expected --append to allow the write, got %v", err)
+	}
+}
+
+func TestWriteChunksResume(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	tmpFile := "/tmp/test_write_chunks.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	rec, err := loadCSV(ctx, memory.NewGoAllocator(), strings.NewReader("id\n1\n2\n3\n4\n5\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+
+	// Resume as if rows 1-2 were committed before an interruption
+	rows, err := writeChunks(ctx, lb, rec, 2, 2, "input", []lockbox.Option{lockbox.WithPassword(password)})
+	if err != nil {
+		t.Fatalf("write chunks: %v", err)
+	}
+	state, ok := lb.IngestState()
+	if rows != 3 || !ok || state.Rows != 5 || !state.Complete {
+		t.Fatalf("expected 3 rows written and a complete ingest, got %d and %+v", rows, state)
+	}
+	if n, _ := lb.Count(ctx, lockbox.WithPassword(password)); n != 3 {
+		t.Fatalf("expected rows 3-5 only, got %d rows", n)
+	}
+}
+
+func TestWriteSortedResume(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	tmpFile := "/tmp/test_write_sorted.lbx"
+	spillDir := "/tmp/test_write_sorted_spill"
+	defer os.Remove(tmpFile)
+	if err := os.MkdirAll(spillDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	defer os.RemoveAll(spillDir)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := lockbox.Create(tmpFile, schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	input, err := lockbox.NewCSVReader(ctx, strings.NewReader("id\n5\n3\n1\n4\n2\n"), schema, lockbox.CSVReadOptions{BatchRows: 3})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	sorted, err := lockbox.SortSpilled(ctx, input, []string{"id"}, 2, spillDir)
+	input.Release()
+	if err != nil {
+		t.Fatalf("sort: %v", err)
+	}
+	defer sorted.Release()
+
+	// Resume as if the first chunk, ids 1-2, was committed before an
+	// interruption
+	opts := []lockbox.Option{lockbox.WithPassword(password), lockbox.WithSortBy("id")}
+	rows, err := writeSorted(ctx, lb, sorted, 2, "input", opts)
+	if err != nil {
+		t.Fatalf("write sorted: %v", err)
+	}
+	state, ok := lb.IngestState()
+	if rows != 3 || !ok || state.Rows != 5 || !state.Complete {
+		t.Fatalf("expected 3 rows written and a complete ingest, got %d and %+v", rows, state)
+	}
+	out, err := lb.Read(ctx, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer out.Release()
+	if got := out.Column(0).(*array.Int64).Int64Values(); !slices.Equal(got, []int64{3, 4, 5}) {
+		t.Fatalf("expected ids 3-5 in order, got %v", got)
+	}
+}
+
+func TestCheckRecordSchema(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	narrow := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: false},
+	}, nil)
+
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), narrow)
+	defer b.Release()
+	b.Field(0).(*array.Int32Builder).AppendValues([]int32{1, 2}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	if err := checkRecordSchema(schema, rec, false, false, time.UTC); !errors.Is(err, lockbox.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch without coerce, got %v", err)
+	}
+	if err := checkRecordSchema(schema, rec, true, true, time.UTC); err != nil {
+		t.Fatalf("expected int32 input to coerce: %v", err)
+	}
+
+	// Truncating floats is lossy, so --strict-coerce refuses it
+	floats := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Float64, Nullable: false},
+	}, nil)
+	fb := array.NewRecordBuilder(memory.NewGoAllocator(), floats)
+	defer fb.Release()
+	fb.Field(0).(*array.Float64Builder).AppendValues([]float64{1.5, 2}, nil)
+	frec := fb.NewRecord()
+	defer frec.Release()
+	if err := checkRecordSchema(schema, frec, true, false, time.UTC); err != nil {
+		t.Fatalf("expected float input to coerce: %v", err)
+	}
+	if err := checkRecordSchema(schema, frec, true, true, time.UTC); !errors.Is(err, lockbox.ErrSchemaMismatch) {
+		t.Fatalf("expected --strict-coerce to refuse truncation, got %v", err)
+	}
+}
+
+func TestWriteShards(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	pattern := "/tmp/test_write_shard-%02d.lbx"
+	password := "test_password_123"
+	ctx := context.Background()
+
+	for _, bad := range []string{"/tmp/test_write_shard.lbx", "/tmp/test_write_shard-%s.lbx", "/tmp/test_write_shard-%d-%d.lbx"} {
+		if _, err := shardPaths(bad, 3); err == nil {
+			t.Fatalf("%s: expected an invalid pattern error", bad)
+		}
+	}
+	paths, err := shardPaths(pattern, 3)
+	if err != nil {
+		t.Fatalf("shard paths: %v", err)
+	}
+	for _, path := range paths {
+		defer os.Remove(path)
+	}
+
+	rec, err := loadCSV(ctx, memory.NewGoAllocator(), strings.NewReader("id\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"), schema, lockbox.CSVReadOptions{}, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	defer rec.Release()
+	creds := []lockbox.Option{lockbox.WithPassword(password)}
+	if err := writeShards(ctx, rec, schema, paths, creds, creds, map[string]string{"source": "crm"}); err != nil {
+		t.Fatalf("write shards: %v", err)
+	}
+
+	var ids []int64
+	for i, path := range paths {
+		lb, err := lockbox.Open(path, creds...)
+		if err != nil {
+			t.Fatalf("open %s: %v", path, err)
+		}
+		props, err := lb.Metadata(creds...)
+		if err != nil {
+			t.Fatalf("metadata: %v", err)
+		}
+		if props[shardProperty] != strconv.Itoa(i) || props[shardsProperty] != "3" || props["source"] != "crm" {
+			t.Fatalf("unexpected properties for shard %d: %v", i, props)
+		}
+		out, err := lb.Read(ctx, creds...)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		ids = append(ids, out.Column(0).(*array.Int64).Int64Values()...)
+		out.Release()
+		lb.Close()
+	}
+	if !slices.Equal(ids, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Fatalf("shards in order should restore the input, got %v", ids)
+	}
+
+	if _, err := shardPaths(pattern, 3); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing shards to be refused, got %v", err)
+	}
+}
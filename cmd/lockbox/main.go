@@ -14,7 +14,7 @@ func main() {
 
 	// Execute the root command
 	if err := cmd.Execute(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to execute command")
-		os.Exit(1)
+		log.Error().Err(err).Msg("Failed to execute command")
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Names of the AEAD ciphers used for column data
+const (
+	CipherAES256GCM        = "AES-256-GCM"
+	CipherChaCha20Poly1305 = "ChaCha20-Poly1305"
+
+	// DefaultCipher is used when no cipher is chosen, and for files that
+	// predate the choice
+	DefaultCipher = CipherAES256GCM
+)
+
+// ErrUnsupportedCipher is returned for a cipher this build does not provide
+var ErrUnsupportedCipher = errors.New("unsupported cipher")
+
+// ciphers maps each available cipher to its AEAD constructor. Every cipher
+// takes a KeySize key and a NonceSize nonce.
+var ciphers = map[string]func(key []byte) (cipher.AEAD, error){
+	CipherAES256GCM: newAESGCM,
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CipherName returns the canonical name of an available cipher, matching
+// name case-insensitively. An empty name selects DefaultCipher.
+func CipherName(name string) (string, error) {
+	if name == "" {
+		return DefaultCipher, nil
+	}
+	for known := range ciphers {
+		if strings.EqualFold(known, name) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q (available: %s)", ErrUnsupportedCipher, name, strings.Join(Ciphers(), ", "))
+}
+
+// Ciphers lists the ciphers available in this build
+func Ciphers() []string {
+	names := make([]string, 0, len(ciphers))
+	for name := range ciphers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newAEAD creates the named cipher keyed with key
+func newAEAD(name string, key []byte) (cipher.AEAD, error) {
+	name, err := CipherName(name)
+	if err != nil {
+		return nil, err
+	}
+	return ciphers[name](key)
+}
@@ -0,0 +1,9 @@
+//go:build !nochacha20
+
+package crypto
+
+import "golang.org/x/crypto/chacha20poly1305"
+
+func init() {
+	ciphers[CipherChaCha20Poly1305] = chacha20poly1305.New
+}
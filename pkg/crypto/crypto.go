@@ -49,6 +49,12 @@ type Key struct {
 type ColumnEncryptor struct {
 	key    []byte
 	cipher cipher.AEAD
+	// nonces issues a unique nonce for every Encrypt call
+	nonces *nonceSource
+	// aad is the associated data every block is sealed with
+	aad []byte
+	// cipherName is the AEAD used for the hybrid key; empty means DefaultCipher
+	cipherName string
 	// PQ components
 	KyberPublicKey kyber.Point
 	KyberSecretKey kyber.Scalar
@@ -81,6 +87,12 @@ func DeriveKey(password string, salt []byte) *Key {
 	// Derive classical key
 	key := pbkdf2.Key([]byte(password), salt, PBKDF2Iterations, KeySize, sha256.New)
 
+	return KeyFromData(key, salt)
+}
+
+// KeyFromData rebuilds a key, including its PQ components, from raw key
+// material such as a data key unwrapped for a recipient
+func KeyFromData(key, salt []byte) *Key {
 	// Derive Kyber keys deterministically from the master key
 	secret := Suite.Scalar().SetBytes(key)
 	public := Suite.Point().Mul(secret, nil)
@@ -109,12 +121,40 @@ func NewColumnEncryptor(key []byte) (*ColumnEncryptor, error) {
 		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
+	nonces, err := newNonceSource()
+	if err != nil {
+		return nil, err
+	}
+
 	return &ColumnEncryptor{
 		key:    key,
 		cipher: gcm,
+		nonces: nonces,
 	}, nil
 }
 
+// SetCipher selects the AEAD used for column data, by name. An empty name
+// selects DefaultCipher.
+func (ce *ColumnEncryptor) SetCipher(name string) error {
+	name, err := CipherName(name)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(name, ce.key)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	ce.cipher = aead
+	ce.cipherName = name
+	return nil
+}
+
+// SetAAD sets the associated data that Encrypt binds to each ciphertext
+// and Decrypt requires. Decryption with different data fails.
+func (ce *ColumnEncryptor) SetAAD(aad []byte) {
+	ce.aad = aad
+}
+
 // Encrypt encrypts data using hybrid classical + post-quantum encryption
 func (ce *ColumnEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
 	// Generate ephemeral keypair for perfect forward secrecy
@@ -135,25 +175,19 @@ func (ce *ColumnEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
 	sha256Hash.Write(sharedBytes)
 	copy(hybridKey, sha256Hash.Sum(nil))
 
-	// Create new AES-GCM cipher with hybrid key
-	block, err := aes.NewCipher(hybridKey)
+	// Create the AEAD with the hybrid key
+	gcm, err := newAEAD(ce.cipherName, hybridKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create hybrid cipher: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	nonce, err := ce.nonces.next()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create hybrid GCM: %w", err)
-	}
-
-	// Generate nonce
-	nonce := make([]byte, NonceSize)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		return nil, err
 	}
 
 	// Encrypt with hybrid key
-	ciphertextFinal := gcm.Seal(nil, nonce, plaintext, nil)
+	ciphertextFinal := gcm.Seal(nil, nonce, plaintext, ce.aad)
 
 	// Format: [ephemeral_public_key][nonce][encrypted_data]
 	ephemeralPubBytes, err := ephemeralPublic.MarshalBinary()
@@ -200,19 +234,14 @@ func (ce *ColumnEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 	sha256Hash.Write(sharedBytes)
 	copy(hybridKey, sha256Hash.Sum(nil))
 
-	// Create new AES-GCM cipher with hybrid key
-	block, err := aes.NewCipher(hybridKey)
+	// Create the AEAD with the hybrid key
+	gcm, err := newAEAD(ce.cipherName, hybridKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create hybrid cipher: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create hybrid GCM: %w", err)
-	}
-
 	// Decrypt with hybrid key
-	plaintext, err := gcm.Open(nil, nonce, encryptedData, nil)
+	plaintext, err := gcm.Open(nil, nonce, encryptedData, ce.aad)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
@@ -0,0 +1,205 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// IdentityPrefix marks an encoded X25519 private key
+	IdentityPrefix = "lbx-sk-"
+	// RecipientPrefix marks an encoded X25519 public key
+	RecipientPrefix = "lbx-pk-"
+
+	wrapInfo = "lockbox key wrap v1"
+)
+
+// ErrUnwrapFailed is returned when a password does not open a sealed key
+var ErrUnwrapFailed = errors.New("failed to unwrap key")
+
+// ErrNoMatchingIdentity is returned when none of the provided identities can
+// unwrap a data key
+var ErrNoMatchingIdentity = errors.New("no identity matches a recipient of this file")
+
+// Identity is an X25519 private key able to unwrap data keys
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// Recipient is an X25519 public key that data keys are wrapped for
+type Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// GenerateIdentity creates a new random identity
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentity decodes an identity produced by Identity.String
+func ParseIdentity(s string) (*Identity, error) {
+	raw, err := decodeKey(s, IdentityPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseRecipient decodes a recipient produced by Recipient.String
+func ParseRecipient(s string) (*Recipient, error) {
+	raw, err := decodeKey(s, RecipientPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return &Recipient{key: key}, nil
+}
+
+// Recipient returns the public half of the identity
+func (id *Identity) Recipient() *Recipient {
+	return &Recipient{key: id.key.PublicKey()}
+}
+
+// String encodes the identity; keep it secret
+func (id *Identity) String() string {
+	return IdentityPrefix + base64.RawURLEncoding.EncodeToString(id.key.Bytes())
+}
+
+// String encodes the recipient for sharing
+func (r *Recipient) String() string {
+	return RecipientPrefix + base64.RawURLEncoding.EncodeToString(r.key.Bytes())
+}
+
+// Bytes returns the raw public key
+func (r *Recipient) Bytes() []byte {
+	return r.key.Bytes()
+}
+
+// WrapKey encrypts dataKey for the recipient using an ephemeral X25519
+// exchange. It returns the ephemeral public key and the sealed data key.
+func WrapKey(dataKey []byte, r *Recipient) (ephemeral, wrapped []byte, err error) {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	aead, err := wrapCipher(eph, r.key, eph.PublicKey())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	wrapped = aead.Seal(nonce, nonce, dataKey, r.key.Bytes())
+	return eph.PublicKey().Bytes(), wrapped, nil
+}
+
+// UnwrapKey recovers a data key sealed by WrapKey
+func UnwrapKey(id *Identity, ephemeral, wrapped []byte) ([]byte, error) {
+	ephPub, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+	}
+	aead, err := wrapCipher(id.key, ephPub, ephPub)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, id.key.PublicKey().Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// SealKeyWithPassword encrypts dataKey under a key derived from password and
+// salt, so the password can later be changed without touching the data key.
+// params selects Argon2id; nil uses PBKDF2.
+func SealKeyWithPassword(dataKey []byte, password string, salt []byte, params *KDFParams) ([]byte, error) {
+	aead, err := passwordCipher(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, salt), nil
+}
+
+// OpenKeyWithPassword recovers a data key sealed by SealKeyWithPassword. A
+// wrong password returns ErrUnwrapFailed.
+func OpenKeyWithPassword(sealed []byte, password string, salt []byte, params *KDFParams) ([]byte, error) {
+	aead, err := passwordCipher(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed key too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, salt)
+	if err != nil {
+		return nil, ErrUnwrapFailed
+	}
+	return dataKey, nil
+}
+
+// passwordCipher derives the AES-GCM key that seals a data key for a password
+func passwordCipher(password string, salt []byte, params *KDFParams) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(passwordKey(password, salt, params))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapCipher derives the AES-GCM key shared between priv and peer
+func wrapCipher(priv *ecdh.PrivateKey, peer, ephemeral *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	key, err := hkdf.Key(sha256.New, shared, ephemeral.Bytes(), wrapInfo, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive wrap key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodeKey(s, prefix string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return nil, fmt.Errorf("expected %s prefix", prefix)
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, prefix))
+}
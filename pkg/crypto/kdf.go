@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// MinKDFMemory is the smallest accepted Argon2id memory cost in KiB
+	MinKDFMemory = 8 * 1024
+	// MaxKDFMemory is the largest accepted Argon2id memory cost in KiB
+	MaxKDFMemory = 4 * 1024 * 1024
+	// MinKDFIterations is the smallest accepted Argon2id time cost
+	MinKDFIterations = 2
+	// MaxKDFParallelism is the most lanes Argon2id supports
+	MaxKDFParallelism = 255
+)
+
+// KDFParams configures Argon2id password hashing. Memory is in KiB.
+type KDFParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint32
+}
+
+// Validate rejects parameters too weak to slow down a password search, or
+// too large to run
+func (p *KDFParams) Validate() error {
+	if p.Memory < MinKDFMemory || p.Memory > MaxKDFMemory {
+		return fmt.Errorf("kdf memory must be between %d and %d KiB, got %d", MinKDFMemory, MaxKDFMemory, p.Memory)
+	}
+	if p.Iterations < MinKDFIterations {
+		return fmt.Errorf("kdf iterations must be at least %d, got %d", MinKDFIterations, p.Iterations)
+	}
+	if p.Parallelism < 1 || p.Parallelism > MaxKDFParallelism {
+		return fmt.Errorf("kdf parallelism must be between 1 and %d, got %d", MaxKDFParallelism, p.Parallelism)
+	}
+	return nil
+}
+
+// passwordKey stretches password into a key. Nil params select PBKDF2, which
+// files created without KDF parameters use.
+func passwordKey(password string, salt []byte, params *KDFParams) []byte {
+	if params == nil {
+		return pbkdf2.Key([]byte(password), salt, PBKDF2Iterations, KeySize, sha256.New)
+	}
+	return argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, uint8(params.Parallelism), KeySize)
+}
@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrNoncesExhausted is returned once an encryptor has issued every nonce
+// its counter can represent
+var ErrNoncesExhausted = errors.New("nonce counter exhausted")
+
+// nonceSource issues the AEAD nonces of one encryptor. Each nonce is a
+// random base, drawn when the source is created, with a 64-bit counter
+// XORed into its last eight bytes. The counter only moves forward, so a
+// source never repeats a nonce, and refuses to wrap around. Writers of the
+// same file each get a fresh base, so nonces from different sessions only
+// meet if their bases land within a few counter steps of each other, which
+// for 96-bit random bases is negligible. The hybrid key of every block also
+// mixes in a fresh ephemeral key, so a repeated nonce would still not be
+// used twice under one key.
+type nonceSource struct {
+	base    [NonceSize]byte
+	counter atomic.Uint64
+}
+
+// newNonceSource draws a random base
+func newNonceSource() (*nonceSource, error) {
+	ns := &nonceSource{}
+	if _, err := io.ReadFull(rand.Reader, ns.base[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce base: %w", err)
+	}
+	return ns, nil
+}
+
+// next returns the next nonce. It is safe for concurrent use.
+func (ns *nonceSource) next() ([]byte, error) {
+	n := ns.counter.Add(1)
+	if n == 0 {
+		ns.counter.Store(^uint64(0))
+		return nil, ErrNoncesExhausted
+	}
+	nonce := ns.base
+	low := binary.BigEndian.Uint64(nonce[NonceSize-8:])
+	binary.BigEndian.PutUint64(nonce[NonceSize-8:], low^n)
+	return nonce[:], nil
+}
+
+// BlockNonce returns the nonce of a ColumnEncryptor ciphertext, which
+// follows the ephemeral public key. ciphertext may be just that prefix.
+func BlockNonce(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < KyberPublicKeySize+NonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return ciphertext[KyberPublicKeySize : KyberPublicKeySize+NonceSize], nil
+}
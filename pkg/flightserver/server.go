@@ -0,0 +1,304 @@
+// Package flightserver serves lockbox files over Arrow Flight. Files under a
+// root directory are exposed by their relative path; clients present a
+// bearer token on every call and the file password on every DoGet, and
+// receive the decrypted record batches as they are read.
+package flightserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys read from incoming calls
+const (
+	// AuthorizationHeader carries "Bearer <token>" on every call
+	AuthorizationHeader = "authorization"
+	// PasswordHeader carries the password of the file a DoGet streams
+	PasswordHeader = "lockbox-password"
+)
+
+// Extension is the file extension ListFlights looks for
+const Extension = ".lbx"
+
+// Config configures a Server
+type Config struct {
+	// Root is the directory whose lockbox files are served
+	Root string
+	// Token is the bearer token clients must present
+	Token string
+	// TLSCert and TLSKey are PEM files; without them the server listens in
+	// plaintext
+	TLSCert string
+	TLSKey  string
+	// NoLock opens files without a shared lock, see lockbox.WithNoLock
+	NoLock bool
+}
+
+// Server is an Arrow Flight service over the lockbox files in a directory
+type Server struct {
+	flight.BaseFlightServer
+	root   string
+	token  []byte
+	noLock bool
+	grpc   *grpc.Server
+}
+
+// New returns a server for cfg. A token is required.
+func New(cfg Config) (*Server, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("a client token is required")
+	}
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %w", err)
+	}
+	if st, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("failed to open root: %w", err)
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("root %s is not a directory", root)
+	}
+
+	s := &Server{root: root, token: []byte(cfg.Token), noLock: cfg.NoLock}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.authUnary),
+		grpc.ChainStreamInterceptor(s.authStream),
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s.grpc = grpc.NewServer(opts...)
+	flight.RegisterFlightServiceServer(s.grpc, s)
+	return s, nil
+}
+
+// Serve accepts connections on lis until ctx is cancelled, then waits for
+// running streams to finish
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.grpc.GracefulStop()
+		case <-stopped:
+		}
+	}()
+	err := s.grpc.Serve(lis)
+	close(stopped)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// authorize checks the bearer token of an incoming call
+func (s *Server) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(AuthorizationHeader) {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), s.token) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (s *Server) authUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// resolve maps a slash-separated path relative to the root to a file on
+// disk. Paths are cleaned as if rooted, so ".." never leaves the root.
+func (s *Server) resolve(name string) (string, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if rel == "" {
+		return "", status.Error(codes.InvalidArgument, "empty path")
+	}
+	filename := filepath.Join(s.root, filepath.FromSlash(rel))
+	st, err := os.Stat(filename)
+	if err != nil {
+		return "", status.Errorf(codes.NotFound, "no lockbox file %s", rel)
+	}
+	if !st.Mode().IsRegular() {
+		return "", status.Errorf(codes.NotFound, "%s is not a file", rel)
+	}
+	return filename, nil
+}
+
+// descriptorPath returns the path a descriptor names
+func descriptorPath(desc *flight.FlightDescriptor) (string, error) {
+	if desc.GetType() != flight.DescriptorPATH {
+		return "", status.Error(codes.InvalidArgument, "only PATH descriptors are supported")
+	}
+	return path.Join(desc.GetPath()...), nil
+}
+
+// flightInfo describes the file at name, relative to the root, from its
+// plaintext metadata
+func (s *Server) flightInfo(name string) (*flight.FlightInfo, error) {
+	filename, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := lockbox.ReadInfo(filename)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: %v", name, err)
+	}
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(info.Schema, memory.DefaultAllocator),
+		FlightDescriptor: &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: strings.Split(name, "/")},
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: []byte(name)}}},
+		TotalRecords:     info.RowCount,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// GetFlightInfo describes a file without a password. The endpoint ticket
+// is the path to pass to DoGet.
+func (s *Server) GetFlightInfo(_ context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	name, err := descriptorPath(desc)
+	if err != nil {
+		return nil, err
+	}
+	return s.flightInfo(name)
+}
+
+// GetSchema returns the schema of a file without a password
+func (s *Server) GetSchema(_ context.Context, desc *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	name, err := descriptorPath(desc)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.flightInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	return &flight.SchemaResult{Schema: info.Schema}, nil
+}
+
+// ListFlights describes every lockbox file under the root. Files that
+// cannot be read are logged and skipped.
+func (s *Server) ListFlights(_ *flight.Criteria, stream flight.FlightService_ListFlightsServer) error {
+	return filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := stream.Context().Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != Extension {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		info, err := s.flightInfo(filepath.ToSlash(rel))
+		if err != nil {
+			log.Warn().Err(err).Str("file", p).Msg("Skipping unreadable lockbox file")
+			return nil
+		}
+		return stream.Send(info)
+	})
+}
+
+// DoGet decrypts the file the ticket names with the password in the
+// lockbox-password header, streaming one record batch per segment
+func (s *Server) DoGet(ticket *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	ctx := stream.Context()
+	name := string(ticket.GetTicket())
+	filename, err := s.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	passwords := md.Get(PasswordHeader)
+	if len(passwords) == 0 || passwords[0] == "" {
+		return status.Errorf(codes.Unauthenticated, "the %s header is required", PasswordHeader)
+	}
+	password := lockbox.WithPassword(passwords[0])
+
+	opts := []lockbox.Option{password, lockbox.WithMode(lockbox.ReadOnly)}
+	if s.noLock {
+		opts = append(opts, lockbox.WithNoLock())
+	}
+	lb, err := lockbox.Open(filename, opts...)
+	if err != nil {
+		return openStatus(name, err)
+	}
+	defer lb.Close()
+
+	rr, err := lb.NewReader(password)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%s: %v", name, err)
+	}
+	defer rr.Release()
+
+	w := flight.NewRecordWriter(stream, ipc.WithSchema(rr.Schema()))
+	defer w.Close()
+
+	var rows int64
+	for rr.Next() {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := w.Write(rr.Record()); err != nil {
+			return err
+		}
+		rows += rr.Record().NumRows()
+	}
+	if err := rr.Err(); err != nil {
+		return status.Errorf(codes.DataLoss, "%s: %v", name, err)
+	}
+
+	log.Info().Str("file", name).Int64("rows", rows).Msg("Served lockbox")
+	return nil
+}
+
+// openStatus maps an error from lockbox.Open to a gRPC status
+func openStatus(name string, err error) error {
+	switch {
+	case errors.Is(err, lockbox.ErrWrongPassword), errors.Is(err, format.ErrPasswordDisabled):
+		return status.Errorf(codes.PermissionDenied, "%s: wrong password", name)
+	case errors.Is(err, lockbox.ErrCorrupt):
+		return status.Errorf(codes.DataLoss, "%s: %v", name, err)
+	case errors.Is(err, lockbox.ErrLocked):
+		return status.Errorf(codes.Unavailable, "%s: %v", name, err)
+	}
+	return status.Errorf(codes.Internal, "%s: %v", name, err)
+}
@@ -0,0 +1,162 @@
+package flightserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TFMV/lockbox/pkg/lockbox"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/flight"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestServer(t *testing.T) {
+	root := "/tmp/test_flight_root"
+	os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	password := "flight_password"
+	lb, err := lockbox.Create(filepath.Join(root, "sub", "people.lbx"), schema, lockbox.WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	mem := memory.NewGoAllocator()
+	for _, batch := range [][]string{{"a", "b", "c"}, {"d", "e"}} {
+		b := array.NewRecordBuilder(mem, schema)
+		for i, name := range batch {
+			b.Field(0).(*array.Int64Builder).Append(int64(i))
+			b.Field(1).(*array.StringBuilder).Append(name)
+		}
+		rec := b.NewRecord()
+		err := lb.Write(context.Background(), rec, lockbox.WithPassword(password))
+		rec.Release()
+		b.Release()
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	lb.Close()
+
+	srv, err := New(Config{Root: root, Token: "secret-token"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, lis) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Fatalf("Serve failed: %v", err)
+		}
+	}()
+
+	client, err := flight.NewClientWithMiddleware(lis.Addr().String(), nil, nil, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	authed := metadata.AppendToOutgoingContext(context.Background(), AuthorizationHeader, "Bearer secret-token")
+	desc := &flight.FlightDescriptor{Type: flight.DescriptorPATH, Path: []string{"sub", "people.lbx"}}
+
+	// Every call needs the token
+	if _, err := client.GetFlightInfo(context.Background(), desc); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a token, got %v", err)
+	}
+	wrongToken := metadata.AppendToOutgoingContext(context.Background(), AuthorizationHeader, "Bearer nope")
+	if _, err := client.GetFlightInfo(wrongToken, desc); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated with a wrong token, got %v", err)
+	}
+
+	info, err := client.GetFlightInfo(authed, desc)
+	if err != nil {
+		t.Fatalf("GetFlightInfo failed: %v", err)
+	}
+	if info.TotalRecords != 5 {
+		t.Fatalf("expected 5 records, got %d", info.TotalRecords)
+	}
+
+	list, err := client.ListFlights(authed, &flight.Criteria{})
+	if err != nil {
+		t.Fatalf("ListFlights failed: %v", err)
+	}
+	var listed []string
+	for {
+		fi, err := list.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ListFlights failed: %v", err)
+		}
+		listed = append(listed, string(fi.Endpoint[0].Ticket.Ticket))
+	}
+	if len(listed) != 1 || listed[0] != "sub/people.lbx" {
+		t.Fatalf("expected [sub/people.lbx], got %v", listed)
+	}
+
+	doGet := func(ctx context.Context, path string) (int64, error) {
+		stream, err := client.DoGet(ctx, &flight.Ticket{Ticket: []byte(path)})
+		if err != nil {
+			return 0, err
+		}
+		rdr, err := flight.NewRecordReader(stream)
+		if err != nil {
+			return 0, err
+		}
+		defer rdr.Release()
+		if !rdr.Schema().Equal(schema) {
+			t.Fatalf("expected schema %s, got %s", schema, rdr.Schema())
+		}
+		var rows int64
+		for rdr.Next() {
+			rows += rdr.Record().NumRows()
+		}
+		return rows, rdr.Err()
+	}
+
+	// DoGet needs the file password as well
+	if _, err := doGet(authed, "sub/people.lbx"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a password, got %v", err)
+	}
+	if _, err := doGet(metadata.AppendToOutgoingContext(authed, PasswordHeader, "wrong"), "sub/people.lbx"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied with a wrong password, got %v", err)
+	}
+
+	withPassword := metadata.AppendToOutgoingContext(authed, PasswordHeader, password)
+	rows, err := doGet(withPassword, "sub/people.lbx")
+	if err != nil {
+		t.Fatalf("DoGet failed: %v", err)
+	}
+	if rows != 5 {
+		t.Fatalf("expected 5 rows, got %d", rows)
+	}
+
+	// Paths cannot leave the root
+	if _, err := doGet(withPassword, "../../etc/passwd"); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a path outside the root, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+)
+
+// ErrWrongAAD is returned when the associated data given to open a file is
+// not the data its blocks were sealed with
+var ErrWrongAAD = errors.New("associated data does not match")
+
+// aadKeyName is the pseudo column the associated data hint key is derived for
+const aadKeyName = "\x00lockbox:aad"
+
+// aadHintSize is the length of the stored hint, enough to tell a wrong
+// context from the right one without standing in for the data itself
+const aadHintSize = 8
+
+// aadHint returns a short MAC of aad under a key derived from the master
+// key, so the hint reveals nothing about aad to anyone without the key
+func (lbf *LockboxFile) aadHint(masterKey []byte, aad []byte) []byte {
+	key := crypto.DeriveColumnKey(masterKey, aadKeyName, lbf.metadata.Encryption.MasterSalt)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(aad)
+	return mac.Sum(nil)[:aadHintSize]
+}
+
+// SetAAD sets the associated data that encryptors created from this handle
+// bind every block to. It is checked against the file when a key is used.
+func (lbf *LockboxFile) SetAAD(aad []byte) {
+	lbf.aad = aad
+}
+
+// BindAAD records the hint for the handle's associated data in a new file,
+// before any block is written
+func (lbf *LockboxFile) BindAAD(masterKey *crypto.Key) error {
+	if len(lbf.metadata.BlockInfo) > 0 {
+		return fmt.Errorf("associated data can only be bound to an empty file")
+	}
+	if len(lbf.aad) == 0 {
+		return nil
+	}
+	lbf.metadata.Encryption.AADHint = lbf.aadHint(masterKey.Data, lbf.aad)
+	return lbf.updateMetadata()
+}
+
+// checkAAD compares the handle's associated data with the file's hint
+func (lbf *LockboxFile) checkAAD(masterKey *crypto.Key) error {
+	hint := lbf.metadata.Encryption.AADHint
+	switch {
+	case len(hint) == 0 && len(lbf.aad) == 0:
+		return nil
+	case len(hint) == 0:
+		return fmt.Errorf("%w: the file is not bound to associated data", ErrWrongAAD)
+	case len(lbf.aad) == 0:
+		return fmt.Errorf("%w: the file is bound to associated data, which must be given to open it", ErrWrongAAD)
+	case !hmac.Equal(hint, lbf.aadHint(masterKey.Data, lbf.aad)):
+		return fmt.Errorf("%w: the file was sealed with different associated data", ErrWrongAAD)
+	}
+	return nil
+}
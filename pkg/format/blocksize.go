@@ -0,0 +1,29 @@
+package format
+
+// SetBlockSize caps the rows per segment of the records WriteRecord writes.
+// Zero uses the block size recorded in the file, and a file without one
+// stores each record as a single segment.
+func (w *Writer) SetBlockSize(rows int) {
+	w.blockSize = rows
+}
+
+// rowsPerBlock returns the segment size for the next record, zero for no
+// limit
+func (w *Writer) rowsPerBlock() int {
+	if w.blockSize > 0 {
+		return w.blockSize
+	}
+	return w.file.metadata.BlockSize
+}
+
+// BlockSize returns the rows per segment writers default to, zero when the
+// file has none
+func (lbf *LockboxFile) BlockSize() int {
+	return lbf.metadata.BlockSize
+}
+
+// SetBlockSize records the rows per segment writers default to
+func (lbf *LockboxFile) SetBlockSize(rows int) error {
+	lbf.metadata.BlockSize = rows
+	return lbf.updateMetadata()
+}
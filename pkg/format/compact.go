@@ -0,0 +1,59 @@
+package format
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CreateCopy creates an empty lockbox file at filename that shares src's
+// schema, key slots, cipher, properties and audit trail. The credentials
+// that open src open the copy, and a writer built from src's master key
+// seals blocks the copy can read. Blocks and statistics are not copied.
+func CreateCopy(filename string, src *LockboxFile, modifiedBy string) (*LockboxFile, error) {
+	meta := *src.metadata
+	meta.BlockInfo = nil
+	meta.Stats = nil
+	meta.ColumnStarts = nil
+	meta.SortOrder = nil
+	meta.Encryption.ColumnSalts = maps.Clone(meta.Encryption.ColumnSalts)
+	meta.Encryption.Recipients = slices.Clone(meta.Encryption.Recipients)
+	meta.Properties = maps.Clone(meta.Properties)
+	meta.Provenance = slices.Clone(meta.Provenance)
+	meta.AuditTrail.AccessLog = slices.Clone(meta.AuditTrail.AccessLog)
+	meta.AuditTrail.ModifiedAt = time.Now()
+	meta.AuditTrail.ModifiedBy = modifiedBy
+	if meta.Ingest != nil {
+		ingest := *meta.Ingest
+		meta.Ingest = &ingest
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	lbf := &LockboxFile{
+		file:     file,
+		metadata: &meta,
+		module:   src.module,
+		aad:      src.aad,
+	}
+	if err := lbf.writeHeader(); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := lbf.updateMetadata(); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return nil, fmt.Errorf("failed to write initial metadata: %w", err)
+	}
+
+	log.Info().Str("file", filename).Msg("Created lockbox copy")
+	return lbf, nil
+}
@@ -0,0 +1,105 @@
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/parquet/compress"
+)
+
+// Codec names accepted for block compression
+const (
+	CodecNone   = "none"
+	CodecZstd   = "zstd"
+	CodecLZ4    = "lz4"
+	CodecSnappy = "snappy"
+)
+
+// Zstandard levels accepted by the writer; zero selects the codec default
+const (
+	MinZstdLevel = 1
+	MaxZstdLevel = 19
+)
+
+var codecs = map[string]compress.Compression{
+	CodecNone:   compress.Codecs.Uncompressed,
+	CodecZstd:   compress.Codecs.Zstd,
+	CodecLZ4:    compress.Codecs.Lz4Raw,
+	CodecSnappy: compress.Codecs.Snappy,
+}
+
+// ValidateCodec returns an error if name is not a supported codec
+func ValidateCodec(name string) error {
+	if _, ok := codecs[name]; !ok {
+		names := make([]string, 0, len(codecs))
+		for n := range codecs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown compression codec %q (expected one of %s)", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// ValidateCompressionLevel checks a zstd level; zero means the default
+func ValidateCompressionLevel(level int) error {
+	if level != 0 && (level < MinZstdLevel || level > MaxZstdLevel) {
+		return fmt.Errorf("compression level %d out of range %d-%d", level, MinZstdLevel, MaxZstdLevel)
+	}
+	return nil
+}
+
+// compressBlock compresses serialized column data before encryption. level
+// is only used by zstd; zero selects the codec default.
+func compressBlock(name string, level int, data []byte) (out []byte, err error) {
+	if name == "" || name == CodecNone {
+		return data, nil
+	}
+	codec, err := getCodec(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%s compression failed: %v", name, r)
+		}
+	}()
+	dst := make([]byte, codec.CompressBound(int64(len(data))))
+	if name == CodecZstd && level != 0 {
+		return codec.EncodeLevel(dst, data, level), nil
+	}
+	return codec.Encode(dst, data), nil
+}
+
+// decompressBlock reverses compressBlock. size is the uncompressed length
+// recorded in the block metadata.
+func decompressBlock(name string, data []byte, size int64) (out []byte, err error) {
+	if name == "" || name == CodecNone {
+		return data, nil
+	}
+	codec, err := getCodec(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The underlying codecs panic on malformed input
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("%w: %s decompression failed: %v", ErrCorruptedBlock, name, r)
+		}
+	}()
+	out = codec.Decode(make([]byte, size), data)
+	if int64(len(out)) != size {
+		return nil, fmt.Errorf("%w: decompressed %d bytes, expected %d", ErrCorruptedBlock, len(out), size)
+	}
+	return out, nil
+}
+
+func getCodec(name string) (compress.Codec, error) {
+	if err := ValidateCodec(name); err != nil {
+		return nil, err
+	}
+	return compress.GetCodec(codecs[name])
+}
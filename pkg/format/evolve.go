@@ -0,0 +1,127 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// SetSchema stages a schema upgrade committed by the next WriteRecord. The
+// new schema must keep every current field unchanged and in place, and may
+// only add nullable fields after them. Rows written before the upgrade read
+// the added fields as null; no existing block is rewritten.
+func (w *Writer) SetSchema(schema *arrow.Schema) error {
+	current := w.file.metadata.Schema
+	if len(schema.Fields()) < len(current.Fields()) {
+		return fmt.Errorf("schema upgrade cannot drop columns")
+	}
+	for i, field := range current.Fields() {
+		if !field.Equal(schema.Field(i)) {
+			return fmt.Errorf("schema upgrade cannot change column %s", field.Name)
+		}
+	}
+	for _, field := range schema.Fields()[len(current.Fields()):] {
+		if len(schema.FieldIndices(field.Name)) > 1 {
+			return fmt.Errorf("duplicate column %s", field.Name)
+		}
+		if !field.Nullable {
+			return fmt.Errorf("added column %s must be nullable", field.Name)
+		}
+	}
+	w.schema = schema
+	return nil
+}
+
+// addedFields returns the fields of schema beyond the file's current schema
+func (lbf *LockboxFile) addedFields(schema *arrow.Schema) []arrow.Field {
+	return schema.Fields()[len(lbf.metadata.Schema.Fields()):]
+}
+
+// upgradeSchema switches the metadata to schema. Each added column starts at
+// the next segment, and the statistics of earlier segments count it as
+// entirely null.
+func (w *Writer) upgradeSchema(schema *arrow.Schema) error {
+	meta := w.file.metadata
+	added := w.file.addedFields(schema)
+
+	starts := make(map[string]int, len(meta.ColumnStarts)+len(added))
+	for name, seg := range meta.ColumnStarts {
+		starts[name] = seg
+	}
+	next := w.file.SegmentCount()
+	for _, field := range added {
+		starts[field.Name] = next
+	}
+
+	stats, err := w.file.readStats(w.masterKey)
+	switch {
+	case errors.Is(err, ErrNoStats):
+		stats = nil
+	case err != nil:
+		return err
+	}
+
+	meta.Schema = schema
+	meta.ColumnStarts = starts
+	meta.SchemaVersion = meta.CurrentSchemaVersion() + 1
+
+	if stats == nil || len(stats.Segments) == 0 {
+		return nil
+	}
+	for i := range stats.Segments {
+		seg := &stats.Segments[i]
+		if seg.Columns == nil {
+			seg.Columns = make(map[string]metadata.ColumnStats)
+		}
+		for _, field := range added {
+			seg.Columns[field.Name] = metadata.ColumnStats{Nulls: seg.Rows}
+		}
+	}
+	return w.file.sealStats(w.masterKey, stats)
+}
+
+// addEncryptors creates encryptors for the columns a staged schema adds
+func (w *Writer) addEncryptors(schema *arrow.Schema) error {
+	masterKey := crypto.KeyFromData(w.masterKey, w.file.metadata.Encryption.MasterSalt)
+	encryptors, err := w.file.fieldEncryptors(masterKey, w.file.addedFields(schema))
+	if err != nil {
+		return err
+	}
+	for name, enc := range encryptors {
+		w.encryptors[name] = enc
+	}
+	return nil
+}
+
+// segmentSource is one segment of a column: either a stored block, or for
+// segments written before the column was added, a run of nulls
+type segmentSource struct {
+	block *metadata.BlockInfo
+	nulls int64
+}
+
+// columnSegments lists the segments of a column in write order
+func (lbf *LockboxFile) columnSegments(name string) []segmentSource {
+	blocks := lbf.metadata.ColumnBlocks(name)
+	start := lbf.metadata.ColumnStarts[name]
+	if start == 0 {
+		segs := make([]segmentSource, len(blocks))
+		for i := range blocks {
+			segs[i] = segmentSource{block: &blocks[i]}
+		}
+		return segs
+	}
+
+	first := lbf.metadata.ColumnBlocks(lbf.metadata.Schema.Field(0).Name)
+	segs := make([]segmentSource, 0, start+len(blocks))
+	for i := 0; i < start && i < len(first); i++ {
+		segs = append(segs, segmentSource{nulls: first[i].RowCount})
+	}
+	for i := range blocks {
+		segs = append(segs, segmentSource{block: &blocks[i]})
+	}
+	return segs
+}
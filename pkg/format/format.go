@@ -2,6 +2,7 @@ package format
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"sort"
 	"sync"
 
 	"github.com/TFMV/lockbox/pkg/crypto"
@@ -20,15 +22,92 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ErrCorrupt is matched by every error reporting a file that fails an
+// integrity check, including ErrCorruptedBlock and ErrPropertiesTampered
+var ErrCorrupt = errors.New("corrupt lockbox file")
+
 // ErrCorruptedBlock is returned when a data block fails checksum validation
-var ErrCorruptedBlock = errors.New("corrupted data block")
+// or cannot be decrypted with the file's key
+var ErrCorruptedBlock error = corruption("corrupted data block")
+
+// ErrPasswordDisabled is returned when a password is used on a file that
+// can only be opened by one of its recipients
+var ErrPasswordDisabled = errors.New("file has no password slot; open it with a recipient identity")
+
+// ErrWrongPassword is returned when a password does not unlock the file
+var ErrWrongPassword = errors.New("wrong password")
+
+// ErrPasswordRequired is returned when an operation needs the key but was
+// given neither a password nor an identity
+var ErrPasswordRequired = errors.New("password or identity is required")
+
+// ErrMmapUnsupported is returned by EnableMmap on platforms without mmap
+var ErrMmapUnsupported = errors.New("memory-mapped reads are not supported on this platform")
+
+// corruption is a sentinel error that also matches ErrCorrupt
+type corruption string
+
+func (e corruption) Error() string { return string(e) }
+
+func (e corruption) Is(target error) bool { return target == ErrCorrupt }
+
+// corruptIfShort marks a read that ran past the end of the file as
+// corruption, leaving other I/O errors as they are
+func corruptIfShort(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return err
+}
+
+// headerSize is the length of the file header plus the metadata offset
+const headerSize = 28
+
+// BlockError reports a data block that failed verification
+type BlockError struct {
+	Column string
+	Offset int64
+	Err    error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block at offset %d (column %s): %v", e.Offset, e.Column, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyReport summarizes a successful integrity check
+type VerifyReport struct {
+	Blocks int
+	Rows   int64
+}
 
 // LockboxFile represents a lockbox file handle
 type LockboxFile struct {
-	file     *os.File
+	file     storage
 	metadata *metadata.Metadata
 	readonly bool
 	module   crypto.Module
+
+	// modified is set once the file has been written through this handle
+	modified bool
+
+	// mapped is a read-only mapping of the file as it was when EnableMmap
+	// ran. Blocks appended later lie beyond it and are read from file.
+	mapped []byte
+
+	// committedEnd is where the committed metadata ends. Anything after it
+	// was written by an interrupted write and is not part of the file.
+	committedEnd int64
+
+	// aad is the associated data every block is sealed with, checked
+	// against the file's hint when a key is used
+	aad []byte
+
+	// mu guards the metadata against concurrent readers of one handle
+	mu sync.Mutex
 }
 
 // Writer handles writing encrypted Arrow data to lockbox files
@@ -37,6 +116,26 @@ type Writer struct {
 	encryptors map[string]*crypto.ColumnEncryptor
 	masterKey  []byte
 	module     crypto.Module
+
+	compression       string
+	compressionLevel  int
+	columnCompression map[string]string
+
+	// parallelism bounds the columns encoded at once; zero means GOMAXPROCS
+	parallelism int
+
+	// ingest, if set, is committed with the next record
+	ingest *metadata.IngestManifest
+	// properties, if set, are merged into the file with the next record
+	properties map[string]string
+	// provenance, if set, is completed and logged with the next record
+	provenance *metadata.ProvenanceEntry
+	// schema, if set, is the upgraded schema committed with the next record
+	schema *arrow.Schema
+	// sortOrder lists the columns the next record is sorted by
+	sortOrder []string
+	// blockSize caps the rows per segment; zero uses the file's block size
+	blockSize int
 }
 
 // Reader handles reading encrypted Arrow data from lockbox files
@@ -47,17 +146,67 @@ type Reader struct {
 	module     crypto.Module
 }
 
-// Create creates a new lockbox file
-func Create(filename string, schema *arrow.Schema, password string, createdBy string, module crypto.Module) (*LockboxFile, error) {
+// Create creates a new lockbox file. With kdf set the master key is random
+// and only reachable through an Argon2id password slot; otherwise it is
+// derived from the password with PBKDF2. Column data is sealed with the
+// named AEAD cipher, or crypto.DefaultCipher when it is empty. The lock for
+// mode is taken before an existing file is truncated and held until Close.
+func Create(filename string, schema *arrow.Schema, password string, createdBy string, module crypto.Module, kdf *crypto.KDFParams, cipherName string, mode LockMode) (*LockboxFile, error) {
+	lbf, err := newFile(schema, password, createdBy, module, kdf, cipherName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create file, locking it before truncating anything it held
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	if err := lock(file, mode); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if err := lbf.create(file); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return nil, err
+	}
+
+	log.Info().Str("file", filename).Msg("Created lockbox file")
+	return lbf, nil
+}
+
+// newFile generates the master key and metadata of a new lockbox, which
+// create then writes out
+func newFile(schema *arrow.Schema, password string, createdBy string, module crypto.Module, kdf *crypto.KDFParams, cipherName string) (*LockboxFile, error) {
 	if module == nil {
 		module, _ = crypto.GetModule("default")
 	}
+	cipherName, err := crypto.CipherName(cipherName)
+	if err != nil {
+		return nil, err
+	}
 
 	// Generate master key
 	masterKey, err := module.NewKey(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate master key: %w", err)
 	}
+	if kdf != nil {
+		if err := kdf.Validate(); err != nil {
+			return nil, err
+		}
+		data := make([]byte, crypto.KeySize)
+		if _, err := rand.Read(data); err != nil {
+			return nil, fmt.Errorf("failed to generate master key: %w", err)
+		}
+		masterKey = crypto.KeyFromData(data, masterKey.Salt)
+	}
 
 	// Create metadata
 	meta, err := metadata.NewMetadata(schema, masterKey.Salt, createdBy)
@@ -67,84 +216,205 @@ func Create(filename string, schema *arrow.Schema, password string, createdBy st
 
 	// Ensure schema is properly set
 	meta.Schema = schema
+	meta.Encryption.Algorithm = cipherName
 
-	// Create file
-	file, err := os.Create(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create file: %w", err)
+	// Seal the master key under the password so it can be rotated later
+	if password != "" {
+		if err := setPasswordSlot(&meta.Encryption, masterKey, password, kdf); err != nil {
+			return nil, err
+		}
 	}
 
 	lbf := &LockboxFile{
-		file:     file,
 		metadata: meta,
 		readonly: false,
 		module:   module,
 	}
+	// Seal the empty provenance log, so stripping a later one is detected
+	meta.ProvenanceMAC = lbf.provenanceMAC(masterKey.Data, nil)
+	return lbf, nil
+}
+
+// create writes the header and initial metadata to the empty storage st
+func (lbf *LockboxFile) create(st storage) error {
+	lbf.file = st
 
 	// Write header and metadata
 	if err := lbf.writeHeader(); err != nil {
-		file.Close()
-		os.Remove(filename)
-		return nil, fmt.Errorf("failed to write header: %w", err)
+		return fmt.Errorf("failed to write header: %w", err)
 	}
 
 	// Write initial metadata with schema
 	if err := lbf.updateMetadata(); err != nil {
-		file.Close()
-		os.Remove(filename)
-		return nil, fmt.Errorf("failed to write initial metadata: %w", err)
+		return fmt.Errorf("failed to write initial metadata: %w", err)
 	}
-
-	log.Info().Str("file", filename).Msg("Created lockbox file")
-	return lbf, nil
+	return nil
 }
 
-// Open opens an existing lockbox file
-func Open(filename string, password string, module crypto.Module) (*LockboxFile, error) {
+// Open opens an existing lockbox file holding the advisory lock for mode
+// until Close. A LockShared handle is read-only. Only a LockExclusive
+// handle removes data an interrupted write left after the committed
+// metadata; other handles ignore it.
+func Open(filename string, password string, module crypto.Module, mode LockMode) (*LockboxFile, error) {
 	if module == nil {
 		module, _ = crypto.GetModule("default")
 	}
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	flag := os.O_RDWR
+	if mode == LockShared {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(filename, flag, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	lbf := &LockboxFile{
 		file:     file,
-		readonly: false,
+		readonly: mode == LockShared,
 		module:   module,
 	}
 
+	if err := lock(file, mode); err != nil {
+		file.Close()
+		return nil, err
+	}
+
 	// Read header and metadata
 	if err := lbf.readHeader(); err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
+	// Only an exclusive lock rules out a writer appending in another
+	// process, so only then is what follows the committed metadata known to
+	// be left by an interrupted write. Other handles ignore it.
+	if mode == LockExclusive && locksEnforced {
+		if err := lbf.truncateUncommitted(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := lbf.cipherName(); err != nil {
+		file.Close()
+		return nil, err
+	}
 
 	// Verify password by attempting to derive key
-	derivedKey := module.DeriveKey(password, lbf.metadata.Encryption.MasterSalt)
-	if derivedKey == nil {
-		file.Close()
-		return nil, fmt.Errorf("invalid password")
+	if password != "" && !lbf.metadata.Encryption.PasswordDisabled {
+		derivedKey := module.DeriveKey(password, lbf.metadata.Encryption.MasterSalt)
+		if derivedKey == nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid password")
+		}
 	}
 
 	log.Info().Str("file", filename).Msg("Opened lockbox file")
 	return lbf, nil
 }
 
+// truncateUncommitted removes blocks and metadata left after the committed
+// metadata by a write that was interrupted before it updated the header
+func (lbf *LockboxFile) truncateUncommitted() error {
+	size, err := lbf.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to get file size: %w", err)
+	}
+	if size <= lbf.committedEnd {
+		return nil
+	}
+	if err := lbf.file.Truncate(lbf.committedEnd); err != nil {
+		return fmt.Errorf("failed to truncate uncommitted data: %w", err)
+	}
+	if err := lbf.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	log.Warn().Int64("bytes", size-lbf.committedEnd).Msg("Removed data from an interrupted write")
+	return nil
+}
+
+// OpenMetadata opens a lockbox file read-only and loads its header and
+// metadata. No key is derived, so the handle cannot read or write blocks.
+// It takes no lock: a write makes its metadata visible only by rewriting
+// the header offset last, so the header always points at complete metadata.
+func OpenMetadata(filename string) (*LockboxFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	lbf := &LockboxFile{
+		file:     file,
+		readonly: true,
+	}
+
+	if err := lbf.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	return lbf, nil
+}
+
 // Close closes the lockbox file
 func (lbf *LockboxFile) Close() error {
+	if lbf.mapped != nil {
+		if err := munmapFile(lbf.mapped); err != nil {
+			log.Warn().Err(err).Msg("Failed to unmap lockbox file")
+		}
+		lbf.mapped = nil
+	}
 	if lbf.file != nil {
 		return lbf.file.Close()
 	}
 	return nil
 }
 
+// EnableMmap maps the file read-only so blocks are decrypted straight from
+// the page cache instead of being copied into a buffer first. It returns
+// ErrMmapUnsupported where mmap is unavailable; reads then keep using the
+// file. Handles from OpenReader are read from their source as they are.
+func (lbf *LockboxFile) EnableMmap() error {
+	f, ok := lbf.file.(*os.File)
+	if !ok || lbf.mapped != nil {
+		return nil
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if st.Size() == 0 {
+		return nil
+	}
+	data, err := mmapFile(f, st.Size())
+	if err != nil {
+		return err
+	}
+	lbf.mapped = data
+	return nil
+}
+
+// blockData returns the encrypted bytes of a block. Blocks inside the
+// mapping are returned without copying and must not be modified.
+func (lbf *LockboxFile) blockData(bi metadata.BlockInfo) ([]byte, error) {
+	if bi.Offset >= 0 && bi.Length >= 0 && bi.Offset+bi.Length <= int64(len(lbf.mapped)) {
+		return lbf.mapped[bi.Offset : bi.Offset+bi.Length], nil
+	}
+	data := make([]byte, bi.Length)
+	if _, err := lbf.file.ReadAt(data, bi.Offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 // Schema returns the Arrow schema
 func (lbf *LockboxFile) Schema() *arrow.Schema {
 	return lbf.metadata.Schema
 }
 
+// Modified reports whether the file has been written through this handle
+func (lbf *LockboxFile) Modified() bool {
+	return lbf.modified
+}
+
 // Metadata returns the file metadata
 func (lbf *LockboxFile) Metadata() *metadata.Metadata {
 	return lbf.metadata
@@ -152,30 +422,306 @@ func (lbf *LockboxFile) Metadata() *metadata.Metadata {
 
 // NewWriter creates a new writer for the lockbox file
 func (lbf *LockboxFile) NewWriter(password string) (*Writer, error) {
+	masterKey, err := lbf.Unlock(password, nil)
+	if err != nil {
+		return nil, err
+	}
+	return lbf.NewWriterWithKey(masterKey)
+}
+
+// NewWriterWithKey creates a writer from an already unlocked master key
+func (lbf *LockboxFile) NewWriterWithKey(masterKey *crypto.Key) (*Writer, error) {
 	if lbf.readonly {
 		return nil, fmt.Errorf("file is read-only")
 	}
 
-	module := lbf.module
-	if module == nil {
-		module, _ = crypto.GetModule("default")
+	encryptors, err := lbf.newEncryptors(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		file:       lbf,
+		encryptors: encryptors,
+		masterKey:  masterKey.Data,
+		module:     lbf.cryptoModule(),
+	}, nil
+}
+
+// NewReader creates a new reader for the lockbox file
+func (lbf *LockboxFile) NewReader(password string) (*Reader, error) {
+	masterKey, err := lbf.Unlock(password, nil)
+	if err != nil {
+		return nil, err
+	}
+	return lbf.NewReaderWithKey(masterKey)
+}
+
+// NewReaderWithKey creates a reader from an already unlocked master key
+func (lbf *LockboxFile) NewReaderWithKey(masterKey *crypto.Key) (*Reader, error) {
+	encryptors, err := lbf.newEncryptors(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		file:       lbf,
+		encryptors: encryptors,
+		masterKey:  masterKey.Data,
+		module:     lbf.cryptoModule(),
+	}, nil
+}
+
+// Unlock recovers the master key. Each identity is tried against the
+// recipient slots first; the password is used only if no identity matches
+// and the file still has a password slot.
+func (lbf *LockboxFile) Unlock(password string, identities []*crypto.Identity) (*crypto.Key, error) {
+	enc := lbf.metadata.Encryption
+	for _, id := range identities {
+		pub := id.Recipient().Bytes()
+		for _, slot := range enc.Recipients {
+			if !bytes.Equal(slot.PublicKey, pub) {
+				continue
+			}
+			data, err := crypto.UnwrapKey(id, slot.EphemeralKey, slot.WrappedKey)
+			if err != nil {
+				return nil, err
+			}
+			return crypto.KeyFromData(data, enc.MasterSalt), nil
+		}
 	}
 
-	// Derive master key
-	masterKey := module.DeriveKey(password, lbf.metadata.Encryption.MasterSalt)
+	if password == "" || enc.PasswordDisabled {
+		if len(identities) > 0 {
+			return nil, crypto.ErrNoMatchingIdentity
+		}
+		if enc.PasswordDisabled {
+			return nil, ErrPasswordDisabled
+		}
+		return nil, ErrPasswordRequired
+	}
+
+	if enc.PasswordSlot != nil {
+		slot := enc.PasswordSlot
+		data, err := crypto.OpenKeyWithPassword(slot.WrappedKey, password, slot.Salt, kdfParams(slot.KDF))
+		if errors.Is(err, crypto.ErrUnwrapFailed) {
+			return nil, ErrWrongPassword
+		}
+		if err != nil {
+			return nil, err
+		}
+		return crypto.KeyFromData(data, enc.MasterSalt), nil
+	}
+
+	masterKey := lbf.cryptoModule().DeriveKey(password, enc.MasterSalt)
 	if masterKey == nil {
 		return nil, fmt.Errorf("failed to derive master key")
 	}
+	return masterKey, nil
+}
+
+// VerifyKey checks that masterKey is the file's key. Keys from a password
+// or recipient slot are authenticated by the slot itself; for older files
+// without a password slot the first data block is decrypted instead. A file
+// with no slot and no blocks holds no ciphertext, so any key is accepted.
+// The handle's associated data must match the file's in every case.
+func (lbf *LockboxFile) VerifyKey(masterKey *crypto.Key) error {
+	if err := lbf.checkAAD(masterKey); err != nil {
+		return err
+	}
+	if lbf.metadata.Encryption.PasswordSlot != nil || len(lbf.metadata.BlockInfo) == 0 {
+		return nil
+	}
+
+	bi := lbf.metadata.BlockInfo[0]
+	encryptors, err := lbf.newEncryptors(masterKey)
+	if err != nil {
+		return err
+	}
+	encryptor, ok := encryptors[bi.ColumnName]
+	if !ok {
+		return fmt.Errorf("no encryptor for column %s", bi.ColumnName)
+	}
+
+	encryptedData, err := lbf.blockData(bi)
+	if err != nil {
+		return fmt.Errorf("failed to read block for column %s: %w", bi.ColumnName, err)
+	}
+	if _, err := encryptor.Decrypt(encryptedData); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// RewrapKey replaces the file's key slots without touching any data block.
+// A non-empty password reseals the password slot, with kdf or else the
+// slot's current cost; otherwise dropPassword removes it. Slots for the identities in drop are removed and recipients
+// gain new slots. Only the metadata is rewritten, and the header offset
+// update that commits it is atomic, so a failure leaves the previous slots
+// in place.
+func (lbf *LockboxFile) RewrapKey(masterKey *crypto.Key, password string, kdf *crypto.KDFParams, dropPassword bool, drop []*crypto.Identity, recipients ...*crypto.Recipient) error {
+	old := lbf.metadata.Encryption
+	enc := old
+
+	enc.Recipients = nil
+	for _, slot := range old.Recipients {
+		keep := true
+		for _, id := range drop {
+			if bytes.Equal(slot.PublicKey, id.Recipient().Bytes()) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			enc.Recipients = append(enc.Recipients, slot)
+		}
+	}
+	for _, r := range recipients {
+		eph, wrapped, err := crypto.WrapKey(masterKey.Data, r)
+		if err != nil {
+			return fmt.Errorf("failed to wrap key for recipient: %w", err)
+		}
+		enc.Recipients = append(enc.Recipients, metadata.RecipientSlot{
+			PublicKey:    r.Bytes(),
+			EphemeralKey: eph,
+			WrappedKey:   wrapped,
+		})
+	}
+
+	if password != "" {
+		if kdf == nil && old.PasswordSlot != nil {
+			kdf = kdfParams(old.PasswordSlot.KDF)
+		}
+		if err := setPasswordSlot(&enc, masterKey, password, kdf); err != nil {
+			return err
+		}
+		enc.PasswordDisabled = false
+	} else if dropPassword {
+		enc.PasswordSlot = nil
+		enc.PasswordDisabled = true
+	}
+
+	if enc.PasswordDisabled && len(enc.Recipients) == 0 {
+		return fmt.Errorf("refusing to remove the last key slot")
+	}
+
+	lbf.metadata.Encryption = enc
+	if err := lbf.updateMetadata(); err != nil {
+		lbf.metadata.Encryption = old
+		return err
+	}
+	return nil
+}
+
+// setPasswordSlot seals masterKey under password with a fresh salt and
+// records the KDF in enc
+func setPasswordSlot(enc *metadata.EncryptionParams, masterKey *crypto.Key, password string, kdf *crypto.KDFParams) error {
+	if kdf != nil {
+		if err := kdf.Validate(); err != nil {
+			return err
+		}
+	}
+
+	salt := make([]byte, crypto.SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	wrapped, err := crypto.SealKeyWithPassword(masterKey.Data, password, salt, kdf)
+	if err != nil {
+		return fmt.Errorf("failed to seal master key: %w", err)
+	}
+
+	slot := &metadata.PasswordSlot{Salt: salt, WrappedKey: wrapped}
+	if kdf != nil {
+		slot.KDF = &metadata.KDFParams{Memory: kdf.Memory, Iterations: kdf.Iterations, Parallelism: kdf.Parallelism}
+		enc.KeyDerivation = "Argon2id"
+		enc.Iterations = int(kdf.Iterations)
+	} else {
+		enc.KeyDerivation = "PBKDF2"
+		enc.Iterations = crypto.PBKDF2Iterations
+	}
+	enc.PasswordSlot = slot
+	return nil
+}
+
+// kdfParams converts stored KDF parameters; nil means PBKDF2
+func kdfParams(p *metadata.KDFParams) *crypto.KDFParams {
+	if p == nil {
+		return nil
+	}
+	return &crypto.KDFParams{Memory: p.Memory, Iterations: p.Iterations, Parallelism: p.Parallelism}
+}
+
+// AddRecipients wraps masterKey for each recipient. With disablePassword the
+// password slot is removed, so only recipients can open the file.
+func (lbf *LockboxFile) AddRecipients(masterKey *crypto.Key, disablePassword bool, recipients ...*crypto.Recipient) error {
+	enc := &lbf.metadata.Encryption
+	for _, r := range recipients {
+		eph, wrapped, err := crypto.WrapKey(masterKey.Data, r)
+		if err != nil {
+			return fmt.Errorf("failed to wrap key for recipient: %w", err)
+		}
+		enc.Recipients = append(enc.Recipients, metadata.RecipientSlot{
+			PublicKey:    r.Bytes(),
+			EphemeralKey: eph,
+			WrappedKey:   wrapped,
+		})
+	}
+	if disablePassword {
+		enc.PasswordDisabled = true
+		enc.PasswordSlot = nil
+	}
+	return lbf.updateMetadata()
+}
+
+// cryptoModule returns the module used for key derivation and encryption
+func (lbf *LockboxFile) cryptoModule() crypto.Module {
+	if lbf.module == nil {
+		module, _ := crypto.GetModule("default")
+		return module
+	}
+	return lbf.module
+}
+
+// cipherName returns the AEAD cipher the file's column data is sealed with.
+// It fails with crypto.ErrUnsupportedCipher when this build lacks it.
+func (lbf *LockboxFile) cipherName() (string, error) {
+	name, err := crypto.CipherName(lbf.metadata.Encryption.Algorithm)
+	if err != nil {
+		return "", fmt.Errorf("file is encrypted with %s: %w", lbf.metadata.Encryption.Algorithm, crypto.ErrUnsupportedCipher)
+	}
+	return name, nil
+}
+
+// newEncryptors creates one encryptor per column from the master key
+func (lbf *LockboxFile) newEncryptors(masterKey *crypto.Key) (map[string]*crypto.ColumnEncryptor, error) {
+	return lbf.fieldEncryptors(masterKey, lbf.metadata.Schema.Fields())
+}
+
+// fieldEncryptors creates one encryptor for each of fields
+func (lbf *LockboxFile) fieldEncryptors(masterKey *crypto.Key, fields []arrow.Field) (map[string]*crypto.ColumnEncryptor, error) {
+	module := lbf.cryptoModule()
+	cipherName, err := lbf.cipherName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lbf.checkAAD(masterKey); err != nil {
+		return nil, err
+	}
 
-	// Create column encryptors
 	encryptors := make(map[string]*crypto.ColumnEncryptor)
-	for i, field := range lbf.metadata.Schema.Fields() {
+	for i, field := range fields {
 		columnKey := crypto.DeriveColumnKey(masterKey.Data, field.Name, lbf.metadata.Encryption.MasterSalt)
 		encryptorIntf, err := module.NewEncryptor(columnKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create encryptor for column %s: %w", field.Name, err)
 		}
 		encryptor := encryptorIntf.(*crypto.ColumnEncryptor)
+		if err := encryptor.SetCipher(cipherName); err != nil {
+			return nil, fmt.Errorf("failed to create encryptor for column %s: %w", field.Name, err)
+		}
+		encryptor.SetAAD(lbf.aad)
 
 		// Initialize post-quantum components
 		if masterKey.KyberPublicKey != nil && masterKey.KyberSecretKey != nil {
@@ -183,120 +729,275 @@ func (lbf *LockboxFile) NewWriter(password string) (*Writer, error) {
 			encryptor.KyberSecretKey = masterKey.KyberSecretKey
 		}
 
-		encryptors[field.Name] = encryptor
-		log.Debug().Str("column", field.Name).Int("index", i).Msg("Created column encryptor")
+		encryptors[field.Name] = encryptor
+		log.Debug().Str("column", field.Name).Int("index", i).Msg("Created column encryptor")
+	}
+	return encryptors, nil
+}
+
+// SetCompression selects the codec applied to column blocks before
+// encryption. perColumn overrides the default for individual columns, and
+// level tunes zstd (zero for its default).
+func (w *Writer) SetCompression(codec string, perColumn map[string]string, level int) error {
+	if codec == "" {
+		codec = CodecNone
+	}
+	if err := ValidateCodec(codec); err != nil {
+		return err
+	}
+	if err := ValidateCompressionLevel(level); err != nil {
+		return err
+	}
+	for col, c := range perColumn {
+		if len(w.file.metadata.Schema.FieldIndices(col)) == 0 {
+			return fmt.Errorf("compression set for unknown column %s", col)
+		}
+		if err := ValidateCodec(c); err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+	}
+	w.compression = codec
+	w.compressionLevel = level
+	w.columnCompression = perColumn
+	return nil
+}
+
+// SetIngest records m in the metadata committed by the next WriteRecord, so
+// an ingest's progress and its blocks become visible together
+func (w *Writer) SetIngest(m *metadata.IngestManifest) {
+	w.ingest = m
+}
+
+// SetParallelism sets how many column blocks WriteRecord compresses and
+// encrypts at once. Zero or less uses GOMAXPROCS.
+func (w *Writer) SetParallelism(n int) {
+	w.parallelism = n
+}
+
+// codecFor returns the compression codec for a column
+func (w *Writer) codecFor(column string) string {
+	if c, ok := w.columnCompression[column]; ok {
+		return c
+	}
+	if w.compression == "" {
+		return CodecNone
+	}
+	return w.compression
+}
+
+// encodedBlock is one column of a record serialized, compressed and
+// encrypted, ready to be appended to the file
+type encodedBlock struct {
+	field    arrow.Field
+	data     []byte
+	checksum [32]byte
+	origSize int64
+	codec    string
+	level    int
+	err      error
+}
+
+// encodeColumn serializes column idx of record as a one-column IPC stream,
+// then compresses and encrypts it
+func (w *Writer) encodeColumn(mem memory.Allocator, record arrow.Record, idx int) encodedBlock {
+	field := record.Schema().Field(idx)
+
+	var buf bytes.Buffer
+	batch := array.NewRecord(
+		arrow.NewSchema([]arrow.Field{field}, nil),
+		[]arrow.Array{record.Column(idx)},
+		record.NumRows(),
+	)
+
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(batch.Schema()), ipc.WithAllocator(mem))
+	if err := writer.Write(batch); err != nil {
+		batch.Release()
+		return encodedBlock{err: fmt.Errorf("failed to serialize column %s: %w", field.Name, err)}
+	}
+	writer.Close()
+	batch.Release()
+
+	origSize := int64(buf.Len())
+
+	codec := w.codecFor(field.Name)
+	level := 0
+	if codec == CodecZstd {
+		level = w.compressionLevel
+	}
+	payload, err := compressBlock(codec, level, buf.Bytes())
+	if err != nil {
+		return encodedBlock{err: fmt.Errorf("failed to compress column %s: %w", field.Name, err)}
+	}
+
+	encryptor, exists := w.encryptors[field.Name]
+	if !exists {
+		return encodedBlock{err: fmt.Errorf("no encryptor for column %s", field.Name)}
+	}
+
+	enc, err := encryptor.Encrypt(payload)
+	if err != nil {
+		return encodedBlock{err: fmt.Errorf("failed to encrypt column %s: %w", field.Name, err)}
+	}
+
+	return encodedBlock{field: field, data: enc, checksum: sha256.Sum256(enc), origSize: origSize, codec: codec, level: level}
+}
+
+// WriteRecord writes an encrypted Arrow record to the file, split into
+// segments of the writer's block size. The segments are committed together,
+// so a failure leaves none of them in the file.
+func (w *Writer) WriteRecord(record arrow.Record) error {
+	mem := memory.NewGoAllocator()
+	defer record.Release()
+	ingest := w.ingest
+	w.ingest = nil
+	properties := w.properties
+	w.properties = nil
+	provenance := w.provenance
+	w.provenance = nil
+	schema := w.schema
+	w.schema = nil
+	sortOrder := w.sortOrder
+	w.sortOrder = nil
+	if schema != nil {
+		if err := w.addEncryptors(schema); err != nil {
+			return err
+		}
+	}
+
+	// New blocks and metadata are appended after the current metadata and
+	// only become visible once the header offset is rewritten, so a failure
+	// before that point is undone by truncating back to the original size.
+	origSize, err := w.file.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to get file size: %w", err)
+	}
+	origBlocks := len(w.file.metadata.BlockInfo)
+	origAccess := len(w.file.metadata.AuditTrail.AccessLog)
+	origStats := w.file.metadata.Stats
+	origIngest := w.file.metadata.Ingest
+	origProps, origPropsMAC := w.file.metadata.Properties, w.file.metadata.PropertiesMAC
+	origProv, origProvMAC := w.file.metadata.Provenance, w.file.metadata.ProvenanceMAC
+	origSchema, origStarts, origVersion := w.file.metadata.Schema, w.file.metadata.ColumnStarts, w.file.metadata.SchemaVersion
+	origSortOrder := w.file.metadata.SortOrder
+	rollback := func() {
+		w.file.metadata.Schema, w.file.metadata.ColumnStarts, w.file.metadata.SchemaVersion = origSchema, origStarts, origVersion
+		w.file.metadata.SortOrder = origSortOrder
+		w.file.metadata.BlockInfo = w.file.metadata.BlockInfo[:origBlocks]
+		w.file.metadata.Stats = origStats
+		w.file.metadata.Ingest = origIngest
+		w.file.metadata.Properties, w.file.metadata.PropertiesMAC = origProps, origPropsMAC
+		w.file.metadata.Provenance, w.file.metadata.ProvenanceMAC = origProv, origProvMAC
+		w.file.metadata.AuditTrail.AccessLog = w.file.metadata.AuditTrail.AccessLog[:origAccess]
+		if err := w.file.file.Truncate(origSize); err != nil {
+			log.Error().Err(err).Msg("Failed to roll back partial write")
+			return
+		}
+		if _, err := w.file.file.Seek(0, io.SeekEnd); err != nil {
+			log.Error().Err(err).Msg("Failed to roll back partial write")
+		}
 	}
 
-	return &Writer{
-		file:       lbf,
-		encryptors: encryptors,
-		masterKey:  masterKey.Data,
-		module:     module,
-	}, nil
-}
+	if schema != nil {
+		if err := w.upgradeSchema(schema); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if properties != nil {
+		if err := w.file.mergeProperties(w.masterKey, properties); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if provenance != nil {
+		if err := w.file.appendProvenance(w.masterKey, newProvenanceEntry(provenance, record.NumRows())); err != nil {
+			rollback()
+			return err
+		}
+	}
 
-// NewReader creates a new reader for the lockbox file
-func (lbf *LockboxFile) NewReader(password string) (*Reader, error) {
-	module := lbf.module
-	if module == nil {
-		module, _ = crypto.GetModule("default")
+	size := int64(w.rowsPerBlock())
+	n := record.NumRows()
+	if size <= 0 || size > n {
+		size = max(n, 1)
+	}
+	var segments []arrow.Record
+	defer func() {
+		for _, segment := range segments {
+			segment.Release()
+		}
+	}()
+	stats := make([]metadata.SegmentStats, 0, n/size+1)
+	for off := int64(0); off < n || off == 0; off += size {
+		segment := record.NewSlice(off, min(off+size, n))
+		segments = append(segments, segment)
+		stats = append(stats, recordStats(segment))
 	}
 
-	// Derive master key
-	masterKey := module.DeriveKey(password, lbf.metadata.Encryption.MasterSalt)
-	if masterKey == nil {
-		return nil, fmt.Errorf("failed to derive master key")
+	// Like the stats footer, the sort order depends on the segment count
+	// before the new blocks
+	w.file.metadata.SortOrder = w.file.nextSortOrder(sortOrder)
+
+	// Extend the stats footer before the new blocks change the segment count
+	if err := w.file.appendStats(w.masterKey, stats...); err != nil {
+		rollback()
+		return err
 	}
 
-	// Create column encryptors
-	encryptors := make(map[string]*crypto.ColumnEncryptor)
-	for i, field := range lbf.metadata.Schema.Fields() {
-		columnKey := crypto.DeriveColumnKey(masterKey.Data, field.Name, lbf.metadata.Encryption.MasterSalt)
-		encryptorIntf, err := module.NewEncryptor(columnKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create encryptor for column %s: %w", field.Name, err)
+	for _, segment := range segments {
+		if err := w.writeSegment(mem, segment); err != nil {
+			rollback()
+			return err
 		}
-		encryptor := encryptorIntf.(*crypto.ColumnEncryptor)
+	}
 
-		// Initialize post-quantum components
-		if masterKey.KyberPublicKey != nil && masterKey.KyberSecretKey != nil {
-			encryptor.KyberPublicKey = masterKey.KyberPublicKey
-			encryptor.KyberSecretKey = masterKey.KyberSecretKey
-		}
+	// Log access
+	w.file.logAccess("write", "record", fmt.Sprintf("wrote %d rows", record.NumRows()))
+	if ingest != nil {
+		w.file.metadata.Ingest = ingest
+	}
 
-		encryptors[field.Name] = encryptor
-		log.Debug().Str("column", field.Name).Int("index", i).Msg("Created column encryptor")
+	// Update metadata in file
+	if err := w.file.updateMetadata(); err != nil {
+		rollback()
+		return fmt.Errorf("failed to update metadata: %w", err)
 	}
 
-	return &Reader{
-		file:       lbf,
-		encryptors: encryptors,
-		masterKey:  masterKey.Data,
-		module:     module,
-	}, nil
+	return nil
 }
 
-// WriteRecord writes an encrypted Arrow record to the file
-func (w *Writer) WriteRecord(record arrow.Record) error {
-	mem := memory.NewGoAllocator()
-	defer record.Release()
-
-	type result struct {
-		field    arrow.Field
-		data     []byte
-		checksum [32]byte
-		origSize int64
-		err      error
+// writeSegment encodes segment and appends its blocks, leaving the
+// metadata to be committed by the caller
+func (w *Writer) writeSegment(mem memory.Allocator, segment arrow.Record) error {
+	// Workers encode columns in any order but each result lands in its
+	// column's slot, so blocks are written in schema order regardless of
+	// parallelism. Every Encrypt call takes the next nonce from an atomic
+	// counter, so the shared encryptors are safe to use concurrently.
+	results := make([]encodedBlock, len(segment.Columns()))
+	workers := w.parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(results) {
+		workers = len(results)
 	}
 
-	results := make([]result, len(record.Columns()))
+	jobs := make(chan int)
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, runtime.NumCPU())
-
-	for i, col := range record.Columns() {
-		field := record.Schema().Field(i)
+	for k := 0; k < workers; k++ {
 		wg.Add(1)
-		sem <- struct{}{}
-		go func(idx int, col arrow.Array, field arrow.Field) {
+		go func() {
 			defer wg.Done()
-			defer func() { <-sem }()
-
-			var buf bytes.Buffer
-			batch := array.NewRecord(
-				arrow.NewSchema([]arrow.Field{field}, nil),
-				[]arrow.Array{col},
-				record.NumRows(),
-			)
-
-			writer := ipc.NewWriter(&buf, ipc.WithSchema(batch.Schema()), ipc.WithAllocator(mem))
-			if err := writer.Write(batch); err != nil {
-				batch.Release()
-				results[idx].err = fmt.Errorf("failed to serialize column %s: %w", field.Name, err)
-				return
-			}
-			writer.Close()
-			batch.Release()
-
-			origSize := int64(buf.Len())
-
-			encryptor, exists := w.encryptors[field.Name]
-			if !exists {
-				results[idx].err = fmt.Errorf("no encryptor for column %s", field.Name)
-				return
+			for idx := range jobs {
+				results[idx] = w.encodeColumn(mem, segment, idx)
 			}
-
-			enc, err := encryptor.Encrypt(buf.Bytes())
-			if err != nil {
-				results[idx].err = fmt.Errorf("failed to encrypt column %s: %w", field.Name, err)
-				return
-			}
-
-			checksum := sha256.Sum256(enc)
-			results[idx] = result{field: field, data: enc, checksum: checksum, origSize: origSize}
-		}(i, col, field)
+		}()
 	}
+	for i := range results {
+		jobs <- i
+	}
+	close(jobs)
 	wg.Wait()
-	close(sem)
 
 	for _, r := range results {
 		if r.err != nil {
@@ -325,10 +1026,12 @@ func (w *Writer) WriteRecord(record arrow.Record) error {
 			r.field.Name,
 			blockStart,
 			int64(len(r.data)),
-			record.NumRows(),
+			segment.NumRows(),
 			r.checksum[:],
 			r.origSize,
 			mime,
+			r.codec,
+			r.level,
 		)
 
 		log.Debug().
@@ -337,262 +1040,284 @@ func (w *Writer) WriteRecord(record arrow.Record) error {
 			Int("size", len(r.data)).
 			Msg("Wrote encrypted column block")
 	}
-
-	// Log access
-	w.file.metadata.LogAccess("system", "write", "record", true, fmt.Sprintf("wrote %d rows", record.NumRows()))
-
-	// Update metadata in file
-	if err := w.file.updateMetadata(); err != nil {
-		return fmt.Errorf("failed to update metadata: %w", err)
-	}
-
 	return nil
 }
 
 // ReadRecord reads and decrypts all columns from the file
 func (r *Reader) ReadRecord() (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
 	schema := r.file.metadata.Schema
 
-	type result struct {
-		field arrow.Field
-		arr   arrow.Array
-		err   error
+	arrays, err := r.readFields(schema.Fields(), allSegments)
+	if err != nil {
+		return nil, err
 	}
 
-	results := make([]result, len(schema.Fields()))
-	var wg sync.WaitGroup
-
-	for i, field := range schema.Fields() {
-		var blockInfo *metadata.BlockInfo
-		for _, block := range r.file.metadata.BlockInfo {
-			if block.ColumnName == field.Name {
-				blockInfo = &block
-				break
-			}
-		}
+	resultRec := array.NewRecord(schema, arrays, -1)
 
-		if blockInfo == nil {
-			return nil, fmt.Errorf("no block info for column %s", field.Name)
-		}
+	for _, arr := range arrays {
+		arr.Release()
+	}
 
-		wg.Add(1)
-		go func(idx int, f arrow.Field, bi metadata.BlockInfo) {
-			defer wg.Done()
+	r.file.logAccess("read", "record", fmt.Sprintf("read %d rows", resultRec.NumRows()))
 
-			encryptedData := make([]byte, bi.Length)
-			if _, err := r.file.file.ReadAt(encryptedData, bi.Offset); err != nil {
-				results[idx].err = fmt.Errorf("failed to read encrypted data for column %s: %w", f.Name, err)
-				return
-			}
+	return resultRec, nil
+}
 
-			checksum := sha256.Sum256(encryptedData)
-			if !bytes.Equal(checksum[:], bi.Checksum) {
-				results[idx].err = fmt.Errorf("%w: checksum mismatch for column %s", ErrCorruptedBlock, f.Name)
-				return
-			}
+// ReadColumns decrypts only the specified columns from the file
+func (r *Reader) ReadColumns(columns []string) (arrow.Record, error) {
+	selectedFields := r.file.selectFields(columns)
 
-			encryptor, exists := r.encryptors[f.Name]
-			if !exists {
-				results[idx].err = fmt.Errorf("no encryptor for column %s", f.Name)
-				return
-			}
+	arrays, err := r.readFields(selectedFields, allSegments)
+	if err != nil {
+		return nil, err
+	}
 
-			dec, err := encryptor.Decrypt(encryptedData)
-			if err != nil {
-				results[idx].err = fmt.Errorf("failed to decrypt column %s: %w", f.Name, err)
-				return
-			}
+	newSchema := arrow.NewSchema(selectedFields, nil)
+	record := array.NewRecord(newSchema, arrays, -1)
 
-			reader, err := ipc.NewReader(bytes.NewReader(dec), ipc.WithAllocator(mem))
-			if err != nil {
-				results[idx].err = fmt.Errorf("failed to create reader for column %s: %w", f.Name, err)
-				return
-			}
+	for _, col := range arrays {
+		col.Release()
+	}
 
-			rec, err := reader.Read()
-			if err != nil {
-				reader.Release()
-				results[idx].err = fmt.Errorf("failed to read record for column %s: %w", f.Name, err)
-				return
-			}
+	r.file.logAccess("read", "record", fmt.Sprintf("read %d rows", record.NumRows()))
 
-			if rec.Column(0) == nil {
-				rec.Release()
-				reader.Release()
-				results[idx].err = fmt.Errorf("nil column data for %s", f.Name)
-				return
-			}
+	return record, nil
+}
 
-			col := rec.Column(0)
-			col.Retain()
-			results[idx] = result{field: f, arr: col}
-			rec.Release()
-			reader.Release()
+// ReadSegment decrypts a single stored row group exactly as it was written,
+// without concatenating it with the rest of the file.
+func (r *Reader) ReadSegment(index int) (arrow.Record, error) {
+	return r.ReadSegmentColumns(index, nil)
+}
 
-			log.Debug().Str("column", f.Name).Int("index", idx).Msg("Read and decrypted column")
-		}(i, field, *blockInfo)
+// ReadSegmentColumns decrypts only the named columns of one segment. An
+// empty list reads every column.
+func (r *Reader) ReadSegmentColumns(index int, columns []string) (arrow.Record, error) {
+	count := r.file.SegmentCount()
+	if index < 0 || index >= count {
+		return nil, fmt.Errorf("segment %d out of range (file has %d segments)", index, count)
 	}
 
-	wg.Wait()
-
-	for _, rres := range results {
-		if rres.err != nil {
-			for _, rr := range results {
-				if rr.arr != nil {
-					rr.arr.Release()
-				}
-			}
-			return nil, rres.err
-		}
+	fields := r.file.selectFields(columns)
+	arrays, err := r.readFields(fields, index)
+	if err != nil {
+		return nil, err
 	}
 
-	arrays := make([]arrow.Array, len(results))
-	for i, rres := range results {
-		arrays[i] = rres.arr
+	schema := r.file.metadata.Schema
+	if len(columns) > 0 {
+		schema = arrow.NewSchema(fields, nil)
 	}
-
-	resultRec := array.NewRecord(schema, arrays, -1)
-
+	rec := array.NewRecord(schema, arrays, -1)
 	for _, arr := range arrays {
 		arr.Release()
 	}
 
-	r.file.metadata.LogAccess("system", "read", "record", true, fmt.Sprintf("read %d rows", resultRec.NumRows()))
+	r.file.logAccess("read", "segment", fmt.Sprintf("read segment %d with %d rows", index, rec.NumRows()))
 
-	return resultRec, nil
+	return rec, nil
 }
 
-// ReadColumns decrypts only the specified columns from the file
-func (r *Reader) ReadColumns(columns []string) (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
-
-	colSet := make(map[string]struct{})
+// selectFields returns the schema fields named in columns, in schema order.
+// Unknown names are ignored and an empty list selects every field.
+func (lbf *LockboxFile) selectFields(columns []string) []arrow.Field {
+	if len(columns) == 0 {
+		return lbf.metadata.Schema.Fields()
+	}
+	colSet := make(map[string]struct{}, len(columns))
 	for _, c := range columns {
 		colSet[c] = struct{}{}
 	}
 
-	type result struct {
-		field arrow.Field
-		arr   arrow.Array
-		err   error
-	}
-
-	var selected []metadata.BlockInfo
-	var selectedFields []arrow.Field
-	schema := r.file.metadata.Schema
-	for _, field := range schema.Fields() {
-		if len(colSet) > 0 {
-			if _, ok := colSet[field.Name]; !ok {
-				continue
-			}
+	var selected []arrow.Field
+	for _, field := range lbf.metadata.Schema.Fields() {
+		if _, ok := colSet[field.Name]; ok {
+			selected = append(selected, field)
 		}
+	}
+	return selected
+}
 
-		var blockInfo *metadata.BlockInfo
-		for _, block := range r.file.metadata.BlockInfo {
-			if block.ColumnName == field.Name {
-				blockInfo = &block
-				break
-			}
-		}
-		if blockInfo == nil {
-			return nil, fmt.Errorf("no block info for column %s", field.Name)
-		}
-		selected = append(selected, *blockInfo)
-		selectedFields = append(selectedFields, field)
+// SegmentCount returns the number of row groups stored in the file
+func (lbf *LockboxFile) SegmentCount() int {
+	fields := lbf.metadata.Schema.Fields()
+	if len(fields) == 0 {
+		return 0
 	}
+	return len(lbf.metadata.ColumnBlocks(fields[0].Name))
+}
 
-	results := make([]result, len(selected))
-	var wg sync.WaitGroup
+// RowCount returns the total number of rows recorded in the block metadata
+func (lbf *LockboxFile) RowCount() int64 {
+	fields := lbf.metadata.Schema.Fields()
+	if len(fields) == 0 {
+		return 0
+	}
+	var rows int64
+	for _, bi := range lbf.metadata.ColumnBlocks(fields[0].Name) {
+		rows += bi.RowCount
+	}
+	return rows
+}
 
-	for i, bi := range selected {
-		field := selectedFields[i]
-		wg.Add(1)
-		go func(idx int, f arrow.Field, bi metadata.BlockInfo) {
-			defer wg.Done()
+// SegmentRows returns the number of rows in each segment, in write order
+func (lbf *LockboxFile) SegmentRows() []int64 {
+	fields := lbf.metadata.Schema.Fields()
+	if len(fields) == 0 {
+		return nil
+	}
+	blocks := lbf.metadata.ColumnBlocks(fields[0].Name)
+	rows := make([]int64, len(blocks))
+	for i, bi := range blocks {
+		rows[i] = bi.RowCount
+	}
+	return rows
+}
 
-			encryptedData := make([]byte, bi.Length)
-			if _, err := r.file.file.ReadAt(encryptedData, bi.Offset); err != nil {
-				results[idx].err = fmt.Errorf("failed to read encrypted data for column %s: %w", f.Name, err)
-				return
-			}
+// allSegments selects every block of a column in readFields
+const allSegments = -1
 
-			checksum := sha256.Sum256(encryptedData)
-			if !bytes.Equal(checksum[:], bi.Checksum) {
-				results[idx].err = fmt.Errorf("%w: checksum mismatch for column %s", ErrCorruptedBlock, f.Name)
-				return
-			}
+// readFields decrypts the blocks of the given fields in parallel. With
+// allSegments the segments of each column are concatenated in write order,
+// otherwise only the block of the requested segment is read.
+// Segments written before a column was added read as nulls.
+func (r *Reader) readFields(fields []arrow.Field, segment int) ([]arrow.Array, error) {
+	mem := memory.NewGoAllocator()
 
-			encryptor, exists := r.encryptors[f.Name]
-			if !exists {
-				results[idx].err = fmt.Errorf("no encryptor for column %s", f.Name)
-				return
-			}
+	type result struct {
+		arr arrow.Array
+		err error
+	}
 
-			dec, err := encryptor.Decrypt(encryptedData)
-			if err != nil {
-				results[idx].err = fmt.Errorf("failed to decrypt column %s: %w", f.Name, err)
-				return
+	blocks := make([][]segmentSource, len(fields))
+	for i, field := range fields {
+		blocks[i] = r.file.columnSegments(field.Name)
+		if len(blocks[i]) == 0 {
+			return nil, fmt.Errorf("no block info for column %s", field.Name)
+		}
+		if segment != allSegments {
+			if segment >= len(blocks[i]) {
+				return nil, fmt.Errorf("no block for column %s in segment %d", field.Name, segment)
 			}
+			blocks[i] = blocks[i][segment : segment+1]
+		}
+	}
 
-			reader, err := ipc.NewReader(bytes.NewReader(dec), ipc.WithAllocator(mem))
-			if err != nil {
-				results[idx].err = fmt.Errorf("failed to create reader for column %s: %w", f.Name, err)
-				return
-			}
+	results := make([][]result, len(fields))
+	var wg sync.WaitGroup
 
-			rec, err := reader.Read()
-			if err != nil {
-				reader.Release()
-				results[idx].err = fmt.Errorf("failed to read record for column %s: %w", f.Name, err)
-				return
+	for i, field := range fields {
+		results[i] = make([]result, len(blocks[i]))
+		for j, src := range blocks[i] {
+			if src.block == nil {
+				results[i][j] = result{arr: array.MakeArrayOfNull(mem, field.Type, int(src.nulls))}
+				continue
 			}
+			wg.Add(1)
+			go func(idx, seg int, f arrow.Field, bi metadata.BlockInfo) {
+				defer wg.Done()
 
-			if rec.Column(0) == nil {
-				rec.Release()
-				reader.Release()
-				results[idx].err = fmt.Errorf("nil column data for %s", f.Name)
-				return
-			}
+				arr, err := r.readBlock(mem, f, bi)
+				results[idx][seg] = result{arr: arr, err: err}
 
-			col := rec.Column(0)
-			col.Retain()
-			results[idx] = result{field: f, arr: col}
-			rec.Release()
-			reader.Release()
-		}(i, field, bi)
+				log.Debug().Str("column", f.Name).Int("index", idx).Int("segment", seg).Msg("Read and decrypted column")
+			}(i, j, field, *src.block)
+		}
 	}
 
 	wg.Wait()
 
-	for _, rres := range results {
-		if rres.err != nil {
-			for _, rr := range results {
+	release := func() {
+		for _, segs := range results {
+			for _, rr := range segs {
 				if rr.arr != nil {
 					rr.arr.Release()
 				}
 			}
-			return nil, rres.err
 		}
 	}
 
-	arrays := make([]arrow.Array, len(results))
-	fields := make([]arrow.Field, len(results))
-	for i, rres := range results {
-		arrays[i] = rres.arr
-		fields[i] = rres.field
+	for _, segs := range results {
+		for _, rres := range segs {
+			if rres.err != nil {
+				release()
+				return nil, rres.err
+			}
+		}
 	}
 
-	newSchema := arrow.NewSchema(fields, nil)
-	record := array.NewRecord(newSchema, arrays, -1)
+	arrays := make([]arrow.Array, len(fields))
+	for i, segs := range results {
+		if len(segs) == 1 {
+			segs[0].arr.Retain()
+			arrays[i] = segs[0].arr
+			continue
+		}
 
-	for _, col := range arrays {
-		col.Release()
+		parts := make([]arrow.Array, len(segs))
+		for j, rres := range segs {
+			parts[j] = rres.arr
+		}
+		out, err := array.Concatenate(parts, mem)
+		if err != nil {
+			for _, arr := range arrays[:i] {
+				arr.Release()
+			}
+			release()
+			return nil, fmt.Errorf("failed to concatenate column %s: %w", fields[i].Name, err)
+		}
+		arrays[i] = out
 	}
 
-	r.file.metadata.LogAccess("system", "read", "record", true, fmt.Sprintf("read %d rows", record.NumRows()))
+	release()
+	return arrays, nil
+}
 
-	return record, nil
+// readBlock reads, authenticates and decrypts a single column block
+func (r *Reader) readBlock(mem memory.Allocator, f arrow.Field, bi metadata.BlockInfo) (arrow.Array, error) {
+	encryptedData, err := r.file.blockData(bi)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted data for column %s: %w", f.Name, err)
+	}
+
+	checksum := sha256.Sum256(encryptedData)
+	if !bytes.Equal(checksum[:], bi.Checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch for column %s", ErrCorruptedBlock, f.Name)
+	}
+
+	encryptor, exists := r.encryptors[f.Name]
+	if !exists {
+		return nil, fmt.Errorf("no encryptor for column %s", f.Name)
+	}
+
+	dec, err := encryptor.Decrypt(encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt column %s: %w", ErrCorruptedBlock, f.Name, err)
+	}
+
+	dec, err = decompressBlock(bi.Codec, dec, bi.OrigSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress column %s: %w", f.Name, err)
+	}
+
+	reader, err := ipc.NewReader(bytes.NewReader(dec), ipc.WithAllocator(mem))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create reader for column %s: %w", ErrCorruptedBlock, f.Name, err)
+	}
+	defer reader.Release()
+
+	rec, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read record for column %s: %w", ErrCorruptedBlock, f.Name, err)
+	}
+
+	if rec.Column(0) == nil {
+		return nil, fmt.Errorf("nil column data for %s", f.Name)
+	}
+
+	col := rec.Column(0)
+	col.Retain()
+	return col, nil
 }
 
 // writeHeader writes the file header and initial metadata
@@ -617,12 +1342,12 @@ func (lbf *LockboxFile) readHeader() error {
 	// Read file header
 	var header metadata.FileHeader
 	if err := binary.Read(lbf.file, binary.LittleEndian, &header); err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
+		return fmt.Errorf("failed to read header: %w", corruptIfShort(err))
 	}
 
 	// Verify magic bytes
 	if string(header.Magic[:]) != metadata.MagicBytes {
-		return fmt.Errorf("invalid magic bytes")
+		return fmt.Errorf("%w: invalid magic bytes", ErrCorrupt)
 	}
 
 	// Check version
@@ -633,12 +1358,12 @@ func (lbf *LockboxFile) readHeader() error {
 	// Read metadata offset
 	var metadataOffset uint64
 	if err := binary.Read(lbf.file, binary.LittleEndian, &metadataOffset); err != nil {
-		return fmt.Errorf("failed to read metadata offset: %w", err)
+		return fmt.Errorf("failed to read metadata offset: %w", corruptIfShort(err))
 	}
 
 	// If metadata offset is 0, metadata hasn't been written yet (new file)
 	if metadataOffset == 0 {
-		return fmt.Errorf("file has no metadata - file may be corrupted or incomplete")
+		return fmt.Errorf("%w: file has no metadata, it may be incomplete", ErrCorrupt)
 	}
 
 	// Seek to metadata position
@@ -649,23 +1374,24 @@ func (lbf *LockboxFile) readHeader() error {
 	// Read metadata length
 	var metadataLen uint32
 	if err := binary.Read(lbf.file, binary.LittleEndian, &metadataLen); err != nil {
-		return fmt.Errorf("failed to read metadata length: %w", err)
+		return fmt.Errorf("failed to read metadata length: %w", corruptIfShort(err))
 	}
 
 	// Read metadata
 	metadataBytes := make([]byte, metadataLen)
 	if _, err := io.ReadFull(lbf.file, metadataBytes); err != nil {
-		return fmt.Errorf("failed to read metadata: %w", err)
+		return fmt.Errorf("failed to read metadata: %w", corruptIfShort(err))
 	}
 
 	// Deserialize metadata
 	meta, err := metadata.Deserialize(metadataBytes)
 	if err != nil {
-		return fmt.Errorf("failed to deserialize metadata: %w", err)
+		return fmt.Errorf("%w: failed to deserialize metadata: %w", ErrCorrupt, err)
 	}
 
 	meta.Header = header
 	lbf.metadata = meta
+	lbf.committedEnd = int64(metadataOffset) + 4 + int64(metadataLen)
 	return nil
 }
 
@@ -674,6 +1400,7 @@ func (lbf *LockboxFile) updateMetadata() error {
 	if lbf.readonly {
 		return fmt.Errorf("file is read-only")
 	}
+	lbf.modified = true
 
 	// Seek to end of file to write metadata
 	metadataPos, err := lbf.file.Seek(0, io.SeekEnd)
@@ -682,7 +1409,9 @@ func (lbf *LockboxFile) updateMetadata() error {
 	}
 
 	// Serialize and write metadata
+	lbf.mu.Lock()
 	metadataBytes, err := lbf.metadata.Serialize()
+	lbf.mu.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to serialize metadata: %w", err)
 	}
@@ -698,7 +1427,16 @@ func (lbf *LockboxFile) updateMetadata() error {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
+	// Make sure blocks and metadata are durable before the header points at them
+	if err := lbf.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+
 	// Update metadata offset in header
+	end, err := lbf.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to get metadata end: %w", err)
+	}
 	if _, err := lbf.file.Seek(20, io.SeekStart); err != nil { // After FileHeader
 		return fmt.Errorf("failed to seek to metadata offset position: %w", err)
 	}
@@ -707,6 +1445,11 @@ func (lbf *LockboxFile) updateMetadata() error {
 		return fmt.Errorf("failed to write metadata offset: %w", err)
 	}
 
+	if err := lbf.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	lbf.committedEnd = end
+
 	// Seek back to end for any future writes
 	if _, err := lbf.file.Seek(0, io.SeekEnd); err != nil {
 		return fmt.Errorf("failed to seek to end: %w", err)
@@ -718,8 +1461,8 @@ func (lbf *LockboxFile) updateMetadata() error {
 // ValidateBlocks verifies the checksum of each data block
 func (lbf *LockboxFile) ValidateBlocks() error {
 	for _, block := range lbf.metadata.BlockInfo {
-		data := make([]byte, block.Length)
-		if _, err := lbf.file.ReadAt(data, block.Offset); err != nil {
+		data, err := lbf.blockData(block)
+		if err != nil {
 			return fmt.Errorf("failed to read block %s: %w", block.ColumnName, err)
 		}
 		sum := sha256.Sum256(data)
@@ -730,6 +1473,93 @@ func (lbf *LockboxFile) ValidateBlocks() error {
 	return nil
 }
 
+// VerifyLayout checks the header, metadata and schema, and that every block
+// lies between the header and the metadata. Block contents are not read.
+func (lbf *LockboxFile) VerifyLayout() error {
+	if lbf.metadata.Schema == nil || len(lbf.metadata.Schema.Fields()) == 0 {
+		return fmt.Errorf("metadata has no schema")
+	}
+
+	var buf [8]byte
+	if _, err := lbf.file.ReadAt(buf[:], 20); err != nil {
+		return fmt.Errorf("failed to read metadata offset: %w", err)
+	}
+	metadataOffset := int64(binary.LittleEndian.Uint64(buf[:]))
+
+	for _, block := range lbf.metadata.BlockInfo {
+		if lbf.metadata.Schema.FieldIndices(block.ColumnName) == nil {
+			return &BlockError{Column: block.ColumnName, Offset: block.Offset, Err: fmt.Errorf("column not in schema")}
+		}
+		if block.Offset < headerSize || block.Length <= 0 || block.Offset+block.Length > metadataOffset {
+			return &BlockError{Column: block.ColumnName, Offset: block.Offset, Err: fmt.Errorf("%w: block outside data region", ErrCorruptedBlock)}
+		}
+	}
+	return nil
+}
+
+// Verify authenticates the file properties and provenance log, then decodes every block in
+// file order, stopping at the first failure. No two blocks may share a
+// nonce. Rows are counted from the first schema column.
+func (r *Reader) Verify() (*VerifyReport, error) {
+	if err := r.file.VerifyLayout(); err != nil {
+		return nil, err
+	}
+	if err := r.file.verifyProperties(r.masterKey); err != nil {
+		return nil, err
+	}
+	if err := r.file.verifyProvenance(r.masterKey); err != nil {
+		return nil, err
+	}
+
+	schema := r.file.metadata.Schema
+	blocks := append([]metadata.BlockInfo(nil), r.file.metadata.BlockInfo...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Offset < blocks[j].Offset })
+
+	mem := memory.NewGoAllocator()
+	report := &VerifyReport{}
+	nonces := make(map[string]int64, len(blocks))
+	for _, bi := range blocks {
+		field := schema.Field(schema.FieldIndices(bi.ColumnName)[0])
+		arr, err := r.readBlock(mem, field, bi)
+		if err != nil {
+			return nil, &BlockError{Column: bi.ColumnName, Offset: bi.Offset, Err: err}
+		}
+		if err := r.file.checkNonce(nonces, bi); err != nil {
+			arr.Release()
+			return nil, &BlockError{Column: bi.ColumnName, Offset: bi.Offset, Err: err}
+		}
+		n := int64(arr.Len())
+		arr.Release()
+		if n != bi.RowCount {
+			return nil, &BlockError{Column: bi.ColumnName, Offset: bi.Offset, Err: fmt.Errorf("%w: expected %d rows, found %d", ErrCorruptedBlock, bi.RowCount, n)}
+		}
+
+		report.Blocks++
+		if field.Name == schema.Field(0).Name {
+			report.Rows += n
+		}
+	}
+	return report, nil
+}
+
+// checkNonce records the nonce of block bi in seen, failing if an earlier
+// block used it
+func (lbf *LockboxFile) checkNonce(seen map[string]int64, bi metadata.BlockInfo) error {
+	head := make([]byte, crypto.KyberPublicKeySize+crypto.NonceSize)
+	if _, err := lbf.file.ReadAt(head, bi.Offset); err != nil {
+		return fmt.Errorf("failed to read block nonce: %w", err)
+	}
+	nonce, err := crypto.BlockNonce(head)
+	if err != nil {
+		return err
+	}
+	if prev, ok := seen[string(nonce)]; ok {
+		return fmt.Errorf("%w: nonce reused from the block at offset %d", ErrCorruptedBlock, prev)
+	}
+	seen[string(nonce)] = bi.Offset
+	return nil
+}
+
 // Repair attempts to remove corrupted blocks from metadata
 func (lbf *LockboxFile) Repair() error {
 	var valid []metadata.BlockInfo
@@ -743,6 +1573,10 @@ func (lbf *LockboxFile) Repair() error {
 			valid = append(valid, block)
 		}
 	}
+	// Dropped blocks leave the stats footer describing data that is gone
+	if len(valid) != len(lbf.metadata.BlockInfo) {
+		lbf.metadata.Stats = nil
+	}
 	lbf.metadata.BlockInfo = valid
 	return lbf.updateMetadata()
 }
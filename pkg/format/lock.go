@@ -0,0 +1,47 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned when another handle, usually in another process,
+// holds a conflicting lock on the file
+var ErrLocked = errors.New("file is locked by another process")
+
+// LockMode is the advisory lock a handle holds for as long as it is open.
+// Locks only order lockbox handles; other programs can still write the file.
+type LockMode int
+
+const (
+	// LockNone takes no lock, for filesystems where locking is unreliable
+	LockNone LockMode = iota
+	// LockShared admits other shared handles but no exclusive one. The
+	// handle is read-only.
+	LockShared
+	// LockExclusive keeps every other locking handle out
+	LockExclusive
+)
+
+// lock takes the advisory lock for mode on f without waiting
+func lock(f *os.File, mode LockMode) error {
+	if mode == LockNone {
+		return nil
+	}
+	if err := lockFile(f, mode == LockExclusive); err != nil {
+		if errors.Is(err, ErrLocked) {
+			return err
+		}
+		return fmt.Errorf("failed to lock file: %w", err)
+	}
+	return nil
+}
+
+// logAccess appends to the audit trail. Readers on the same handle may run
+// concurrently, so the append is serialized.
+func (lbf *LockboxFile) logAccess(action, resource, details string) {
+	lbf.mu.Lock()
+	defer lbf.mu.Unlock()
+	lbf.metadata.LogAccess("system", action, resource, true, details)
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package format
+
+import (
+	"os"
+	"syscall"
+)
+
+// locksEnforced reports whether lockFile takes a real lock
+const locksEnforced = true
+
+// lockFile takes a flock on f, failing with ErrLocked instead of waiting.
+// Closing f releases it.
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH | syscall.LOCK_NB
+	if exclusive {
+		how = syscall.LOCK_EX | syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch err {
+		case nil:
+			return nil
+		case syscall.EWOULDBLOCK:
+			return ErrLocked
+		case syscall.EINTR:
+			continue
+		}
+		return err
+	}
+}
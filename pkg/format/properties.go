@@ -0,0 +1,85 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+)
+
+// ErrPropertiesTampered is returned when the file properties do not match
+// their MAC, i.e. they were changed by someone without the key
+var ErrPropertiesTampered error = corruption("file properties failed authentication")
+
+// propertiesKeyName is the pseudo column the properties MAC key is derived for
+const propertiesKeyName = "\x00lockbox:properties"
+
+// propertiesMAC authenticates props under a key derived from the master key.
+// Keys are sorted and every string is length prefixed, so the encoding is
+// unambiguous.
+func (lbf *LockboxFile) propertiesMAC(masterKey []byte, props map[string]string) []byte {
+	key := crypto.DeriveColumnKey(masterKey, propertiesKeyName, lbf.metadata.Encryption.MasterSalt)
+	mac := hmac.New(sha256.New, key)
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var n [8]byte
+	for _, k := range keys {
+		for _, s := range []string{k, props[k]} {
+			binary.LittleEndian.PutUint64(n[:], uint64(len(s)))
+			mac.Write(n[:])
+			mac.Write([]byte(s))
+		}
+	}
+	return mac.Sum(nil)
+}
+
+// verifyProperties checks the stored properties against their MAC
+func (lbf *LockboxFile) verifyProperties(masterKey []byte) error {
+	meta := lbf.metadata
+	if len(meta.Properties) == 0 && meta.PropertiesMAC == nil {
+		return nil
+	}
+	if !hmac.Equal(meta.PropertiesMAC, lbf.propertiesMAC(masterKey, meta.Properties)) {
+		return ErrPropertiesTampered
+	}
+	return nil
+}
+
+// SetProperties stages props to be merged into the file properties by the
+// next WriteRecord. Existing keys are overwritten.
+func (w *Writer) SetProperties(props map[string]string) {
+	w.properties = props
+}
+
+// mergeProperties merges props into the file properties and seals them,
+// after checking the existing ones so tampered values are not re-signed
+func (lbf *LockboxFile) mergeProperties(masterKey []byte, props map[string]string) error {
+	if err := lbf.verifyProperties(masterKey); err != nil {
+		return err
+	}
+	merged := make(map[string]string, len(lbf.metadata.Properties)+len(props))
+	for k, v := range lbf.metadata.Properties {
+		merged[k] = v
+	}
+	for k, v := range props {
+		merged[k] = v
+	}
+	lbf.metadata.Properties = merged
+	lbf.metadata.PropertiesMAC = lbf.propertiesMAC(masterKey, merged)
+	return nil
+}
+
+// Properties returns the file properties after authenticating them
+func (r *Reader) Properties() (map[string]string, error) {
+	if err := r.file.verifyProperties(r.masterKey); err != nil {
+		return nil, fmt.Errorf("failed to verify properties: %w", err)
+	}
+	return r.file.metadata.Properties, nil
+}
@@ -0,0 +1,91 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/metadata"
+)
+
+// ErrProvenanceTampered is returned when the provenance log does not match
+// its MAC, i.e. entries were changed, dropped or reordered without the key,
+// or the log was removed along with its MAC
+var ErrProvenanceTampered error = corruption("provenance log failed authentication")
+
+// provenanceKeyName is the pseudo column the provenance MAC key is derived for
+const provenanceKeyName = "\x00lockbox:provenance"
+
+// provenanceMAC authenticates entries, in order, under a key derived from
+// the master key. Every field is fixed width or length prefixed, so the
+// encoding is unambiguous.
+func (lbf *LockboxFile) provenanceMAC(masterKey []byte, entries []metadata.ProvenanceEntry) []byte {
+	key := crypto.DeriveColumnKey(masterKey, provenanceKeyName, lbf.metadata.Encryption.MasterSalt)
+	mac := hmac.New(sha256.New, key)
+
+	var n [8]byte
+	writeInt := func(v int64) {
+		binary.LittleEndian.PutUint64(n[:], uint64(v))
+		mac.Write(n[:])
+	}
+	writeInt(int64(len(entries)))
+	for _, e := range entries {
+		writeInt(e.Timestamp.UnixNano())
+		writeInt(e.Rows)
+		for _, s := range []string{e.Tool, e.User} {
+			writeInt(int64(len(s)))
+			mac.Write([]byte(s))
+		}
+	}
+	return mac.Sum(nil)
+}
+
+// verifyProvenance checks the stored provenance log against its MAC. The
+// log is sealed when the file is created, even while it is empty, so a
+// missing MAC means the log was stripped.
+func (lbf *LockboxFile) verifyProvenance(masterKey []byte) error {
+	meta := lbf.metadata
+	if !hmac.Equal(meta.ProvenanceMAC, lbf.provenanceMAC(masterKey, meta.Provenance)) {
+		return ErrProvenanceTampered
+	}
+	return nil
+}
+
+// SetProvenance stages the tool and user recorded in the provenance log by
+// the next WriteRecord. Records written without it leave no entry.
+func (w *Writer) SetProvenance(tool, user string) {
+	w.provenance = &metadata.ProvenanceEntry{Tool: tool, User: user}
+}
+
+// appendProvenance adds entry to the provenance log and seals it, after
+// checking the existing entries so tampered ones are not re-signed
+func (lbf *LockboxFile) appendProvenance(masterKey []byte, entry metadata.ProvenanceEntry) error {
+	if err := lbf.verifyProvenance(masterKey); err != nil {
+		return err
+	}
+	// Clip so a rollback's saved slice is never overwritten
+	entries := append(slices.Clip(lbf.metadata.Provenance), entry)
+	lbf.metadata.Provenance = entries
+	lbf.metadata.ProvenanceMAC = lbf.provenanceMAC(masterKey, entries)
+	return nil
+}
+
+// newProvenanceEntry completes a staged entry for a write of rows
+func newProvenanceEntry(staged *metadata.ProvenanceEntry, rows int64) metadata.ProvenanceEntry {
+	entry := *staged
+	entry.Timestamp = time.Now().UTC()
+	entry.Rows = rows
+	return entry
+}
+
+// Provenance returns the provenance log after authenticating it
+func (r *Reader) Provenance() ([]metadata.ProvenanceEntry, error) {
+	if err := r.file.verifyProvenance(r.masterKey); err != nil {
+		return nil, fmt.Errorf("failed to verify provenance: %w", err)
+	}
+	return r.file.metadata.Provenance, nil
+}
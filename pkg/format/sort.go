@@ -0,0 +1,25 @@
+package format
+
+// SetSortOrder declares that the record passed to the next WriteRecord is
+// sorted by columns. A record written without it is taken to be unsorted.
+func (w *Writer) SetSortOrder(columns []string) {
+	w.sortOrder = columns
+}
+
+// nextSortOrder returns the sort order that holds for every segment once a
+// segment sorted by columns is added: columns itself for the first segment,
+// otherwise the prefix it shares with the current order
+func (lbf *LockboxFile) nextSortOrder(columns []string) []string {
+	if lbf.SegmentCount() == 0 {
+		return columns
+	}
+	current := lbf.metadata.SortOrder
+	n := 0
+	for n < len(current) && n < len(columns) && current[n] == columns[n] {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return current[:n]
+}
@@ -0,0 +1,265 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// ErrNoStats is returned when a file has no statistics footer, or the footer
+// no longer matches the stored segments
+var ErrNoStats = errors.New("file has no statistics; recompute them first")
+
+// statsKeyName is the pseudo column the footer key is derived for
+const statsKeyName = "\x00lockbox:stats"
+
+// statsEncryptor returns the encryptor for the statistics footer. The PQ
+// components are rebuilt from the key data so every session derives the
+// same ones.
+func (lbf *LockboxFile) statsEncryptor(masterKey []byte) (crypto.Encryptor, error) {
+	cipherName, err := lbf.cipherName()
+	if err != nil {
+		return nil, err
+	}
+	salt := lbf.metadata.Encryption.MasterSalt
+	key := crypto.DeriveColumnKey(masterKey, statsKeyName, salt)
+	enc, err := lbf.cryptoModule().NewEncryptor(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stats encryptor: %w", err)
+	}
+	if ce, ok := enc.(*crypto.ColumnEncryptor); ok {
+		if err := ce.SetCipher(cipherName); err != nil {
+			return nil, fmt.Errorf("failed to create stats encryptor: %w", err)
+		}
+		pq := crypto.KeyFromData(masterKey, salt)
+		ce.KyberPublicKey = pq.KyberPublicKey
+		ce.KyberSecretKey = pq.KyberSecretKey
+	}
+	return enc, nil
+}
+
+// readStats decrypts the statistics footer. Footers that do not cover every
+// segment, e.g. after Repair dropped blocks, are reported as ErrNoStats.
+func (lbf *LockboxFile) readStats(masterKey []byte) (*metadata.FileStats, error) {
+	if lbf.metadata.Stats == nil {
+		if lbf.SegmentCount() == 0 {
+			return &metadata.FileStats{}, nil
+		}
+		return nil, ErrNoStats
+	}
+	enc, err := lbf.statsEncryptor(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := enc.Decrypt(lbf.metadata.Stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt stats: %w", err)
+	}
+	var stats metadata.FileStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+	if len(stats.Segments) != lbf.SegmentCount() {
+		return nil, ErrNoStats
+	}
+	return &stats, nil
+}
+
+// sealStats encrypts stats into the metadata footer
+func (lbf *LockboxFile) sealStats(masterKey []byte, stats *metadata.FileStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %w", err)
+	}
+	enc, err := lbf.statsEncryptor(masterKey)
+	if err != nil {
+		return err
+	}
+	sealed, err := enc.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt stats: %w", err)
+	}
+	lbf.metadata.Stats = sealed
+	return nil
+}
+
+// appendStats adds the statistics of new segments to the footer. Files
+// that already hold segments without a footer are left without one, since
+// a partial footer would misreport the totals.
+func (lbf *LockboxFile) appendStats(masterKey []byte, segs ...metadata.SegmentStats) error {
+	stats := &metadata.FileStats{}
+	if lbf.SegmentCount() > 0 {
+		existing, err := lbf.readStats(masterKey)
+		if errors.Is(err, ErrNoStats) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats = existing
+	}
+	stats.Segments = append(stats.Segments, segs...)
+	return lbf.sealStats(masterKey, stats)
+}
+
+// Stats decrypts the statistics footer
+func (r *Reader) Stats() (*metadata.FileStats, error) {
+	return r.file.readStats(r.masterKey)
+}
+
+// RecomputeStats rebuilds the statistics footer by decrypting every
+// segment. It repairs files written before the footer existed.
+func (r *Reader) RecomputeStats() error {
+	stats := &metadata.FileStats{}
+	for i := 0; i < r.file.SegmentCount(); i++ {
+		rec, err := r.ReadSegment(i)
+		if err != nil {
+			return err
+		}
+		stats.Segments = append(stats.Segments, recordStats(rec))
+		rec.Release()
+	}
+
+	orig := r.file.metadata.Stats
+	if err := r.file.sealStats(r.masterKey, stats); err != nil {
+		return err
+	}
+	if err := r.file.updateMetadata(); err != nil {
+		r.file.metadata.Stats = orig
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+	return nil
+}
+
+// recordStats computes the statistics of one segment
+func recordStats(record arrow.Record) metadata.SegmentStats {
+	seg := metadata.SegmentStats{
+		Rows:    record.NumRows(),
+		Columns: make(map[string]metadata.ColumnStats, record.NumCols()),
+	}
+	for i, col := range record.Columns() {
+		seg.Columns[record.Schema().Field(i).Name] = columnStats(col)
+	}
+	return seg
+}
+
+// columnStats counts nulls and, for sortable primitive types, records the
+// bounds of the non-null values
+func columnStats(col arrow.Array) metadata.ColumnStats {
+	cs := metadata.ColumnStats{Nulls: int64(col.NullN())}
+	switch c := col.(type) {
+	case *array.Int8:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Int16:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Int32:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Int64:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return c.Value(i) })
+	case *array.Uint8:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Uint16:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Uint32:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Date32:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Date64:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Timestamp:
+		cs.Min, cs.Max = intBounds(col, func(i int) int64 { return int64(c.Value(i)) })
+	case *array.Float32:
+		cs.Min, cs.Max = floatBounds(col, func(i int) float64 { return float64(c.Value(i)) })
+	case *array.Float64:
+		cs.Min, cs.Max = floatBounds(col, func(i int) float64 { return c.Value(i) })
+	case *array.String:
+		cs.Min, cs.Max = stringBounds(col, c.Value)
+	case *array.LargeString:
+		cs.Min, cs.Max = stringBounds(col, c.Value)
+	case *array.Dictionary:
+		if dict, ok := c.Dictionary().(*array.String); ok {
+			cs.Min, cs.Max = stringBounds(col, func(i int) string { return dict.Value(c.GetValueIndex(i)) })
+		}
+	}
+	return cs
+}
+
+func intBounds(col arrow.Array, value func(int) int64) (lo, hi *metadata.StatsValue) {
+	var minV, maxV int64
+	found := false
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := value(i)
+		if !found || v < minV {
+			minV = v
+		}
+		if !found || v > maxV {
+			maxV = v
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return &metadata.StatsValue{Int: &minV}, &metadata.StatsValue{Int: &maxV}
+}
+
+// floatBounds skips NaN, which has no place in an ordering
+func floatBounds(col arrow.Array, value func(int) float64) (lo, hi *metadata.StatsValue) {
+	var minV, maxV float64
+	found := false
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := value(i)
+		if math.IsNaN(v) {
+			continue
+		}
+		if !found || v < minV {
+			minV = v
+		}
+		if !found || v > maxV {
+			maxV = v
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return &metadata.StatsValue{Float: &minV}, &metadata.StatsValue{Float: &maxV}
+}
+
+func stringBounds(col arrow.Array, value func(int) string) (lo, hi *metadata.StatsValue) {
+	var minV, maxV string
+	found := false
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := value(i)
+		if !found || v < minV {
+			minV = v
+		}
+		if !found || v > maxV {
+			maxV = v
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	// Copy out of the Arrow buffers, which may be released before the
+	// footer is encoded
+	minV, maxV = strings.Clone(minV), strings.Clone(maxV)
+	return &metadata.StatsValue{String: &minV}, &metadata.StatsValue{String: &maxV}
+}
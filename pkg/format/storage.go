@@ -0,0 +1,142 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/rs/zerolog/log"
+)
+
+// storage holds the bytes of a lockbox: an *os.File, a read-only view of
+// an io.ReaderAt for OpenReader, or a buffer for CreateMemory
+type storage interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// errReadOnlySource is returned when a handle from OpenReader is written
+var errReadOnlySource = errors.New("lockbox source is read-only")
+
+// readerStorage serves a lockbox from an io.ReaderAt. Close leaves the
+// source open, since the caller owns it.
+type readerStorage struct {
+	*io.SectionReader
+}
+
+func (readerStorage) Write([]byte) (int, error) { return 0, errReadOnlySource }
+func (readerStorage) Truncate(int64) error      { return errReadOnlySource }
+func (readerStorage) Sync() error               { return nil }
+func (readerStorage) Close() error              { return nil }
+
+// OpenReader loads the header and metadata of a lockbox held in r, which is
+// size bytes long, such as a bytes.Reader over a file read into memory. The
+// handle is read-only and takes no lock. Data left after the committed
+// metadata by an interrupted write is ignored rather than removed.
+func OpenReader(r io.ReaderAt, size int64, module crypto.Module) (*LockboxFile, error) {
+	if module == nil {
+		module, _ = crypto.GetModule("default")
+	}
+	lbf := &LockboxFile{
+		file:     readerStorage{io.NewSectionReader(r, 0, size)},
+		readonly: true,
+		module:   module,
+	}
+	if err := lbf.readHeader(); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if _, err := lbf.cipherName(); err != nil {
+		return nil, err
+	}
+
+	log.Info().Int64("bytes", size).Msg("Opened lockbox from reader")
+	return lbf, nil
+}
+
+// memStorage holds a lockbox being built in memory for CreateMemory
+type memStorage struct {
+	data []byte
+	pos  int64
+}
+
+func (m *memStorage) Read(p []byte) (int, error) {
+	if m.pos >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.pos:])
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memStorage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memStorage) Write(p []byte) (int, error) {
+	if end := m.pos + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	n := copy(m.data[m.pos:], p)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memStorage) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	m.pos = offset
+	return offset, nil
+}
+
+func (m *memStorage) Truncate(size int64) error {
+	if size < int64(len(m.data)) {
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+func (m *memStorage) Sync() error  { return nil }
+func (m *memStorage) Close() error { return nil }
+
+// CreateMemory creates a new lockbox held in memory rather than in a file,
+// taking the same arguments as Create. WriteTo copies it out once written.
+func CreateMemory(schema *arrow.Schema, password string, createdBy string, module crypto.Module, kdf *crypto.KDFParams, cipherName string) (*LockboxFile, error) {
+	lbf, err := newFile(schema, password, createdBy, module, kdf, cipherName)
+	if err != nil {
+		return nil, err
+	}
+	if err := lbf.create(&memStorage{}); err != nil {
+		return nil, err
+	}
+
+	log.Info().Msg("Created lockbox in memory")
+	return lbf, nil
+}
+
+// WriteTo copies the committed bytes of the lockbox to w, leaving out any
+// data from a write that was never committed
+func (lbf *LockboxFile) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, io.NewSectionReader(lbf.file, 0, lbf.committedEnd))
+}
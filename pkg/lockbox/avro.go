@@ -0,0 +1,723 @@
+package lockbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// avroMagic starts every Avro Object Container File
+var avroMagic = []byte("Obj\x01")
+
+// avroSchema is a node of a parsed Avro schema
+type avroSchema struct {
+	// typ is a primitive type name, or record, enum, array, map, fixed or
+	// union
+	typ     string
+	name    string
+	logical string
+	// precision and scale describe decimal logical types
+	precision int
+	scale     int
+	fields    []avroField
+	symbols   []string
+	items     *avroSchema
+	values    *avroSchema
+	size      int
+	branches  []*avroSchema
+}
+
+type avroField struct {
+	name   string
+	schema *avroSchema
+}
+
+// avroPrimitives lists the Avro primitive type names
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// avroDefinition is the JSON form of a complex Avro schema
+type avroDefinition struct {
+	Type        json.RawMessage `json:"type"`
+	Name        string          `json:"name"`
+	Namespace   string          `json:"namespace"`
+	LogicalType string          `json:"logicalType"`
+	Precision   int             `json:"precision"`
+	Scale       int             `json:"scale"`
+	Fields      []struct {
+		Name string          `json:"name"`
+		Type json.RawMessage `json:"type"`
+	} `json:"fields"`
+	Symbols []string        `json:"symbols"`
+	Items   json.RawMessage `json:"items"`
+	Values  json.RawMessage `json:"values"`
+	Size    int             `json:"size"`
+}
+
+// parseAvroSchema parses an Avro schema in JSON form. names holds the named
+// types defined so far, by full name, and namespace is the enclosing one.
+func parseAvroSchema(raw json.RawMessage, names map[string]*avroSchema, namespace string) (*avroSchema, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing Avro type")
+	}
+	switch raw[0] {
+	case '"':
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return nil, err
+		}
+		if avroPrimitives[name] {
+			return &avroSchema{typ: name}, nil
+		}
+		if s, ok := names[avroFullName(name, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := names[name]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown Avro type %q", name)
+	case '[':
+		var branches []json.RawMessage
+		if err := json.Unmarshal(raw, &branches); err != nil {
+			return nil, err
+		}
+		union := &avroSchema{typ: "union"}
+		for _, b := range branches {
+			s, err := parseAvroSchema(b, names, namespace)
+			if err != nil {
+				return nil, err
+			}
+			union.branches = append(union.branches, s)
+		}
+		return union, nil
+	}
+
+	var def avroDefinition
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	var typ string
+	if err := json.Unmarshal(def.Type, &typ); err != nil {
+		// A nested definition such as {"type": {"type": "array", ...}}
+		return parseAvroSchema(def.Type, names, namespace)
+	}
+
+	s := &avroSchema{typ: typ, logical: def.LogicalType, precision: def.Precision, scale: def.Scale}
+	switch typ {
+	case "record", "error":
+		s.typ = "record"
+		if def.Namespace != "" {
+			namespace = def.Namespace
+		}
+		s.name = avroFullName(def.Name, namespace)
+		names[s.name] = s
+		if i := strings.LastIndex(s.name, "."); i >= 0 {
+			namespace = s.name[:i]
+		}
+		for _, f := range def.Fields {
+			fs, err := parseAvroSchema(f.Type, names, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			s.fields = append(s.fields, avroField{name: f.Name, schema: fs})
+		}
+	case "enum":
+		s.name = avroFullName(def.Name, namespace)
+		s.symbols = def.Symbols
+		names[s.name] = s
+	case "fixed":
+		s.name = avroFullName(def.Name, namespace)
+		s.size = def.Size
+		names[s.name] = s
+	case "array":
+		items, err := parseAvroSchema(def.Items, names, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.items = items
+	case "map":
+		values, err := parseAvroSchema(def.Values, names, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.values = values
+	default:
+		if !avroPrimitives[typ] {
+			// A reference to a named type, possibly with attributes
+			return parseAvroSchema(def.Type, names, namespace)
+		}
+	}
+	return s, nil
+}
+
+// avroFullName qualifies a type name with namespace unless it already has one
+func avroFullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// avroArrowSchema maps a top-level Avro record to an Arrow schema
+func avroArrowSchema(s *avroSchema) (*arrow.Schema, error) {
+	if s.typ != "record" {
+		return nil, fmt.Errorf("Avro schema must be a record, got %s", s.typ)
+	}
+	fields, err := avroArrowFields(s)
+	if err != nil {
+		return nil, err
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// avroArrowFields maps the fields of an Avro record
+func avroArrowFields(s *avroSchema) ([]arrow.Field, error) {
+	fields := make([]arrow.Field, len(s.fields))
+	for i, f := range s.fields {
+		dt, nullable, err := avroArrowType(f.schema)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		fields[i] = arrow.Field{Name: f.name, Type: dt, Nullable: nullable}
+	}
+	return fields, nil
+}
+
+// avroArrowType maps an Avro type to an Arrow type. Unions of null and one
+// other type are nullable; other unions have no Arrow mapping.
+func avroArrowType(s *avroSchema) (arrow.DataType, bool, error) {
+	switch s.typ {
+	case "union":
+		var value *avroSchema
+		nullable := false
+		for _, b := range s.branches {
+			if b.typ == "null" {
+				nullable = true
+			} else if value == nil {
+				value = b
+			} else {
+				value = nil
+				break
+			}
+		}
+		if value == nil || len(s.branches) > 2 {
+			return nil, false, fmt.Errorf("%w: Avro union of %s (only a type or a type and null map to Arrow)", ErrUnsupportedType, avroUnionNames(s))
+		}
+		dt, _, err := avroArrowType(value)
+		return dt, nullable, err
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean, false, nil
+	case "int":
+		switch s.logical {
+		case "date":
+			return arrow.FixedWidthTypes.Date32, false, nil
+		case "time-millis":
+			return arrow.FixedWidthTypes.Time32ms, false, nil
+		}
+		return arrow.PrimitiveTypes.Int32, false, nil
+	case "long":
+		switch s.logical {
+		case "timestamp-millis":
+			return &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}, false, nil
+		case "timestamp-micros":
+			return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, false, nil
+		case "timestamp-nanos":
+			return &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}, false, nil
+		case "local-timestamp-millis":
+			return &arrow.TimestampType{Unit: arrow.Millisecond}, false, nil
+		case "local-timestamp-micros":
+			return &arrow.TimestampType{Unit: arrow.Microsecond}, false, nil
+		case "local-timestamp-nanos":
+			return &arrow.TimestampType{Unit: arrow.Nanosecond}, false, nil
+		case "time-micros":
+			return arrow.FixedWidthTypes.Time64us, false, nil
+		}
+		return arrow.PrimitiveTypes.Int64, false, nil
+	case "float":
+		return arrow.PrimitiveTypes.Float32, false, nil
+	case "double":
+		return arrow.PrimitiveTypes.Float64, false, nil
+	case "bytes":
+		if s.logical == "decimal" {
+			dt, err := avroDecimalType(s)
+			return dt, false, err
+		}
+		return arrow.BinaryTypes.Binary, false, nil
+	case "string", "enum":
+		return arrow.BinaryTypes.String, false, nil
+	case "fixed":
+		switch s.logical {
+		case "decimal":
+			dt, err := avroDecimalType(s)
+			return dt, false, err
+		case "duration":
+			return nil, false, fmt.Errorf("%w: Avro duration", ErrUnsupportedType)
+		}
+		return &arrow.FixedSizeBinaryType{ByteWidth: s.size}, false, nil
+	case "record":
+		fields, err := avroArrowFields(s)
+		if err != nil {
+			return nil, false, err
+		}
+		return arrow.StructOf(fields...), false, nil
+	case "array":
+		dt, nullable, err := avroArrowType(s.items)
+		if err != nil {
+			return nil, false, err
+		}
+		return arrow.ListOfField(arrow.Field{Name: "item", Type: dt, Nullable: nullable}), false, nil
+	case "map":
+		dt, nullable, err := avroArrowType(s.values)
+		if err != nil {
+			return nil, false, err
+		}
+		return arrow.MapOfFields(
+			arrow.Field{Name: "key", Type: arrow.BinaryTypes.String},
+			arrow.Field{Name: "value", Type: dt, Nullable: nullable},
+		), false, nil
+	}
+	return nil, false, fmt.Errorf("%w: Avro %s outside a union", ErrUnsupportedType, s.typ)
+}
+
+// avroUnionNames lists the branch types of a union
+func avroUnionNames(s *avroSchema) string {
+	names := make([]string, len(s.branches))
+	for i, b := range s.branches {
+		names[i] = b.typ
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// avroDecimalType maps a decimal logical type to the narrowest Arrow decimal
+func avroDecimalType(s *avroSchema) (arrow.DataType, error) {
+	switch {
+	case s.precision < 1 || s.scale < 0 || s.scale > s.precision:
+		return nil, fmt.Errorf("invalid Avro decimal(%d, %d)", s.precision, s.scale)
+	case s.precision <= 38:
+		return &arrow.Decimal128Type{Precision: int32(s.precision), Scale: int32(s.scale)}, nil
+	case s.precision <= 76:
+		return &arrow.Decimal256Type{Precision: int32(s.precision), Scale: int32(s.scale)}, nil
+	}
+	return nil, fmt.Errorf("%w: Avro decimal precision %d", ErrUnsupportedType, s.precision)
+}
+
+// avroHeader is the header of an Avro Object Container File
+type avroHeader struct {
+	avro   *avroSchema
+	schema *arrow.Schema
+	codec  string
+	sync   [16]byte
+}
+
+// readAvroHeader reads the magic, metadata and sync marker of a container
+// file and maps its schema to Arrow
+func readAvroHeader(br *bufio.Reader) (*avroHeader, error) {
+	magic := make([]byte, len(avroMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, avroMagic) {
+		return nil, fmt.Errorf("not an Avro object container file")
+	}
+
+	meta := map[string][]byte{}
+	for {
+		count, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Avro header: %w", err)
+		}
+		if count == 0 {
+			break
+		}
+		if count < 0 {
+			count = -count
+			if _, err := binary.ReadVarint(br); err != nil {
+				return nil, fmt.Errorf("failed to read Avro header: %w", err)
+			}
+		}
+		for ; count > 0; count-- {
+			key, err := readAvroBytes(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Avro header: %w", err)
+			}
+			value, err := readAvroBytes(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Avro header: %w", err)
+			}
+			meta[string(key)] = value
+		}
+	}
+
+	h := &avroHeader{codec: string(meta["avro.codec"])}
+	switch h.codec {
+	case "", "null", "deflate", "snappy", "zstandard":
+	default:
+		return nil, fmt.Errorf("unsupported Avro codec %q", h.codec)
+	}
+	if _, err := io.ReadFull(br, h.sync[:]); err != nil {
+		return nil, fmt.Errorf("failed to read Avro header: %w", err)
+	}
+	rawSchema, ok := meta["avro.schema"]
+	if !ok {
+		return nil, fmt.Errorf("Avro header has no schema")
+	}
+	var err error
+	if h.avro, err = parseAvroSchema(rawSchema, map[string]*avroSchema{}, ""); err != nil {
+		return nil, err
+	}
+	if h.schema, err = avroArrowSchema(h.avro); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readAvroBytes reads a length-prefixed byte string from the file header
+func readAvroBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(br, buf)
+	return buf, err
+}
+
+// LoadAvro reads an Avro Object Container File into a record with the
+// file's schema mapped to Arrow. Unions of null and one other type become
+// nullable fields and the date, time, timestamp and decimal logical types
+// their Arrow equivalents; other unions and the duration type fail with
+// ErrUnsupportedType. Blocks may use the null, deflate, snappy or zstandard
+// codec.
+func LoadAvro(ctx context.Context, r io.Reader, opts ReadOptions) (arrow.Record, error) {
+	br := bufio.NewReader(r)
+	h, err := readAvroHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	b := array.NewRecordBuilder(allocatorOrDefault(opts.Allocator), h.schema)
+	defer b.Release()
+
+	var sync [16]byte
+	for block := 1; ; block++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		count, err := binary.ReadVarint(br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Avro block %d: %w", block, err)
+		}
+		data, err := readAvroBytes(br)
+		if err != nil {
+			return nil, fmt.Errorf("Avro block %d: %w", block, err)
+		}
+		if _, err := io.ReadFull(br, sync[:]); err != nil || sync != h.sync {
+			return nil, fmt.Errorf("Avro block %d: sync marker mismatch", block)
+		}
+		if data, err = avroDecompress(h.codec, data); err != nil {
+			return nil, fmt.Errorf("Avro block %d: %w", block, err)
+		}
+
+		d := &avroDecoder{buf: data}
+		for row := int64(0); row < count; row++ {
+			for i, f := range h.avro.fields {
+				if err := appendAvroValue(b.Field(i), f.schema, d); err != nil {
+					return nil, fmt.Errorf("Avro block %d, row %d, field %s: %w", block, row+1, f.name, err)
+				}
+			}
+		}
+		if d.pos != len(d.buf) {
+			return nil, fmt.Errorf("Avro block %d: %d bytes left after %d rows", block, len(d.buf)-d.pos, count)
+		}
+		opts.addRows(count)
+	}
+	return b.NewRecord(), nil
+}
+
+// AvroSchema reads the header of an Avro Object Container File and returns
+// its schema mapped to Arrow as LoadAvro maps it
+func AvroSchema(r io.Reader) (*arrow.Schema, error) {
+	h, err := readAvroHeader(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	return h.schema, nil
+}
+
+// avroDecompress decompresses a block with a container file codec
+func avroDecompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "", "null":
+		return data, nil
+	case "deflate":
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		return io.ReadAll(fr)
+	case "snappy":
+		// The block ends with the CRC-32 of the uncompressed data
+		if len(data) < 4 {
+			return nil, fmt.Errorf("snappy block too short")
+		}
+		out, err := snappy.Decode(nil, data[:len(data)-4])
+		if err != nil {
+			return nil, err
+		}
+		if crc32.ChecksumIEEE(out) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+			return nil, fmt.Errorf("snappy block checksum mismatch")
+		}
+		return out, nil
+	case "zstandard":
+		zr, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return zr.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported Avro codec %q", codec)
+}
+
+// avroDecoder reads Avro binary encoded values from a decompressed block
+type avroDecoder struct {
+	buf []byte
+	pos int
+}
+
+var errAvroTruncated = errors.New("truncated Avro data")
+
+// long reads a zigzag varint, the encoding of int and long
+func (d *avroDecoder) long() (int64, error) {
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 {
+		return 0, errAvroTruncated
+	}
+	d.pos += n
+	return v, nil
+}
+
+// next returns the following n bytes
+func (d *avroDecoder) next(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(d.buf)-d.pos) {
+		return nil, errAvroTruncated
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// bytes reads a length-prefixed byte string
+func (d *avroDecoder) bytes() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	return d.next(n)
+}
+
+// blockCount reads the item count of an array or map block. A negative
+// count is followed by the block size in bytes, which is not needed.
+func (d *avroDecoder) blockCount() (int64, error) {
+	n, err := d.long()
+	if err != nil || n >= 0 {
+		return n, err
+	}
+	if _, err := d.long(); err != nil {
+		return 0, err
+	}
+	return -n, nil
+}
+
+// appendAvroValue decodes one value of type s and appends it to b, whose
+// type avroArrowType chose for s
+func appendAvroValue(b array.Builder, s *avroSchema, d *avroDecoder) error {
+	switch s.typ {
+	case "union":
+		i, err := d.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.branches)) {
+			return fmt.Errorf("union branch %d out of range", i)
+		}
+		if s.branches[i].typ == "null" {
+			b.AppendNull()
+			return nil
+		}
+		return appendAvroValue(b, s.branches[i], d)
+	case "null":
+		b.AppendNull()
+	case "boolean":
+		v, err := d.next(1)
+		if err != nil {
+			return err
+		}
+		b.(*array.BooleanBuilder).Append(v[0] != 0)
+	case "int", "long":
+		v, err := d.long()
+		if err != nil {
+			return err
+		}
+		switch ib := b.(type) {
+		case *array.Int32Builder:
+			ib.Append(int32(v))
+		case *array.Int64Builder:
+			ib.Append(v)
+		case *array.Date32Builder:
+			ib.Append(arrow.Date32(v))
+		case *array.Time32Builder:
+			ib.Append(arrow.Time32(v))
+		case *array.Time64Builder:
+			ib.Append(arrow.Time64(v))
+		case *array.TimestampBuilder:
+			ib.Append(arrow.Timestamp(v))
+		}
+	case "float":
+		v, err := d.next(4)
+		if err != nil {
+			return err
+		}
+		b.(*array.Float32Builder).Append(math.Float32frombits(binary.LittleEndian.Uint32(v)))
+	case "double":
+		v, err := d.next(8)
+		if err != nil {
+			return err
+		}
+		b.(*array.Float64Builder).Append(math.Float64frombits(binary.LittleEndian.Uint64(v)))
+	case "bytes", "fixed":
+		var v []byte
+		var err error
+		if s.typ == "fixed" {
+			v, err = d.next(int64(s.size))
+		} else {
+			v, err = d.bytes()
+		}
+		if err != nil {
+			return err
+		}
+		switch bb := b.(type) {
+		case *array.BinaryBuilder:
+			bb.Append(v)
+		case *array.FixedSizeBinaryBuilder:
+			bb.Append(v)
+		default:
+			return appendAvroDecimal(b, v)
+		}
+	case "string":
+		v, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		b.(*array.StringBuilder).Append(string(v))
+	case "enum":
+		i, err := d.long()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(s.symbols)) {
+			return fmt.Errorf("enum index %d out of range", i)
+		}
+		b.(*array.StringBuilder).Append(s.symbols[i])
+	case "record":
+		sb := b.(*array.StructBuilder)
+		sb.Append(true)
+		for i, f := range s.fields {
+			if err := appendAvroValue(sb.FieldBuilder(i), f.schema, d); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+	case "array":
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			for ; n > 0; n-- {
+				if err := appendAvroValue(lb.ValueBuilder(), s.items, d); err != nil {
+					return err
+				}
+			}
+		}
+	case "map":
+		mb := b.(*array.MapBuilder)
+		mb.Append(true)
+		keys := mb.KeyBuilder().(*array.StringBuilder)
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			for ; n > 0; n-- {
+				key, err := d.bytes()
+				if err != nil {
+					return err
+				}
+				keys.Append(string(key))
+				if err := appendAvroValue(mb.ItemBuilder(), s.values, d); err != nil {
+					return fmt.Errorf("key %s: %w", key, err)
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported Avro type %s", s.typ)
+	}
+	return nil
+}
+
+// appendAvroDecimal appends a decimal stored as a big-endian two's
+// complement unscaled integer
+func appendAvroDecimal(b array.Builder, v []byte) error {
+	n := new(big.Int).SetBytes(v)
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(v)*8)))
+	}
+	switch db := b.(type) {
+	case *array.Decimal128Builder:
+		typ := db.Type().(*arrow.Decimal128Type)
+		num := decimal128.FromBigInt(n)
+		if n.BitLen() > 127 || !num.FitsInPrecision(typ.Precision) {
+			return fmt.Errorf("decimal %s exceeds precision %d", n, typ.Precision)
+		}
+		db.Append(num)
+	case *array.Decimal256Builder:
+		typ := db.Type().(*arrow.Decimal256Type)
+		num := decimal256.FromBigInt(n)
+		if n.BitLen() > 255 || !num.FitsInPrecision(typ.Precision) {
+			return fmt.Errorf("decimal %s exceeds precision %d", n, typ.Precision)
+		}
+		db.Append(num)
+	default:
+		return fmt.Errorf("unexpected builder %T for Avro bytes", b)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package lockbox
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// avroFile builds an Avro object container file with one block per row
+func avroFile(t *testing.T, schema, codec string, rows ...[]byte) []byte {
+	t.Helper()
+	sync := []byte("0123456789abcdef")
+
+	buf := append([]byte(nil), avroMagic...)
+	buf = binary.AppendVarint(buf, 2)
+	for _, kv := range [][2]string{{"avro.schema", schema}, {"avro.codec", codec}} {
+		buf = avroBytes(buf, []byte(kv[0]))
+		buf = avroBytes(buf, []byte(kv[1]))
+	}
+	buf = binary.AppendVarint(buf, 0)
+	buf = append(buf, sync...)
+
+	for _, row := range rows {
+		if codec == "deflate" {
+			var out bytes.Buffer
+			fw, err := flate.NewWriter(&out, flate.BestCompression)
+			if err != nil {
+				t.Fatalf("deflate: %v", err)
+			}
+			fw.Write(row)
+			fw.Close()
+			row = out.Bytes()
+		}
+		buf = binary.AppendVarint(buf, 1)
+		buf = avroBytes(buf, row)
+		buf = append(buf, sync...)
+	}
+	return buf
+}
+
+// avroBytes appends a length-prefixed byte string
+func avroBytes(buf, b []byte) []byte {
+	return append(binary.AppendVarint(buf, int64(len(b))), b...)
+}
+
+const testAvroSchema = `{
+  "type": "record", "name": "Event", "namespace": "test",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": ["null", "string"]},
+    {"name": "score", "type": "double"},
+    {"name": "ratio", "type": "float"},
+    {"name": "ok", "type": "boolean"},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+    {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "long"}},
+    {"name": "loc", "type": ["null", {"type": "record", "name": "Point", "fields": [
+      {"name": "x", "type": "int"}, {"name": "y", "type": "int"}]}]},
+    {"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 4}},
+    {"name": "prev", "type": ["null", "test.Kind"]}
+  ]
+}`
+
+// testAvroRow encodes one row of testAvroSchema; a nil name is null
+func testAvroRow(id int64, name *string, price []byte, kind int64) []byte {
+	var b []byte
+	b = binary.AppendVarint(b, id)
+	if name == nil {
+		b = binary.AppendVarint(b, 0)
+	} else {
+		b = binary.AppendVarint(b, 1)
+		b = avroBytes(b, []byte(*name))
+	}
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(id)+0.5))
+	b = binary.LittleEndian.AppendUint32(b, math.Float32bits(0.25))
+	b = append(b, 1)
+	b = binary.AppendVarint(b, 19000+id)
+	b = binary.AppendVarint(b, 1700000000000+id)
+	b = avroBytes(b, price)
+	b = binary.AppendVarint(b, kind)
+	// Two array blocks, the second with a negative count and a byte size
+	b = binary.AppendVarint(b, 1)
+	b = avroBytes(b, []byte("x"))
+	b = binary.AppendVarint(b, -1)
+	b = binary.AppendVarint(b, 2)
+	b = avroBytes(b, []byte("y"))
+	b = binary.AppendVarint(b, 0)
+	b = binary.AppendVarint(b, 1)
+	b = avroBytes(b, []byte("k"))
+	b = binary.AppendVarint(b, id*10)
+	b = binary.AppendVarint(b, 0)
+	if name == nil {
+		b = binary.AppendVarint(b, 0)
+	} else {
+		b = binary.AppendVarint(b, 1)
+		b = binary.AppendVarint(b, 3)
+		b = binary.AppendVarint(b, -4)
+	}
+	b = append(b, "abcd"...)
+	b = binary.AppendVarint(b, 1)
+	return binary.AppendVarint(b, 1-kind)
+}
+
+func TestLoadAvro(t *testing.T) {
+	name := "alice"
+	for _, codec := range []string{"null", "deflate"} {
+		// 12.34 and -1.50 as two's complement unscaled integers
+		data := avroFile(t, testAvroSchema, codec,
+			testAvroRow(1, &name, []byte{0x04, 0xD2}, 0),
+			testAvroRow(2, nil, []byte{0xFF, 0x6A}, 1))
+
+		mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+		rec, err := LoadAvro(context.Background(), bytes.NewReader(data), ReadOptions{Allocator: mem})
+		if err != nil {
+			t.Fatalf("%s: load avro: %v", codec, err)
+		}
+
+		want := []string{
+			"id: int64", "name: utf8 (nullable)", "score: float64", "ratio: float32",
+			"ok: bool", "day: date32", "ts: timestamp[ms, tz=UTC]", "price: decimal(10, 2)",
+			"kind: utf8", "tags: list<item: utf8>", "attrs: map<utf8, int64, items_non_nullable>",
+			"loc: struct<x: int32, y: int32> (nullable)", "hash: fixed_size_binary[4]", "prev: utf8 (nullable)",
+		}
+		for i, f := range rec.Schema().Fields() {
+			got := f.Name + ": " + f.Type.String()
+			if f.Nullable {
+				got += " (nullable)"
+			}
+			if got != want[i] {
+				t.Fatalf("%s: field %d: expected %s, got %s", codec, i, want[i], got)
+			}
+		}
+		if rec.NumRows() != 2 {
+			t.Fatalf("%s: expected 2 rows, got %d", codec, rec.NumRows())
+		}
+
+		names := rec.Column(1).(*array.String)
+		if names.Value(0) != "alice" || !names.IsNull(1) {
+			t.Fatalf("%s: unexpected names %v", codec, names)
+		}
+		prices := rec.Column(7).(*array.Decimal128)
+		if got := prices.ValueStr(0) + " " + prices.ValueStr(1); got != "12.34 -1.5" {
+			t.Fatalf("%s: unexpected prices %s", codec, got)
+		}
+		if got := rec.Column(8).(*array.String).Value(1); got != "B" {
+			t.Fatalf("%s: expected enum B, got %s", codec, got)
+		}
+		if got := rec.Column(9).(*array.List).ListValues().(*array.String).Len(); got != 4 {
+			t.Fatalf("%s: expected 4 tags, got %d", codec, got)
+		}
+		loc := rec.Column(11).(*array.Struct)
+		if !loc.IsValid(0) || !loc.IsNull(1) || loc.Field(1).(*array.Int32).Value(0) != -4 {
+			t.Fatalf("%s: unexpected loc %v", codec, loc)
+		}
+		if got := rec.Column(6).(*array.Timestamp).Value(1); got != 1700000000002 {
+			t.Fatalf("%s: unexpected timestamp %d", codec, got)
+		}
+		rec.Release()
+		mem.AssertSize(t, 0)
+	}
+}
+
+func TestLoadAvroErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, schema, want string
+		unsupported        bool
+	}{
+		{"union", `{"type": "record", "name": "r", "fields": [{"name": "v", "type": ["int", "string"]}]}`, "field v", true},
+		{"duration", `{"type": "record", "name": "r", "fields": [{"name": "d", "type": {"type": "fixed", "name": "D", "size": 12, "logicalType": "duration"}}]}`, "duration", true},
+		{"not a record", `"long"`, "must be a record", false},
+		{"unknown type", `{"type": "record", "name": "r", "fields": [{"name": "v", "type": "Missing"}]}`, "unknown Avro type", false},
+	} {
+		_, err := LoadAvro(context.Background(), bytes.NewReader(avroFile(t, tt.schema, "null")), ReadOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, ErrUnsupportedType) != tt.unsupported {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+
+	schema := `{"type": "record", "name": "r", "fields": [{"name": "v", "type": "long"}]}`
+	data := avroFile(t, schema, "null", binary.AppendVarint(nil, 7))
+	data[len(data)-1] ^= 0xFF
+	if _, err := LoadAvro(context.Background(), bytes.NewReader(data), ReadOptions{}); err == nil || !strings.Contains(err.Error(), "sync marker") {
+		t.Fatalf("expected a sync marker error, got %v", err)
+	}
+	if _, err := LoadAvro(context.Background(), strings.NewReader("id,name\n"), ReadOptions{}); err == nil {
+		t.Fatalf("expected an error for non-Avro input")
+	}
+	if _, err := LoadAvro(context.Background(), bytes.NewReader(avroFile(t, schema, "lzma")), ReadOptions{}); err == nil {
+		t.Fatalf("expected an error for an unknown codec")
+	}
+}
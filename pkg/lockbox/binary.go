@@ -0,0 +1,76 @@
+package lockbox
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// BinaryEncoding is the text form of binary values in CSV and JSON. The
+// zero value means base64 for binary and hex for fixed-size binary.
+type BinaryEncoding string
+
+const (
+	BinaryHex    BinaryEncoding = "hex"
+	BinaryBase64 BinaryEncoding = "base64"
+)
+
+// decode decodes val, in def for the zero value. Hex may contain dashes, as
+// UUIDs do.
+func (e BinaryEncoding) decode(val string, def BinaryEncoding) ([]byte, error) {
+	enc := e.orDefault(def)
+	var data []byte
+	var err error
+	if enc == BinaryBase64 {
+		data, err = base64.StdEncoding.DecodeString(val)
+	} else {
+		data, err = hex.DecodeString(strings.ReplaceAll(val, "-", ""))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %q", enc, val)
+	}
+	return data, nil
+}
+
+// decodeFixed decodes val for a fixed-size binary column and checks that it
+// has the type's width
+func (e BinaryEncoding) decodeFixed(val string, typ *arrow.FixedSizeBinaryType) ([]byte, error) {
+	data, err := e.decode(val, BinaryHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != typ.ByteWidth {
+		return nil, fmt.Errorf("%s expects %d bytes, got %d", typ, typ.ByteWidth, len(data))
+	}
+	return data, nil
+}
+
+// Encode formats the value of a binary column, in base64 for the zero value
+func (e BinaryEncoding) Encode(data []byte) string {
+	return e.encode(data, BinaryBase64)
+}
+
+// EncodeFixed formats the value of a fixed-size binary column, in hex for
+// the zero value
+func (e BinaryEncoding) EncodeFixed(data []byte) string {
+	return e.encode(data, BinaryHex)
+}
+
+// encode formats data, in def for the zero value
+func (e BinaryEncoding) encode(data []byte, def BinaryEncoding) string {
+	if e.orDefault(def) == BinaryBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// orDefault returns e, or def for the zero value
+func (e BinaryEncoding) orDefault(def BinaryEncoding) BinaryEncoding {
+	if e == "" {
+		return def
+	}
+	return e
+}
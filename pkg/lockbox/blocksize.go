@@ -0,0 +1,32 @@
+package lockbox
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Block sizes outside this range are allowed but rarely pay off: smaller
+// blocks spend more on per-block encryption and metadata than they save in
+// read granularity, and larger ones must be decrypted whole to read a row.
+const (
+	minTunedBlockSize = 1024
+	maxTunedBlockSize = 1 << 20
+)
+
+// WithBlockSize sets the number of rows per segment. Create records it as
+// the file's default for later writes, Write splits records into segments
+// of this size, and Compact rewrites the file into them. Smaller blocks let
+// filters and segment reads skip more; larger ones compress better and
+// carry less per-block overhead.
+func WithBlockSize(rows int) Option {
+	return func(o *Options) {
+		if rows <= 0 && o.err == nil {
+			o.err = fmt.Errorf("block size must be positive, got %d", rows)
+		}
+		if rows > 0 && (rows < minTunedBlockSize || rows > maxTunedBlockSize) {
+			log.Warn().Int("rows", rows).Int("min", minTunedBlockSize).Int("max", maxTunedBlockSize).Msg("Block size is outside the usual range")
+		}
+		o.BlockSize = rows
+	}
+}
@@ -0,0 +1,391 @@
+package lockbox
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/compute"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// CoercionNote describes one change CoerceRecordVerbose made to a record
+type CoercionNote struct {
+	// Column is the lockbox column, or the input column that was dropped
+	Column string `json:"column"`
+	// Change describes the conversion, e.g. "int32 to int64"
+	Change string `json:"change"`
+	// Lossy marks changes that can lose data: narrowing a numeric type,
+	// truncating floats to integers or dropping a column
+	Lossy bool `json:"lossy"`
+}
+
+func (n CoercionNote) String() string {
+	if n.Lossy {
+		return fmt.Sprintf("%s: %s (lossy)", n.Column, n.Change)
+	}
+	return fmt.Sprintf("%s: %s", n.Column, n.Change)
+}
+
+// WithTimestampTimezone sets the zone naive timestamps are read in when
+// CoerceRecord converts them to or from a zoned timestamp. Without it naive
+// timestamps are taken as UTC.
+func WithTimestampTimezone(loc *time.Location) Option {
+	return func(o *Options) {
+		if loc == nil && o.err == nil {
+			o.err = fmt.Errorf("timestamp time zone must not be nil")
+		}
+		o.TimestampTimezone = loc
+	}
+}
+
+// CoerceRecord converts record columns, matched by position, to the types
+// of schema. See CoerceRecordVerbose for the conversions it applies.
+func CoerceRecord(schema *arrow.Schema, rec arrow.Record, opts ...Option) (arrow.Record, error) {
+	out, _, err := CoerceRecordVerbose(schema, rec, opts...)
+	return out, err
+}
+
+// CoerceRecordVerbose converts record columns, matched by position, to the
+// types and nullability of schema and reports each change it made. Numeric
+// columns are cast to any numeric type, failing on values out of the target
+// range; floats cast to integers are truncated. Strings convert to and from
+// string dictionaries. Timestamps convert between time zones, to and from
+// naive timestamps, and between units; the instant each value names is kept,
+// and a change of unit fails rather than truncate or overflow. Naive
+// timestamps are wall clock times in the zone set by WithTimestampTimezone,
+// UTC by default. A nullable column becomes non-nullable only if it holds
+// no nulls. Input columns past the end of schema are dropped.
+func CoerceRecordVerbose(schema *arrow.Schema, rec arrow.Record, opts ...Option) (arrow.Record, []CoercionNote, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, nil, options.err
+	}
+	return coerceRecord(allocatorOrDefault(options.Allocator), schema, rec, options.TimestampTimezone)
+}
+
+// coerceRecord is CoerceRecordVerbose allocating from mem and reading
+// naive timestamps in loc, or UTC if loc is nil
+func coerceRecord(mem memory.Allocator, schema *arrow.Schema, rec arrow.Record, loc *time.Location) (arrow.Record, []CoercionNote, error) {
+	if rec.Schema().Equal(schema) {
+		rec.Retain()
+		return rec, nil, nil
+	}
+
+	if int(rec.NumCols()) < len(schema.Fields()) {
+		return nil, nil, fmt.Errorf("cannot coerce record with %d columns to schema with %d fields", rec.NumCols(), len(schema.Fields()))
+	}
+
+	var cols []arrow.Array
+	release := func() {
+		for _, c := range cols {
+			c.Release()
+		}
+	}
+	defer release()
+
+	var notes []CoercionNote
+	for i, field := range schema.Fields() {
+		src := rec.Column(i)
+		srcField := rec.Schema().Field(i)
+		if srcField.Name != field.Name {
+			notes = append(notes, CoercionNote{Column: field.Name, Change: fmt.Sprintf("renamed from %s", srcField.Name)})
+		}
+		if arrow.TypeEqual(field.Type, src.DataType()) {
+			src.Retain()
+			cols = append(cols, src)
+		} else {
+			arr, lossy, err := coerceColumn(mem, field.Type, src, loc)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot coerce column %s: %w", field.Name, err)
+			}
+			cols = append(cols, arr)
+			notes = append(notes, CoercionNote{
+				Column: field.Name,
+				Change: fmt.Sprintf("%s to %s", src.DataType(), field.Type),
+				Lossy:  lossy,
+			})
+		}
+
+		// Making a column nullable always works; the reverse only while it
+		// holds no nulls
+		switch {
+		case srcField.Nullable && !field.Nullable:
+			if row := firstNull(src); row >= 0 {
+				return nil, nil, fmt.Errorf("cannot coerce column %s: null at row %d in a non-nullable column", field.Name, row)
+			}
+			notes = append(notes, CoercionNote{Column: field.Name, Change: "nullable to non-nullable"})
+		case !srcField.Nullable && field.Nullable:
+			notes = append(notes, CoercionNote{Column: field.Name, Change: "non-nullable to nullable"})
+		}
+	}
+	for _, extra := range rec.Schema().Fields()[len(schema.Fields()):] {
+		notes = append(notes, CoercionNote{Column: extra.Name, Change: "dropped", Lossy: true})
+	}
+	return array.NewRecord(schema, cols, rec.NumRows()), notes, nil
+}
+
+// CheckCoercible reports, from the schemas alone, every column that
+// CoerceRecord could not convert from a record of schema from to schema: a
+// missing column, a column found at another position, or a type with no
+// conversion. The error wraps ErrSchemaMismatch and lists them all. Checks
+// that depend on the data, such as nulls in a non-nullable column or values
+// out of range, are left to CoerceRecord.
+func CheckCoercible(schema, from *arrow.Schema) error {
+	var problems []string
+	for i, field := range schema.Fields() {
+		if i >= len(from.Fields()) {
+			problems = append(problems, fmt.Sprintf("missing column %s", field.Name))
+			continue
+		}
+		src := from.Field(i)
+		if src.Name != field.Name {
+			if at := from.FieldIndices(field.Name); len(at) > 0 {
+				problems = append(problems, fmt.Sprintf("column %s is at position %d, expected %d", field.Name, at[0]+1, i+1))
+				continue
+			}
+		}
+		if !coercible(src.Type, field.Type) {
+			problems = append(problems, fmt.Sprintf("column %s: cannot convert %s to %s", field.Name, src.Type, field.Type))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// coercible reports whether coerceColumn converts from to to
+func coercible(from, to arrow.DataType) bool {
+	if arrow.TypeEqual(from, to) {
+		return true
+	}
+	if isNumeric(from) && isNumeric(to) {
+		return true
+	}
+	if from.ID() == arrow.TIMESTAMP && to.ID() == arrow.TIMESTAMP {
+		return true
+	}
+	if dict, ok := to.(*arrow.DictionaryType); ok {
+		return from.ID() == arrow.STRING && dict.ValueType.ID() == arrow.STRING
+	}
+	if dict, ok := from.(*arrow.DictionaryType); ok {
+		return to.ID() == arrow.STRING && dict.ValueType.ID() == arrow.STRING
+	}
+	return false
+}
+
+// firstNull returns the index of the first null in arr, or -1
+func firstNull(arr arrow.Array) int {
+	if arr.NullN() == 0 {
+		return -1
+	}
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// coerceColumn converts src to dt, reading naive timestamps in loc. lossy
+// reports whether dt cannot hold every value of the source type.
+func coerceColumn(mem memory.Allocator, dt arrow.DataType, src arrow.Array, loc *time.Location) (arrow.Array, bool, error) {
+	if arr, ok, err := coerceDictionary(mem, dt, src); ok {
+		return arr, false, err
+	}
+	if arr, ok, err := coerceTimestamp(mem, dt, src, loc); ok {
+		return arr, false, err
+	}
+	if isNumeric(dt) && isNumeric(src.DataType()) {
+		ctx := compute.WithAllocator(context.Background(), mem)
+		opts := compute.SafeCastOptions(dt)
+		if arrow.IsFloating(src.DataType().ID()) && arrow.IsInteger(dt.ID()) {
+			// Truncation skips the range check, so check the range first
+			if err := checkTruncatedRange(ctx, src, dt); err != nil {
+				return nil, false, err
+			}
+			opts.AllowFloatTruncate = true
+		}
+		arr, err := compute.CastArray(ctx, src, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		return arr, !numericWidens(src.DataType(), dt), nil
+	}
+	return nil, false, fmt.Errorf("%w: %s to %s", ErrUnsupportedType, src.DataType(), dt)
+}
+
+// checkTruncatedRange fails if a float in src, truncated, is out of the
+// range of the integer type dt
+func checkTruncatedRange(ctx context.Context, src arrow.Array, dt arrow.DataType) error {
+	wide, err := compute.CastToType(ctx, src, arrow.PrimitiveTypes.Float64)
+	if err != nil {
+		return err
+	}
+	defer wide.Release()
+
+	bits := dt.(arrow.FixedWidthDataType).BitWidth()
+	lo, hi := 0.0, math.Ldexp(1, bits)
+	if arrow.IsSignedInteger(dt.ID()) {
+		lo, hi = -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+	}
+	values := wide.(*array.Float64)
+	for i := 0; i < values.Len(); i++ {
+		if values.IsNull(i) {
+			continue
+		}
+		// NaN fails both comparisons
+		if v := math.Trunc(values.Value(i)); !(v >= lo && v < hi) {
+			return fmt.Errorf("float value %v not in range of %s", values.Value(i), dt)
+		}
+	}
+	return nil
+}
+
+// isNumeric reports whether dt is an integer or a 32 or 64 bit float
+func isNumeric(dt arrow.DataType) bool {
+	return arrow.IsInteger(dt.ID()) || dt.ID() == arrow.FLOAT32 || dt.ID() == arrow.FLOAT64
+}
+
+// numericWidens reports whether every value of the numeric type from is
+// exactly representable in to
+func numericWidens(from, to arrow.DataType) bool {
+	fromBits := from.(arrow.FixedWidthDataType).BitWidth()
+	toBits := to.(arrow.FixedWidthDataType).BitWidth()
+	fromFloat := arrow.IsFloating(from.ID())
+	switch {
+	case arrow.IsFloating(to.ID()):
+		if fromFloat {
+			return toBits >= fromBits
+		}
+		// Integers fit in the significand: 24 bits for float32, 53 for float64
+		significand := 24
+		if toBits == 64 {
+			significand = 53
+		}
+		return fromBits < significand
+	case fromFloat:
+		return false
+	case arrow.IsSignedInteger(from.ID()) == arrow.IsSignedInteger(to.ID()):
+		return toBits >= fromBits
+	case arrow.IsUnsignedInteger(from.ID()):
+		// An unsigned value needs one more bit once signed
+		return toBits > fromBits
+	}
+	return false
+}
+
+// coerceDictionary converts between plain and dictionary-encoded strings. ok
+// is false when neither side is a string dictionary.
+func coerceDictionary(mem memory.Allocator, dt arrow.DataType, src arrow.Array) (arrow.Array, bool, error) {
+	switch typ := dt.(type) {
+	case *arrow.DictionaryType:
+		strs, isString := src.(*array.String)
+		if !isString || typ.ValueType.ID() != arrow.STRING {
+			return nil, false, nil
+		}
+		b := array.NewDictionaryBuilder(mem, typ).(*array.BinaryDictionaryBuilder)
+		defer b.Release()
+		for i := 0; i < strs.Len(); i++ {
+			if strs.IsNull(i) {
+				b.AppendNull()
+				continue
+			}
+			if err := b.AppendString(strs.Value(i)); err != nil {
+				return nil, true, err
+			}
+		}
+		return b.NewArray(), true, nil
+	case *arrow.StringType:
+		dict, isDict := src.(*array.Dictionary)
+		if !isDict {
+			return nil, false, nil
+		}
+		values, isString := dict.Dictionary().(*array.String)
+		if !isString {
+			return nil, false, nil
+		}
+		b := array.NewStringBuilder(mem)
+		defer b.Release()
+		for i := 0; i < dict.Len(); i++ {
+			if dict.IsNull(i) {
+				b.AppendNull()
+				continue
+			}
+			b.Append(values.Value(dict.GetValueIndex(i)))
+		}
+		return b.NewArray(), true, nil
+	}
+	return nil, false, nil
+}
+
+// coerceTimestamp converts between timestamp types. Arrow stores every
+// timestamp as an offset from the Unix epoch in UTC, whatever its time zone,
+// so a change of zone keeps the values and the instants they name. A naive
+// timestamp instead stores a wall clock time in loc as if it were UTC, so
+// converting to or from one shifts each value by the offset of loc at that
+// time; with loc nil or UTC the values are kept. A change of unit rescales
+// them. ok is false unless both sides are timestamps.
+func coerceTimestamp(mem memory.Allocator, dt arrow.DataType, src arrow.Array, loc *time.Location) (arrow.Array, bool, error) {
+	to, isTimestamp := dt.(*arrow.TimestampType)
+	from, srcTimestamp := src.DataType().(*arrow.TimestampType)
+	if !isTimestamp || !srcTimestamp {
+		return nil, false, nil
+	}
+	var arr arrow.Array
+	if from.Unit == to.Unit {
+		data := array.NewData(dt, src.Len(), src.Data().Buffers(), nil, src.NullN(), src.Data().Offset())
+		defer data.Release()
+		arr = array.MakeFromData(data)
+	} else {
+		ctx := compute.WithAllocator(context.Background(), mem)
+		var err error
+		if arr, err = compute.CastArray(ctx, src, compute.SafeCastOptions(dt)); err != nil {
+			return nil, true, err
+		}
+	}
+	if loc == nil || loc == time.UTC || (from.TimeZone == "") == (to.TimeZone == "") {
+		return arr, true, nil
+	}
+	defer arr.Release()
+	return shiftWallClock(mem, arr.(*array.Timestamp), loc, to.TimeZone == ""), true, nil
+}
+
+// shiftWallClock converts timestamps between instants and wall clock times
+// in loc stored as if in UTC: toWall turns each instant into the time it
+// shows in loc, and !toWall turns each wall clock time into its instant
+func shiftWallClock(mem memory.Allocator, arr *array.Timestamp, loc *time.Location, toWall bool) arrow.Array {
+	typ := arr.DataType().(*arrow.TimestampType)
+	perSecond := int64(time.Second / typ.Unit.Multiplier())
+
+	b := array.NewTimestampBuilder(mem, typ)
+	defer b.Release()
+	b.Reserve(arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		if arr.IsNull(i) {
+			b.AppendNull()
+			continue
+		}
+		v := arr.Value(i)
+		t := v.ToTime(typ.Unit)
+		var offset int
+		if toWall {
+			_, offset = t.In(loc).Zone()
+		} else {
+			// A wall clock time skipped by a daylight saving change maps
+			// to the instant time.Date picks
+			_, offset = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc).Zone()
+			offset = -offset
+		}
+		b.Append(v + arrow.Timestamp(int64(offset)*perSecond))
+	}
+	return b.NewArray()
+}
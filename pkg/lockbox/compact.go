@@ -0,0 +1,249 @@
+package lockbox
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultBlockSize is the number of rows per segment Compact writes unless
+// WithBlockSize is given or the file records a block size
+const DefaultBlockSize = 64 * 1024
+
+// CompactReport describes the file before and after Compact
+type CompactReport struct {
+	Rows           int64
+	SegmentsBefore int
+	SegmentsAfter  int
+	BytesBefore    int64
+	BytesAfter     int64
+}
+
+// Compact rewrites a local lockbox file into segments of WithBlockSize rows,
+// so a file built from many small appends reads as a few large blocks. With
+// WithSortBy the rows are sorted first, which tightens the min/max
+// statistics filters use to skip segments. Without WithCompression each
+// column keeps the codec of its latest block.
+//
+// The rewrite goes to a temporary file in the same directory that replaces
+// the original only once it is complete, so a failure leaves the file as it
+// was, and the original stays exclusively locked while it is rewritten. The
+// key slots, properties and schema version are carried over and the same
+// credentials open the result.
+func Compact(ctx context.Context, filename string, opts ...Option) (*CompactReport, error) {
+	options := &Options{
+		CreatedBy: "system",
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	var rows int64
+	var before, after int
+	size, err := rewrite("compact", filename, options, opts, func(lb *Lockbox, out *format.LockboxFile) error {
+		if err := checkSortColumns(lb.Schema(), options.SortBy); err != nil {
+			return err
+		}
+		if options.BlockSize == 0 {
+			options.BlockSize = cmp.Or(lb.file.BlockSize(), DefaultBlockSize)
+		}
+		var err error
+		rows, err = lb.compactInto(ctx, out, options)
+		before, after = lb.SegmentCount(), out.SegmentCount()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompactReport{
+		Rows:           rows,
+		SegmentsBefore: before,
+		SegmentsAfter:  after,
+		BytesBefore:    size,
+	}
+	if st, err := os.Stat(filename); err == nil {
+		report.BytesAfter = st.Size()
+	}
+	log.Info().
+		Str("file", filename).
+		Int("segments_before", report.SegmentsBefore).
+		Int("segments_after", report.SegmentsAfter).
+		Msg("Compacted lockbox")
+	return report, nil
+}
+
+// compactInto copies every row of lb into out in segments of
+// options.BlockSize rows, returning the number of rows written
+func (lb *Lockbox) compactInto(ctx context.Context, out *format.LockboxFile, options *Options) (int64, error) {
+	reader, err := lb.file.NewReaderWithKey(lb.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create reader: %w", err)
+	}
+	writer, err := out.NewWriterWithKey(lb.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create writer: %w", err)
+	}
+	codec, columns, level := options.Compression, options.ColumnCompression, options.CompressionLevel
+	if codec == "" && len(columns) == 0 {
+		columns, level = lb.currentCompression()
+	}
+	if err := writer.SetCompression(codec, columns, level); err != nil {
+		return 0, fmt.Errorf("invalid compression: %w", err)
+	}
+	writer.SetParallelism(options.Parallelism)
+	writer.SetBlockSize(options.BlockSize)
+
+	mem := memory.NewGoAllocator()
+	chunks := &rechunker{mem: mem, writer: writer, size: int64(options.BlockSize), sortBy: options.SortBy}
+	defer chunks.release()
+
+	if len(options.SortBy) > 0 {
+		rec, err := reader.ReadRecord()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read record: %w", err)
+		}
+		sorted, err := sortRecord(ctx, mem, rec, options.SortBy)
+		rec.Release()
+		if err != nil {
+			return 0, err
+		}
+		if err := chunks.add(sorted); err != nil {
+			return chunks.rows, err
+		}
+	} else {
+		for i := 0; i < lb.SegmentCount(); i++ {
+			if err := ctx.Err(); err != nil {
+				return chunks.rows, err
+			}
+			rec, err := reader.ReadSegment(i)
+			if err != nil {
+				return chunks.rows, fmt.Errorf("failed to read segment %d: %w", i, err)
+			}
+			if err := chunks.add(rec); err != nil {
+				return chunks.rows, err
+			}
+		}
+	}
+	return chunks.rows, chunks.flush()
+}
+
+// currentCompression returns the codec of each column's latest block, and
+// the zstd level of the latest zstd block
+func (lb *Lockbox) currentCompression() (map[string]string, int) {
+	meta := lb.file.Metadata()
+	columns := make(map[string]string)
+	level := 0
+	for _, field := range lb.Schema().Fields() {
+		blocks := meta.ColumnBlocks(field.Name)
+		if len(blocks) == 0 {
+			continue
+		}
+		last := blocks[len(blocks)-1]
+		if last.Codec == "" {
+			continue
+		}
+		columns[field.Name] = last.Codec
+		if last.Codec == format.CodecZstd && last.Level != 0 {
+			level = last.Level
+		}
+	}
+	return columns, level
+}
+
+// rechunker buffers records and writes them as segments of exactly size
+// rows, with a shorter final segment from flush
+type rechunker struct {
+	mem      memory.Allocator
+	writer   *format.Writer
+	size     int64
+	sortBy   []string
+	pending  []arrow.Record
+	buffered int64
+	// rows counts the rows written so far
+	rows int64
+}
+
+// add takes ownership of rec and writes every full segment now available
+func (c *rechunker) add(rec arrow.Record) error {
+	if rec.NumRows() == 0 {
+		rec.Release()
+		return nil
+	}
+	c.pending = append(c.pending, rec)
+	c.buffered += rec.NumRows()
+	for c.buffered >= c.size {
+		if err := c.write(c.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes whatever rows remain buffered
+func (c *rechunker) flush() error {
+	if c.buffered == 0 {
+		return nil
+	}
+	return c.write(c.buffered)
+}
+
+// write writes the first n buffered rows as one segment
+func (c *rechunker) write(n int64) error {
+	all := c.pending[0]
+	if len(c.pending) > 1 {
+		cols := make([]arrow.Array, all.NumCols())
+		for i := range cols {
+			parts := make([]arrow.Array, len(c.pending))
+			for k, rec := range c.pending {
+				parts[k] = rec.Column(i)
+			}
+			col, err := array.Concatenate(parts, c.mem)
+			if err != nil {
+				for _, done := range cols[:i] {
+					done.Release()
+				}
+				return fmt.Errorf("failed to concatenate column %s: %w", all.ColumnName(i), err)
+			}
+			cols[i] = col
+		}
+		all = array.NewRecord(all.Schema(), cols, c.buffered)
+		for _, col := range cols {
+			col.Release()
+		}
+		c.release()
+	} else {
+		c.pending = nil
+	}
+
+	// WriteRecord releases the segment it is given
+	c.writer.SetSortOrder(c.sortBy)
+	if err := c.writer.WriteRecord(all.NewSlice(0, n)); err != nil {
+		all.Release()
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	c.rows += n
+	c.buffered -= n
+	if c.buffered > 0 {
+		c.pending = []arrow.Record{all.NewSlice(n, n+c.buffered)}
+	}
+	all.Release()
+	return nil
+}
+
+// release drops the buffered records
+func (c *rechunker) release() {
+	for _, rec := range c.pending {
+		rec.Release()
+	}
+	c.pending = nil
+}
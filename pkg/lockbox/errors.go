@@ -0,0 +1,46 @@
+package lockbox
+
+import (
+	"errors"
+
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/format"
+)
+
+// Errors returned by this package are wrapped with context; test for them
+// with errors.Is.
+var (
+	// ErrWrongPassword is returned when the password does not unlock the
+	// file
+	ErrWrongPassword = format.ErrWrongPassword
+
+	// ErrNoMatchingIdentity is returned when none of the identities is a
+	// recipient of the file
+	ErrNoMatchingIdentity = crypto.ErrNoMatchingIdentity
+
+	// ErrPasswordRequired is returned when an operation needs the key but
+	// was given neither a password nor an identity, e.g. reading data from
+	// a file opened with OpenRead alone
+	ErrPasswordRequired = format.ErrPasswordRequired
+
+	// ErrWrongAAD is returned when a file bound to associated data with
+	// WithAAD is opened with different data, or without it
+	ErrWrongAAD = format.ErrWrongAAD
+
+	// ErrCorrupt is returned when the file fails an integrity check: a
+	// damaged header or metadata, a block that fails authentication, or
+	// properties edited without the key
+	ErrCorrupt = format.ErrCorrupt
+
+	// ErrLocked is returned by Open and Create when another handle holds a
+	// conflicting lock on the file
+	ErrLocked = format.ErrLocked
+
+	// ErrSchemaMismatch is returned by Write when a record's schema differs
+	// from the lockbox schema and coercion was not requested or failed
+	ErrSchemaMismatch = errors.New("record schema does not match lockbox schema")
+
+	// ErrUnsupportedType is returned when an operation does not handle a
+	// column's data type, such as filtering, sorting or coercing it
+	ErrUnsupportedType = errors.New("unsupported data type")
+)
@@ -0,0 +1,80 @@
+package lockbox
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// WithSchemaEvolution lets Write accept records whose columns differ from
+// the lockbox schema by name: extra nullable columns upgrade the schema, and
+// missing nullable columns are filled with nulls. See EvolveSchema.
+func WithSchemaEvolution(v bool) Option {
+	return func(o *Options) {
+		o.Evolve = v
+	}
+}
+
+// EvolveSchema returns the schema a lockbox with schema current has after
+// writing records with schema incoming. Columns are matched by name. New
+// columns must be nullable and are appended in incoming's order; columns
+// incoming lacks must be nullable. A column that changes type is an error.
+func EvolveSchema(current, incoming *arrow.Schema) (*arrow.Schema, error) {
+	fields := append([]arrow.Field(nil), current.Fields()...)
+	for _, field := range current.Fields() {
+		idx := incoming.FieldIndices(field.Name)
+		if len(idx) == 0 {
+			if !field.Nullable {
+				return nil, fmt.Errorf("record is missing non-nullable column %s", field.Name)
+			}
+			continue
+		}
+		got := incoming.Field(idx[0])
+		if !arrow.TypeEqual(field.Type, got.Type) {
+			return nil, fmt.Errorf("column %s changes type from %s to %s", field.Name, field.Type, got.Type)
+		}
+	}
+	for _, field := range incoming.Fields() {
+		if current.HasField(field.Name) {
+			continue
+		}
+		if !field.Nullable {
+			return nil, fmt.Errorf("new column %s must be nullable, since existing rows have no value for it", field.Name)
+		}
+		fields = append(fields, arrow.Field{Name: field.Name, Type: field.Type, Nullable: true, Metadata: field.Metadata})
+	}
+	md := current.Metadata()
+	return arrow.NewSchema(fields, &md), nil
+}
+
+// conformRecord arranges rec's columns to match schema by name, filling
+// columns rec lacks with nulls. Columns of non-nullable fields must have no
+// nulls.
+func conformRecord(schema *arrow.Schema, rec arrow.Record) (arrow.Record, error) {
+	mem := memory.NewGoAllocator()
+	cols := make([]arrow.Array, 0, len(schema.Fields()))
+	release := func() {
+		for _, c := range cols {
+			c.Release()
+		}
+	}
+	for _, field := range schema.Fields() {
+		idx := rec.Schema().FieldIndices(field.Name)
+		if len(idx) == 0 {
+			cols = append(cols, array.MakeArrayOfNull(mem, field.Type, int(rec.NumRows())))
+			continue
+		}
+		col := rec.Column(idx[0])
+		if !field.Nullable && col.NullN() > 0 {
+			release()
+			return nil, fmt.Errorf("column %s is not nullable but has %d nulls", field.Name, col.NullN())
+		}
+		col.Retain()
+		cols = append(cols, col)
+	}
+	out := array.NewRecord(schema, cols, rec.NumRows())
+	release()
+	return out, nil
+}
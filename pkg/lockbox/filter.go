@@ -0,0 +1,409 @@
+package lockbox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// Filter is a comparison between a column and a constant. Filters passed to
+// a reader are combined with AND.
+type Filter struct {
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// filterOps lists the supported comparison operators
+var filterOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// WithFilter keeps only rows where col op value holds, with op one of =,
+// !=, <, <=, >, >=. Integer, floating point and timestamp columns take any
+// operator; value may be a Go number, a time.Time for timestamps, or a
+// string that is parsed for the column type. String and string dictionary
+// columns take = and != with a string value. Segments whose stored min/max
+// cannot match are skipped without being decrypted. Nulls never match.
+func WithFilter(col, op string, value interface{}) Option {
+	return func(o *Options) {
+		if !filterOps[op] && o.err == nil {
+			o.err = fmt.Errorf("unsupported filter operator %q (expected =, !=, <, <=, >, >=)", op)
+		}
+		o.Filters = append(o.Filters, Filter{Column: col, Op: op, Value: value})
+	}
+}
+
+// ParseFilter parses a condition such as "age>=18" or "status='open'" into
+// a Filter. The operator is one of =, !=, <, <=, >, >=; spaces around it are
+// allowed, and quotes around the value are removed, so a quoted value may
+// be empty. The value stays a string, parsed for the column type when the
+// filter is applied.
+func ParseFilter(expr string) (Filter, error) {
+	i := strings.IndexAny(expr, "!<>=")
+	if i < 0 {
+		return Filter{}, fmt.Errorf("invalid condition %q: expected =, !=, <, <=, > or >=", expr)
+	}
+	op := expr[i : i+1]
+	if op != "=" && i+1 < len(expr) && expr[i+1] == '=' {
+		op += "="
+	}
+	if op == "!" {
+		return Filter{}, fmt.Errorf("invalid condition %q: unsupported operator", expr)
+	}
+	col := strings.TrimSpace(expr[:i])
+	value := strings.TrimSpace(expr[i+len(op):])
+	if value != "" && strings.ContainsRune("!<>=", rune(value[0])) {
+		return Filter{}, fmt.Errorf("invalid condition %q: unsupported operator", expr)
+	}
+	if col == "" || value == "" {
+		return Filter{}, fmt.Errorf("invalid condition %q: expected column, operator and value", expr)
+	}
+	return Filter{Column: col, Op: op, Value: strings.Trim(value, `'"`)}, nil
+}
+
+// predicate is a Filter resolved against the schema. Integer and timestamp
+// columns compare as int64 unless the constant has a fraction, then as
+// float64; string columns compare s.
+type predicate struct {
+	column   string
+	op       string
+	isFloat  bool
+	isString bool
+	i        int64
+	f        float64
+	s        string
+}
+
+// compilePredicates checks filters against the schema and converts their
+// constants to the column representation
+func compilePredicates(schema *arrow.Schema, filters []Filter) ([]predicate, error) {
+	preds := make([]predicate, 0, len(filters))
+	for _, flt := range filters {
+		idx := schema.FieldIndices(flt.Column)
+		if len(idx) == 0 {
+			return nil, fmt.Errorf("unknown filter column %s", flt.Column)
+		}
+		p := predicate{column: flt.Column, op: flt.Op}
+		var err error
+		switch dt := schema.Field(idx[0]).Type.(type) {
+		case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type,
+			*arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type:
+			err = p.setNumber(flt.Value, true)
+		case *arrow.Float32Type, *arrow.Float64Type:
+			p.isFloat = true
+			err = p.setNumber(flt.Value, false)
+		case *arrow.TimestampType:
+			err = p.setTime(flt.Value, dt)
+		case *arrow.StringType, *arrow.LargeStringType:
+			err = p.setString(flt.Value)
+		case *arrow.DictionaryType:
+			if dt.ValueType.ID() != arrow.STRING {
+				err = fmt.Errorf("%w: %s", ErrUnsupportedType, dt)
+				break
+			}
+			err = p.setString(flt.Value)
+		default:
+			err = fmt.Errorf("%w: %s", ErrUnsupportedType, dt)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter on %s: %w", flt.Column, err)
+		}
+		preds = append(preds, p)
+	}
+	return preds, nil
+}
+
+// setNumber stores a numeric constant. For integer columns a whole number
+// stays an int64 so large values compare exactly.
+func (p *predicate) setNumber(v interface{}, integer bool) error {
+	var f float64
+	switch n := v.(type) {
+	case int:
+		p.i, f = int64(n), float64(n)
+	case int32:
+		p.i, f = int64(n), float64(n)
+	case int64:
+		p.i, f = n, float64(n)
+	case float32:
+		f = float64(n)
+	case float64:
+		f = n
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			p.i, f = i, float64(i)
+			break
+		}
+		parsed, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", n)
+		}
+		f = parsed
+	default:
+		return fmt.Errorf("unsupported value %v (%T)", v, v)
+	}
+
+	if math.IsNaN(f) {
+		return fmt.Errorf("NaN is not comparable")
+	}
+	p.f = f
+	if integer && float64(p.i) != f {
+		p.isFloat = true
+	}
+	return nil
+}
+
+// setTime stores a timestamp constant in the column's unit
+func (p *predicate) setTime(v interface{}, dt *arrow.TimestampType) error {
+	var tm time.Time
+	switch t := v.(type) {
+	case time.Time:
+		tm = t
+	case string:
+		ts, err := arrow.TimestampFromString(t, dt.Unit)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", t)
+		}
+		tm = ts.ToTime(dt.Unit)
+	default:
+		return p.setNumber(v, true)
+	}
+
+	ts, err := arrow.TimestampFromTime(tm, dt.Unit)
+	if err != nil {
+		return err
+	}
+	p.i, p.f = int64(ts), float64(ts)
+	return nil
+}
+
+// setString stores a string constant. Strings have no numeric ordering
+// here, so only equality is supported.
+func (p *predicate) setString(v interface{}) error {
+	if p.op != "=" && p.op != "!=" {
+		return fmt.Errorf("%w: operator %s on a string column (expected = or !=)", ErrUnsupportedType, p.op)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("unsupported value %v (%T) for a string column", v, v)
+	}
+	p.isString, p.s = true, s
+	return nil
+}
+
+// compare orders a column value against the constant: -1, 0 or +1
+func (p *predicate) compare(i int64, f float64, isFloat bool) int {
+	if p.isFloat || isFloat {
+		if !isFloat {
+			f = float64(i)
+		}
+		switch {
+		case f < p.f:
+			return -1
+		case f > p.f:
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case i < p.i:
+		return -1
+	case i > p.i:
+		return 1
+	}
+	return 0
+}
+
+// holds applies the operator to a comparison result
+func (p *predicate) holds(c int) bool {
+	switch p.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// boundCompare compares a stored bound against the constant
+func (p *predicate) boundCompare(v *metadata.StatsValue) (int, bool) {
+	switch {
+	case p.isString:
+		if v.String == nil {
+			return 0, false
+		}
+		return strings.Compare(*v.String, p.s), true
+	case v.Int != nil:
+		return p.compare(*v.Int, 0, false), true
+	case v.Float != nil:
+		return p.compare(0, *v.Float, true), true
+	}
+	return 0, false
+}
+
+// mayMatch reports whether any row of a segment with these stats can satisfy
+// the predicate. Missing or unusable bounds always may match.
+func (p *predicate) mayMatch(seg metadata.SegmentStats) bool {
+	cs, ok := seg.Columns[p.column]
+	if !ok {
+		return true
+	}
+	if cs.Min == nil || cs.Max == nil {
+		// Bounds are only missing when every value is null or NaN
+		return cs.Nulls < seg.Rows
+	}
+	lo, okLo := p.boundCompare(cs.Min)
+	hi, okHi := p.boundCompare(cs.Max)
+	if !okLo || !okHi {
+		return true
+	}
+	switch p.op {
+	case "=":
+		return lo <= 0 && hi >= 0
+	case "!=":
+		// Only a segment holding nothing but the constant is ruled out
+		return lo != 0 || hi != 0
+	case "<":
+		return lo < 0
+	case "<=":
+		return lo <= 0
+	case ">":
+		return hi > 0
+	case ">=":
+		return hi >= 0
+	}
+	return true
+}
+
+// matchRow evaluates the predicate for one row
+func (p *predicate) matchRow(col arrow.Array, row int) bool {
+	if col.IsNull(row) {
+		return false
+	}
+	switch c := col.(type) {
+	case *array.Int8:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Int16:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Int32:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Int64:
+		return p.holds(p.compare(c.Value(row), 0, false))
+	case *array.Uint8:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Uint16:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Uint32:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Timestamp:
+		return p.holds(p.compare(int64(c.Value(row)), 0, false))
+	case *array.Float32:
+		v := float64(c.Value(row))
+		return !math.IsNaN(v) && p.holds(p.compare(0, v, true))
+	case *array.Float64:
+		v := c.Value(row)
+		return !math.IsNaN(v) && p.holds(p.compare(0, v, true))
+	case *array.String:
+		return p.holds(strings.Compare(c.Value(row), p.s))
+	case *array.LargeString:
+		return p.holds(strings.Compare(c.Value(row), p.s))
+	case *array.Dictionary:
+		if dict, ok := c.Dictionary().(*array.String); ok {
+			return p.holds(strings.Compare(dict.Value(c.GetValueIndex(row)), p.s))
+		}
+	}
+	return false
+}
+
+// matchingRows returns the ascending indices of the rows of rec matching
+// every predicate
+func matchingRows(rec arrow.Record, preds []predicate) []int {
+	cols := make([]arrow.Array, len(preds))
+	for i, p := range preds {
+		cols[i] = rec.Column(rec.Schema().FieldIndices(p.column)[0])
+	}
+
+	var keep []int
+	for row := 0; row < int(rec.NumRows()); row++ {
+		match := true
+		for i := range preds {
+			if !preds[i].matchRow(cols[i], row) {
+				match = false
+				break
+			}
+		}
+		if match {
+			keep = append(keep, row)
+		}
+	}
+	return keep
+}
+
+// filterRecord returns the rows of rec matching every predicate, keeping
+// only the fields of schema. rec is not released.
+func filterRecord(rec arrow.Record, preds []predicate, schema *arrow.Schema) (arrow.Record, error) {
+	return takeRecordRows(rec, matchingRows(rec, preds), schema)
+}
+
+// takeRecordRows copies the given ascending rows of rec, keeping only the
+// fields of schema. rec is not released.
+func takeRecordRows(rec arrow.Record, keep []int, schema *arrow.Schema) (arrow.Record, error) {
+	mem := memory.NewGoAllocator()
+	arrays := make([]arrow.Array, 0, schema.NumFields())
+	release := func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
+	}
+	for _, f := range schema.Fields() {
+		arr, err := takeRows(mem, rec.Column(rec.Schema().FieldIndices(f.Name)[0]), keep)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to filter column %s: %w", f.Name, err)
+		}
+		arrays = append(arrays, arr)
+	}
+
+	out := array.NewRecord(schema, arrays, int64(len(keep)))
+	release()
+	return out, nil
+}
+
+// takeRows copies the given ascending row indices of col, slicing
+// contiguous runs so whole ranges are copied at once
+func takeRows(mem memory.Allocator, col arrow.Array, rows []int) (arrow.Array, error) {
+	if len(rows) == 0 {
+		return array.NewSlice(col, 0, 0), nil
+	}
+
+	var parts []arrow.Array
+	defer func() {
+		for _, p := range parts {
+			p.Release()
+		}
+	}()
+	start := rows[0]
+	for i := 1; i <= len(rows); i++ {
+		if i < len(rows) && rows[i] == rows[i-1]+1 {
+			continue
+		}
+		parts = append(parts, array.NewSlice(col, int64(start), int64(rows[i-1]+1)))
+		if i < len(rows) {
+			start = rows[i]
+		}
+	}
+	return array.Concatenate(parts, mem)
+}
@@ -0,0 +1,104 @@
+package lockbox
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// WithHead makes NewReader stop after the first n rows, decrypting no
+// segment past them
+func WithHead(n int64) Option {
+	return func(o *Options) {
+		if n <= 0 && o.err == nil {
+			o.err = fmt.Errorf("head must be positive, got %d", n)
+		}
+		o.Head = n
+	}
+}
+
+// WithTail makes NewReader return only the last n rows. Without filters
+// the segment row counts in the metadata locate them, so earlier segments
+// are never decrypted. With filters the matching rows can only be counted
+// by reading to the end; the reader then keeps just enough records to hold
+// the last n.
+func WithTail(n int64) Option {
+	return func(o *Options) {
+		if n <= 0 && o.err == nil {
+			o.err = fmt.Errorf("tail must be positive, got %d", n)
+		}
+		o.Tail = n
+	}
+}
+
+// tailStart returns the first segment holding any of the last n rows and
+// how many of its leading rows to skip
+func tailStart(segmentRows []int64, n int64) (int, int64) {
+	var total int64
+	for i := len(segmentRows) - 1; i >= 0; i-- {
+		total += segmentRows[i]
+		if total >= n {
+			return i, total - n
+		}
+	}
+	return 0, 0
+}
+
+// nextTail serves the last rr.tail rows matching the filters, reading every
+// segment on the first call and keeping only the records that cover them
+func (rr *RecordReader) nextTail() bool {
+	if !rr.tailRead {
+		rr.tailRead = true
+		var total int64
+		for {
+			rec, ok := rr.nextSegment()
+			if !ok {
+				break
+			}
+			rr.buffered = append(rr.buffered, rec)
+			total += rec.NumRows()
+			for total-rr.buffered[0].NumRows() >= rr.tail {
+				total -= rr.buffered[0].NumRows()
+				rr.buffered[0].Release()
+				rr.buffered = rr.buffered[1:]
+			}
+		}
+		if rr.err != nil {
+			rr.releaseBuffered()
+			return false
+		}
+		if excess := total - rr.tail; excess > 0 {
+			first := rr.buffered[0]
+			rr.buffered[0] = first.NewSlice(excess, first.NumRows())
+			first.Release()
+		}
+	}
+	if len(rr.buffered) == 0 {
+		return false
+	}
+	rr.cur = rr.buffered[0]
+	rr.buffered = rr.buffered[1:]
+	return true
+}
+
+// releaseBuffered drops the records nextTail holds
+func (rr *RecordReader) releaseBuffered() {
+	for _, rec := range rr.buffered {
+		rec.Release()
+	}
+	rr.buffered = nil
+}
+
+// limitHead trims rec to the rows WithHead still allows
+func (rr *RecordReader) limitHead(rec arrow.Record) arrow.Record {
+	if rr.head < 0 {
+		return rec
+	}
+	if rec.NumRows() > rr.head {
+		sliced := rec.NewSlice(0, rr.head)
+		rec.Release()
+		rec = sliced
+	}
+	rr.head -= rec.NumRows()
+	return rec
+}
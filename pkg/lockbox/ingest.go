@@ -0,0 +1,1262 @@
+package lockbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/decimal256"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+)
+
+// CSVReadOptions controls how LoadCSV parses CSV input. The zero value reads
+// comma separated rows under a header row.
+type CSVReadOptions struct {
+	// Delimiter separates fields; zero means comma
+	Delimiter rune
+	// NoHeader indicates the first row is data
+	NoHeader bool
+	// ColumnNames names the CSV columns, replacing the header row (which is
+	// still skipped unless NoHeader is set) when matching them to fields
+	ColumnNames []string
+	// StrictColumns maps columns to schema fields by position even when
+	// there is a header, instead of by header name
+	StrictColumns bool
+	// StrictHeader fails on a header that does not match the schema
+	// field names, which otherwise only logs a warning
+	StrictHeader bool
+	// SkipRows data rows are dropped after any header, then at most
+	// LimitRows rows are loaded, zero meaning all of them
+	SkipRows  int
+	LimitRows int
+	// MaxErrors is how many invalid rows are skipped before loading fails
+	MaxErrors int
+	// ErrorLog, if set, receives one CSV line per invalid row
+	ErrorLog io.Writer
+	// TimestampLayouts are the Go layouts tried in order for timestamp
+	// values, RFC3339 when empty
+	TimestampLayouts []string
+	// Location is the time zone of timestamps without an offset in columns
+	// without a time zone, UTC when nil
+	Location *time.Location
+	// NullStrings are field values read as null, in addition to the empty
+	// string in nullable columns
+	NullStrings []string
+	// TrimNulls ignores surrounding whitespace when matching NullStrings
+	TrimNulls bool
+	// Binary is the text encoding of binary fields
+	Binary BinaryEncoding
+	// Allocator builds the record, memory.DefaultAllocator when nil
+	Allocator memory.Allocator
+	// OnRows, if set, is called with the number of rows loaded as they are
+	OnRows func(n int64)
+	// BatchRows is how many rows each record of NewCSVReader holds,
+	// 65536 when zero. LoadCSV ignores it.
+	BatchRows int
+}
+
+// isNullString reports whether val matches one of NullStrings
+func (o CSVReadOptions) isNullString(val string) bool {
+	if o.TrimNulls {
+		val = strings.TrimSpace(val)
+	}
+	for _, s := range o.NullStrings {
+		if val == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONReadOptions controls how LoadJSON parses JSON input
+type JSONReadOptions struct {
+	// SkipRows objects are dropped, then at most LimitRows objects are
+	// loaded, zero meaning all of them
+	SkipRows  int
+	LimitRows int
+	// TimestampLayouts are the Go layouts tried in order for timestamp
+	// strings, RFC3339 when empty
+	TimestampLayouts []string
+	// Location is the time zone of timestamps without an offset in fields
+	// without a time zone, UTC when nil
+	Location *time.Location
+	// Binary is the text encoding of binary fields
+	Binary BinaryEncoding
+	// Allocator builds the record, memory.DefaultAllocator when nil
+	Allocator memory.Allocator
+	// OnRows, if set, is called with the number of rows loaded as they are
+	OnRows func(n int64)
+}
+
+// timestamps returns the parser for the timestamp options
+func (o CSVReadOptions) timestamps() timestampParser {
+	return timestampParser{Layouts: o.TimestampLayouts, Location: o.Location}
+}
+
+// cancelCheckRows is how many rows the text loaders parse between checks
+// for cancellation
+const cancelCheckRows = 1024
+
+// allocatorOrDefault returns mem, or the default allocator for nil
+func allocatorOrDefault(mem memory.Allocator) memory.Allocator {
+	if mem == nil {
+		return memory.DefaultAllocator
+	}
+	return mem
+}
+
+// LoadCSV parses CSV rows from r into a record matching schema. Columns are
+// matched to fields by header name, or by ColumnNames: extra columns are
+// ignored and missing nullable fields are null. Without a header or
+// ColumnNames, or with StrictColumns, they are matched by position.
+// Loading stops with ctx's error once ctx is cancelled.
+func LoadCSV(ctx context.Context, r io.Reader, schema *arrow.Schema, opts CSVReadOptions) (arrow.Record, error) {
+	l, err := newCSVLoader(r, schema, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer l.close()
+	return l.readBatch(ctx, 0)
+}
+
+// NewCSVReader parses CSV rows from r like LoadCSV, but returns them as
+// records of at most BatchRows rows, read as the caller asks for them, so
+// input larger than memory can be processed. The reader must be released.
+func NewCSVReader(ctx context.Context, r io.Reader, schema *arrow.Schema, opts CSVReadOptions) (array.RecordReader, error) {
+	if opts.BatchRows < 0 {
+		return nil, fmt.Errorf("batch rows must not be negative, got %d", opts.BatchRows)
+	}
+	l, err := newCSVLoader(r, schema, opts)
+	if err != nil {
+		return nil, err
+	}
+	size := opts.BatchRows
+	if size == 0 {
+		size = defaultCSVBatchRows
+	}
+	return &csvRecordReader{refCount: 1, ctx: ctx, loader: l, size: size}, nil
+}
+
+// defaultCSVBatchRows is the batch size of NewCSVReader when BatchRows is
+// zero
+const defaultCSVBatchRows = 65536
+
+// csvLoader parses CSV rows into batches for LoadCSV and NewCSVReader
+type csvLoader struct {
+	schema     *arrow.Schema
+	opts       CSVReadOptions
+	timestamps timestampParser
+	rdr        *csv.Reader
+	builders   []array.Builder
+	// sources maps each field to its CSV column, or -1 when it has none
+	sources []int
+	width   int
+	values  []interface{}
+	errLog  *csv.Writer
+	invalid int
+	// read counts the rows read toward LimitRows, including rejected ones
+	read int
+	done bool
+}
+
+// newCSVLoader sets up the builders, reads the header and skips SkipRows
+// rows
+func newCSVLoader(r io.Reader, schema *arrow.Schema, opts CSVReadOptions) (*csvLoader, error) {
+	numFields := len(schema.Fields())
+	mem := allocatorOrDefault(opts.Allocator)
+	l := &csvLoader{
+		schema:     schema,
+		opts:       opts,
+		timestamps: opts.timestamps(),
+		builders:   make([]array.Builder, numFields),
+		values:     make([]interface{}, numFields),
+	}
+
+	// Create array builders for each column
+	for i, field := range schema.Fields() {
+		switch typ := field.Type.(type) {
+		case *arrow.Int64Type:
+			l.builders[i] = array.NewInt64Builder(mem)
+		case *arrow.Int32Type:
+			l.builders[i] = array.NewInt32Builder(mem)
+		case *arrow.Int8Type, *arrow.Int16Type, *arrow.Uint8Type, *arrow.Uint16Type,
+			*arrow.Uint32Type, *arrow.Uint64Type:
+			l.builders[i] = array.NewBuilder(mem, typ)
+		case *arrow.Float64Type:
+			l.builders[i] = array.NewFloat64Builder(mem)
+		case *arrow.Float32Type:
+			l.builders[i] = array.NewFloat32Builder(mem)
+		case *arrow.StringType:
+			l.builders[i] = array.NewStringBuilder(mem)
+		case *arrow.TimestampType:
+			l.builders[i] = array.NewTimestampBuilder(mem, typ)
+		case *arrow.Decimal128Type:
+			l.builders[i] = array.NewDecimal128Builder(mem, typ)
+		case *arrow.Decimal256Type:
+			l.builders[i] = array.NewDecimal256Builder(mem, typ)
+		case *arrow.BinaryType:
+			l.builders[i] = array.NewBinaryBuilder(mem, typ)
+		case *arrow.FixedSizeBinaryType:
+			l.builders[i] = array.NewFixedSizeBinaryBuilder(mem, typ)
+		case *arrow.DictionaryType:
+			if typ.ValueType.ID() != arrow.STRING {
+				l.close()
+				return nil, fmt.Errorf("unsupported dictionary value type: %v", typ.ValueType)
+			}
+			l.builders[i] = array.NewDictionaryBuilder(mem, typ)
+		default:
+			l.close()
+			return nil, fmt.Errorf("unsupported type: %v", field.Type)
+		}
+	}
+	if err := l.start(r); err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// start reads the header, maps columns to fields and skips SkipRows rows
+func (l *csvLoader) start(r io.Reader) error {
+	opts, schema := l.opts, l.schema
+	numFields := len(schema.Fields())
+
+	l.rdr = csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		l.rdr.Comma = opts.Delimiter
+	}
+
+	l.sources = make([]int, numFields)
+	for i := range l.sources {
+		l.sources[i] = i
+	}
+	l.width = numFields
+	header := opts.ColumnNames
+	if !opts.NoHeader {
+		row, err := l.rdr.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		if header == nil {
+			header = row
+		}
+	}
+	if header != nil {
+		if unexpected, missing := csvHeaderMismatch(header, schema, opts.StrictColumns); len(unexpected)+len(missing) > 0 {
+			if opts.StrictHeader {
+				return fmt.Errorf("CSV header does not match the schema: unexpected columns [%s], missing fields [%s]",
+					strings.Join(unexpected, ", "), strings.Join(missing, ", "))
+			}
+			log.Warn().Strs("unexpected", unexpected).Strs("missing", missing).Msg("CSV header does not match the schema")
+		}
+		if !opts.StrictColumns {
+			var err error
+			if l.sources, err = csvColumnSources(header, schema); err != nil {
+				return err
+			}
+			l.width = len(header)
+		}
+	}
+
+	if opts.ErrorLog != nil {
+		l.errLog = csv.NewWriter(opts.ErrorLog)
+		l.errLog.Write([]string{"line", "column", "value", "expected", "error"})
+	}
+
+	// Width is checked here rather than by the csv package so bad rows can
+	// be rejected like bad values
+	l.rdr.FieldsPerRecord = -1
+
+	for i := 0; i < opts.SkipRows; i++ {
+		if _, err := l.rdr.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("failed to read CSV: %w", err)
+		}
+	}
+	return nil
+}
+
+// reject records a bad row and fails once more than MaxErrors rows were
+// rejected
+func (l *csvLoader) reject(err error, line int, column, value, expected string) error {
+	l.invalid++
+	if l.errLog != nil {
+		l.errLog.Write([]string{strconv.Itoa(line), column, value, expected, err.Error()})
+	}
+	if l.invalid <= l.opts.MaxErrors {
+		return nil
+	}
+	if l.opts.MaxErrors == 0 {
+		return err
+	}
+	return fmt.Errorf("more than %d invalid rows: %w", l.opts.MaxErrors, err)
+}
+
+// readBatch parses up to limit rows, or all remaining rows when limit is
+// zero, into a record. The record is empty once the input is exhausted.
+func (l *csvLoader) readBatch(ctx context.Context, limit int) (arrow.Record, error) {
+	opts, schema, rdr := l.opts, l.schema, l.rdr
+	if l.errLog != nil {
+		defer l.errLog.Flush()
+	}
+
+	// Errors name the source line from FieldPos rather than a record
+	// count, since a quoted field may span several lines
+	rows := 0
+	for !l.done && (limit == 0 || rows < limit) {
+		if opts.LimitRows > 0 && l.read >= opts.LimitRows {
+			l.done = true
+			break
+		}
+		if l.read%cancelCheckRows == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		l.read++
+		row, err := rdr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) { // EOF check
+				l.done = true
+				break
+			}
+			// csv.ParseError already carries the line and column
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		if len(row) != l.width {
+			line, _ := rdr.FieldPos(0)
+			err := fmt.Errorf("line %d: expected %d fields, got %d", line, l.width, len(row))
+			if err := l.reject(err, line, "", "", fmt.Sprintf("%d fields", l.width)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Parse the whole row before appending so a rejected row leaves
+		// no partial values behind
+		valid := true
+		for i, src := range l.sources {
+			field := schema.Field(i)
+			if src < 0 {
+				l.values[i] = nil
+				continue
+			}
+			val := row[src]
+			var v interface{}
+			var err error
+			if opts.isNullString(val) {
+				if !field.Nullable {
+					err = fmt.Errorf("null value %q for non-nullable field", val)
+				}
+			} else {
+				v, err = parseCSVValue(field, val, l.timestamps, opts.Binary)
+			}
+			if err != nil {
+				line, col := rdr.FieldPos(src)
+				err = fmt.Errorf("line %d, column %d (%s): %w", line, col, field.Name, err)
+				if err := l.reject(err, line, field.Name, val, field.Type.String()); err != nil {
+					return nil, err
+				}
+				valid = false
+				break
+			}
+			l.values[i] = v
+		}
+		if !valid {
+			continue
+		}
+		for i, v := range l.values {
+			if err := appendParsedValue(l.builders[i], v); err != nil {
+				line, col := rdr.FieldPos(max(l.sources[i], 0))
+				return nil, fmt.Errorf("line %d, column %d (%s): %w", line, col, schema.Field(i).Name, err)
+			}
+		}
+		rows++
+		if opts.OnRows != nil {
+			opts.OnRows(1)
+		}
+	}
+
+	// Build Arrow arrays and record
+	arrays := make([]arrow.Array, len(l.builders))
+	for i, b := range l.builders {
+		arrays[i] = b.NewArray()
+	}
+	record := array.NewRecord(schema, arrays, int64(rows))
+
+	// Clean up arrays
+	for _, arr := range arrays {
+		arr.Release()
+	}
+
+	return record, nil
+}
+
+// close releases the builders and reports the rows that were skipped
+func (l *csvLoader) close() {
+	for _, b := range l.builders {
+		if b != nil {
+			b.Release()
+		}
+	}
+	l.builders = nil
+	if l.invalid > 0 {
+		log.Warn().Int("rows", l.invalid).Int("max_errors", l.opts.MaxErrors).Msg("Skipped invalid CSV rows")
+	}
+}
+
+// csvRecordReader serves the batches of a csvLoader as an
+// array.RecordReader
+type csvRecordReader struct {
+	refCount int64
+	ctx      context.Context
+	loader   *csvLoader
+	size     int
+	cur      arrow.Record
+	err      error
+}
+
+// Schema returns the schema of the records
+func (cr *csvRecordReader) Schema() *arrow.Schema {
+	return cr.loader.schema
+}
+
+// Next parses the next batch, returning false at the end of the input or
+// on error
+func (cr *csvRecordReader) Next() bool {
+	if cr.cur != nil {
+		cr.cur.Release()
+		cr.cur = nil
+	}
+	if cr.err != nil || cr.loader.done {
+		return false
+	}
+	rec, err := cr.loader.readBatch(cr.ctx, cr.size)
+	if err != nil {
+		cr.err = err
+		return false
+	}
+	if rec.NumRows() == 0 {
+		rec.Release()
+		return false
+	}
+	cr.cur = rec
+	return true
+}
+
+// Record returns the current record, valid until the next call to Next
+func (cr *csvRecordReader) Record() arrow.Record {
+	return cr.cur
+}
+
+// Err returns the first error encountered while parsing
+func (cr *csvRecordReader) Err() error {
+	return cr.err
+}
+
+// Retain increases the reference count of the reader
+func (cr *csvRecordReader) Retain() {
+	atomic.AddInt64(&cr.refCount, 1)
+}
+
+// Release decreases the reference count of the reader, releasing its
+// builders once it reaches zero
+func (cr *csvRecordReader) Release() {
+	if atomic.AddInt64(&cr.refCount, -1) != 0 {
+		return
+	}
+	if cr.cur != nil {
+		cr.cur.Release()
+		cr.cur = nil
+	}
+	cr.loader.close()
+}
+
+// csvHeaderMismatch compares a CSV header with the schema field names.
+// unexpected lists header columns with no field and missing lists fields
+// with no column. When positional, a column only matches the field at
+// its own position, so a header shifted by one reports both.
+func csvHeaderMismatch(header []string, schema *arrow.Schema, positional bool) (unexpected, missing []string) {
+	fields := schema.Fields()
+	if positional {
+		for i := 0; i < max(len(header), len(fields)); i++ {
+			switch {
+			case i >= len(fields):
+				unexpected = append(unexpected, header[i])
+			case i >= len(header):
+				missing = append(missing, fields[i].Name)
+			case header[i] != fields[i].Name:
+				unexpected = append(unexpected, header[i])
+				missing = append(missing, fields[i].Name)
+			}
+		}
+		return unexpected, missing
+	}
+
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		names[f.Name] = true
+	}
+	columns := make(map[string]bool, len(header))
+	for _, name := range header {
+		columns[name] = true
+		if !names[name] {
+			unexpected = append(unexpected, name)
+		}
+	}
+	for _, f := range fields {
+		if !columns[f.Name] {
+			missing = append(missing, f.Name)
+		}
+	}
+	return unexpected, missing
+}
+
+// csvColumnSources maps each schema field to the index of the header column
+// of the same name, in any order, or -1 for a nullable field with no column.
+// Every non-nullable field needs a column.
+func csvColumnSources(header []string, schema *arrow.Schema) ([]int, error) {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, dup := columns[name]; dup {
+			// Ambiguous only if a field needs the column
+			columns[name] = -2
+			continue
+		}
+		columns[name] = i
+	}
+
+	sources := make([]int, len(schema.Fields()))
+	var missing []string
+	for i, field := range schema.Fields() {
+		src, ok := columns[field.Name]
+		switch {
+		case src == -2:
+			return nil, fmt.Errorf("duplicate CSV column %q", field.Name)
+		case ok:
+			sources[i] = src
+		case field.Nullable:
+			sources[i] = -1
+		default:
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("CSV header has no column for non-nullable fields: %s", strings.Join(missing, ", "))
+	}
+	return sources, nil
+}
+
+// parseCSVValue converts one CSV field to the Go value for its type, or nil
+// for null. Empty fields are null when the field is nullable.
+func parseCSVValue(field arrow.Field, val string, timestamps timestampParser, binary BinaryEncoding) (interface{}, error) {
+	if val == "" && field.Nullable {
+		return nil, nil
+	}
+
+	switch typ := field.Type.(type) {
+	case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type,
+		*arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type, *arrow.Uint64Type:
+		return parseInteger(typ, val)
+	case *arrow.Float64Type:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float64: %s", val)
+		}
+		return v, nil
+	case *arrow.Float32Type:
+		return parseFloat32(val)
+	case *arrow.StringType, *arrow.DictionaryType:
+		return val, nil
+	case *arrow.TimestampType:
+		return timestamps.parse(val, typ)
+	case *arrow.Decimal128Type:
+		return parseDecimal128(val, typ)
+	case *arrow.Decimal256Type:
+		return parseDecimal256(val, typ)
+	case *arrow.BinaryType:
+		return binary.decode(val, BinaryBase64)
+	case *arrow.FixedSizeBinaryType:
+		return binary.decodeFixed(val, typ)
+	}
+	return nil, fmt.Errorf("unsupported type: %v", field.Type)
+}
+
+// parseInteger parses a base 10 integer for an integer type, returning the
+// Go value of that width. Values outside the type's range are reported as
+// overflowing it, e.g. "value 300 overflows uint8".
+func parseInteger(dt arrow.DataType, val string) (interface{}, error) {
+	var bits int
+	signed := true
+	switch dt.ID() {
+	case arrow.INT8:
+		bits = 8
+	case arrow.INT16:
+		bits = 16
+	case arrow.INT32:
+		bits = 32
+	case arrow.INT64:
+		bits = 64
+	case arrow.UINT8:
+		bits, signed = 8, false
+	case arrow.UINT16:
+		bits, signed = 16, false
+	case arrow.UINT32:
+		bits, signed = 32, false
+	case arrow.UINT64:
+		bits, signed = 64, false
+	default:
+		return nil, fmt.Errorf("unsupported integer type: %v", dt)
+	}
+
+	if signed {
+		v, err := strconv.ParseInt(val, 10, bits)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("value %s overflows %s", val, dt)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", dt, val)
+		}
+		switch bits {
+		case 8:
+			return int8(v), nil
+		case 16:
+			return int16(v), nil
+		case 32:
+			return int32(v), nil
+		}
+		return v, nil
+	}
+
+	v, err := strconv.ParseUint(val, 10, bits)
+	if errors.Is(err, strconv.ErrRange) || (err != nil && strings.HasPrefix(val, "-")) {
+		return nil, fmt.Errorf("value %s overflows %s", val, dt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", dt, val)
+	}
+	switch bits {
+	case 8:
+		return uint8(v), nil
+	case 16:
+		return uint16(v), nil
+	case 32:
+		return uint32(v), nil
+	}
+	return v, nil
+}
+
+// parseFloat32 parses val directly at 32-bit precision, so the result is
+// the float32 nearest the text rather than a rounded float64. Values beyond
+// the float32 range are rejected instead of becoming infinity.
+func parseFloat32(val string) (float32, error) {
+	v, err := strconv.ParseFloat(val, 32)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("value %s overflows float32", val)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid float32: %s", val)
+	}
+	return float32(v), nil
+}
+
+// appendParsedValue appends a value from parseCSVValue or parseInteger to b
+func appendParsedValue(b array.Builder, v interface{}) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		b.Append(v.(int64))
+	case *array.Int32Builder:
+		b.Append(v.(int32))
+	case *array.Int16Builder:
+		b.Append(v.(int16))
+	case *array.Int8Builder:
+		b.Append(v.(int8))
+	case *array.Uint64Builder:
+		b.Append(v.(uint64))
+	case *array.Uint32Builder:
+		b.Append(v.(uint32))
+	case *array.Uint16Builder:
+		b.Append(v.(uint16))
+	case *array.Uint8Builder:
+		b.Append(v.(uint8))
+	case *array.Float64Builder:
+		b.Append(v.(float64))
+	case *array.Float32Builder:
+		b.Append(v.(float32))
+	case *array.StringBuilder:
+		b.Append(v.(string))
+	case *array.TimestampBuilder:
+		b.Append(v.(arrow.Timestamp))
+	case *array.Decimal128Builder:
+		b.Append(v.(decimal128.Num))
+	case *array.Decimal256Builder:
+		b.Append(v.(decimal256.Num))
+	case *array.BinaryBuilder:
+		b.Append(v.([]byte))
+	case *array.FixedSizeBinaryBuilder:
+		b.Append(v.([]byte))
+	case *array.BinaryDictionaryBuilder:
+		return b.AppendString(v.(string))
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
+
+// LoadJSON parses a JSON array of objects or newline-delimited objects from
+// r into a record matching schema. The form is chosen from the first
+// non-whitespace byte, so r never needs to seek and may be a pipe or stdin.
+// Only the objects selected by SkipRows and LimitRows are loaded.
+func LoadJSON(ctx context.Context, r io.Reader, schema *arrow.Schema, opts JSONReadOptions) (arrow.Record, error) {
+	numFields := len(schema.Fields())
+	mem := allocatorOrDefault(opts.Allocator)
+
+	// Create builders for each column
+	builders := make([]array.Builder, numFields)
+	defer func() {
+		for _, b := range builders {
+			if b != nil {
+				b.Release()
+			}
+		}
+	}()
+	for i, field := range schema.Fields() {
+		if err := checkJSONType(field.Type); err != nil {
+			return nil, err
+		}
+		builders[i] = array.NewBuilder(mem, field.Type)
+	}
+
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read JSON input: %w", err)
+	}
+
+	empty := err == io.EOF
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	isArray := false
+	switch {
+	case empty:
+		// Empty input yields an empty record
+	case first == '[':
+		// Array of objects
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("JSON decode error: %w", err)
+		}
+		isArray = true
+	case first == '{':
+		// NDJSON (one object per line)
+	default:
+		return nil, fmt.Errorf("unsupported JSON input: expected an array or newline-delimited objects, found %q", first)
+	}
+
+	// Objects are decoded one at a time and appended straight to the
+	// builders, so only the current row is held as Go values and
+	// --limit-rows stops reading early. The row map is reused.
+	rec := map[string]interface{}{}
+	var numRows int64
+	for rowNum := 1; !empty; rowNum++ {
+		if opts.LimitRows > 0 && rowNum > opts.SkipRows+opts.LimitRows {
+			break
+		}
+		if isArray && !dec.More() {
+			if err := closeJSONArray(dec); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if rowNum%cancelCheckRows == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		clear(rec)
+		var skipped json.RawMessage
+		var target interface{} = &rec
+		if rowNum <= opts.SkipRows {
+			target = &skipped
+		}
+		if err := dec.Decode(target); err != nil {
+			if err == io.EOF && !isArray {
+				break
+			}
+			return nil, fmt.Errorf("JSON decode error: %w", err)
+		}
+		if rowNum <= opts.SkipRows {
+			continue
+		}
+
+		numRows++
+		if opts.OnRows != nil {
+			opts.OnRows(1)
+		}
+		for i, field := range schema.Fields() {
+			val, ok := rec[field.Name]
+			if (!ok || val == nil) && !field.Nullable {
+				return nil, fmt.Errorf("row %d: missing non-nullable field '%s'", rowNum, field.Name)
+			}
+			if err := appendJSONValue(builders[i], field, val, opts); err != nil {
+				return nil, fmt.Errorf("row %d, col %s: %w", rowNum, field.Name, err)
+			}
+		}
+	}
+
+	// Build Arrow arrays and record
+	arrays := make([]arrow.Array, numFields)
+	for i, b := range builders {
+		arrays[i] = b.NewArray()
+	}
+	record := array.NewRecord(schema, arrays, numRows)
+	for _, arr := range arrays {
+		arr.Release()
+	}
+
+	return record, nil
+}
+
+// closeJSONArray reads the closing bracket of a JSON array input and
+// rejects anything after it
+func closeJSONArray(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("JSON decode error: %w", err)
+	}
+	if tok, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return fmt.Errorf("unexpected data after the JSON array: %w", err)
+		}
+		return fmt.Errorf("unexpected data after the JSON array: %v", tok)
+	}
+	return nil
+}
+
+// checkJSONType rejects types the JSON loader cannot build, looking inside
+// lists, maps and structs
+func checkJSONType(dt arrow.DataType) error {
+	switch typ := dt.(type) {
+	case *arrow.Int64Type, *arrow.Int32Type, *arrow.Int16Type, *arrow.Int8Type,
+		*arrow.Uint64Type, *arrow.Uint32Type, *arrow.Uint16Type, *arrow.Uint8Type,
+		*arrow.Float64Type, *arrow.Float32Type, *arrow.StringType,
+		*arrow.TimestampType, *arrow.Decimal128Type, *arrow.Decimal256Type,
+		*arrow.BinaryType, *arrow.FixedSizeBinaryType:
+		return nil
+	case *arrow.DictionaryType:
+		if typ.ValueType.ID() != arrow.STRING {
+			return fmt.Errorf("unsupported dictionary value type: %v", typ.ValueType)
+		}
+		return nil
+	case *arrow.ListType:
+		return checkJSONType(typ.Elem())
+	case *arrow.MapType:
+		if err := checkJSONType(typ.KeyType()); err != nil {
+			return err
+		}
+		return checkJSONType(typ.ItemType())
+	case *arrow.StructType:
+		for _, f := range typ.Fields() {
+			if err := checkJSONType(f.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type: %v", dt)
+	}
+}
+
+// timestamps returns the parser for the timestamp options
+func (o JSONReadOptions) timestamps() timestampParser {
+	return timestampParser{Layouts: o.TimestampLayouts, Location: o.Location}
+}
+
+// appendJSONValue appends one decoded JSON value to b. Arrays fill lists and
+// objects fill structs and maps, recursing into their elements and fields;
+// nulls and missing keys are allowed only where the field is nullable. Map
+// entries are appended in key order, with keys parsed as the key type.
+// Numbers arrive as json.Number.
+func appendJSONValue(b array.Builder, field arrow.Field, val interface{}, opts JSONReadOptions) error {
+	if val == nil {
+		if !field.Nullable {
+			return fmt.Errorf("null value for non-nullable field '%s'", field.Name)
+		}
+		b.AppendNull()
+		return nil
+	}
+
+	switch typ := field.Type.(type) {
+	case *arrow.Int64Type:
+		switch v := val.(type) {
+		case json.Number: // the decoder keeps numbers as text, so no float64 rounding
+			num, err := v.Int64()
+			if err != nil {
+				return fmt.Errorf("invalid int64: %v", v)
+			}
+			b.(*array.Int64Builder).Append(num)
+		case string:
+			if v == "" && field.Nullable {
+				b.AppendNull()
+				return nil
+			}
+			num, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid int64: %v", v)
+			}
+			b.(*array.Int64Builder).Append(num)
+		default:
+			return fmt.Errorf("expected int64, got %T", val)
+		}
+	case *arrow.Int32Type, *arrow.Int16Type, *arrow.Int8Type, *arrow.Uint64Type,
+		*arrow.Uint32Type, *arrow.Uint16Type, *arrow.Uint8Type:
+		var str string
+		switch v := val.(type) {
+		case json.Number:
+			str = v.String()
+		case string:
+			if v == "" && field.Nullable {
+				b.AppendNull()
+				return nil
+			}
+			str = v
+		default:
+			return fmt.Errorf("expected %s, got %T", typ, val)
+		}
+		v, err := parseInteger(typ, str)
+		if err != nil {
+			return err
+		}
+		return appendParsedValue(b, v)
+	case *arrow.Float64Type:
+		switch v := val.(type) {
+		case json.Number:
+			num, err := v.Float64()
+			if err != nil {
+				return fmt.Errorf("invalid float64: %v", v)
+			}
+			b.(*array.Float64Builder).Append(num)
+		case string:
+			if v == "" && field.Nullable {
+				b.AppendNull()
+				return nil
+			}
+			num, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid float64: %v", v)
+			}
+			b.(*array.Float64Builder).Append(num)
+		default:
+			return fmt.Errorf("expected float64, got %T", val)
+		}
+	case *arrow.Float32Type:
+		var str string
+		switch v := val.(type) {
+		case json.Number:
+			str = v.String()
+		case string:
+			if v == "" && field.Nullable {
+				b.AppendNull()
+				return nil
+			}
+			str = v
+		default:
+			return fmt.Errorf("expected float32, got %T", val)
+		}
+		v, err := parseFloat32(str)
+		if err != nil {
+			return err
+		}
+		b.(*array.Float32Builder).Append(v)
+	case *arrow.StringType:
+		switch v := val.(type) {
+		case string:
+			if v == "" && field.Nullable {
+				b.AppendNull()
+			} else {
+				b.(*array.StringBuilder).Append(v)
+			}
+		default:
+			b.(*array.StringBuilder).Append(fmt.Sprintf("%v", val))
+		}
+	case *arrow.DictionaryType:
+		v, ok := val.(string)
+		if !ok {
+			v = fmt.Sprintf("%v", val)
+		}
+		if v == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		return b.(*array.BinaryDictionaryBuilder).AppendString(v)
+	case *arrow.TimestampType:
+		v, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("invalid timestamp type: %T", val)
+		}
+		if v == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		ts, err := opts.timestamps().parse(v, typ)
+		if err != nil {
+			return err
+		}
+		b.(*array.TimestampBuilder).Append(ts)
+	case *arrow.Decimal128Type:
+		str, ok := decimalString(val)
+		if !ok {
+			return fmt.Errorf("expected decimal, got %T", val)
+		}
+		if str == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		num, err := parseDecimal128(str, typ)
+		if err != nil {
+			return err
+		}
+		b.(*array.Decimal128Builder).Append(num)
+	case *arrow.Decimal256Type:
+		str, ok := decimalString(val)
+		if !ok {
+			return fmt.Errorf("expected decimal, got %T", val)
+		}
+		if str == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		num, err := parseDecimal256(str, typ)
+		if err != nil {
+			return err
+		}
+		b.(*array.Decimal256Builder).Append(num)
+	case *arrow.BinaryType:
+		v, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("expected %s string, got %T", opts.Binary.orDefault(BinaryBase64), val)
+		}
+		if v == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		data, err := opts.Binary.decode(v, BinaryBase64)
+		if err != nil {
+			return err
+		}
+		b.(*array.BinaryBuilder).Append(data)
+	case *arrow.FixedSizeBinaryType:
+		v, ok := val.(string)
+		if !ok {
+			return fmt.Errorf("expected %s string, got %T", opts.Binary.orDefault(BinaryHex), val)
+		}
+		if v == "" && field.Nullable {
+			b.AppendNull()
+			return nil
+		}
+		data, err := opts.Binary.decodeFixed(v, typ)
+		if err != nil {
+			return err
+		}
+		b.(*array.FixedSizeBinaryBuilder).Append(data)
+	case *arrow.ListType:
+		items, ok := val.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %T", val)
+		}
+		lb := b.(*array.ListBuilder)
+		lb.Append(true)
+		elem := typ.ElemField()
+		for j, item := range items {
+			if err := appendJSONValue(lb.ValueBuilder(), elem, item, opts); err != nil {
+				return fmt.Errorf("element %d: %w", j, err)
+			}
+		}
+	case *arrow.MapType:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object for map, got %T", val)
+		}
+		mb := b.(*array.MapBuilder)
+		mb.Append(true)
+		keyField, itemField := typ.KeyField(), typ.ItemField()
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			if err := appendJSONValue(mb.KeyBuilder(), keyField, key, opts); err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			if err := appendJSONValue(mb.ItemBuilder(), itemField, obj[key], opts); err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+		}
+	case *arrow.StructType:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %T", val)
+		}
+		sb := b.(*array.StructBuilder)
+		sb.Append(true)
+		for j, f := range typ.Fields() {
+			if err := appendJSONValue(sb.FieldBuilder(j), f, obj[f.Name], opts); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type: %v", field.Type)
+	}
+	return nil
+}
+
+// decimalString returns the textual form of a decoded JSON value for a
+// decimal column. Numbers keep their source text, so 0.1 stays "0.1" rather
+// than its binary expansion.
+func decimalString(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
+
+// scaleDecimal parses a base-10 string and returns its unscaled integer value
+// for the given scale. Inputs with more fractional digits than the scale allows
+// are rejected instead of being rounded.
+func scaleDecimal(val string, scale int32) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(val)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal: %s", val)
+	}
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs32(scale))), nil)
+	if scale >= 0 {
+		r.Mul(r, new(big.Rat).SetInt(pow))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	if !r.IsInt() {
+		return nil, fmt.Errorf("decimal %s exceeds scale %d", val, scale)
+	}
+	return r.Num(), nil
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// parseDecimal128 parses val according to the precision and scale of typ
+func parseDecimal128(val string, typ *arrow.Decimal128Type) (decimal128.Num, error) {
+	unscaled, err := scaleDecimal(val, typ.Scale)
+	if err != nil {
+		return decimal128.Num{}, err
+	}
+	if unscaled.BitLen() > 127 {
+		return decimal128.Num{}, fmt.Errorf("decimal %s overflows %s", val, typ)
+	}
+	num := decimal128.FromBigInt(unscaled)
+	if !num.FitsInPrecision(typ.Precision) {
+		return decimal128.Num{}, fmt.Errorf("decimal %s exceeds precision %d", val, typ.Precision)
+	}
+	return num, nil
+}
+
+// parseDecimal256 parses val according to the precision and scale of typ
+func parseDecimal256(val string, typ *arrow.Decimal256Type) (decimal256.Num, error) {
+	unscaled, err := scaleDecimal(val, typ.Scale)
+	if err != nil {
+		return decimal256.Num{}, err
+	}
+	if unscaled.BitLen() > 255 {
+		return decimal256.Num{}, fmt.Errorf("decimal %s overflows %s", val, typ)
+	}
+	num := decimal256.FromBigInt(unscaled)
+	if !num.FitsInPrecision(typ.Precision) {
+		return decimal256.Num{}, fmt.Errorf("decimal %s exceeds precision %d", val, typ.Precision)
+	}
+	return num, nil
+}
+
+// peekNonSpace skips leading JSON whitespace and returns the next byte
+// without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// timestampParser parses timestamp text by trying each Go layout in turn.
+// Values without a zone offset are read in the column's time zone, or in
+// Location when the column has none. The zero value accepts RFC3339 in UTC.
+type timestampParser struct {
+	Layouts  []string
+	Location *time.Location
+}
+
+// parse converts val to a timestamp in typ's unit
+func (tp timestampParser) parse(val string, typ *arrow.TimestampType) (arrow.Timestamp, error) {
+	layouts := tp.Layouts
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	loc := tp.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if typ.TimeZone != "" {
+		zone, err := typ.GetZone()
+		if err != nil {
+			return 0, fmt.Errorf("invalid time zone %q: %w", typ.TimeZone, err)
+		}
+		loc = zone
+	}
+
+	for _, layout := range layouts {
+		tm, err := time.ParseInLocation(layout, val, loc)
+		if err != nil {
+			continue
+		}
+		switch typ.Unit {
+		case arrow.Second:
+			return arrow.Timestamp(tm.Unix()), nil
+		case arrow.Millisecond:
+			return arrow.Timestamp(tm.UnixMilli()), nil
+		case arrow.Microsecond:
+			return arrow.Timestamp(tm.UnixMicro()), nil
+		case arrow.Nanosecond:
+			return arrow.Timestamp(tm.UnixNano()), nil
+		}
+		return 0, fmt.Errorf("unknown timestamp unit: %v", typ.Unit)
+	}
+	return 0, fmt.Errorf("invalid timestamp %q: tried layouts %s", val, strings.Join(layouts, ", "))
+}
@@ -0,0 +1,226 @@
+package lockbox
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestLoadCSVOptions(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	// ColumnNames replaces the header, so its columns are matched by name
+	var rows int64
+	opts := CSVReadOptions{
+		ColumnNames: []string{"name", "id"},
+		NullStrings: []string{"NA"},
+		Allocator:   mem,
+		OnRows:      func(n int64) { rows += n },
+	}
+	rec, err := LoadCSV(context.Background(), strings.NewReader("a,b\nAlice,1\nNA,2\n"), schema, opts)
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	ids := rec.Column(0).(*array.Int64)
+	names := rec.Column(1).(*array.String)
+	if rows != 2 || ids.Value(1) != 2 || names.Value(0) != "Alice" || !names.IsNull(1) {
+		t.Fatalf("unexpected record %v after %d rows", rec, rows)
+	}
+	rec.Release()
+
+	// ...and names headerless columns
+	opts = CSVReadOptions{NoHeader: true, ColumnNames: []string{"name", "id"}, Allocator: mem}
+	rec, err = LoadCSV(context.Background(), strings.NewReader("Bob,3\n"), schema, opts)
+	if err != nil {
+		t.Fatalf("load headerless csv: %v", err)
+	}
+	if rec.NumRows() != 1 || rec.Column(0).(*array.Int64).Value(0) != 3 {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	rec.Release()
+
+	opts = CSVReadOptions{ColumnNames: []string{"name"}, Allocator: mem}
+	if _, err := LoadCSV(context.Background(), strings.NewReader("name\nAlice\n"), schema, opts); err == nil || !strings.Contains(err.Error(), "non-nullable fields: id") {
+		t.Fatalf("expected a missing column error, got %v", err)
+	}
+}
+
+func TestLoadJSONOptions(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Second}, Nullable: true},
+		{Name: "raw", Type: arrow.BinaryTypes.Binary, Nullable: true},
+	}, nil)
+
+	var rows int64
+	opts := JSONReadOptions{
+		SkipRows:         1,
+		TimestampLayouts: []string{"2006-01-02 15:04:05"},
+		Binary:           BinaryHex,
+		OnRows:           func(n int64) { rows += n },
+	}
+	input := `{"id": 1}` + "\n" + `{"id": 2, "ts": "2024-03-04 05:06:07", "raw": "cafe"}` + "\n"
+	rec, err := LoadJSON(context.Background(), strings.NewReader(input), schema, opts)
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	defer rec.Release()
+	if rows != 1 || rec.NumRows() != 1 || rec.Column(0).(*array.Int64).Value(0) != 2 {
+		t.Fatalf("unexpected record %v after %d rows", rec, rows)
+	}
+	want := arrow.Timestamp(time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC).Unix())
+	if got := rec.Column(1).(*array.Timestamp).Value(0); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := rec.Column(2).(*array.Binary).Value(0); string(got) != "\xca\xfe" {
+		t.Fatalf("unexpected binary %x", got)
+	}
+}
+
+func TestLoadNoFields(t *testing.T) {
+	empty := arrow.NewSchema(nil, nil)
+	ctx := context.Background()
+
+	rec, err := LoadCSV(ctx, strings.NewReader("a\n1\n2\n"), empty, CSVReadOptions{StrictColumns: true, NoHeader: true})
+	if err == nil {
+		rec.Release()
+		t.Fatalf("expected rows wider than an empty schema to be rejected")
+	}
+	rec, err = LoadCSV(ctx, strings.NewReader("a\n1\n2\n"), empty, CSVReadOptions{})
+	if err != nil {
+		t.Fatalf("load csv: %v", err)
+	}
+	if rec.NumRows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", rec.NumRows())
+	}
+	rec.Release()
+
+	rec, err = LoadJSON(ctx, strings.NewReader(`[{"a": 1}, {"a": 2}]`), empty, JSONReadOptions{})
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	if rec.NumRows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", rec.NumRows())
+	}
+	rec.Release()
+}
+
+func TestLoadJSONTrailingData(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	ctx := context.Background()
+
+	rec, err := LoadJSON(ctx, strings.NewReader("[{\"id\": 1}]\n  \n"), schema, JSONReadOptions{})
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	rec.Release()
+
+	for _, input := range []string{`[{"id": 1}] {"id": 2}`, `[{"id": 1}]]`, `[{"id": 1}] x`, `[{"id": 1}`} {
+		if rec, err := LoadJSON(ctx, strings.NewReader(input), schema, JSONReadOptions{}); err == nil {
+			rec.Release()
+			t.Fatalf("%s: expected trailing or missing data to be rejected", input)
+		}
+	}
+}
+
+func TestTimestampParser(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	tp := timestampParser{Layouts: []string{time.RFC3339, "2006-01-02 15:04:05"}, Location: newYork}
+	naive := &arrow.TimestampType{Unit: arrow.Second}
+
+	// An explicit offset wins over --timezone
+	got, err := tp.parse("2024-01-02T03:04:05Z", naive)
+	if err != nil || got != arrow.Timestamp(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Unix()) {
+		t.Fatalf("RFC3339: got %v, %v", got, err)
+	}
+
+	// A naive value is read in --timezone
+	got, err = tp.parse("2024-01-02 03:04:05", naive)
+	if err != nil || got != arrow.Timestamp(time.Date(2024, 1, 2, 3, 4, 5, 0, newYork).Unix()) {
+		t.Fatalf("naive: got %v, %v", got, err)
+	}
+
+	// ...unless the column has its own time zone
+	tokyo := &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "Asia/Tokyo"}
+	got, err = tp.parse("2024-01-02 03:04:05", tokyo)
+	if err != nil || got != arrow.Timestamp(time.Date(2024, 1, 1, 18, 4, 5, 0, time.UTC).UnixMilli()) {
+		t.Fatalf("column zone: got %v, %v", got, err)
+	}
+
+	_, err = tp.parse("02/01/2024", naive)
+	if err == nil || !strings.Contains(err.Error(), "tried layouts "+time.RFC3339+", 2006-01-02 15:04:05") {
+		t.Fatalf("expected the layouts tried in the error, got %v", err)
+	}
+}
+
+func TestDecimalExceedsScale(t *testing.T) {
+	typ := &arrow.Decimal128Type{Precision: 10, Scale: 2}
+	if _, err := parseDecimal128("1234.567", typ); err == nil {
+		t.Fatalf("expected scale error")
+	}
+	if _, err := parseDecimal128("123456789.01", typ); err == nil {
+		t.Fatalf("expected precision error")
+	}
+	num, err := parseDecimal128("1234.56", typ)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := num.ToString(typ.Scale); got != "1234.56" {
+		t.Fatalf("unexpected value %s", got)
+	}
+}
+
+func TestCSVHeaderMismatch(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tests := []struct {
+		header     []string
+		positional bool
+		unexpected []string
+		missing    []string
+	}{
+		{[]string{"id", "name", "email"}, false, nil, nil},
+		{[]string{"email", "id", "name"}, false, nil, nil},
+		{[]string{"id", "mail", "name", "source"}, false, []string{"mail", "source"}, []string{"email"}},
+		{[]string{"id", "name", "email"}, true, nil, nil},
+		// Shifted by one: every column lands on the wrong field
+		{[]string{"row", "id", "name"}, true, []string{"row", "id", "name"}, []string{"id", "name", "email"}},
+		{[]string{"id", "name"}, true, nil, []string{"email"}},
+	}
+	for _, tt := range tests {
+		unexpected, missing := csvHeaderMismatch(tt.header, schema, tt.positional)
+		if !slices.Equal(unexpected, tt.unexpected) || !slices.Equal(missing, tt.missing) {
+			t.Fatalf("%v (positional %v): expected %v and %v, got %v and %v", tt.header, tt.positional, tt.unexpected, tt.missing, unexpected, missing)
+		}
+	}
+
+	input := "id,name,mail\n1,Alice,a@example.com\n"
+	rec, err := LoadCSV(context.Background(), strings.NewReader(input), schema, CSVReadOptions{})
+	if err != nil {
+		t.Fatalf("a mismatched header should only warn: %v", err)
+	}
+	rec.Release()
+	_, err = LoadCSV(context.Background(), strings.NewReader(input), schema, CSVReadOptions{StrictHeader: true})
+	if err == nil || !strings.Contains(err.Error(), "unexpected columns [mail], missing fields [email]") {
+		t.Fatalf("expected a header mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,436 @@
+package lockbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// ReadOptions controls loading of self-describing inputs (Arrow IPC,
+// Parquet and Avro), whose record takes the input's own schema
+type ReadOptions struct {
+	// Allocator builds the record, memory.DefaultAllocator when nil
+	Allocator memory.Allocator
+	// OnRows, if set, is called with the number of rows loaded as they are
+	OnRows func(n int64)
+	// Threads is how many Parquet row groups LoadParquet decodes at once;
+	// 0 or 1 reads them one after another. Rows keep the file's order.
+	Threads int
+	// Columns, if set, limits LoadParquet to these top-level columns, in
+	// this order
+	Columns []string
+	// RowGroups, if set, limits LoadParquet to these row groups, numbered
+	// from 0, in this order
+	RowGroups []int
+}
+
+// addRows reports n loaded rows to OnRows
+func (o ReadOptions) addRows(n int64) {
+	if o.OnRows != nil {
+		o.OnRows(n)
+	}
+}
+
+// ConcatRecords concatenates records, which must all have schema, into a
+// single record allocated from mem. Without records it returns an empty
+// record of schema, never nil.
+func ConcatRecords(mem memory.Allocator, schema *arrow.Schema, records ...arrow.Record) (arrow.Record, error) {
+	mem = allocatorOrDefault(mem)
+	if len(records) == 0 {
+		b := array.NewRecordBuilder(mem, schema)
+		defer b.Release()
+		return b.NewRecord(), nil
+	}
+
+	numFields := len(schema.Fields())
+	concatArrays := make([]arrow.Array, numFields)
+
+	for i := 0; i < numFields; i++ {
+		var arraysToConcat []arrow.Array
+		for _, rec := range records {
+			arraysToConcat = append(arraysToConcat, rec.Column(i))
+		}
+		out, err := array.Concatenate(arraysToConcat, mem)
+		if err != nil {
+			// Release any arrays already created
+			for _, arr := range concatArrays {
+				if arr != nil {
+					arr.Release()
+				}
+			}
+			return nil, err
+		}
+		concatArrays[i] = out
+	}
+
+	// Count total rows
+	var totalRows int64
+	for _, rec := range records {
+		totalRows += rec.NumRows()
+	}
+
+	rec := array.NewRecord(schema, concatArrays, totalRows)
+	for _, arr := range concatArrays {
+		arr.Release()
+	}
+	return rec, nil
+}
+
+// LoadBlobRecord builds a single-row record with each field read from its
+// reader in blobs; fields without a reader are null. Blob fields must be
+// binary or string.
+func LoadBlobRecord(blobs map[string]io.Reader, schema *arrow.Schema, opts ReadOptions) (arrow.Record, error) {
+	mem := allocatorOrDefault(opts.Allocator)
+	builders := make([]array.Builder, len(schema.Fields()))
+	defer func() {
+		for _, b := range builders {
+			b.Release()
+		}
+	}()
+	for i, f := range schema.Fields() {
+		builders[i] = array.NewBuilder(mem, f.Type)
+	}
+
+	for i, f := range schema.Fields() {
+		r, ok := blobs[f.Name]
+		if !ok {
+			builders[i].AppendNull()
+			continue
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read blob %s: %w", f.Name, err)
+		}
+		switch b := builders[i].(type) {
+		case *array.BinaryBuilder:
+			b.Append(data)
+		case *array.StringBuilder:
+			b.Append(string(data))
+		default:
+			return nil, fmt.Errorf("blob field %q must be binary or string, not %v", f.Name, f.Type)
+		}
+	}
+
+	arrays := make([]arrow.Array, len(schema.Fields()))
+	for i, b := range builders {
+		arrays[i] = b.NewArray()
+	}
+
+	rec := array.NewRecord(schema, arrays, 1)
+	for _, arr := range arrays {
+		arr.Release()
+	}
+	opts.addRows(1)
+	return rec, nil
+}
+
+// LoadParquet reads a whole Parquet file into a single record using the
+// file's own schema, empty when the file holds no rows, leaving any
+// reconciliation with a lockbox to the caller. CoerceRecord converts it
+// where the types differ. r is left open.
+func LoadParquet(ctx context.Context, r parquet.ReaderAtSeeker, opts ReadOptions) (arrow.Record, error) {
+	mem := allocatorOrDefault(opts.Allocator)
+
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet file: %w", err)
+	}
+	// pf.Close would close r, which belongs to the caller
+
+	pqReader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1024}, mem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+
+	schema, err := pqReader.Schema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parquet schema: %w", err)
+	}
+	leaves, schema, err := parquetColumns(pqReader, schema, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+	groups := opts.RowGroups
+	if groups == nil {
+		groups = make([]int, pf.NumRowGroups())
+		for i := range groups {
+			groups[i] = i
+		}
+	}
+	for _, g := range groups {
+		if g < 0 || g >= pf.NumRowGroups() {
+			return nil, fmt.Errorf("row group %d out of range: the file has %d (0-%d)", g, pf.NumRowGroups(), pf.NumRowGroups()-1)
+		}
+	}
+
+	var batches []arrow.Record
+	if opts.Threads > 1 && len(groups) > 1 {
+		batches, err = readRowGroups(ctx, pqReader, leaves, groups, opts)
+	} else if len(groups) > 0 {
+		batches, err = readParquetBatches(ctx, pqReader, leaves, groups, opts)
+	}
+	defer func() {
+		for _, rec := range batches {
+			rec.Release()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return ConcatRecords(mem, schema, batches...)
+}
+
+// ParquetSchema reads the Arrow schema of a Parquet file from its footer,
+// without reading any data. r is left open.
+func ParquetSchema(r parquet.ReaderAtSeeker) (*arrow.Schema, error) {
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parquet file: %w", err)
+	}
+	schema, err := pqarrow.FromParquet(pf.MetaData().Schema, nil, pf.MetaData().KeyValueMetadata())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parquet schema: %w", err)
+	}
+	return schema, nil
+}
+
+// parquetColumns returns the leaf columns and schema of the named top-level
+// columns, in the order given, or of every column without names
+func parquetColumns(pqReader *pqarrow.FileReader, schema *arrow.Schema, names []string) ([]int, *arrow.Schema, error) {
+	if len(names) == 0 {
+		leaves := make([]int, pqReader.ParquetReader().MetaData().Schema.NumColumns())
+		for i := range leaves {
+			leaves[i] = i
+		}
+		return leaves, schema, nil
+	}
+
+	// Group the leaf columns under the top-level field they belong to
+	descr := pqReader.ParquetReader().MetaData().Schema
+	fieldLeaves := make([][]int, len(schema.Fields()))
+	for leaf := 0; leaf < descr.NumColumns(); leaf++ {
+		if f := descr.Root().FieldIndexByField(descr.ColumnRoot(leaf)); f >= 0 && f < len(fieldLeaves) {
+			fieldLeaves[f] = append(fieldLeaves[f], leaf)
+		}
+	}
+
+	var leaves []int
+	var fields []arrow.Field
+	var unknown []string
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			return nil, nil, fmt.Errorf("parquet column %s given twice", name)
+		}
+		at := schema.FieldIndices(name)
+		if len(at) == 0 {
+			unknown = append(unknown, name)
+			continue
+		}
+		leaves = append(leaves, fieldLeaves[at[0]]...)
+		fields = append(fields, schema.Field(at[0]))
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("parquet file has no column %s", strings.Join(unknown, ", "))
+	}
+	md := schema.Metadata()
+	return leaves, arrow.NewSchema(fields, &md), nil
+}
+
+// readParquetBatches reads the batches of the leaf columns in each of the
+// row groups in turn
+func readParquetBatches(ctx context.Context, pqReader *pqarrow.FileReader, leaves, groups []int, opts ReadOptions) ([]arrow.Record, error) {
+	recReader, err := pqReader.GetRecordReader(ctx, leaves, groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record reader: %w", err)
+	}
+	defer recReader.Release()
+
+	var batches []arrow.Record
+	for ctx.Err() == nil && recReader.Next() {
+		rec := recReader.Record()
+		rec.Retain()
+		batches = append(batches, rec)
+		opts.addRows(rec.NumRows())
+	}
+	if err := ctx.Err(); err != nil {
+		return batches, err
+	}
+	// The pqarrow reader reports io.EOF once every row group is read
+	if err := recReader.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return batches, fmt.Errorf("failed to read parquet data: %w", err)
+	}
+	return batches, nil
+}
+
+// rowGroupResult holds the decoded batches of one row group
+type rowGroupResult struct {
+	batches []arrow.Record
+	err     error
+}
+
+// readRowGroups decodes the leaf columns of each of the row groups on
+// opts.Threads workers and collects their batches in the order of groups,
+// each row group as soon as those before it are done. Batches read so far
+// are returned with any error.
+func readRowGroups(ctx context.Context, pqReader *pqarrow.FileReader, leaves, groups []int, opts ReadOptions) ([]arrow.Record, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n := len(groups)
+	results := make([]chan rowGroupResult, n)
+	for i := range results {
+		results[i] = make(chan rowGroupResult, 1)
+	}
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := 0; i < n; i++ {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Threads, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				batches, err := readRowGroup(ctx, pqReader, leaves, groups[i])
+				results[i] <- rowGroupResult{batches: batches, err: err}
+			}
+		}()
+	}
+	// Once the workers stop, release the row groups that were not consumed
+	defer func() {
+		cancel()
+		wg.Wait()
+		for _, ch := range results {
+			select {
+			case res := <-ch:
+				for _, rec := range res.batches {
+					rec.Release()
+				}
+			default:
+			}
+		}
+	}()
+
+	var batches []arrow.Record
+	for i := range results {
+		select {
+		case res := <-results[i]:
+			batches = append(batches, res.batches...)
+			if res.err != nil {
+				return batches, fmt.Errorf("failed to read parquet row group %d: %w", groups[i], res.err)
+			}
+			for _, rec := range res.batches {
+				opts.addRows(rec.NumRows())
+			}
+		case <-ctx.Done():
+			return batches, ctx.Err()
+		}
+	}
+	return batches, nil
+}
+
+// readRowGroup decodes the leaf columns of row group i into batches
+func readRowGroup(ctx context.Context, pqReader *pqarrow.FileReader, leaves []int, i int) ([]arrow.Record, error) {
+	tbl, err := pqReader.ReadRowGroups(ctx, leaves, []int{i})
+	if err != nil {
+		return nil, err
+	}
+	defer tbl.Release()
+	if tbl.NumRows() == 0 {
+		return nil, nil
+	}
+
+	tr := array.NewTableReader(tbl, tbl.NumRows())
+	defer tr.Release()
+	var batches []arrow.Record
+	for tr.Next() {
+		rec := tr.Record()
+		rec.Retain()
+		batches = append(batches, rec)
+	}
+	return batches, nil
+}
+
+// arrowFileMagic opens Arrow IPC files. The file format is the stream format
+// framed by this magic (padded to 8 bytes) and a footer, so skipping the
+// prefix lets a stream reader consume either without seeking.
+const arrowFileMagic = "ARROW1"
+
+// newArrowReader returns an IPC reader over an Arrow stream or file
+func newArrowReader(mem memory.Allocator, r io.Reader) (*ipc.Reader, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(arrowFileMagic)); string(head) == arrowFileMagic {
+		if _, err := br.Discard(8); err != nil {
+			return nil, fmt.Errorf("failed to read Arrow file header: %w", err)
+		}
+	}
+	rdr, err := ipc.NewReader(br, ipc.WithAllocator(mem))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Arrow IPC input: %w", err)
+	}
+	return rdr, nil
+}
+
+// LoadArrow reads every batch of an Arrow IPC stream or file (Feather v2)
+// into a single record with the input's own schema, empty without batches,
+// leaving any reconciliation with a lockbox to the caller. The input is read
+// sequentially, so it need not be seekable.
+func LoadArrow(ctx context.Context, r io.Reader, opts ReadOptions) (arrow.Record, error) {
+	mem := allocatorOrDefault(opts.Allocator)
+	rdr, err := newArrowReader(mem, r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Release()
+
+	var batches []arrow.Record
+	defer func() {
+		for _, rec := range batches {
+			rec.Release()
+		}
+	}()
+	for rdr.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rec := rdr.Record()
+		rec.Retain()
+		batches = append(batches, rec)
+		opts.addRows(rec.NumRows())
+	}
+	if err := rdr.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Arrow data: %w", err)
+	}
+	return ConcatRecords(mem, rdr.Schema(), batches...)
+}
+
+// ArrowSchema reads only the schema of an Arrow IPC stream or file
+func ArrowSchema(r io.Reader) (*arrow.Schema, error) {
+	rdr, err := newArrowReader(memory.DefaultAllocator, r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Release()
+	return rdr.Schema(), nil
+}
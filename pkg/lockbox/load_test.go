@@ -0,0 +1,353 @@
+package lockbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+func TestLoadArrowAndParquet(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	batch := func(ids ...int64) arrow.Record {
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		b.AppendValues(ids, nil)
+		col := b.NewArray()
+		defer col.Release()
+		return array.NewRecord(schema, []arrow.Array{col}, int64(len(ids)))
+	}
+	first, second := batch(1, 2), batch(3)
+	defer first.Release()
+	defer second.Release()
+
+	// An Arrow IPC file of two batches loads as one record
+	var buf bytes.Buffer
+	w, err := ipc.NewFileWriter(&buf, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	if err != nil {
+		t.Fatalf("ipc writer: %v", err)
+	}
+	for _, rec := range []arrow.Record{first, second} {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("ipc write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("ipc close: %v", err)
+	}
+
+	var rows int64
+	opts := ReadOptions{Allocator: mem, OnRows: func(n int64) { rows += n }}
+	rec, err := LoadArrow(context.Background(), bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("load arrow: %v", err)
+	}
+	ids := rec.Column(0).(*array.Int64)
+	if rows != 3 || rec.NumRows() != 3 || ids.Value(2) != 3 {
+		t.Fatalf("unexpected record %v after %d rows", rec, rows)
+	}
+	rec.Release()
+
+	got, err := ArrowSchema(bytes.NewReader(buf.Bytes()))
+	if err != nil || !got.Equal(schema) {
+		t.Fatalf("unexpected Arrow schema %v: %v", got, err)
+	}
+
+	// ConcatRecords joins the same batches
+	rec, err = ConcatRecords(mem, schema, first, second)
+	if err != nil || rec.NumRows() != 3 {
+		t.Fatalf("unexpected concatenated record %v: %v", rec, err)
+	}
+
+	path := "/tmp/test_load_parquet.parquet"
+	defer os.Remove(path)
+	if err := writeParquet(path, rec); err != nil {
+		t.Fatalf("write parquet: %v", err)
+	}
+	rec.Release()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	defer f.Close()
+	rows = 0
+	rec, err = LoadParquet(context.Background(), f, opts)
+	if err != nil {
+		t.Fatalf("load parquet: %v", err)
+	}
+	if rows != 3 || rec.NumRows() != 3 || rec.Column(0).(*array.Int64).Value(0) != 1 {
+		t.Fatalf("unexpected record %v after %d rows", rec, rows)
+	}
+	rec.Release()
+
+	// The footer alone gives the schema LoadParquet reads
+	got, err = ParquetSchema(f)
+	if err != nil || !got.Equal(rec.Schema()) {
+		t.Fatalf("unexpected Parquet schema %v: %v", got, err)
+	}
+
+	// A file without rows loads as an empty record
+	empty, err := ConcatRecords(mem, schema)
+	if err != nil {
+		t.Fatalf("concat nothing: %v", err)
+	}
+	if err := writeParquet(path, empty); err != nil {
+		t.Fatalf("write empty parquet: %v", err)
+	}
+	empty.Release()
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	defer f.Close()
+	rec, err = LoadParquet(context.Background(), f, opts)
+	if err != nil || rec.NumRows() != 0 || rec.NumCols() != 1 {
+		t.Fatalf("expected an empty record, got %v (%v)", rec, err)
+	}
+	rec.Release()
+
+	if _, err := LoadArrow(context.Background(), strings.NewReader("id\n1\n"), ReadOptions{}); err == nil {
+		t.Fatalf("expected an error loading CSV as Arrow")
+	}
+}
+
+func TestLoadParquetThreads(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	b := array.NewInt64Builder(mem)
+	for i := 0; i < 1000; i++ {
+		b.Append(int64(i))
+	}
+	col := b.NewArray()
+	b.Release()
+	rec := array.NewRecord(schema, []arrow.Array{col}, 1000)
+	col.Release()
+
+	// 20 row groups of 50 rows
+	var buf bytes.Buffer
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(50))
+	w, err := pqarrow.NewFileWriter(schema, &buf, props, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		t.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("parquet write: %v", err)
+	}
+	rec.Release()
+	if err := w.Close(); err != nil {
+		t.Fatalf("parquet close: %v", err)
+	}
+
+	for _, threads := range []int{1, 4, 32} {
+		var rows int64
+		opts := ReadOptions{Allocator: mem, Threads: threads, OnRows: func(n int64) { rows += n }}
+		rec, err := LoadParquet(context.Background(), bytes.NewReader(buf.Bytes()), opts)
+		if err != nil {
+			t.Fatalf("threads %d: load parquet: %v", threads, err)
+		}
+		ids := rec.Column(0).(*array.Int64)
+		for i := 0; i < ids.Len(); i++ {
+			if ids.Value(i) != int64(i) {
+				t.Fatalf("threads %d: row %d holds %d", threads, i, ids.Value(i))
+			}
+		}
+		if rows != 1000 || rec.NumRows() != 1000 {
+			t.Fatalf("threads %d: loaded %d rows, counted %d", threads, rec.NumRows(), rows)
+		}
+		rec.Release()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LoadParquet(ctx, bytes.NewReader(buf.Bytes()), ReadOptions{Allocator: mem, Threads: 4}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLoadParquetSubset(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	for i := 0; i < 40; i++ {
+		b.Field(0).(*array.Int64Builder).Append(int64(i))
+		tags := b.Field(1).(*array.ListBuilder)
+		tags.Append(true)
+		tags.ValueBuilder().(*array.StringBuilder).Append("t")
+		b.Field(2).(*array.StringBuilder).Append("row")
+	}
+	rec := b.NewRecord()
+	b.Release()
+
+	// 4 row groups of 10 rows
+	var buf bytes.Buffer
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(10))
+	w, err := pqarrow.NewFileWriter(schema, &buf, props, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		t.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("parquet write: %v", err)
+	}
+	rec.Release()
+	if err := w.Close(); err != nil {
+		t.Fatalf("parquet close: %v", err)
+	}
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	for _, threads := range []int{1, 4} {
+		opts := ReadOptions{Allocator: mem, Threads: threads, Columns: []string{"name", "tags", "id"}, RowGroups: []int{2, 0}}
+		rec, err := LoadParquet(context.Background(), bytes.NewReader(buf.Bytes()), opts)
+		if err != nil {
+			t.Fatalf("threads %d: load parquet: %v", threads, err)
+		}
+		names := []string{}
+		for _, f := range rec.Schema().Fields() {
+			names = append(names, f.Name)
+		}
+		if strings.Join(names, ",") != "name,tags,id" || rec.NumRows() != 20 {
+			t.Fatalf("threads %d: unexpected record %v", threads, rec)
+		}
+		ids := rec.Column(2).(*array.Int64)
+		if ids.Value(0) != 20 || ids.Value(10) != 0 {
+			t.Fatalf("threads %d: expected row groups 2 then 0, got ids %v", threads, ids)
+		}
+		rec.Release()
+	}
+
+	for _, tt := range []struct {
+		opts ReadOptions
+		want string
+	}{
+		{ReadOptions{RowGroups: []int{4}}, "row group 4 out of range: the file has 4"},
+		{ReadOptions{RowGroups: []int{-1}}, "row group -1 out of range"},
+		{ReadOptions{Columns: []string{"id", "missing"}}, "no column missing"},
+		{ReadOptions{Columns: []string{"id", "id"}}, "given twice"},
+	} {
+		tt.opts.Allocator = mem
+		if _, err := LoadParquet(context.Background(), bytes.NewReader(buf.Bytes()), tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("expected %q, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestLoadParquetReleasesOnError(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	for i := 0; i < 400; i++ {
+		b.Field(0).(*array.Int64Builder).Append(int64(i))
+		b.Field(1).(*array.StringBuilder).Append("row")
+	}
+	rec := b.NewRecord()
+	b.Release()
+
+	// 4 row groups of 100 rows
+	var buf bytes.Buffer
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(100), parquet.WithDictionaryDefault(false))
+	w, err := pqarrow.NewFileWriter(schema, &buf, props, pqarrow.ArrowWriterProperties{})
+	if err != nil {
+		t.Fatalf("parquet writer: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("parquet write: %v", err)
+	}
+	rec.Release()
+	if err := w.Close(); err != nil {
+		t.Fatalf("parquet close: %v", err)
+	}
+
+	// Overwrite the page header of the third row group's name column, so
+	// reading fails after two row groups have been decoded
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parquet reader: %v", err)
+	}
+	chunk, err := pf.MetaData().RowGroup(2).ColumnChunk(1)
+	if err != nil {
+		t.Fatalf("column chunk: %v", err)
+	}
+	corrupt := bytes.Clone(buf.Bytes())
+	off := chunk.DataPageOffset()
+	copy(corrupt[off:off+16], bytes.Repeat([]byte{0xff}, 16))
+
+	for _, threads := range []int{1, 4} {
+		mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+		opts := ReadOptions{Allocator: mem, Threads: threads}
+
+		rec, err := LoadParquet(context.Background(), bytes.NewReader(buf.Bytes()), opts)
+		if err != nil {
+			t.Fatalf("threads %d: load parquet: %v", threads, err)
+		}
+		rec.Release()
+		mem.AssertSize(t, 0)
+
+		if _, err := LoadParquet(context.Background(), bytes.NewReader(corrupt), opts); err == nil {
+			t.Fatalf("threads %d: expected an error for a corrupt row group", threads)
+		}
+		mem.AssertSize(t, 0)
+
+		// A cancellation between batches releases those already read
+		ctx, cancel := context.WithCancel(context.Background())
+		opts.OnRows = func(int64) { cancel() }
+		if _, err := LoadParquet(ctx, bytes.NewReader(buf.Bytes()), opts); !errors.Is(err, context.Canceled) {
+			t.Fatalf("threads %d: expected context.Canceled, got %v", threads, err)
+		}
+		mem.AssertSize(t, 0)
+	}
+}
+
+func TestLoadBlobRecord(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "doc", Type: arrow.BinaryTypes.Binary, Nullable: true},
+		{Name: "note", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	rec, err := LoadBlobRecord(map[string]io.Reader{"doc": strings.NewReader("payload")}, schema, ReadOptions{Allocator: mem})
+	if err != nil {
+		t.Fatalf("load blob: %v", err)
+	}
+	if rec.NumRows() != 1 || string(rec.Column(0).(*array.Binary).Value(0)) != "payload" || !rec.Column(1).IsNull(0) {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	rec.Release()
+
+	bad := arrow.NewSchema([]arrow.Field{{Name: "doc", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	if _, err := LoadBlobRecord(map[string]io.Reader{"doc": strings.NewReader("x")}, bad, ReadOptions{Allocator: mem}); err == nil {
+		t.Fatalf("expected an error for a non-binary blob field")
+	}
+}
@@ -2,11 +2,17 @@ package lockbox
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/apache/arrow-go/v18/parquet/file"
@@ -14,18 +20,34 @@ import (
 
 	"github.com/TFMV/lockbox/pkg/crypto"
 	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/TFMV/lockbox/pkg/store"
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/apache/arrow-go/v18/arrow/memory"
 	"github.com/rs/zerolog/log"
 )
 
-// Lockbox represents a lockbox file with high-level operations
+// Lockbox represents a lockbox file with high-level operations.
+//
+// Reads are safe for concurrent use: any number of goroutines may call
+// NewReader, Read, ReadSegment or Count on one Lockbox. Writes must not run
+// concurrently with any other call on the same Lockbox.
+//
+// An open Lockbox holds an advisory lock on its file until Close: an
+// exclusive one by default, or a shared one when opened WithMode(ReadOnly),
+// so any number of readers or a single writer may have the file open. An
+// open that conflicts fails with ErrLocked instead of waiting.
 type Lockbox struct {
 	file   *format.LockboxFile
 	writer *format.Writer
 	reader *format.Reader
 	key    *crypto.Key // Store the key for signing operations
+	remote *remoteFile // Set when the file lives in an object store
+	sink   io.Writer   // Set by CreateTo; receives the file on Close
+
+	// readerMu guards the creation of reader, shared by Read and ReadSegment
+	readerMu sync.Mutex
 }
 
 // Options for lockbox operations
@@ -34,7 +56,44 @@ type Options struct {
 	CreatedBy    string
 	Columns      []string
 	DryRun       bool
+	Coerce       bool
+	Evolve       bool
+	Mmap         bool
 	CryptoModule string
+	Mode         Mode
+	NoLock       bool
+
+	Filters []Filter
+	Head    int64
+	Tail    int64
+
+	Recipients []*crypto.Recipient
+	Identities []*crypto.Identity
+	KDF        *crypto.KDFParams
+	Cipher     string
+	AAD        []byte
+
+	Compression       string
+	CompressionLevel  int
+	ColumnCompression map[string]string
+	Parallelism       int
+	BlockSize         int
+	SortBy            []string
+
+	Ingest   *IngestState
+	Metadata map[string]string
+	Tool     string
+
+	// TimestampTimezone is the zone naive timestamps are read in when
+	// coercing to or from a zoned timestamp; nil means UTC
+	TimestampTimezone *time.Location
+
+	// Allocator builds the records Write and SortSpilled copy into;
+	// nil means memory.DefaultAllocator
+	Allocator memory.Allocator
+
+	// err records an invalid option value so it surfaces before any I/O
+	err error
 }
 
 // Option is a functional option for lockbox operations
@@ -54,13 +113,22 @@ func WithCreatedBy(createdBy string) Option {
 	}
 }
 
-// WithColumns sets the specific columns to operate on
+// WithColumns sets the specific columns to operate on. Readers decrypt only
+// the blocks of these columns and return them in schema order.
 func WithColumns(columns ...string) Option {
 	return func(o *Options) {
 		o.Columns = columns
 	}
 }
 
+// WithAllocator sets the allocator for the records Write makes when it
+// coerces or sorts its input, and for the runs SortSpilled merges
+func WithAllocator(mem memory.Allocator) Option {
+	return func(o *Options) {
+		o.Allocator = mem
+	}
+}
+
 // WithDryRun enables or disables dry-run mode
 func WithDryRun(v bool) Option {
 	return func(o *Options) {
@@ -68,6 +136,64 @@ func WithDryRun(v bool) Option {
 	}
 }
 
+// WithCoerce lets Write convert records whose schema differs from the
+// lockbox schema but is convertible, via CoerceRecord
+func WithCoerce(v bool) Option {
+	return func(o *Options) {
+		o.Coerce = v
+	}
+}
+
+// IngestState is the progress of a chunked ingest: which input it is, how
+// many of its rows are committed and whether it finished
+type IngestState struct {
+	Fingerprint string
+	Rows        int64
+	Complete    bool
+}
+
+// WithIngestState makes Write commit state together with the record, so an
+// interrupted ingest can tell exactly which rows reached the file
+func WithIngestState(state IngestState) Option {
+	return func(o *Options) {
+		o.Ingest = &state
+	}
+}
+
+// WithTool names the program Write records in the provenance log. It
+// defaults to the name of the running executable.
+func WithTool(name string) Option {
+	return func(o *Options) {
+		o.Tool = name
+	}
+}
+
+// ProvenanceEntry is one write recorded in the provenance log
+type ProvenanceEntry = metadata.ProvenanceEntry
+
+// provenanceUser returns the operating system user recorded for a write
+func provenanceUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// WithMetadata merges key-value pairs such as the source system or an
+// ingest description into the file properties with the next Write. They are
+// stored unencrypted but authenticated, so edits without the key are
+// detected by Metadata and Verify.
+func WithMetadata(m map[string]string) Option {
+	return func(o *Options) {
+		for k := range m {
+			if k == "" && o.err == nil {
+				o.err = fmt.Errorf("metadata keys must not be empty")
+			}
+		}
+		o.Metadata = m
+	}
+}
+
 // WithCryptoModule selects the cryptographic module by name.
 func WithCryptoModule(name string) Option {
 	return func(o *Options) {
@@ -75,8 +201,202 @@ func WithCryptoModule(name string) Option {
 	}
 }
 
-// Create creates a new lockbox file with the given schema
+// WithKeyFile reads the password from a file, dropping a single trailing
+// newline, so automation need not pass secrets on the command line
+func WithKeyFile(path string) Option {
+	return func(o *Options) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if o.err == nil {
+				o.err = fmt.Errorf("failed to read key file: %w", err)
+			}
+			return
+		}
+		password := string(data)
+		if strings.HasSuffix(password, "\n") {
+			password = strings.TrimSuffix(strings.TrimSuffix(password, "\n"), "\r")
+		}
+		if password == "" && o.err == nil {
+			o.err = fmt.Errorf("key file %s is empty", path)
+		}
+		o.Password = password
+	}
+}
+
+// WithRecipient wraps the file's data key for an X25519 public key when
+// creating a file, so the holder of the matching identity can open it.
+// Repeat for several recipients.
+func WithRecipient(r *crypto.Recipient) Option {
+	return func(o *Options) {
+		o.Recipients = append(o.Recipients, r)
+	}
+}
+
+// WithIdentity adds a private key to try against the file's recipients.
+// Identities are tried before falling back to the password.
+func WithIdentity(id *crypto.Identity) Option {
+	return func(o *Options) {
+		o.Identities = append(o.Identities, id)
+	}
+}
+
+// hasCredentials reports whether a password or identity was supplied
+func (o *Options) hasCredentials() bool {
+	return o.Password != "" || len(o.Identities) > 0
+}
+
+// WithCompression sets the codec (none, zstd, lz4 or snappy) applied to
+// column blocks before encryption. The default is none.
+func WithCompression(codec string) Option {
+	return func(o *Options) {
+		if err := format.ValidateCodec(codec); err != nil && o.err == nil {
+			o.err = err
+		}
+		o.Compression = codec
+	}
+}
+
+// WithCompressionLevel sets the zstd level (1-19); zero keeps the default.
+// The level is recorded per block but not needed to decompress.
+func WithCompressionLevel(level int) Option {
+	return func(o *Options) {
+		if err := format.ValidateCompressionLevel(level); err != nil && o.err == nil {
+			o.err = err
+		}
+		o.CompressionLevel = level
+	}
+}
+
+// WithKDFParams derives the password key with Argon2id at the given memory
+// (KiB), time and parallelism cost when creating a file or rotating its
+// password. The parameters are stored in the file so Open needs no options.
+// Without it PBKDF2 is used.
+func WithKDFParams(memoryKiB, iterations, parallelism uint32) Option {
+	return func(o *Options) {
+		o.KDF = &crypto.KDFParams{Memory: memoryKiB, Iterations: iterations, Parallelism: parallelism}
+		if err := o.KDF.Validate(); err != nil && o.err == nil {
+			o.err = err
+		}
+	}
+}
+
+// WithCipher selects the AEAD cipher that seals column data when creating
+// a file, e.g. AES-256-GCM (the default) or ChaCha20-Poly1305. The choice is
+// stored in the file so Open needs no options.
+func WithCipher(name string) Option {
+	return func(o *Options) {
+		canonical, err := crypto.CipherName(name)
+		if err != nil && o.err == nil {
+			o.err = err
+		}
+		o.Cipher = canonical
+	}
+}
+
+// WithColumnCompression overrides the compression codec for individual
+// columns, keyed by column name.
+func WithColumnCompression(codecs map[string]string) Option {
+	return func(o *Options) {
+		for col, codec := range codecs {
+			if err := format.ValidateCodec(codec); err != nil && o.err == nil {
+				o.err = fmt.Errorf("column %s: %w", col, err)
+			}
+		}
+		o.ColumnCompression = codecs
+	}
+}
+
+// WithMmap makes Open memory-map the file so blocks are decrypted directly
+// from the mapped region. Where mmap is unavailable, or the mapping fails,
+// Open logs a warning and reads the file as usual.
+func WithMmap() Option {
+	return func(o *Options) {
+		o.Mmap = true
+	}
+}
+
+// WithAAD binds the file's blocks to associated data such as a tenant ID
+// or the file's intended name. Create seals every block with it and records
+// a keyed hint, not the data itself; Open must then be given the same data,
+// or using the key fails with ErrWrongAAD, so a file cannot be passed off
+// in another context.
+func WithAAD(aad []byte) Option {
+	return func(o *Options) {
+		o.AAD = aad
+	}
+}
+
+// Mode is how Open uses a file
+type Mode int
+
+const (
+	// ReadWrite, the default, holds an exclusive lock on the file
+	ReadWrite Mode = iota
+	// ReadOnly holds a shared lock, so other readers may open the file at
+	// the same time; writes fail
+	ReadOnly
+)
+
+// WithMode sets how Open uses the file
+func WithMode(m Mode) Option {
+	return func(o *Options) {
+		if m != ReadWrite && m != ReadOnly {
+			o.err = fmt.Errorf("invalid mode %d", m)
+			return
+		}
+		o.Mode = m
+	}
+}
+
+// WithNoLock makes Open and Create take no lock, for network filesystems
+// where advisory locks are unreliable. Nothing then stops two writers from
+// corrupting the file.
+func WithNoLock() Option {
+	return func(o *Options) {
+		o.NoLock = true
+	}
+}
+
+// lockMode returns the lock a handle opened with these options holds
+func (o *Options) lockMode() format.LockMode {
+	switch {
+	case o.NoLock:
+		return format.LockNone
+	case o.Mode == ReadOnly:
+		return format.LockShared
+	}
+	return format.LockExclusive
+}
+
+// createLock returns the lock Create holds: exclusive whatever the mode,
+// since Create writes the file
+func createLock(o *Options) format.LockMode {
+	if o.NoLock {
+		return format.LockNone
+	}
+	return format.LockExclusive
+}
+
+// WithParallelism sets how many column blocks Write compresses and encrypts
+// at once. Zero, the default, uses GOMAXPROCS. The blocks are written in the
+// same order whatever the setting.
+func WithParallelism(n int) Option {
+	return func(o *Options) {
+		if n < 0 && o.err == nil {
+			o.err = fmt.Errorf("parallelism must not be negative, got %d", n)
+		}
+		o.Parallelism = n
+	}
+}
+
+// Create creates a new lockbox file with the given schema. filename may be
+// an object store URI such as s3://bucket/key; the file is then built
+// locally and uploaded on Close.
 func Create(filename string, schema *arrow.Schema, opts ...Option) (*Lockbox, error) {
+	if store.IsRemote(filename) {
+		return createRemote(filename, schema, opts...)
+	}
+
 	options := &Options{
 		Password:     "",
 		CreatedBy:    "system",
@@ -88,8 +408,64 @@ func Create(filename string, schema *arrow.Schema, opts ...Option) (*Lockbox, er
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return nil, fmt.Errorf("password is required")
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	return newLockbox(filename, schema, options,
+		func(password string, module crypto.Module) (*format.LockboxFile, error) {
+			return format.Create(filename, schema, password, options.CreatedBy, module, options.KDF, options.Cipher, createLock(options))
+		},
+		func() { os.Remove(filename) })
+}
+
+// CreateTo creates a new lockbox that is written to w when it is closed,
+// such as os.Stdout or a network connection that cannot seek. The whole
+// file is built in memory, and nothing reaches w until Close; a lockbox
+// that fails to close is never written. The options are those of Create.
+func CreateTo(w io.Writer, schema *arrow.Schema, opts ...Option) (*Lockbox, error) {
+	options := &Options{
+		Password:     "",
+		CreatedBy:    "system",
+		Columns:      []string{},
+		CryptoModule: "",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	lb, err := newLockbox("", schema, options,
+		func(password string, module crypto.Module) (*format.LockboxFile, error) {
+			return format.CreateMemory(schema, password, options.CreatedBy, module, options.KDF, options.Cipher)
+		},
+		func() {})
+	if err != nil {
+		return nil, err
+	}
+	lb.sink = w
+	return lb, nil
+}
+
+// newLockbox sets up a lockbox made by create with the keys, block size,
+// associated data and recipients of options. discard removes what create
+// left behind when a later step fails.
+func newLockbox(filename string, schema *arrow.Schema, options *Options, create func(password string, module crypto.Module) (*format.LockboxFile, error), discard func()) (*Lockbox, error) {
+	if options.Password == "" && len(options.Recipients) == 0 {
+		return nil, fmt.Errorf("password or recipient is required")
+	}
+
+	// Without a password the data key is random and only recipients hold it
+	password := options.Password
+	if password == "" {
+		var err error
+		if password, err = randomPassword(); err != nil {
+			return nil, err
+		}
 	}
 
 	module, ok := crypto.GetModule(options.CryptoModule)
@@ -98,16 +474,49 @@ func Create(filename string, schema *arrow.Schema, opts ...Option) (*Lockbox, er
 	}
 
 	// Generate key with post-quantum components
-	key, err := module.NewKey(options.Password)
+	key, err := module.NewKey(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key: %w", err)
 	}
 
-	file, err := format.Create(filename, schema, options.Password, options.CreatedBy, module)
+	file, err := create(password, module)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create lockbox file: %w", err)
 	}
 
+	if options.BlockSize > 0 {
+		if err := file.SetBlockSize(options.BlockSize); err != nil {
+			file.Close()
+			discard()
+			return nil, fmt.Errorf("failed to record block size: %w", err)
+		}
+	}
+
+	file.SetAAD(options.AAD)
+	if len(options.AAD) > 0 {
+		dataKey, err := file.Unlock(password, nil)
+		if err == nil {
+			err = file.BindAAD(dataKey)
+		}
+		if err != nil {
+			file.Close()
+			discard()
+			return nil, fmt.Errorf("failed to bind associated data: %w", err)
+		}
+	}
+
+	if len(options.Recipients) > 0 {
+		dataKey, err := file.Unlock(password, nil)
+		if err == nil {
+			err = file.AddRecipients(dataKey, options.Password == "", options.Recipients...)
+		}
+		if err != nil {
+			file.Close()
+			discard()
+			return nil, fmt.Errorf("failed to add recipients: %w", err)
+		}
+	}
+
 	lb := &Lockbox{
 		file: file,
 		key:  key,
@@ -122,8 +531,16 @@ func Create(filename string, schema *arrow.Schema, opts ...Option) (*Lockbox, er
 	return lb, nil
 }
 
-// Open opens an existing lockbox file
+// Open opens an existing lockbox file. filename may be an object store URI
+// such as s3://bucket/key or gs://bucket/object; the object is downloaded to
+// a temporary working copy and uploaded again on Close if it was written.
+// A password or identity is required unless the file is opened
+// WithMode(ReadOnly); see OpenRead.
 func Open(filename string, opts ...Option) (*Lockbox, error) {
+	if store.IsRemote(filename) {
+		return openRemote(filename, opts...)
+	}
+
 	options := &Options{
 		Password:     "",
 		CreatedBy:    "system",
@@ -135,8 +552,13 @@ func Open(filename string, opts ...Option) (*Lockbox, error) {
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return nil, fmt.Errorf("password is required")
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	// Read-only handles can be opened without the key, for metadata
+	if !options.hasCredentials() && options.Mode != ReadOnly {
+		return nil, fmt.Errorf("%w to open for writing", ErrPasswordRequired)
 	}
 
 	module, ok := crypto.GetModule(options.CryptoModule)
@@ -144,28 +566,194 @@ func Open(filename string, opts ...Option) (*Lockbox, error) {
 		module, _ = crypto.GetModule("default")
 	}
 
-	// Derive key with post-quantum components if available
-	key := module.DeriveKey(options.Password, nil) // Salt will be read from file
-
-	file, err := format.Open(filename, options.Password, module)
+	file, err := format.Open(filename, options.Password, module, options.lockMode())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open lockbox file: %w", err)
 	}
+	lb, err := openHandle(file, options)
+	if err != nil {
+		return nil, err
+	}
 
-	lb := &Lockbox{
-		file: file,
-		key:  key,
+	if options.Mmap {
+		if err := file.EnableMmap(); err != nil {
+			log.Warn().Err(err).Str("file", filename).Msg("Falling back to buffered reads")
+		}
 	}
 
 	log.Info().
 		Str("file", filename).
 		Int("fields", len(file.Schema().Fields())).
-		Bool("pq_enabled", key.KyberPublicKey != nil).
+		Bool("pq_enabled", lb.key != nil && lb.key.KyberPublicKey != nil).
 		Msg("Opened lockbox")
 
 	return lb, nil
 }
 
+// OpenReader opens a lockbox held in r, size bytes long, without touching
+// the filesystem, e.g. OpenReader(bytes.NewReader(data), int64(len(data)),
+// WithPassword(pw)). The handle is read-only, so it can be opened without
+// credentials like OpenRead; Read, NewReader and the other readers work as
+// on a file. r must stay readable until Close, which does not close it.
+func OpenReader(r io.ReaderAt, size int64, opts ...Option) (*Lockbox, error) {
+	options := &Options{
+		Password:     "",
+		CreatedBy:    "system",
+		Columns:      []string{},
+		CryptoModule: "",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	module, ok := crypto.GetModule(options.CryptoModule)
+	if !ok {
+		module, _ = crypto.GetModule("default")
+	}
+
+	file, err := format.OpenReader(r, size, module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockbox: %w", err)
+	}
+	return openHandle(file, options)
+}
+
+// openHandle wraps an opened file, unlocking it when options hold
+// credentials. The file is closed if unlocking fails.
+func openHandle(file *format.LockboxFile, options *Options) (*Lockbox, error) {
+	file.SetAAD(options.AAD)
+
+	// Try each identity, then the password
+	var key *crypto.Key
+	if options.hasCredentials() {
+		var err error
+		key, err = unlock(file, options)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to unlock lockbox: %w", err)
+		}
+	}
+	return &Lockbox{file: file, key: key}, nil
+}
+
+// OpenRead opens a lockbox file read-only, holding a shared lock. Unlike
+// Open it needs no credentials: the schema, counts and other plaintext
+// metadata are available at once, while reading data takes a password or
+// identity on each call and fails with ErrPasswordRequired without one.
+func OpenRead(filename string, opts ...Option) (*Lockbox, error) {
+	return Open(filename, append(opts, WithMode(ReadOnly))...)
+}
+
+// checkColumns rejects projected column names missing from the schema
+func (lb *Lockbox) checkColumns(columns []string) error {
+	for _, c := range columns {
+		if !lb.Schema().HasField(c) {
+			return fmt.Errorf("unknown column %s", c)
+		}
+	}
+	return nil
+}
+
+// unlock returns the file's key for the credentials in options, failing
+// with ErrWrongPassword unless the key is verified against the file. Older
+// files without a password slot derive some key from any password, so
+// without the check a wrong one would write blocks no other reader can
+// decrypt.
+func unlock(file *format.LockboxFile, options *Options) (*crypto.Key, error) {
+	key, err := file.Unlock(options.Password, options.Identities)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.VerifyKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newReader unlocks the file with the credentials in options
+func (lb *Lockbox) newReader(options *Options) (*format.Reader, error) {
+	key, err := unlock(lb.file, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock: %w", err)
+	}
+	reader, err := lb.file.NewReaderWithKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reader: %w", err)
+	}
+	return reader, nil
+}
+
+// sharedReader returns the reader Read and ReadSegment share, created with
+// the first caller's credentials
+func (lb *Lockbox) sharedReader(options *Options) (*format.Reader, error) {
+	lb.readerMu.Lock()
+	defer lb.readerMu.Unlock()
+	if lb.reader == nil {
+		reader, err := lb.newReader(options)
+		if err != nil {
+			return nil, err
+		}
+		lb.reader = reader
+	}
+	return lb.reader, nil
+}
+
+// randomPassword returns a random secret for files opened only by recipients
+func randomPassword() (string, error) {
+	buf := make([]byte, crypto.KeySize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
+
+// RotateKey re-wraps the file's data key from the old credential to the new
+// one, e.g. RotateKey(WithPassword("old"), WithPassword("new")). Only the key
+// slots in the metadata are rewritten; the encrypted blocks are untouched.
+// The old password, or the old identity's recipient slot, stops working. If
+// the old credential is wrong the file is left unchanged. Extra options such
+// as WithKDFParams apply to the new password slot.
+func (lb *Lockbox) RotateKey(old Option, new ...Option) error {
+	oldOpts := &Options{}
+	old(oldOpts)
+	newOpts := &Options{}
+	for _, opt := range new {
+		opt(newOpts)
+	}
+	if oldOpts.err != nil {
+		return oldOpts.err
+	}
+	if newOpts.err != nil {
+		return newOpts.err
+	}
+
+	if !oldOpts.hasCredentials() {
+		return fmt.Errorf("%w to rotate the key", ErrPasswordRequired)
+	}
+	if newOpts.Password == "" && len(newOpts.Recipients) == 0 {
+		return fmt.Errorf("new password or recipient is required")
+	}
+
+	key, err := unlock(lb.file, oldOpts)
+	if err != nil {
+		return fmt.Errorf("failed to unlock with old credential: %w", err)
+	}
+
+	// The old password stops working unless it is replaced by a new one
+	dropPassword := oldOpts.Password != ""
+	if err := lb.file.RewrapKey(key, newOpts.Password, newOpts.KDF, dropPassword, oldOpts.Identities, newOpts.Recipients...); err != nil {
+		return fmt.Errorf("failed to rotate key: %w", err)
+	}
+
+	log.Info().Msg("Rotated lockbox key")
+	return nil
+}
+
 // Close closes the lockbox file
 func (lb *Lockbox) Close() error {
 	if lb.writer != nil {
@@ -176,10 +764,37 @@ func (lb *Lockbox) Close() error {
 		// Readers don't need explicit closing, they use the underlying file
 		lb.reader = nil
 	}
-	if lb.file != nil {
-		return lb.file.Close()
+	if lb.file == nil {
+		return nil
 	}
-	return nil
+	if lb.sink != nil {
+		_, err := lb.file.WriteTo(lb.sink)
+		lb.sink = nil
+		if err != nil {
+			lb.file.Close()
+			return fmt.Errorf("failed to write lockbox: %w", err)
+		}
+	}
+	err := lb.file.Close()
+	if lb.remote != nil {
+		// Never upload a copy that failed to close cleanly
+		modified := err == nil && lb.file.Modified()
+		if syncErr := lb.remote.sync(modified); syncErr != nil {
+			err = syncErr
+		}
+		lb.remote = nil
+	}
+	return err
+}
+
+// IngestState returns the progress of the last chunked ingest, or false if
+// none was recorded
+func (lb *Lockbox) IngestState() (IngestState, bool) {
+	m := lb.file.Metadata().Ingest
+	if m == nil {
+		return IngestState{}, false
+	}
+	return IngestState{Fingerprint: m.Fingerprint, Rows: m.Rows, Complete: m.Complete}, true
 }
 
 // Schema returns the Arrow schema of the lockbox
@@ -187,7 +802,10 @@ func (lb *Lockbox) Schema() *arrow.Schema {
 	return lb.file.Schema()
 }
 
-// Write writes an Arrow record to the lockbox
+// Write writes an Arrow record to the lockbox and releases it. If Write
+// fails the record is not released, so the caller still owns it. A record
+// without rows is allowed: it adds an empty segment and commits any
+// metadata set with it, such as properties or ingest progress.
 func (lb *Lockbox) Write(ctx context.Context, record arrow.Record, opts ...Option) error {
 	options := &Options{
 		Password:     "",
@@ -199,19 +817,104 @@ func (lb *Lockbox) Write(ctx context.Context, record arrow.Record, opts ...Optio
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return fmt.Errorf("password is required for writing")
+	if options.err != nil {
+		return options.err
+	}
+
+	if !options.hasCredentials() {
+		return fmt.Errorf("%w for writing", ErrPasswordRequired)
+	}
+	if err := checkSortColumns(lb.Schema(), options.SortBy); err != nil {
+		return err
+	}
+
+	// Work on a reference of our own, replaced by each copy made below and
+	// released on any error, so the caller's is only released once written
+	input := record
+	record.Retain()
+	defer func() {
+		if record != nil {
+			record.Release()
+		}
+	}()
+
+	// Catch schema drift before any block is encrypted
+	var evolved *arrow.Schema
+	if diff := SchemaDiff(lb.Schema(), record.Schema()); len(diff) > 0 && options.Evolve {
+		schema, err := EvolveSchema(lb.Schema(), record.Schema())
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSchemaMismatch, err)
+		}
+		conformed, err := conformRecord(schema, record)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSchemaMismatch, err)
+		}
+		record.Release()
+		record = conformed
+		if len(schema.Fields()) > len(lb.Schema().Fields()) {
+			evolved = schema
+		}
+	} else if len(diff) > 0 {
+		if !options.Coerce {
+			return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(diff, "; "))
+		}
+		coerced, _, err := coerceRecord(allocatorOrDefault(options.Allocator), lb.Schema(), record, options.TimestampTimezone)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSchemaMismatch, err)
+		}
+		record.Release()
+		record = coerced
+	}
+
+	if len(options.SortBy) > 0 {
+		sorted, err := sortRecord(ctx, allocatorOrDefault(options.Allocator), record, options.SortBy)
+		if err != nil {
+			return err
+		}
+		record.Release()
+		record = sorted
 	}
 
 	// Create writer if it doesn't exist
 	if lb.writer == nil {
-		writer, err := lb.file.NewWriter(options.Password)
+		key, err := unlock(lb.file, options)
+		if err != nil {
+			return fmt.Errorf("failed to unlock: %w", err)
+		}
+		writer, err := lb.file.NewWriterWithKey(key)
 		if err != nil {
 			return fmt.Errorf("failed to create writer: %w", err)
 		}
 		lb.writer = writer
 	}
 
+	if err := lb.writer.SetCompression(options.Compression, options.ColumnCompression, options.CompressionLevel); err != nil {
+		return fmt.Errorf("invalid compression: %w", err)
+	}
+	lb.writer.SetParallelism(options.Parallelism)
+	lb.writer.SetBlockSize(options.BlockSize)
+	lb.writer.SetSortOrder(options.SortBy)
+	if evolved != nil {
+		if err := lb.writer.SetSchema(evolved); err != nil {
+			return fmt.Errorf("failed to upgrade schema: %w", err)
+		}
+	}
+	if options.Metadata != nil {
+		lb.writer.SetProperties(options.Metadata)
+	}
+	tool := options.Tool
+	if tool == "" {
+		tool = filepath.Base(os.Args[0])
+	}
+	lb.writer.SetProvenance(tool, provenanceUser())
+	if options.Ingest != nil {
+		lb.writer.SetIngest(&metadata.IngestManifest{
+			Fingerprint: options.Ingest.Fingerprint,
+			Rows:        options.Ingest.Rows,
+			Complete:    options.Ingest.Complete,
+		})
+	}
+
 	// Sign the record before writing
 	if lb.key != nil && lb.key.KyberSecretKey != nil {
 		encryptor, err := crypto.NewColumnEncryptor(lb.key.Data)
@@ -236,14 +939,23 @@ func (lb *Lockbox) Write(ctx context.Context, record arrow.Record, opts ...Optio
 			Msg("Added quantum-resistant signature to record")
 	}
 
-	// Write the record
-	if err := lb.writer.WriteRecord(record); err != nil {
+	// Nothing has been written yet, so a cancelled write leaves no trace
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Write the record, which the writer releases
+	rows, columns := record.NumRows(), record.NumCols()
+	rec := record
+	record = nil
+	if err := lb.writer.WriteRecord(rec); err != nil {
 		return fmt.Errorf("failed to write record: %w", err)
 	}
+	input.Release()
 
 	log.Debug().
-		Int64("rows", record.NumRows()).
-		Int("columns", len(record.Columns())).
+		Int64("rows", rows).
+		Int64("columns", columns).
 		Bool("pq_signed", lb.key != nil && lb.key.KyberSecretKey != nil).
 		Msg("Wrote record to lockbox")
 
@@ -271,21 +983,30 @@ func (lb *Lockbox) Read(ctx context.Context, opts ...Option) (arrow.Record, erro
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return nil, fmt.Errorf("password is required for reading")
+	if options.err != nil {
+		return nil, options.err
 	}
 
-	// Create reader if it doesn't exist
-	if lb.reader == nil {
-		reader, err := lb.file.NewReader(options.Password)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create reader: %w", err)
-		}
-		lb.reader = reader
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w for reading", ErrPasswordRequired)
+	}
+
+	reader, err := lb.sharedReader(options)
+	if err != nil {
+		return nil, err
 	}
 
-	// Read the record
-	record, err := lb.reader.ReadRecord()
+	if err := lb.checkColumns(options.Columns); err != nil {
+		return nil, err
+	}
+
+	// Read the record, decrypting only the projected columns
+	var record arrow.Record
+	if len(options.Columns) > 0 {
+		record, err = reader.ReadColumns(options.Columns)
+	} else {
+		record, err = reader.ReadRecord()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read record: %w", err)
 	}
@@ -298,28 +1019,9 @@ func (lb *Lockbox) Read(ctx context.Context, opts ...Option) (arrow.Record, erro
 	return record, nil
 }
 
-// ReadAsync performs Read in a separate goroutine
-func (lb *Lockbox) ReadAsync(ctx context.Context, opts ...Option) (<-chan arrow.Record, <-chan error) {
-	rch := make(chan arrow.Record, 1)
-	ech := make(chan error, 1)
-	go func() {
-		rec, err := lb.Read(ctx, opts...)
-		if err != nil {
-			ech <- err
-			close(rch)
-			close(ech)
-			return
-		}
-		rch <- rec
-		close(ech)
-	}()
-	return rch, ech
-}
-
-// Query performs a simple query on the lockbox data
-// This is a basic implementation that reads all data and applies simple filters
-// query-engine
-func (lb *Lockbox) Query(ctx context.Context, query string, opts ...Option) (arrow.Record, error) {
+// ReadSegment reads a single stored row group from the lockbox. Each call to
+// Write produces one segment, numbered from zero in write order.
+func (lb *Lockbox) ReadSegment(ctx context.Context, index int, opts ...Option) (arrow.Record, error) {
 	options := &Options{
 		Password:     "",
 		Columns:      []string{},
@@ -330,568 +1032,299 @@ func (lb *Lockbox) Query(ctx context.Context, query string, opts ...Option) (arr
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return nil, fmt.Errorf("password is required for querying")
-	}
-
-	pq, err := parseQuery(query)
-	if err != nil {
-		return nil, err
+	if options.err != nil {
+		return nil, options.err
 	}
 
-	// Determine required columns
-	required := append([]string{}, pq.SelectCols...)
-	if pq.WhereCol != "" {
-		if !contains(required, pq.WhereCol) {
-			required = append(required, pq.WhereCol)
-		}
-	}
-	if pq.OrderCol != "" {
-		if !contains(required, pq.OrderCol) {
-			required = append(required, pq.OrderCol)
-		}
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w for reading", ErrPasswordRequired)
 	}
 
-	reader, err := lb.file.NewReader(options.Password)
+	reader, err := lb.sharedReader(options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create reader: %w", err)
+		return nil, err
 	}
 
-	rec, err := reader.ReadColumns(required)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read data: %w", err)
+	if err := lb.checkColumns(options.Columns); err != nil {
+		return nil, err
 	}
 
-	result, err := applyQuery(rec, pq)
+	record, err := reader.ReadSegmentColumns(index, options.Columns)
 	if err != nil {
-		rec.Release()
-		return nil, err
+		return nil, fmt.Errorf("failed to read segment: %w", err)
 	}
-	rec.Release()
-
-	log.Debug().Str("query", query).Int64("rows", result.NumRows()).Msg("Executed query on lockbox")
 
-	return result, nil
+	return record, nil
 }
 
-type aggregateSpec struct {
-	Func string
-	Col  string
+// SegmentCount returns the number of row groups stored in the lockbox
+func (lb *Lockbox) SegmentCount() int {
+	return lb.file.SegmentCount()
 }
 
-type parsedQuery struct {
-	SelectCols []string
-	Aggregates []aggregateSpec
-	WhereCol   string
-	WhereOp    string
-	WhereVal   string
-	OrderCol   string
-	OrderDesc  bool
-	Limit      int
+// ReadAsync performs Read in a separate goroutine
+func (lb *Lockbox) ReadAsync(ctx context.Context, opts ...Option) (<-chan arrow.Record, <-chan error) {
+	rch := make(chan arrow.Record, 1)
+	ech := make(chan error, 1)
+	go func() {
+		rec, err := lb.Read(ctx, opts...)
+		if err != nil {
+			ech <- err
+			close(rch)
+			close(ech)
+			return
+		}
+		rch <- rec
+		close(ech)
+	}()
+	return rch, ech
 }
 
-func parseQuery(q string) (*parsedQuery, error) {
-	pq := &parsedQuery{Limit: -1}
-
-	upper := strings.ToUpper(q)
-	parts := strings.Fields(upper)
-	if len(parts) < 4 || parts[0] != "SELECT" {
-		return nil, fmt.Errorf("invalid query")
-	}
-
-	fromIdx := -1
-	for i, p := range parts {
-		if p == "FROM" {
-			fromIdx = i
-			break
-		}
-	}
-	if fromIdx == -1 || fromIdx == 1 {
-		return nil, fmt.Errorf("invalid query")
-	}
-
-	selectRaw := strings.Join(parts[1:fromIdx], " ")
-	cols := strings.Split(selectRaw, ",")
-	for _, raw := range cols {
-		c := strings.TrimSpace(raw)
-		u := strings.ToUpper(c)
-		switch {
-		case strings.HasPrefix(u, "COUNT(") && strings.HasSuffix(c, ")"):
-			col := strings.TrimSuffix(c[len("COUNT("):], ")")
-			pq.Aggregates = append(pq.Aggregates, aggregateSpec{Func: "COUNT", Col: strings.ToLower(col)})
-		case strings.HasPrefix(u, "SUM(") && strings.HasSuffix(c, ")"):
-			col := strings.TrimSuffix(c[len("SUM("):], ")")
-			pq.Aggregates = append(pq.Aggregates, aggregateSpec{Func: "SUM", Col: strings.ToLower(col)})
-		case strings.HasPrefix(u, "AVG(") && strings.HasSuffix(c, ")"):
-			col := strings.TrimSuffix(c[len("AVG("):], ")")
-			pq.Aggregates = append(pq.Aggregates, aggregateSpec{Func: "AVG", Col: strings.ToLower(col)})
-		case strings.HasPrefix(u, "MIN(") && strings.HasSuffix(c, ")"):
-			col := strings.TrimSuffix(c[len("MIN("):], ")")
-			pq.Aggregates = append(pq.Aggregates, aggregateSpec{Func: "MIN", Col: strings.ToLower(col)})
-		case strings.HasPrefix(u, "MAX(") && strings.HasSuffix(c, ")"):
-			col := strings.TrimSuffix(c[len("MAX("):], ")")
-			pq.Aggregates = append(pq.Aggregates, aggregateSpec{Func: "MAX", Col: strings.ToLower(col)})
-		default:
-			if c != "" && c != "*" {
-				pq.SelectCols = append(pq.SelectCols, strings.ToLower(c))
-			}
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
 		}
 	}
+	return false
+}
 
-	i := fromIdx + 2 // skip FROM data
-	for i < len(parts) {
-		switch parts[i] {
-		case "WHERE":
-			if i+3 >= len(parts) {
-				return nil, fmt.Errorf("invalid WHERE clause")
-			}
-			pq.WhereCol = strings.ToLower(parts[i+1])
-			pq.WhereOp = parts[i+2]
-			pq.WhereVal = parts[i+3]
-			i += 4
-		case "ORDER":
-			if i+3 >= len(parts) || parts[i+1] != "BY" {
-				return nil, fmt.Errorf("invalid ORDER BY clause")
-			}
-			pq.OrderCol = strings.ToLower(parts[i+2])
-			if i+3 < len(parts) && (parts[i+3] == "DESC" || parts[i+3] == "ASC") {
-				pq.OrderDesc = parts[i+3] == "DESC"
-				i += 4
-			} else {
-				i += 3
-			}
-		case "LIMIT":
-			if i+1 >= len(parts) {
-				return nil, fmt.Errorf("invalid LIMIT clause")
-			}
-			val, err := strconv.Atoi(parts[i+1])
-			if err != nil {
-				return nil, fmt.Errorf("invalid LIMIT value")
-			}
-			pq.Limit = val
-			i += 2
-		default:
-			i++
-		}
+// Info returns information about the lockbox file
+func (lb *Lockbox) Info() (*Info, error) {
+	return newInfo(lb.file), nil
+}
+
+// ReadInfo returns information about a lockbox file without a password.
+// Only the plaintext header and metadata are read; no blocks are decrypted.
+func ReadInfo(filename string) (*Info, error) {
+	file, err := format.OpenMetadata(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockbox file: %w", err)
 	}
+	defer file.Close()
 
-	return pq, nil
+	return newInfo(file), nil
 }
 
-func applyQuery(rec arrow.Record, pq *parsedQuery) (arrow.Record, error) {
-	mem := memory.NewGoAllocator()
-
-	rowCount := int(rec.NumRows())
-	idx := make([]int, rowCount)
-	for i := range idx {
-		idx[i] = i
-	}
+func newInfo(file *format.LockboxFile) *Info {
+	meta := file.Metadata()
 
-	// WHERE filtering
-	if pq.WhereCol != "" {
-		col := rec.Column(rec.Schema().FieldIndices(pq.WhereCol)[0])
-		var keep []int
-		for _, i := range idx {
-			if matchValue(col, i, pq.WhereOp, pq.WhereVal) {
-				keep = append(keep, i)
-			}
+	// Report every codec in use, e.g. "none" or "lz4,zstd (level 19)"
+	seen := map[string]bool{}
+	var used []string
+	for _, bi := range meta.BlockInfo {
+		codec := bi.Codec
+		if !bi.Compressed {
+			codec = format.CodecNone
+		}
+		if bi.Level != 0 {
+			codec = fmt.Sprintf("%s (level %d)", codec, bi.Level)
+		}
+		if !seen[codec] {
+			seen[codec] = true
+			used = append(used, codec)
 		}
-		idx = keep
 	}
+	sort.Strings(used)
+	compression := format.CodecNone
+	if len(used) > 0 {
+		compression = strings.Join(used, ",")
+	}
+
+	info := &Info{
+		Version:       meta.Header.Version,
+		Schema:        meta.Schema,
+		SchemaVersion: meta.CurrentSchemaVersion(),
+		CreatedAt:     meta.AuditTrail.CreatedAt,
+		CreatedBy:     meta.AuditTrail.CreatedBy,
+		ModifiedAt:    meta.AuditTrail.ModifiedAt,
+		ModifiedBy:    meta.AuditTrail.ModifiedBy,
+		RowCount:      file.RowCount(),
+		SegmentCount:  file.SegmentCount(),
+		BlockCount:    len(meta.BlockInfo),
+		AccessCount:   len(meta.AuditTrail.AccessLog),
+		Algorithm:     meta.Encryption.Algorithm,
+		KeyDerivation: meta.Encryption.KeyDerivation,
+		KDFIterations: meta.Encryption.Iterations,
+		Recipients:    len(meta.Encryption.Recipients),
+		PasswordSlot:  !meta.Encryption.PasswordDisabled,
+		Compression:   compression,
+		SortOrder:     meta.SortOrder,
+		BlockSize:     meta.BlockSize,
+		Metadata:      meta.Properties,
+	}
+	if slot := meta.Encryption.PasswordSlot; slot != nil && slot.KDF != nil {
+		info.KDFMemory = slot.KDF.Memory
+		info.KDFLanes = slot.KDF.Parallelism
+	}
+	return info
+}
 
-	// ORDER BY
-	if pq.OrderCol != "" {
-		col := rec.Column(rec.Schema().FieldIndices(pq.OrderCol)[0])
-		sort.Slice(idx, func(a, b int) bool {
-			va := getValue(col, idx[a])
-			vb := getValue(col, idx[b])
-			if pq.OrderDesc {
-				return less(vb, va)
-			}
-			return less(va, vb)
-		})
-	}
+// Validate verifies the integrity of the lockbox data blocks
+func (lb *Lockbox) Validate() error {
+	return lb.file.ValidateBlocks()
+}
 
-	// Aggregations (before LIMIT)
-	if len(pq.Aggregates) > 0 {
-		arrays := make([]arrow.Array, len(pq.Aggregates))
-		fields := make([]arrow.Field, len(pq.Aggregates))
+// Repair attempts to remove corrupted blocks and update metadata
+func (lb *Lockbox) Repair() error {
+	return lb.file.Repair()
+}
 
-		for i, ag := range pq.Aggregates {
-			val, dt, err := computeAggregate(rec, idx, ag)
-			if err != nil {
-				return nil, err
-			}
-			fields[i] = arrow.Field{Name: fmt.Sprintf("%s_%s", strings.ToLower(ag.Func), ag.Col), Type: dt}
-			switch dt.ID() {
-			case arrow.INT64:
-				b := array.NewInt64Builder(mem)
-				b.Append(val.(int64))
-				arrays[i] = b.NewArray()
-				b.Release()
-			case arrow.FLOAT64:
-				b := array.NewFloat64Builder(mem)
-				b.Append(val.(float64))
-				arrays[i] = b.NewArray()
-				b.Release()
-			case arrow.STRING:
-				b := array.NewStringBuilder(mem)
-				b.Append(val.(string))
-				arrays[i] = b.NewArray()
-				b.Release()
-			default:
-				b := array.NewStringBuilder(mem)
-				b.Append(fmt.Sprintf("%v", val))
-				arrays[i] = b.NewArray()
-				b.Release()
-			}
-		}
+// VerifyReport summarizes a successful integrity check
+type VerifyReport struct {
+	Blocks int   `json:"blocks"`
+	Rows   int64 `json:"rows"`
+}
 
-		schema := arrow.NewSchema(fields, nil)
-		return array.NewRecord(schema, arrays, 1), nil
+// Verify authenticates and decrypts every block in the lockbox. Failures
+// wrap a *format.BlockError naming the first bad block.
+func (lb *Lockbox) Verify(ctx context.Context, opts ...Option) (*VerifyReport, error) {
+	options := &Options{
+		Password:     "",
+		Columns:      []string{},
+		CryptoModule: "",
 	}
 
-	// LIMIT
-	if pq.Limit >= 0 && pq.Limit < len(idx) {
-		idx = idx[:pq.Limit]
+	for _, opt := range opts {
+		opt(options)
 	}
 
-	// Build result
-	if len(pq.SelectCols) == 0 {
-		for _, f := range rec.Schema().Fields() {
-			pq.SelectCols = append(pq.SelectCols, f.Name)
-		}
+	if options.err != nil {
+		return nil, options.err
 	}
 
-	builders := make([]array.Builder, len(pq.SelectCols))
-	fields := make([]arrow.Field, len(pq.SelectCols))
-
-	for i, name := range pq.SelectCols {
-		fIdx := rec.Schema().FieldIndices(name)[0]
-		field := rec.Schema().Field(fIdx)
-		fields[i] = field
-		switch field.Type.ID() {
-		case arrow.INT64:
-			builders[i] = array.NewInt64Builder(mem)
-		case arrow.FLOAT64:
-			builders[i] = array.NewFloat64Builder(mem)
-		case arrow.STRING:
-			builders[i] = array.NewStringBuilder(mem)
-		case arrow.TIMESTAMP:
-			builders[i] = array.NewTimestampBuilder(mem, field.Type.(*arrow.TimestampType))
-		default:
-			// fallback to string, or handle more types as needed
-			builders[i] = array.NewStringBuilder(mem)
-		}
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w for verification", ErrPasswordRequired)
 	}
 
-	for _, row := range idx {
-		for i, name := range pq.SelectCols {
-			fIdx := rec.Schema().FieldIndices(name)[0]
-			col := rec.Column(fIdx)
-			appendValue(builders[i], col, row)
-		}
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return nil, err
 	}
 
-	arrays := make([]arrow.Array, len(builders))
-	for i, b := range builders {
-		arrays[i] = b.NewArray()
-		b.Release()
+	report, err := reader.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("verification failed: %w", err)
 	}
 
-	schema := arrow.NewSchema(fields, nil)
-	return array.NewRecord(schema, arrays, int64(len(idx))), nil
+	return &VerifyReport{Blocks: report.Blocks, Rows: report.Rows}, nil
 }
 
-func matchValue(col arrow.Array, row int, op, val string) bool {
-	cv := getValue(col, row)
-	fVal, ferr := strconv.ParseFloat(val, 64)
-	switch v := cv.(type) {
-	case int64:
-		if ferr != nil {
-			return false
-		}
-		switch op {
-		case ">":
-			return float64(v) > fVal
-		case "<":
-			return float64(v) < fVal
-		case "=":
-			return float64(v) == fVal
-		case ">=":
-			return float64(v) >= fVal
-		case "<=":
-			return float64(v) <= fVal
-		}
-	case float64:
-		if ferr != nil {
-			return false
-		}
-		switch op {
-		case ">":
-			return v > fVal
-		case "<":
-			return v < fVal
-		case "=":
-			return v == fVal
-		case ">=":
-			return v >= fVal
-		case "<=":
-			return v <= fVal
-		}
-	case string:
-		switch op {
-		case "=":
-			return v == strings.Trim(val, "'\"")
-		}
+// Metadata returns the key-value pairs stored with WithMetadata after
+// checking they were not modified without the key
+func (lb *Lockbox) Metadata(opts ...Option) (map[string]string, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
 	}
-	return false
-}
-
-func getValue(col arrow.Array, row int) interface{} {
-	if col.IsNull(row) {
-		return "NULL"
-	}
-	switch c := col.(type) {
-	case *array.Int64:
-		val := c.Value(row)
-		return val
-	case *array.Float64:
-		val := c.Value(row)
-		return val
-	case *array.String:
-		val := c.Value(row)
-		return val
-	case *array.Timestamp:
-		ts := c.Value(row)
-		switch typ := c.DataType().(*arrow.TimestampType); typ.Unit {
-		case arrow.Second:
-			return time.Unix(int64(ts), 0).UTC().Format(time.RFC3339)
-		case arrow.Millisecond:
-			return time.UnixMilli(int64(ts)).UTC().Format(time.RFC3339)
-		case arrow.Microsecond:
-			return time.UnixMicro(int64(ts)).UTC().Format(time.RFC3339)
-		case arrow.Nanosecond:
-			return time.Unix(0, int64(ts)).UTC().Format(time.RFC3339)
-		default:
-			return ts
-		}
-	default:
-		return "NULL"
+	if options.err != nil {
+		return nil, options.err
 	}
-}
-
-func appendValue(b array.Builder, col arrow.Array, row int) {
-	switch c := col.(type) {
-	case *array.Int64:
-		b.(*array.Int64Builder).Append(c.Value(row))
-	case *array.Float64:
-		b.(*array.Float64Builder).Append(c.Value(row))
-	case *array.String:
-		b.(*array.StringBuilder).Append(c.Value(row))
-	case *array.Timestamp:
-		b.(*array.TimestampBuilder).Append(c.Value(row))
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w to verify metadata", ErrPasswordRequired)
 	}
-}
 
-func computeAggregate(rec arrow.Record, idx []int, ag aggregateSpec) (interface{}, arrow.DataType, error) {
-	switch ag.Func {
-	case "COUNT":
-		return int64(len(idx)), arrow.PrimitiveTypes.Int64, nil
-	case "SUM", "AVG", "MIN", "MAX":
-		if ag.Col == "" || ag.Col == "*" {
-			return nil, nil, fmt.Errorf("aggregate %s requires column", ag.Func)
-		}
-		fIdx := rec.Schema().FieldIndices(ag.Col)
-		if len(fIdx) == 0 {
-			return nil, nil, fmt.Errorf("column %s not found", ag.Col)
-		}
-		col := rec.Column(fIdx[0])
-		switch c := col.(type) {
-		case *array.Int64:
-			if len(idx) == 0 {
-				switch ag.Func {
-				case "SUM", "AVG":
-					return float64(0), arrow.PrimitiveTypes.Float64, nil
-				default:
-					return int64(0), arrow.PrimitiveTypes.Int64, nil
-				}
-			}
-			var sum int64
-			min := c.Value(idx[0])
-			max := c.Value(idx[0])
-			for _, i := range idx {
-				if c.IsNull(i) {
-					continue
-				}
-				v := c.Value(i)
-				sum += v
-				if v < min {
-					min = v
-				}
-				if v > max {
-					max = v
-				}
-			}
-			switch ag.Func {
-			case "SUM":
-				return float64(sum), arrow.PrimitiveTypes.Float64, nil
-			case "AVG":
-				return float64(sum) / float64(len(idx)), arrow.PrimitiveTypes.Float64, nil
-			case "MIN":
-				return min, arrow.PrimitiveTypes.Int64, nil
-			case "MAX":
-				return max, arrow.PrimitiveTypes.Int64, nil
-			}
-		case *array.Float64:
-			if len(idx) == 0 {
-				return float64(0), arrow.PrimitiveTypes.Float64, nil
-			}
-			var sum, min, max float64
-			min = c.Value(idx[0])
-			max = c.Value(idx[0])
-			for _, i := range idx {
-				if c.IsNull(i) {
-					continue
-				}
-				v := c.Value(i)
-				sum += v
-				if v < min {
-					min = v
-				}
-				if v > max {
-					max = v
-				}
-			}
-			switch ag.Func {
-			case "SUM":
-				return sum, arrow.PrimitiveTypes.Float64, nil
-			case "AVG":
-				return sum / float64(len(idx)), arrow.PrimitiveTypes.Float64, nil
-			case "MIN":
-				return min, arrow.PrimitiveTypes.Float64, nil
-			case "MAX":
-				return max, arrow.PrimitiveTypes.Float64, nil
-			}
-		case *array.String:
-			if ag.Func != "MIN" && ag.Func != "MAX" {
-				return nil, nil, fmt.Errorf("unsupported aggregate on string")
-			}
-			if len(idx) == 0 {
-				return "", arrow.BinaryTypes.String, nil
-			}
-			min := c.Value(idx[0])
-			max := c.Value(idx[0])
-			for _, i := range idx {
-				if c.IsNull(i) {
-					continue
-				}
-				v := c.Value(i)
-				if v < min {
-					min = v
-				}
-				if v > max {
-					max = v
-				}
-			}
-			if ag.Func == "MIN" {
-				return min, arrow.BinaryTypes.String, nil
-			}
-			return max, arrow.BinaryTypes.String, nil
-		}
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil, fmt.Errorf("unsupported aggregate")
+	return reader.Properties()
 }
 
-func less(a, b interface{}) bool {
-	switch av := a.(type) {
-	case int64:
-		return av < b.(int64)
-	case float64:
-		return av < b.(float64)
-	case string:
-		return av < b.(string)
-	default:
-		return false
+// History returns the provenance log, one entry per write oldest first,
+// after checking it was not modified without the key
+func (lb *Lockbox) History(opts ...Option) ([]ProvenanceEntry, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
 	}
-}
-
-func contains(list []string, v string) bool {
-	for _, s := range list {
-		if s == v {
-			return true
-		}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w to verify the history", ErrPasswordRequired)
 	}
-	return false
-}
-
-// Info returns information about the lockbox file
-func (lb *Lockbox) Info() (*Info, error) {
-	meta := lb.file.Metadata()
-
-	return &Info{
-		Version:     meta.Header.Version,
-		Schema:      meta.Schema,
-		CreatedAt:   meta.AuditTrail.CreatedAt,
-		CreatedBy:   meta.AuditTrail.CreatedBy,
-		ModifiedAt:  meta.AuditTrail.ModifiedAt,
-		ModifiedBy:  meta.AuditTrail.ModifiedBy,
-		BlockCount:  len(meta.BlockInfo),
-		AccessCount: len(meta.AuditTrail.AccessLog),
-	}, nil
-}
 
-// Validate verifies the integrity of the lockbox data blocks
-func (lb *Lockbox) Validate() error {
-	return lb.file.ValidateBlocks()
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return nil, err
+	}
+	return reader.Provenance()
 }
 
-// Repair attempts to remove corrupted blocks and update metadata
-func (lb *Lockbox) Repair() error {
-	return lb.file.Repair()
+// VerifyQuick checks the header, metadata and schema and that blocks are
+// laid out within the file, without decrypting anything.
+func (lb *Lockbox) VerifyQuick() error {
+	if err := lb.file.VerifyLayout(); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	return nil
 }
 
 // GetBlob returns the blob data for the given field and row index.
 func (lb *Lockbox) GetBlob(field string, row int, opts ...Option) ([]byte, error) {
-	ctx := context.Background()
-	rec, err := lb.Read(ctx, opts...)
-	if err != nil {
-		return nil, err
-	}
-	defer rec.Release()
-
-	idx := rec.Schema().FieldIndices(field)
+	idx := lb.Schema().FieldIndices(field)
 	if len(idx) == 0 {
 		return nil, fmt.Errorf("field %s not found", field)
 	}
 
-	col := rec.Column(idx[0])
-	switch arr := col.(type) {
-	case *array.Binary:
-		if row >= arr.Len() {
-			return nil, fmt.Errorf("row out of bounds")
+	rr, err := lb.NewReader(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+
+	// Stream segments until the one holding the requested row
+	for rr.Next() {
+		rec := rr.Record()
+		if row >= int(rec.NumRows()) {
+			row -= int(rec.NumRows())
+			continue
 		}
-		return arr.Value(row), nil
-	case *array.LargeBinary:
-		if row >= arr.Len() {
-			return nil, fmt.Errorf("row out of bounds")
+
+		switch arr := rec.Column(idx[0]).(type) {
+		case *array.Binary:
+			return append([]byte(nil), arr.Value(row)...), nil
+		case *array.LargeBinary:
+			return append([]byte(nil), arr.Value(row)...), nil
+		default:
+			return nil, fmt.Errorf("field %s is not binary", field)
 		}
-		return arr.Value(row), nil
-	default:
-		return nil, fmt.Errorf("field %s is not binary", field)
 	}
+	if err := rr.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+	return nil, fmt.Errorf("row out of bounds")
 }
 
 // Info represents information about a lockbox file
 type Info struct {
-	Version     uint32        `json:"version"`
-	Schema      *arrow.Schema `json:"-"`
-	CreatedAt   interface{}   `json:"createdAt"`
-	CreatedBy   string        `json:"createdBy"`
-	ModifiedAt  interface{}   `json:"modifiedAt"`
-	ModifiedBy  string        `json:"modifiedBy"`
-	BlockCount  int           `json:"blockCount"`
-	AccessCount int           `json:"accessCount"`
+	Version       uint32        `json:"version"`
+	Schema        *arrow.Schema `json:"-"`
+	SchemaVersion int           `json:"schemaVersion"`
+	CreatedAt     interface{}   `json:"createdAt"`
+	CreatedBy     string        `json:"createdBy"`
+	ModifiedAt    interface{}   `json:"modifiedAt"`
+	ModifiedBy    string        `json:"modifiedBy"`
+	RowCount      int64         `json:"rowCount"`
+	SegmentCount  int           `json:"segmentCount"`
+	BlockCount    int           `json:"blockCount"`
+	AccessCount   int           `json:"accessCount"`
+	Algorithm     string        `json:"algorithm"`
+	KeyDerivation string        `json:"keyDerivation"`
+	KDFIterations int           `json:"kdfIterations"`
+	KDFMemory     uint32        `json:"kdfMemoryKiB,omitempty"`
+	KDFLanes      uint32        `json:"kdfParallelism,omitempty"`
+	Recipients    int           `json:"recipients"`
+	PasswordSlot  bool          `json:"passwordSlot"`
+	Compression   string        `json:"compression"`
+	// SortOrder lists the columns every segment is sorted by
+	SortOrder []string `json:"sortOrder,omitempty"`
+	// BlockSize is the rows per segment writes default to, zero for one
+	// segment per write
+	BlockSize int `json:"blockSize,omitempty"`
+	// Metadata holds the file properties as stored, without verification
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // IngestParquet ingests a Parquet file into the lockbox
@@ -901,8 +1334,12 @@ func (lb *Lockbox) IngestParquet(ctx context.Context, path string, opts ...Optio
 		opt(options)
 	}
 
-	if options.Password == "" {
-		return fmt.Errorf("password is required for ingestion")
+	if options.err != nil {
+		return options.err
+	}
+
+	if !options.hasCredentials() {
+		return fmt.Errorf("%w for ingestion", ErrPasswordRequired)
 	}
 
 	f, err := os.Open(path)
@@ -938,25 +1375,30 @@ func (lb *Lockbox) IngestParquet(ctx context.Context, path string, opts ...Optio
 	}
 	defer recReader.Release()
 
+	// The reader owns each batch and releases it on Next; Write releases
+	// the coerced copy
 	var totalRows int64
 	for recReader.Next() {
-		rec := recReader.Record()
-		coerced, err := CoerceRecord(lb.Schema(), rec)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		coerced, err := CoerceRecord(lb.Schema(), recReader.Record(), opts...)
 		if err != nil {
-			rec.Release()
 			return err
 		}
 
-		if !options.DryRun {
-			if err := lb.Write(ctx, coerced, WithPassword(options.Password)); err != nil {
-				coerced.Release()
-				rec.Release()
-				return err
-			}
+		rows := coerced.NumRows()
+		if options.DryRun {
+			coerced.Release()
+		} else if err := lb.Write(ctx, coerced, opts...); err != nil {
+			coerced.Release()
+			return err
 		}
-		totalRows += coerced.NumRows()
-		coerced.Release()
-		rec.Release()
+		totalRows += rows
+	}
+	// The pqarrow reader reports io.EOF once every row group is read
+	if err := recReader.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read parquet data: %w", err)
 	}
 
 	log.Info().Str("file", path).Int64("rows", totalRows).Bool("dry_run", options.DryRun).Msg("Ingested parquet")
@@ -1002,41 +1444,28 @@ func typesCompatible(dst, src arrow.DataType) bool {
 	return false
 }
 
-// CoerceRecord converts parquet record columns to lockbox schema order and types
-func CoerceRecord(schema *arrow.Schema, rec arrow.Record) (arrow.Record, error) {
-	if rec.Schema().Equal(schema) {
-		rec.Retain()
-		return rec, nil
-	}
-
-	mem := memory.NewGoAllocator()
-	var cols []arrow.Array
-	for i, field := range schema.Fields() {
-		src := rec.Column(i)
-		if !arrow.TypeEqual(field.Type, src.DataType()) {
-			if field.Type.ID() == arrow.INT64 && src.DataType().ID() == arrow.INT32 {
-				b := array.NewInt64Builder(mem)
-				int32Arr := src.(*array.Int32)
-				for j := 0; j < int(int32Arr.Len()); j++ {
-					if int32Arr.IsNull(j) {
-						b.AppendNull()
-					} else {
-						b.Append(int64(int32Arr.Value(j)))
-					}
-				}
-				cols = append(cols, b.NewArray())
-				b.Release()
-			} else {
-				return nil, fmt.Errorf("cannot coerce column %s", field.Name)
-			}
-		} else {
-			src.Retain()
-			cols = append(cols, src)
+// SchemaDiff describes how actual deviates from expected, comparing field
+// names, types and nullability by position. It returns nil when they match.
+func SchemaDiff(expected, actual *arrow.Schema) []string {
+	var diffs []string
+	for i, field := range expected.Fields() {
+		if i >= len(actual.Fields()) {
+			diffs = append(diffs, fmt.Sprintf("missing field %s", field.Name))
+			continue
+		}
+		got := actual.Field(i)
+		if field.Name != got.Name {
+			diffs = append(diffs, fmt.Sprintf("field %d: expected name %s, got %s", i, field.Name, got.Name))
+		}
+		if !arrow.TypeEqual(field.Type, got.Type) {
+			diffs = append(diffs, fmt.Sprintf("field %s: expected type %s, got %s", field.Name, field.Type, got.Type))
+		}
+		if field.Nullable != got.Nullable {
+			diffs = append(diffs, fmt.Sprintf("field %s: expected nullable=%t, got nullable=%t", field.Name, field.Nullable, got.Nullable))
 		}
 	}
-	out := array.NewRecord(schema, cols, rec.NumRows())
-	for _, c := range cols {
-		c.Release()
+	for _, extra := range actual.Fields()[min(len(expected.Fields()), len(actual.Fields())):] {
+		diffs = append(diffs, fmt.Sprintf("unexpected field %s", extra.Name))
 	}
-	return out, nil
+	return diffs
 }
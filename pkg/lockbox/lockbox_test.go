@@ -1,12 +1,26 @@
 package lockbox
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/TFMV/lockbox/pkg/crypto"
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/TFMV/lockbox/pkg/store"
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
 	"github.com/apache/arrow-go/v18/arrow/memory"
 )
 
@@ -114,7 +128,6 @@ func TestOpenAndRead(t *testing.T) {
 	}
 
 	// Clean up write resources
-	record.Release()
 	idArray.Release()
 	nameArray.Release()
 	idBuilder.Release()
@@ -183,6 +196,43 @@ func TestInfo(t *testing.T) {
 	t.Logf("Info test passed: created by %s, %d fields", info.CreatedBy, len(info.Schema.Fields()))
 }
 
+func TestReadInfoWithoutPassword(t *testing.T) {
+	tmpFile := "/tmp/test_lockbox_readinfo.lbx"
+	defer os.Remove(tmpFile)
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	b := array.NewInt64Builder(memory.NewGoAllocator())
+	b.AppendValues([]int64{1, 2, 3, 4}, nil)
+	arr := b.NewArray()
+	b.Release()
+	record := array.NewRecord(schema, []arrow.Array{arr}, 4)
+	arr.Release()
+	if err := lb.Write(context.Background(), record, WithPassword(password)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	lb.Close()
+
+	info, err := ReadInfo(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read info: %v", err)
+	}
+	if info.RowCount != 4 || info.SegmentCount != 1 || info.BlockCount != 1 {
+		t.Fatalf("unexpected counts: %+v", info)
+	}
+	if info.KeyDerivation != "PBKDF2" || info.Algorithm != "AES-256-GCM" {
+		t.Fatalf("unexpected crypto params: %s / %s", info.Algorithm, info.KeyDerivation)
+	}
+}
+
 func TestQuery(t *testing.T) {
 	schema := arrow.NewSchema([]arrow.Field{
 		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
@@ -218,7 +268,6 @@ func TestQuery(t *testing.T) {
 	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
 		t.Fatalf("write error: %v", err)
 	}
-	record.Release()
 	idArr.Release()
 	nameArr.Release()
 	scoreArr.Release()
@@ -284,7 +333,6 @@ func TestQueryAggregate(t *testing.T) {
 	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
 		t.Fatalf("write error: %v", err)
 	}
-	record.Release()
 	idArr.Release()
 	nameArr.Release()
 	scoreArr.Release()
@@ -319,3 +367,3528 @@ func TestQueryAggregate(t *testing.T) {
 		t.Fatalf("unexpected avg %f", avg)
 	}
 }
+
+func TestAppendRowGroups(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_append.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithCreatedBy("tester"))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	lb.Close()
+
+	mem := memory.NewGoAllocator()
+	ctx := context.Background()
+	batches := [][]int64{{1, 2}, {3, 4, 5}}
+	for _, ids := range batches {
+		lb, err := Open(tmpFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+
+		idb := array.NewInt64Builder(mem)
+		nameb := array.NewStringBuilder(mem)
+		for _, id := range ids {
+			idb.Append(id)
+			nameb.Append("user")
+		}
+		idArr := idb.NewArray()
+		nameArr := nameb.NewArray()
+		record := array.NewRecord(schema, []arrow.Array{idArr, nameArr}, int64(len(ids)))
+		idArr.Release()
+		nameArr.Release()
+		idb.Release()
+		nameb.Release()
+
+		if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+		lb.Close()
+	}
+
+	lb2, err := Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer lb2.Close()
+
+	rec, err := lb2.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	defer rec.Release()
+
+	if rec.NumRows() != 5 {
+		t.Fatalf("expected 5 rows, got %d", rec.NumRows())
+	}
+	ids := rec.Column(0).(*array.Int64)
+	for i := 0; i < ids.Len(); i++ {
+		if ids.Value(i) != int64(i+1) {
+			t.Fatalf("row %d: expected id %d, got %d", i, i+1, ids.Value(i))
+		}
+	}
+}
+
+func TestSchemaDiff(t *testing.T) {
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	if diff := SchemaDiff(expected, expected); len(diff) != 0 {
+		t.Fatalf("expected no differences, got %v", diff)
+	}
+
+	actual := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "extra", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	diff := SchemaDiff(expected, actual)
+	if len(diff) != 2 {
+		t.Fatalf("expected 2 differences, got %v", diff)
+	}
+}
+
+func TestRecordReader(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_reader.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithCreatedBy("tester"))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	mem := memory.NewGoAllocator()
+	ctx := context.Background()
+	for _, ids := range [][]int64{{1, 2}, {3}, {4, 5, 6}} {
+		b := array.NewInt64Builder(mem)
+		b.AppendValues(ids, nil)
+		arr := b.NewArray()
+		record := array.NewRecord(schema, []arrow.Array{arr}, int64(len(ids)))
+		arr.Release()
+		b.Release()
+		if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+
+	rr, err := lb.NewReader(WithPassword(password))
+	if err != nil {
+		t.Fatalf("reader error: %v", err)
+	}
+	defer rr.Release()
+
+	var batches int
+	var next int64 = 1
+	for rr.Next() {
+		batches++
+		ids := rr.Record().Column(0).(*array.Int64)
+		for i := 0; i < ids.Len(); i++ {
+			if ids.Value(i) != next {
+				t.Fatalf("expected id %d, got %d", next, ids.Value(i))
+			}
+			next++
+		}
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("iteration error: %v", err)
+	}
+	if batches != 3 {
+		t.Fatalf("expected 3 batches, got %d", batches)
+	}
+	if next != 7 {
+		t.Fatalf("expected 6 rows, got %d", next-1)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_verify.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithCreatedBy("tester"))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	nameb := array.NewStringBuilder(mem)
+	idb.AppendValues([]int64{1, 2, 3}, nil)
+	nameb.AppendValues([]string{"a", "b", "c"}, nil)
+	idArr := idb.NewArray()
+	nameArr := nameb.NewArray()
+	record := array.NewRecord(schema, []arrow.Array{idArr, nameArr}, 3)
+	idArr.Release()
+	nameArr.Release()
+	idb.Release()
+	nameb.Release()
+
+	ctx := context.Background()
+	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	report, err := lb.Verify(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("verify error: %v", err)
+	}
+	if report.Blocks != 2 || report.Rows != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// Flip a byte inside the second block
+	bad := lb.file.Metadata().BlockInfo[1]
+	lb.Close()
+
+	f, err := os.OpenFile(tmpFile, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("open raw: %v", err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, bad.Offset+bad.Length-1); err != nil {
+		t.Fatalf("read raw: %v", err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, bad.Offset+bad.Length-1); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+	f.Close()
+
+	lb2, err := Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer lb2.Close()
+
+	if err := lb2.VerifyQuick(); err != nil {
+		t.Fatalf("quick verify should not read blocks: %v", err)
+	}
+
+	_, err = lb2.Verify(ctx, WithPassword(password))
+	var blockErr *format.BlockError
+	if !errors.As(err, &blockErr) {
+		t.Fatalf("expected BlockError, got %v", err)
+	}
+	if blockErr.Offset != bad.Offset {
+		t.Fatalf("expected bad block at %d, got %d", bad.Offset, blockErr.Offset)
+	}
+}
+
+func TestColumnCompression(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_compression.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	nameb := array.NewStringBuilder(mem)
+	for i := 0; i < 1000; i++ {
+		idb.Append(int64(i))
+		nameb.Append("repeated value")
+	}
+	idArr := idb.NewArray()
+	nameArr := nameb.NewArray()
+	idb.Release()
+	nameb.Release()
+	record := array.NewRecord(schema, []arrow.Array{idArr, nameArr}, 1000)
+	idArr.Release()
+	nameArr.Release()
+
+	ctx := context.Background()
+
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password), WithCompression("gzip9")); err == nil {
+		t.Fatalf("expected error for unknown codec")
+	}
+	if n := len(lb.file.Metadata().BlockInfo); n != 0 {
+		t.Fatalf("invalid codec should not write blocks, got %d", n)
+	}
+
+	codecs := []string{"none", "zstd", "lz4", "snappy"}
+	for _, codec := range codecs {
+		record.Retain()
+		err = lb.Write(ctx, record, WithPassword(password),
+			WithCompression(codec),
+			WithColumnCompression(map[string]string{"name": "zstd"}))
+		if err != nil {
+			t.Fatalf("write %s error: %v", codec, err)
+		}
+	}
+
+	for seg, codec := range codecs {
+		for _, bi := range lb.file.Metadata().BlockInfo[seg*2 : seg*2+2] {
+			want := codec
+			if bi.ColumnName == "name" {
+				want = "zstd"
+			}
+			if want == "none" {
+				want = ""
+			}
+			if bi.Codec != want {
+				t.Fatalf("segment %d column %s: expected codec %q, got %q", seg, bi.ColumnName, want, bi.Codec)
+			}
+		}
+
+		out, err := lb.ReadSegment(ctx, seg, WithPassword(password))
+		if err != nil {
+			t.Fatalf("read %s error: %v", codec, err)
+		}
+		if !array.RecordEqual(record, out) {
+			t.Fatalf("round trip mismatch for %s", codec)
+		}
+		out.Release()
+	}
+	record.Release()
+}
+
+func TestZstdCompressionLevel(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_zstd_level.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	b := array.NewInt64Builder(memory.NewGoAllocator())
+	for i := 0; i < 1000; i++ {
+		b.Append(int64(i % 10))
+	}
+	arr := b.NewArray()
+	b.Release()
+	record := array.NewRecord(schema, []arrow.Array{arr}, 1000)
+	arr.Release()
+
+	ctx := context.Background()
+	if err := lb.Write(ctx, record, WithPassword(password), WithCompression("zstd"), WithCompressionLevel(20)); err == nil {
+		t.Fatalf("expected error for level 20")
+	}
+
+	if err := lb.Write(ctx, record, WithPassword(password), WithCompression("zstd"), WithCompressionLevel(19)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	info, err := lb.Info()
+	if err != nil {
+		t.Fatalf("info error: %v", err)
+	}
+	if info.Compression != "zstd (level 19)" {
+		t.Fatalf("unexpected compression %q", info.Compression)
+	}
+
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	defer out.Release()
+	if out.NumRows() != 1000 {
+		t.Fatalf("expected 1000 rows, got %d", out.NumRows())
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	alice, err := crypto.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	bob, err := crypto.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	mallory, err := crypto.GenerateIdentity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+
+	tmpFile := "/tmp/test_lockbox_recipients.lbx"
+	defer os.Remove(tmpFile)
+
+	lb, err := Create(tmpFile, schema, WithRecipient(alice.Recipient()), WithRecipient(bob.Recipient()))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	idb.AppendValues([]int64{1, 2, 3}, nil)
+	idArr := idb.NewArray()
+	idb.Release()
+	record := array.NewRecord(schema, []arrow.Array{idArr}, 3)
+	idArr.Release()
+	defer record.Release()
+
+	ctx := context.Background()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithIdentity(alice)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	for _, id := range []*crypto.Identity{alice, bob} {
+		lb, err := Open(tmpFile, WithIdentity(id))
+		if err != nil {
+			t.Fatalf("Failed to open with identity: %v", err)
+		}
+		out, err := lb.Read(ctx, WithIdentity(id))
+		if err != nil {
+			t.Fatalf("Failed to read with identity: %v", err)
+		}
+		if !array.RecordEqual(record, out) {
+			t.Fatalf("round trip mismatch")
+		}
+		out.Release()
+		lb.Close()
+	}
+
+	if _, err := Open(tmpFile, WithIdentity(mallory)); !errors.Is(err, crypto.ErrNoMatchingIdentity) {
+		t.Fatalf("expected ErrNoMatchingIdentity, got %v", err)
+	}
+	if _, err := Open(tmpFile, WithPassword("guess")); err == nil {
+		t.Fatalf("expected error opening recipient-only file with a password")
+	}
+
+	// A file with both a password and a recipient opens with either
+	os.Remove(tmpFile)
+	lb, err = Create(tmpFile, schema, WithPassword("test_password_123"), WithRecipient(alice.Recipient()))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	lb.Close()
+	for _, opt := range []Option{WithPassword("test_password_123"), WithIdentity(alice)} {
+		lb, err := Open(tmpFile, opt)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		lb.Close()
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_rotate.lbx"
+	defer os.Remove(tmpFile)
+
+	oldPassword := "test_password_123"
+	newPassword := "rotated_password_456"
+
+	lb, err := Create(tmpFile, schema, WithPassword(oldPassword))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	idb.AppendValues([]int64{1, 2, 3}, nil)
+	idArr := idb.NewArray()
+	idb.Release()
+	record := array.NewRecord(schema, []arrow.Array{idArr}, 3)
+	idArr.Release()
+	defer record.Release()
+
+	ctx := context.Background()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(oldPassword)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	blocks := append([]metadata.BlockInfo(nil), lb.file.Metadata().BlockInfo...)
+
+	before, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if err := lb.RotateKey(WithPassword("wrong"), WithPassword(newPassword)); !errors.Is(err, format.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	after, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("failed rotation modified the file")
+	}
+
+	if err := lb.RotateKey(WithPassword(oldPassword), WithPassword(newPassword)); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	lb.Close()
+
+	if _, err := Open(tmpFile, WithPassword(oldPassword)); !errors.Is(err, format.ErrWrongPassword) {
+		t.Fatalf("expected old password to fail, got %v", err)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(newPassword))
+	if err != nil {
+		t.Fatalf("Failed to open with new password: %v", err)
+	}
+	defer lb.Close()
+
+	for i, bi := range lb.file.Metadata().BlockInfo {
+		if bi.Offset != blocks[i].Offset || !bytes.Equal(bi.Checksum, blocks[i].Checksum) {
+			t.Fatalf("block %d was rewritten by rotation", i)
+		}
+	}
+
+	out, err := lb.Read(ctx, WithPassword(newPassword))
+	if err != nil {
+		t.Fatalf("Failed to read with new password: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(record, out) {
+		t.Fatalf("round trip mismatch after rotation")
+	}
+}
+
+func TestKDFParams(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_kdf.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	for _, weak := range [][3]uint32{{1024, 3, 1}, {8 * 1024, 1, 1}, {8 * 1024, 3, 0}} {
+		if _, err := Create(tmpFile, schema, WithPassword(password), WithKDFParams(weak[0], weak[1], weak[2])); err == nil {
+			t.Fatalf("expected error for weak kdf params %v", weak)
+		}
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithKDFParams(8*1024, 2, 1))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	mem := memory.NewGoAllocator()
+	idb := array.NewInt64Builder(mem)
+	idb.AppendValues([]int64{1, 2, 3}, nil)
+	idArr := idb.NewArray()
+	idb.Release()
+	record := array.NewRecord(schema, []arrow.Array{idArr}, 3)
+	idArr.Release()
+	defer record.Release()
+
+	ctx := context.Background()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	info, err := ReadInfo(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read info: %v", err)
+	}
+	if info.KeyDerivation != "Argon2id" || info.KDFMemory != 8*1024 || info.KDFIterations != 2 || info.KDFLanes != 1 {
+		t.Fatalf("kdf params not stored: %+v", info)
+	}
+
+	if _, err := Open(tmpFile, WithPassword("wrong")); !errors.Is(err, format.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer lb.Close()
+
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(record, out) {
+		t.Fatalf("round trip mismatch")
+	}
+}
+
+func TestWithKeyFile(t *testing.T) {
+	keyFile := "/tmp/test_lockbox_key.txt"
+	defer os.Remove(keyFile)
+
+	cases := map[string]string{
+		"secret\n":   "secret",
+		"secret\r\n": "secret",
+		"secret\n\n": "secret\n",
+		"secret":     "secret",
+	}
+	for contents, want := range cases {
+		if err := os.WriteFile(keyFile, []byte(contents), 0600); err != nil {
+			t.Fatalf("Failed to write key file: %v", err)
+		}
+		options := &Options{}
+		WithKeyFile(keyFile)(options)
+		if options.err != nil || options.Password != want {
+			t.Fatalf("key file %q: got %q, %v", contents, options.Password, options.err)
+		}
+	}
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	if _, err := Create("/tmp/test_lockbox_keyfile.lbx", schema, WithKeyFile("/tmp/test_lockbox_missing.txt")); err == nil {
+		t.Fatalf("expected error for missing key file")
+	}
+}
+
+func TestWriteSchemaMismatch(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_mismatch.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	narrow := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: false},
+	}, nil)
+	mem := memory.NewGoAllocator()
+	b := array.NewInt32Builder(mem)
+	b.AppendValues([]int32{1, 2, 3}, nil)
+	arr := b.NewArray()
+	b.Release()
+	record := array.NewRecord(narrow, []arrow.Array{arr}, 3)
+	arr.Release()
+	defer record.Release()
+
+	ctx := context.Background()
+	err = lb.Write(ctx, record, WithPassword(password))
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	if n := len(lb.file.Metadata().BlockInfo); n != 0 {
+		t.Fatalf("mismatched write stored %d blocks", n)
+	}
+
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password), WithCoerce(true)); err != nil {
+		t.Fatalf("coerced write failed: %v", err)
+	}
+
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	if got := out.Column(0).(*array.Int64).Int64Values(); len(got) != 3 || got[2] != 3 {
+		t.Fatalf("unexpected coerced values %v", got)
+	}
+}
+
+func TestReadColumnsProjection(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_projection.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	b.Field(2).(*array.Float64Builder).AppendValues([]float64{0.5, 1.5}, nil)
+	record := b.NewRecord()
+	b.Release()
+
+	ctx := context.Background()
+	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	// Corrupt the name block: a projection without it must never touch it
+	for _, bi := range lb.file.Metadata().BlockInfo {
+		if bi.ColumnName != "name" {
+			continue
+		}
+		f, err := os.OpenFile(tmpFile, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open file: %v", err)
+		}
+		if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, bi.Offset); err != nil {
+			t.Fatalf("Failed to corrupt block: %v", err)
+		}
+		f.Close()
+	}
+
+	out, err := lb.Read(ctx, WithPassword(password), WithColumns("score", "id"))
+	if err != nil {
+		t.Fatalf("projected read touched an unrequested column: %v", err)
+	}
+	if out.NumCols() != 2 || out.ColumnName(0) != "id" || out.ColumnName(1) != "score" {
+		t.Fatalf("unexpected projected schema %v", out.Schema())
+	}
+	out.Release()
+
+	rr, err := lb.NewReader(WithPassword(password), WithColumns("id"))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	for rr.Next() {
+		if rr.Record().NumCols() != 1 {
+			t.Fatalf("streaming projection returned %d columns", rr.Record().NumCols())
+		}
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("streaming projection failed: %v", err)
+	}
+	rr.Release()
+
+	if _, err := lb.Read(ctx, WithPassword(password)); err == nil {
+		t.Fatalf("expected full read to hit the corrupted block")
+	}
+	if _, err := lb.Read(ctx, WithPassword(password), WithColumns("missing")); err == nil {
+		t.Fatalf("expected error for unknown column")
+	}
+}
+
+func TestStats(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_stats.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	write := func(ids []int64, names []string, scores []float64, valid []bool) {
+		b := array.NewRecordBuilder(mem, schema)
+		defer b.Release()
+		b.Field(0).(*array.Int64Builder).AppendValues(ids, nil)
+		b.Field(1).(*array.StringBuilder).AppendValues(names, valid)
+		b.Field(2).(*array.Float64Builder).AppendValues(scores, valid)
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	write([]int64{5, 2, 9}, []string{"m", "", "c"}, []float64{1.5, 0, -3}, []bool{true, false, true})
+	write([]int64{-4, 7}, []string{"z", "a"}, []float64{8, 2}, nil)
+
+	stats, err := lb.Stats(WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read stats: %v", err)
+	}
+	if stats.Rows != 5 || stats.Segments != 2 {
+		t.Fatalf("expected 5 rows in 2 segments, got %d in %d", stats.Rows, stats.Segments)
+	}
+	id := stats.Columns["id"]
+	if id.Nulls != 0 || id.Min != int64(-4) || id.Max != int64(9) {
+		t.Fatalf("unexpected id stats %+v", id)
+	}
+	name := stats.Columns["name"]
+	if name.Nulls != 1 || name.Min != "a" || name.Max != "z" {
+		t.Fatalf("unexpected name stats %+v", name)
+	}
+	score := stats.Columns["score"]
+	if score.Nulls != 1 || score.Min != -3.0 || score.Max != 8.0 {
+		t.Fatalf("unexpected score stats %+v", score)
+	}
+
+	// The footer must not leak bounds in plaintext
+	raw, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if bytes.Contains(raw, []byte(`"min"`)) {
+		t.Fatalf("stats footer is stored in plaintext")
+	}
+
+	// Files without a footer stay without one until recomputed
+	lb.file.Metadata().Stats = nil
+	write([]int64{100}, []string{"q"}, []float64{4}, nil)
+	if _, err := lb.Stats(WithPassword(password)); !errors.Is(err, format.ErrNoStats) {
+		t.Fatalf("expected ErrNoStats, got %v", err)
+	}
+
+	if err := lb.RecomputeStats(WithPassword(password)); err != nil {
+		t.Fatalf("Failed to recompute stats: %v", err)
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen lockbox: %v", err)
+	}
+	defer lb.Close()
+	stats, err = lb.Stats(WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read recomputed stats: %v", err)
+	}
+	if stats.Rows != 6 || stats.Columns["id"].Max != int64(100) {
+		t.Fatalf("unexpected recomputed stats %+v", stats)
+	}
+}
+
+func TestReaderFilter(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_filter.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	for _, base := range []int64{0, 10, 20} {
+		b := array.NewRecordBuilder(mem, schema)
+		b.Field(0).(*array.Int64Builder).AppendValues([]int64{base + 1, base + 2, base + 3}, nil)
+		b.Field(1).(*array.Float64Builder).AppendValues([]float64{float64(base), 0, 0.5}, []bool{true, false, true})
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		b.Release()
+	}
+
+	// Corrupt the middle segment: filters that rule it out must never read it
+	f, err := os.OpenFile(tmpFile, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	for _, col := range []string{"id", "score"} {
+		bi := lb.file.Metadata().ColumnBlocks(col)[1]
+		if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, bi.Offset); err != nil {
+			t.Fatalf("Failed to corrupt block: %v", err)
+		}
+	}
+	f.Close()
+
+	collect := func(opts ...Option) ([]int64, error) {
+		rr, err := lb.NewReader(append(opts, WithPassword(password))...)
+		if err != nil {
+			return nil, err
+		}
+		defer rr.Release()
+		var ids []int64
+		for rr.Next() {
+			col := rr.Record().Column(0).(*array.Int64)
+			ids = append(ids, col.Int64Values()...)
+		}
+		return ids, rr.Err()
+	}
+
+	ids, err := collect(WithFilter("id", ">=", 22))
+	if err != nil {
+		t.Fatalf("filter read a skipped segment: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 22 || ids[1] != 23 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+
+	ids, err = collect(WithFilter("id", "<", "3"), WithColumns("id"))
+	if err != nil {
+		t.Fatalf("filter read a skipped segment: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+
+	// Projection drops the filter column; nulls never match
+	ids, err = collect(WithFilter("score", ">", 0.25), WithFilter("id", "<=", 3), WithColumns("id"))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+
+	if _, err := collect(WithFilter("id", "=", 11)); err == nil {
+		t.Fatalf("expected the corrupted segment to be read for id=11")
+	}
+
+	// Without a footer every segment is decrypted and filtered row by row
+	lb.file.Metadata().Stats = nil
+	if _, err := collect(WithFilter("id", ">=", 22)); err == nil {
+		t.Fatalf("expected row-by-row filtering to read every segment")
+	}
+
+	if _, err := collect(WithFilter("id", "<>", 1)); err == nil {
+		t.Fatalf("expected error for unsupported operator")
+	}
+	if _, err := collect(WithFilter("missing", "=", 1)); err == nil {
+		t.Fatalf("expected error for unknown column")
+	}
+	if _, err := collect(WithFilter("id", "=", "abc")); err == nil {
+		t.Fatalf("expected error for non-numeric value")
+	}
+}
+
+func TestReaderStringFilter(t *testing.T) {
+	dict := &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "username", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "status", Type: dict, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_string_filter.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	segments := []struct {
+		names  []string
+		valid  []bool
+		status []string
+	}{
+		{[]string{"alice", "bob", ""}, []bool{true, true, false}, []string{"open", "closed", "open"}},
+		{[]string{"carol", "dave", "erin"}, nil, []string{"closed", "closed", "open"}},
+	}
+	for i, seg := range segments {
+		b := array.NewRecordBuilder(mem, schema)
+		for k := range seg.names {
+			b.Field(0).(*array.Int64Builder).Append(int64(i*3 + k + 1))
+			if err := b.Field(2).(*array.BinaryDictionaryBuilder).AppendString(seg.status[k]); err != nil {
+				t.Fatalf("append status: %v", err)
+			}
+		}
+		b.Field(1).(*array.StringBuilder).AppendValues(seg.names, seg.valid)
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		b.Release()
+	}
+
+	// Corrupt the second segment: a filter its bounds rule out never reads it
+	f, err := os.OpenFile(tmpFile, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("open file: %v", err)
+	}
+	for _, col := range []string{"id", "username", "status"} {
+		bi := lb.file.Metadata().ColumnBlocks(col)[1]
+		if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, bi.Offset); err != nil {
+			t.Fatalf("corrupt block: %v", err)
+		}
+	}
+	f.Close()
+
+	collect := func(opts ...Option) ([]int64, error) {
+		rr, err := lb.NewReader(append(opts, WithPassword(password), WithColumns("id"))...)
+		if err != nil {
+			return nil, err
+		}
+		defer rr.Release()
+		var ids []int64
+		for rr.Next() {
+			ids = append(ids, rr.Record().Column(0).(*array.Int64).Int64Values()...)
+		}
+		return ids, rr.Err()
+	}
+
+	ids, err := collect(WithFilter("username", "=", "bob"))
+	if err != nil {
+		t.Fatalf("filter read a skipped segment: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("expected id 2 for username = bob, got %v", ids)
+	}
+
+	// Nulls match neither = nor !=
+	ids, err = collect(WithFilter("username", "!=", "bob"), WithFilter("id", "<=", 3))
+	if err != nil {
+		t.Fatalf("filter read a skipped segment: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("expected id 1 for username != bob, got %v", ids)
+	}
+
+	ids, err = collect(WithFilter("status", "=", "open"), WithFilter("id", "<=", 3))
+	if err != nil {
+		t.Fatalf("filter read a skipped segment: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("expected ids 1 and 3 for status = open, got %v", ids)
+	}
+
+	if _, err := collect(WithFilter("username", "<", "bob")); err == nil {
+		t.Fatalf("expected an ordering operator on a string column to fail")
+	}
+	if _, err := collect(WithFilter("username", "=", 7)); err == nil {
+		t.Fatalf("expected a numeric value for a string column to fail")
+	}
+}
+
+func TestReaderHeadTail(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_headtail.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	for base := int64(0); base < 40; base += 10 {
+		b := array.NewRecordBuilder(mem, schema)
+		for id := base; id < base+10; id++ {
+			b.Field(0).(*array.Int64Builder).Append(id)
+		}
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		b.Release()
+	}
+
+	// Corrupt the second segment: limits that do not reach it must never
+	// decrypt it
+	f, err := os.OpenFile(tmpFile, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	bi := lb.file.Metadata().ColumnBlocks("id")[1]
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, bi.Offset); err != nil {
+		t.Fatalf("Failed to corrupt block: %v", err)
+	}
+	f.Close()
+
+	collect := func(opts ...Option) ([]int64, error) {
+		rr, err := lb.NewReader(append(opts, WithPassword(password))...)
+		if err != nil {
+			return nil, err
+		}
+		defer rr.Release()
+		var ids []int64
+		for rr.Next() {
+			ids = append(ids, rr.Record().Column(0).(*array.Int64).Int64Values()...)
+		}
+		return ids, rr.Err()
+	}
+	expect := func(ids []int64, first, last int64) {
+		t.Helper()
+		if int64(len(ids)) != last-first+1 || ids[0] != first || ids[len(ids)-1] != last {
+			t.Fatalf("expected ids %d..%d, got %v", first, last, ids)
+		}
+	}
+
+	ids, err := collect(WithHead(5))
+	if err != nil {
+		t.Fatalf("head read past its rows: %v", err)
+	}
+	expect(ids, 0, 4)
+
+	// The segment row counts locate the tail without decrypting earlier
+	// segments; the first one read is sliced
+	ids, err = collect(WithTail(15))
+	if err != nil {
+		t.Fatalf("tail read an earlier segment: %v", err)
+	}
+	expect(ids, 25, 39)
+
+	ids, err = collect(WithHead(7), WithFilter("id", ">=", 25))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	expect(ids, 25, 31)
+
+	// Filtered tails buffer the last matching rows
+	ids, err = collect(WithTail(12), WithFilter("id", "<", 35), WithFilter("id", ">=", 20))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	expect(ids, 23, 34)
+
+	if _, err := collect(WithTail(25)); err == nil {
+		t.Fatalf("expected a tail of 25 rows to read the corrupted segment")
+	}
+	if _, err := collect(WithHead(1), WithTail(1)); err == nil {
+		t.Fatalf("expected head and tail to be rejected together")
+	}
+	if _, err := collect(WithHead(0)); err == nil {
+		t.Fatalf("expected a zero head to be rejected")
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_concurrent.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	for seg := int64(0); seg < 4; seg++ {
+		b := array.NewRecordBuilder(mem, schema)
+		for i := int64(0); i < 100; i++ {
+			b.Field(0).(*array.Int64Builder).Append(seg*100 + i)
+			b.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("row %d", seg*100+i))
+		}
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		b.Release()
+	}
+	lb.Close()
+
+	shared, err := Open(tmpFile, WithPassword(password), WithMode(ReadOnly))
+	if err != nil {
+		t.Fatalf("Failed to open lockbox: %v", err)
+	}
+	defer shared.Close()
+
+	// Half the goroutines share one handle, the rest open their own
+	const readers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+	for g := 0; g < readers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			lb := shared
+			if g%2 == 1 {
+				own, err := Open(tmpFile, WithPassword(password), WithMode(ReadOnly))
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer own.Close()
+				lb = own
+			}
+
+			rr, err := lb.NewReader(WithPassword(password))
+			if err != nil {
+				errs <- err
+				return
+			}
+			var sum int64
+			for rr.Next() {
+				for _, id := range rr.Record().Column(0).(*array.Int64).Int64Values() {
+					sum += id
+				}
+			}
+			rr.Release()
+			if err := rr.Err(); err != nil {
+				errs <- err
+				return
+			}
+			if sum != 399*400/2 {
+				errs <- fmt.Errorf("reader %d: expected id sum %d, got %d", g, 399*400/2, sum)
+				return
+			}
+
+			rec, err := lb.ReadSegment(ctx, g%4, WithPassword(password))
+			if err != nil {
+				errs <- err
+				return
+			}
+			first := rec.Column(0).(*array.Int64).Value(0)
+			rec.Release()
+			if first != int64(g%4)*100 {
+				errs <- fmt.Errorf("reader %d: segment %d starts at %d", g, g%4, first)
+				return
+			}
+
+			rec, err = lb.Read(ctx, WithPassword(password), WithColumns("name"))
+			if err != nil {
+				errs <- err
+				return
+			}
+			rows := rec.NumRows()
+			rec.Release()
+			if rows != 400 {
+				errs <- fmt.Errorf("reader %d: expected 400 rows, got %d", g, rows)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Concurrent read failed: %v", err)
+	}
+}
+
+func TestOpenRead(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_open_read.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	rec := b.NewRecord()
+	b.Release()
+	rec.Retain()
+	if err := lb.Write(ctx, rec, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	// Writing needs the key up front
+	if _, err := Open(tmpFile); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired opening for writing, got %v", err)
+	}
+
+	// Metadata needs no key; data needs it on each call
+	lb, err = OpenRead(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to open for reading: %v", err)
+	}
+	defer lb.Close()
+	if !lb.Schema().Equal(schema) {
+		t.Fatalf("expected schema %s, got %s", schema, lb.Schema())
+	}
+	if _, err := lb.Read(ctx); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired reading without a password, got %v", err)
+	}
+	if _, err := lb.Read(ctx, WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	got, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer got.Release()
+	if got.NumRows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", got.NumRows())
+	}
+	if err := lb.Write(ctx, rec, WithPassword(password)); err == nil {
+		t.Fatalf("expected a write through OpenRead to fail")
+	}
+	rec.Release()
+
+	// Credentials given to OpenRead are still checked
+	if _, err := OpenRead(tmpFile, WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword from OpenRead, got %v", err)
+	}
+}
+
+func TestLocking(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_locking.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	writer, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	// A writer keeps every other handle out
+	if _, err := Open(tmpFile, WithPassword(password)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for a second writer, got %v", err)
+	}
+	if _, err := Open(tmpFile, WithPassword(password), WithMode(ReadOnly)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for a reader while writing, got %v", err)
+	}
+	if _, err := Create(tmpFile, schema, WithPassword(password)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked when recreating an open file, got %v", err)
+	}
+
+	// WithNoLock bypasses the lock
+	unlocked, err := Open(tmpFile, WithPassword(password), WithNoLock())
+	if err != nil {
+		t.Fatalf("Failed to open without a lock: %v", err)
+	}
+	unlocked.Close()
+	writer.Close()
+
+	// Readers share the file but keep writers out
+	r1, err := Open(tmpFile, WithPassword(password), WithMode(ReadOnly))
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	r2, err := Open(tmpFile, WithPassword(password), WithMode(ReadOnly))
+	if err != nil {
+		t.Fatalf("Failed to open second reader: %v", err)
+	}
+	if _, err := Open(tmpFile, WithPassword(password)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for a writer while reading, got %v", err)
+	}
+
+	// A read-only handle cannot write
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	b.Field(0).(*array.Int64Builder).Append(1)
+	rec := b.NewRecord()
+	b.Release()
+	if err := r1.Write(context.Background(), rec, WithPassword(password)); err == nil {
+		t.Fatalf("expected a write on a read-only handle to fail")
+	}
+	rec.Release()
+	r1.Close()
+	r2.Close()
+
+	// Closing releases the lock
+	lb, err := Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open after readers closed: %v", err)
+	}
+	lb.Close()
+}
+
+func TestCount(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_count.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	for _, ids := range [][]int64{{1, 2, 3}, {4, 5}} {
+		b := array.NewRecordBuilder(mem, schema)
+		b.Field(0).(*array.Int64Builder).AppendValues(ids, nil)
+		for range ids {
+			b.Field(1).(*array.StringBuilder).Append("x")
+		}
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		b.Release()
+	}
+
+	n, err := lb.Count(ctx, WithPassword(password))
+	if err != nil || n != 5 {
+		t.Fatalf("expected 5 rows, got %d (%v)", n, err)
+	}
+	n, err = lb.Count(ctx, WithPassword(password), WithFilter("id", ">", 3))
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 matching rows, got %d (%v)", n, err)
+	}
+
+	// Without a footer the segments are streamed
+	lb.file.Metadata().Stats = nil
+	n, err = lb.Count(ctx, WithPassword(password))
+	if err != nil || n != 5 {
+		t.Fatalf("expected 5 streamed rows, got %d (%v)", n, err)
+	}
+
+	if _, err := lb.Count(ctx, WithPassword("wrong")); err == nil {
+		t.Fatalf("expected error for wrong password")
+	}
+}
+
+func TestParallelWriteLayout(t *testing.T) {
+	fields := make([]arrow.Field, 12)
+	for i := range fields {
+		fields[i] = arrow.Field{Name: fmt.Sprintf("c%d", i), Type: arrow.PrimitiveTypes.Int64}
+	}
+	schema := arrow.NewSchema(fields, nil)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	// Random nonces make ciphertexts differ on every run, so compare the
+	// block layout and the decrypted data instead of raw bytes
+	write := func(path string, parallelism int) ([]metadata.BlockInfo, arrow.Record) {
+		lb, err := Create(path, schema, WithPassword(password))
+		if err != nil {
+			t.Fatalf("Failed to create lockbox: %v", err)
+		}
+		defer lb.Close()
+
+		b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+		defer b.Release()
+		for c := range fields {
+			for r := 0; r < 100; r++ {
+				b.Field(c).(*array.Int64Builder).Append(int64(c*1000 + r))
+			}
+		}
+		for seg := 0; seg < 2; seg++ {
+			if err := lb.Write(ctx, b.NewRecord(), WithPassword(password), WithCompression("zstd"), WithParallelism(parallelism)); err != nil {
+				t.Fatalf("Failed to write with parallelism %d: %v", parallelism, err)
+			}
+			for c := range fields {
+				for r := 0; r < 50; r++ {
+					b.Field(c).(*array.Int64Builder).Append(int64(r))
+				}
+			}
+		}
+		rec, err := lb.Read(ctx, WithPassword(password))
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		return lb.file.Metadata().BlockInfo, rec
+	}
+
+	serialFile := "/tmp/test_lockbox_serial.lbx"
+	parallelFile := "/tmp/test_lockbox_parallel.lbx"
+	defer os.Remove(serialFile)
+	defer os.Remove(parallelFile)
+
+	serialBlocks, serialRec := write(serialFile, 1)
+	defer serialRec.Release()
+	parallelBlocks, parallelRec := write(parallelFile, 8)
+	defer parallelRec.Release()
+
+	if len(serialBlocks) != len(parallelBlocks) {
+		t.Fatalf("block count differs: %d vs %d", len(serialBlocks), len(parallelBlocks))
+	}
+	// Offsets are compared within a segment: the metadata between segments
+	// holds timestamps whose encoded length varies
+	for i := range serialBlocks {
+		s, p := serialBlocks[i], parallelBlocks[i]
+		first := i - i%len(fields)
+		if s.ColumnName != p.ColumnName || s.Length != p.Length || s.RowCount != p.RowCount || s.OrigSize != p.OrigSize ||
+			s.Offset-serialBlocks[first].Offset != p.Offset-parallelBlocks[first].Offset {
+			t.Fatalf("block %d differs: %+v vs %+v", i, s, p)
+		}
+	}
+	if !array.RecordEqual(serialRec, parallelRec) {
+		t.Fatalf("decrypted data differs between parallelism settings")
+	}
+
+	if _, err := Create("/tmp/test_lockbox_unused.lbx", schema, WithParallelism(-1)); err == nil {
+		os.Remove("/tmp/test_lockbox_unused.lbx")
+		t.Fatalf("expected error for negative parallelism")
+	}
+}
+
+func TestOpenWithMmap(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_mmap.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	write := func(lb *Lockbox, ids ...int64) {
+		b := array.NewRecordBuilder(mem, schema)
+		defer b.Release()
+		b.Field(0).(*array.Int64Builder).AppendValues(ids, nil)
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	write(lb, 1, 2, 3)
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password), WithMmap())
+	if err != nil {
+		t.Fatalf("Failed to open with mmap: %v", err)
+	}
+	defer lb.Close()
+
+	// The second segment lies beyond the mapping and is read from the file
+	write(lb, 4, 5)
+
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer rec.Release()
+	ids := rec.Column(0).(*array.Int64)
+	if ids.Len() != 5 || ids.Value(0) != 1 || ids.Value(4) != 5 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+}
+
+// memStore is an in-memory object store for exercising URI paths
+type memStore struct {
+	objects map[string][]byte
+}
+
+type memObject struct{ *bytes.Reader }
+
+func (memObject) Close() error { return nil }
+
+type memWriter struct {
+	bytes.Buffer
+	commit func([]byte)
+}
+
+func (w *memWriter) Close() error {
+	w.commit(w.Bytes())
+	return nil
+}
+
+func (m *memStore) Reader(path string) (io.ReadSeekCloser, error) {
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return memObject{bytes.NewReader(data)}, nil
+}
+
+func (m *memStore) Writer(path string) (io.WriteCloser, error) {
+	return &memWriter{commit: func(b []byte) { m.objects[path] = append([]byte(nil), b...) }}, nil
+}
+
+func TestRemoteStore(t *testing.T) {
+	mem := &memStore{objects: map[string][]byte{}}
+	store.Register("memtest", func(ctx context.Context, bucket string) (store.Store, error) {
+		return mem, nil
+	})
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	uri := "memtest://bucket/data/test.lbx"
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(uri, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create remote lockbox: %v", err)
+	}
+	if err := lb.Close(); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	created := mem.objects["data/test.lbx"]
+	if len(created) == 0 {
+		t.Fatalf("expected the new file to be uploaded")
+	}
+
+	lb, err = Open(uri, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open remote lockbox: %v", err)
+	}
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	b.Release()
+	if err := lb.Close(); err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	if bytes.Equal(created, mem.objects["data/test.lbx"]) {
+		t.Fatalf("expected the written file to be uploaded")
+	}
+
+	// Reading leaves the object untouched
+	written := mem.objects["data/test.lbx"]
+	lb, err = Open(uri, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen remote lockbox: %v", err)
+	}
+	n, err := lb.Count(ctx, WithPassword(password))
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 rows, got %d (%v)", n, err)
+	}
+	local := lb.remote.local
+	lb.Close()
+	if !bytes.Equal(written, mem.objects["data/test.lbx"]) {
+		t.Fatalf("read-only use should not upload")
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Fatalf("expected working copy %s to be removed", local)
+	}
+
+	if _, err := Open("memtest://bucket/missing.lbx", WithPassword(password)); err == nil {
+		t.Fatalf("expected error for missing object")
+	}
+}
+
+func TestDictionaryColumn(t *testing.T) {
+	plain := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "country", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	schema, err := DictionaryEncode(plain, "country")
+	if err != nil {
+		t.Fatalf("dictionary encode: %v", err)
+	}
+	if _, err := DictionaryEncode(plain, "id"); err == nil {
+		t.Fatalf("expected error encoding an int64 column")
+	}
+
+	tmpFile := "/tmp/test_lockbox_dictionary.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	defer lb.Close()
+
+	// Plain strings are converted to the dictionary column by WithCoerce
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, plain)
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3, 4}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"us", "uk", "", "us"}, []bool{true, true, false, true})
+	if err := lb.Write(context.Background(), b.NewRecord(), WithPassword(password), WithCoerce(true)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	rec, err := lb.Read(context.Background(), WithPassword(password))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	defer rec.Release()
+	col, ok := rec.Column(1).(*array.Dictionary)
+	if !ok {
+		t.Fatalf("country is %s, want a dictionary", rec.Column(1).DataType())
+	}
+	if col.Dictionary().Len() != 2 || !col.IsNull(2) {
+		t.Fatalf("unexpected dictionary column %v", col)
+	}
+	values := col.Dictionary().(*array.String)
+	if values.Value(col.GetValueIndex(3)) != "us" {
+		t.Fatalf("row 3 = %q, want us", values.Value(col.GetValueIndex(3)))
+	}
+
+	stats, err := lb.Stats(WithPassword(password))
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+	cs := stats.Columns["country"]
+	if cs.Nulls != 1 || cs.Min != "uk" || cs.Max != "us" {
+		t.Fatalf("unexpected country stats %+v", cs)
+	}
+}
+
+func TestInterruptedWriteRecovery(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_crash.lbx"
+	crashFile := "/tmp/test_lockbox_crash_copy.lbx"
+	defer os.Remove(tmpFile)
+	defer os.Remove(crashFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	write := func(path string, state IngestState, ids ...int64) {
+		t.Helper()
+		lb, err := Open(path, WithPassword(password))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer lb.Close()
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		b.AppendValues(ids, nil)
+		arr := b.NewArray()
+		defer arr.Release()
+		rec := array.NewRecord(schema, []arrow.Array{arr}, int64(len(ids)))
+		if err := lb.Write(ctx, rec, WithPassword(password), WithIngestState(state)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lb.Close()
+	write(tmpFile, IngestState{Fingerprint: "input", Rows: 2}, 1, 2)
+	committed, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	write(tmpFile, IngestState{Fingerprint: "input", Rows: 5, Complete: true}, 3, 4, 5)
+	full, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+
+	// A crash after the second write's blocks and metadata reached the disk
+	// but before the header pointed at them leaves them behind the old
+	// header. Cutting the tail short covers torn writes as well.
+	const headerLen = 28
+	for _, cut := range []int{len(committed) + 1, (len(committed) + len(full)) / 2, len(full)} {
+		crash := append([]byte(nil), full[:cut]...)
+		copy(crash[:headerLen], committed[:headerLen])
+		if err := os.WriteFile(crashFile, crash, 0o644); err != nil {
+			t.Fatalf("write crash file: %v", err)
+		}
+
+		// Without an exclusive lock a live writer may own the tail, so
+		// it is left alone
+		for _, opts := range [][]Option{{WithMode(ReadOnly)}, {WithPassword(password), WithNoLock()}} {
+			lb, err := Open(crashFile, opts...)
+			if err != nil {
+				t.Fatalf("cut %d: open without an exclusive lock: %v", cut, err)
+			}
+			lb.Close()
+			if st, _ := os.Stat(crashFile); st.Size() != int64(cut) {
+				t.Fatalf("cut %d: expected a handle without an exclusive lock to leave %d bytes, got %d", cut, cut, st.Size())
+			}
+		}
+
+		lb, err := Open(crashFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("cut %d: open after crash: %v", cut, err)
+		}
+		state, ok := lb.IngestState()
+		count, err := lb.Count(ctx, WithPassword(password))
+		lb.Close()
+		if err != nil {
+			t.Fatalf("cut %d: count: %v", cut, err)
+		}
+		if !ok || state.Rows != 2 || state.Complete || count != 2 {
+			t.Fatalf("cut %d: expected the first commit only, got %+v and %d rows", cut, state, count)
+		}
+		if st, _ := os.Stat(crashFile); st.Size() != int64(len(committed)) {
+			t.Fatalf("cut %d: expected the uncommitted tail to be truncated to %d bytes, got %d", cut, len(committed), st.Size())
+		}
+
+		// Resuming appends after the last commit
+		write(crashFile, IngestState{Fingerprint: "input", Rows: 5, Complete: true}, 3, 4, 5)
+		lb, err = Open(crashFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("cut %d: reopen: %v", cut, err)
+		}
+		rec, err := lb.Read(ctx, WithPassword(password))
+		lb.Close()
+		if err != nil {
+			t.Fatalf("cut %d: read: %v", cut, err)
+		}
+		ids := rec.Column(0).(*array.Int64)
+		if ids.Len() != 5 || ids.Value(4) != 5 {
+			t.Fatalf("cut %d: expected ids 1-5 after resuming, got %v", cut, ids)
+		}
+		rec.Release()
+	}
+}
+
+func TestCipherSelection(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_cipher.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	if _, err := Create(tmpFile, schema, WithPassword(password), WithCipher("rot13")); !errors.Is(err, crypto.ErrUnsupportedCipher) {
+		t.Fatalf("expected ErrUnsupportedCipher for an unknown cipher, got %v", err)
+	}
+	if _, err := crypto.CipherName(crypto.CipherChaCha20Poly1305); err != nil {
+		t.Skipf("built without ChaCha20-Poly1305: %v", err)
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithCipher("chacha20-poly1305"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	b := array.NewInt64Builder(memory.NewGoAllocator())
+	b.AppendValues([]int64{1, 2, 3}, nil)
+	arr := b.NewArray()
+	b.Release()
+	rec := array.NewRecord(schema, []arrow.Array{arr}, 3)
+	arr.Release()
+	if err := lb.Write(ctx, rec, WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if alg := lb.file.Metadata().Encryption.Algorithm; alg != crypto.CipherChaCha20Poly1305 {
+		t.Fatalf("expected %s to be stored, got %s", crypto.CipherChaCha20Poly1305, alg)
+	}
+	got, err := lb.Read(ctx, WithPassword(password))
+	lb.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ids := got.Column(0).(*array.Int64); ids.Len() != 3 || ids.Value(2) != 3 {
+		t.Fatalf("expected ids 1-3, got %v", ids)
+	}
+	got.Release()
+
+	// A binary built without the file's cipher must refuse it cleanly.
+	// Renaming the stored cipher stands in for such a build.
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	data = bytes.ReplaceAll(data, []byte(`"ChaCha20-Poly1305"`), []byte(`"XSalsa20-Poly1305"`))
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := Open(tmpFile, WithPassword(password)); !errors.Is(err, crypto.ErrUnsupportedCipher) {
+		t.Fatalf("expected ErrUnsupportedCipher opening a file with an unavailable cipher, got %v", err)
+	}
+}
+
+func TestMetadataProperties(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_properties.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	write := func(meta map[string]string) error {
+		t.Helper()
+		lb, err := Open(tmpFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer lb.Close()
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		b.Append(1)
+		arr := b.NewArray()
+		defer arr.Release()
+		return lb.Write(ctx, array.NewRecord(schema, []arrow.Array{arr}, 1), WithPassword(password), WithMetadata(meta))
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lb.Close()
+	if err := write(map[string]string{"source": "crm", "note": "first"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := write(map[string]string{"note": "second"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	props, err := lb.Metadata(WithPassword(password))
+	lb.Close()
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if len(props) != 2 || props["source"] != "crm" || props["note"] != "second" {
+		t.Fatalf("expected merged properties, got %v", props)
+	}
+	info, err := ReadInfo(tmpFile)
+	if err != nil {
+		t.Fatalf("read info: %v", err)
+	}
+	if info.Metadata["source"] != "crm" {
+		t.Fatalf("expected info to show the properties without a password, got %v", info.Metadata)
+	}
+
+	// Editing the plaintext properties without the key is detected
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	data = bytes.ReplaceAll(data, []byte(`"source": "crm"`), []byte(`"source": "erp"`))
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := lb.Metadata(WithPassword(password)); !errors.Is(err, format.ErrPropertiesTampered) {
+		t.Fatalf("expected ErrPropertiesTampered, got %v", err)
+	}
+	if _, err := lb.Verify(ctx, WithPassword(password)); !errors.Is(err, format.ErrPropertiesTampered) {
+		t.Fatalf("expected verify to report the tampering, got %v", err)
+	}
+	lb.Close()
+	if err := write(map[string]string{"note": "third"}); !errors.Is(err, format.ErrPropertiesTampered) {
+		t.Fatalf("expected a write not to re-sign tampered properties, got %v", err)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_provenance.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	write := func(rows int, tool string) error {
+		t.Helper()
+		lb, err := Open(tmpFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer lb.Close()
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		for i := 0; i < rows; i++ {
+			b.Append(int64(i))
+		}
+		arr := b.NewArray()
+		defer arr.Release()
+		return lb.Write(ctx, array.NewRecord(schema, []arrow.Array{arr}, int64(rows)), WithPassword(password), WithTool(tool))
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	history, err := lb.History(WithPassword(password))
+	lb.Close()
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expected an empty history, got %v, %v", history, err)
+	}
+	if err := write(3, "etl"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := write(5, "cli"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password), WithMode(ReadOnly))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	history, err = lb.History(WithPassword(password))
+	lb.Close()
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(history))
+	}
+	if history[0].Rows != 3 || history[0].Tool != "etl" || history[1].Rows != 5 || history[1].Tool != "cli" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if history[0].User == "" || history[0].Timestamp.IsZero() || history[1].Timestamp.Before(history[0].Timestamp) {
+		t.Fatalf("expected user and ordered timestamps, got %+v", history)
+	}
+
+	// Editing an entry without the key is detected
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	data = bytes.ReplaceAll(data, []byte(`"tool": "etl"`), []byte(`"tool": "ETL"`))
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := lb.History(WithPassword(password)); !errors.Is(err, format.ErrProvenanceTampered) {
+		t.Fatalf("expected ErrProvenanceTampered, got %v", err)
+	}
+	if _, err := lb.Verify(ctx, WithPassword(password)); !errors.Is(err, format.ErrProvenanceTampered) {
+		t.Fatalf("expected verify to report the tampering, got %v", err)
+	}
+	lb.Close()
+	if err := write(1, "etl"); !errors.Is(err, format.ErrProvenanceTampered) {
+		t.Fatalf("expected a write not to re-sign a tampered history, got %v", err)
+	}
+
+	// So is stripping the whole log with its MAC, as if it had never been
+	// written
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lb.Close()
+	meta := lb.file.Metadata()
+	meta.Provenance, meta.ProvenanceMAC = nil, nil
+	if _, err := lb.History(WithPassword(password)); !errors.Is(err, format.ErrProvenanceTampered) {
+		t.Fatalf("expected a stripped log to be reported, got %v", err)
+	}
+}
+
+func TestCoerceRecordVerbose(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "score", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+	input := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "label", Type: arrow.BinaryTypes.String},
+		{Name: "extra", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	mem := memory.NewGoAllocator()
+	b := array.NewRecordBuilder(mem, input)
+	defer b.Release()
+	b.Field(0).(*array.Int32Builder).AppendValues([]int32{1, 2}, nil)
+	b.Field(1).(*array.Float64Builder).AppendValues([]float64{9.75, -3.5}, nil)
+	b.Field(2).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	b.Field(3).(*array.Int64Builder).AppendValues([]int64{7, 8}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	out, notes, err := CoerceRecordVerbose(schema, rec)
+	if err != nil {
+		t.Fatalf("coerce: %v", err)
+	}
+	defer out.Release()
+	if !out.Schema().Equal(schema) {
+		t.Fatalf("expected schema %s, got %s", schema, out.Schema())
+	}
+	if got := out.Column(1).(*array.Int32).Int32Values(); got[0] != 9 || got[1] != -3 {
+		t.Fatalf("expected truncated scores, got %v", got)
+	}
+
+	want := []CoercionNote{
+		{Column: "id", Change: "int32 to int64"},
+		{Column: "score", Change: "float64 to int32", Lossy: true},
+		{Column: "name", Change: "renamed from label"},
+		{Column: "extra", Change: "dropped", Lossy: true},
+	}
+	if len(notes) != len(want) {
+		t.Fatalf("expected notes %v, got %v", want, notes)
+	}
+	for i := range want {
+		if notes[i] != want[i] {
+			t.Fatalf("note %d: expected %v, got %v", i, want[i], notes[i])
+		}
+	}
+
+	// Values out of the target range fail instead of wrapping
+	b.Field(0).(*array.Int32Builder).Append(1)
+	b.Field(1).(*array.Float64Builder).Append(1e12)
+	b.Field(2).(*array.StringBuilder).Append("c")
+	b.Field(3).(*array.Int64Builder).Append(9)
+	big := b.NewRecord()
+	defer big.Release()
+	if _, _, err := CoerceRecordVerbose(schema, big); err == nil {
+		t.Fatalf("expected an out of range value to fail")
+	}
+}
+
+func TestCoerceRecordTimestamps(t *testing.T) {
+	utc := &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	instant := time.Date(2024, 3, 10, 6, 30, 0, 123456000, time.UTC)
+
+	mem := memory.NewGoAllocator()
+	input := arrow.NewSchema([]arrow.Field{{Name: "ts", Type: utc, Nullable: true}}, nil)
+	b := array.NewRecordBuilder(mem, input)
+	defer b.Release()
+	b.Field(0).(*array.TimestampBuilder).AppendTime(instant)
+	b.Field(0).(*array.TimestampBuilder).AppendNull()
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	tests := []struct {
+		name string
+		to   *arrow.TimestampType
+	}{
+		{"tz to naive", &arrow.TimestampType{Unit: arrow.Microsecond}},
+		{"tz to tz", &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "America/New_York"}},
+		{"tz to finer unit", &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "Europe/Berlin"}},
+	}
+	for _, tt := range tests {
+		schema := arrow.NewSchema([]arrow.Field{{Name: "ts", Type: tt.to, Nullable: true}}, nil)
+		if err := CheckCoercible(schema, input); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		out, notes, err := CoerceRecordVerbose(schema, rec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !out.Schema().Equal(schema) {
+			t.Fatalf("%s: expected schema %s, got %s", tt.name, schema, out.Schema())
+		}
+		col := out.Column(0).(*array.Timestamp)
+		if got := col.Value(0).ToTime(tt.to.Unit); !got.Equal(instant) {
+			t.Fatalf("%s: expected instant %s, got %s", tt.name, instant, got)
+		}
+		if !col.IsNull(1) {
+			t.Fatalf("%s: expected the null to be kept", tt.name)
+		}
+		if len(notes) != 1 || notes[0].Lossy {
+			t.Fatalf("%s: expected one lossless note, got %v", tt.name, notes)
+		}
+		out.Release()
+	}
+
+	// A coarser unit fails rather than drop the microseconds
+	seconds := arrow.NewSchema([]arrow.Field{{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Second}, Nullable: true}}, nil)
+	if _, _, err := CoerceRecordVerbose(seconds, rec); err == nil {
+		t.Fatalf("expected a truncating unit change to fail")
+	}
+
+	// In another zone naive values are its wall clock times, an hour before
+	// New York moves its clocks forward here
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load zone: %v", err)
+	}
+	naive := arrow.NewSchema([]arrow.Field{{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Nanosecond}, Nullable: true}}, nil)
+	wall, err := CoerceRecord(naive, rec, WithTimestampTimezone(newYork))
+	if err != nil {
+		t.Fatalf("tz to naive in zone: %v", err)
+	}
+	defer wall.Release()
+	want := time.Date(2024, 3, 10, 1, 30, 0, 123456000, time.UTC)
+	if got := wall.Column(0).(*array.Timestamp).Value(0).ToTime(arrow.Nanosecond); !got.Equal(want) {
+		t.Fatalf("expected wall clock %s, got %s", want, got)
+	}
+	back, err := CoerceRecord(input, wall, WithTimestampTimezone(newYork))
+	if err != nil {
+		t.Fatalf("naive in zone to tz: %v", err)
+	}
+	defer back.Release()
+	if got := back.Column(0).(*array.Timestamp).Value(0).ToTime(arrow.Microsecond); !got.Equal(instant) {
+		t.Fatalf("expected instant %s after the round trip, got %s", instant, got)
+	}
+	if _, err := CoerceRecord(naive, rec, WithTimestampTimezone(nil)); err == nil {
+		t.Fatalf("expected a nil time zone to fail")
+	}
+}
+
+func TestCoerceRecordNullability(t *testing.T) {
+	mem := memory.NewGoAllocator()
+	column := func(typ arrow.DataType, nullable bool, values []int64, valid []bool) arrow.Record {
+		t.Helper()
+		schema := arrow.NewSchema([]arrow.Field{{Name: "v", Type: typ, Nullable: nullable}}, nil)
+		b := array.NewRecordBuilder(mem, schema)
+		defer b.Release()
+		for i, v := range values {
+			switch fb := b.Field(0).(type) {
+			case *array.Int64Builder:
+				if valid != nil && !valid[i] {
+					fb.AppendNull()
+				} else {
+					fb.Append(v)
+				}
+			case *array.Int32Builder:
+				if valid != nil && !valid[i] {
+					fb.AppendNull()
+				} else {
+					fb.Append(int32(v))
+				}
+			}
+		}
+		return b.NewRecord()
+	}
+	target := func(typ arrow.DataType, nullable bool) *arrow.Schema {
+		return arrow.NewSchema([]arrow.Field{{Name: "v", Type: typ, Nullable: nullable}}, nil)
+	}
+	i64 := arrow.PrimitiveTypes.Int64
+
+	tests := []struct {
+		name     string
+		rec      arrow.Record
+		schema   *arrow.Schema
+		nulls    int
+		errorRow string
+	}{
+		{"widen, no nulls", column(i64, false, []int64{1, 2, 3}, nil), target(i64, true), 0, ""},
+		{"widen keeps an all-null mask", column(i64, false, []int64{0, 0}, []bool{false, false}), target(i64, true), 2, ""},
+		{"narrow, no nulls", column(i64, true, []int64{1, 2, 3}, nil), target(i64, false), 0, ""},
+		{"narrow, all null", column(i64, true, []int64{0, 0}, []bool{false, false}), target(i64, false), 0, "row 0"},
+		{"narrow, one null", column(i64, true, []int64{1, 2, 0, 4}, []bool{true, true, false, true}), target(i64, false), 0, "row 2"},
+		{"narrow with a cast", column(arrow.PrimitiveTypes.Int32, true, []int64{1, 0}, []bool{true, false}), target(i64, false), 0, "row 1"},
+		{"widen with a cast", column(arrow.PrimitiveTypes.Int32, false, []int64{1, 0}, []bool{true, false}), target(i64, true), 1, ""},
+	}
+	for _, tt := range tests {
+		out, notes, err := CoerceRecordVerbose(tt.schema, tt.rec)
+		tt.rec.Release()
+		if tt.errorRow != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errorRow) {
+				t.Fatalf("%s: expected an error naming %s, got %v", tt.name, tt.errorRow, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !out.Schema().Equal(tt.schema) {
+			t.Fatalf("%s: expected schema %s, got %s", tt.name, tt.schema, out.Schema())
+		}
+		if got := out.Column(0).NullN(); got != tt.nulls {
+			t.Fatalf("%s: expected %d nulls, got %d", tt.name, tt.nulls, got)
+		}
+		if last := notes[len(notes)-1]; last.Lossy || !strings.Contains(last.Change, "nullable") {
+			t.Fatalf("%s: expected a lossless nullability note, got %v", tt.name, notes)
+		}
+		out.Release()
+	}
+}
+
+func TestSchemaEvolution(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_evolve.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	ids := array.NewInt64Builder(mem)
+	defer ids.Release()
+	ids.AppendValues([]int64{1, 2}, nil)
+	names := array.NewStringBuilder(mem)
+	defer names.Release()
+	names.AppendValues([]string{"a", "b"}, nil)
+	rec := array.NewRecord(schema, []arrow.Array{ids.NewArray(), names.NewArray()}, 2)
+	if err := lb.Write(ctx, rec, WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// The upstream drops name and adds score
+	upstream := arrow.NewSchema([]arrow.Field{
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	scores := array.NewFloat64Builder(mem)
+	defer scores.Release()
+	scores.AppendValues([]float64{0.5, 1.5}, nil)
+	ids.AppendValues([]int64{3, 4}, nil)
+	rec = array.NewRecord(upstream, []arrow.Array{scores.NewArray(), ids.NewArray()}, 2)
+	if err := lb.Write(ctx, rec, WithPassword(password)); !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch without evolution, got %v", err)
+	}
+	if err := lb.Write(ctx, rec, WithPassword(password), WithSchemaEvolution(true)); err != nil {
+		t.Fatalf("evolving write: %v", err)
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got := lb.Schema().Fields(); len(got) != 3 || got[2].Name != "score" {
+		t.Fatalf("expected score appended to the schema, got %v", lb.Schema())
+	}
+	if info, _ := lb.Info(); info.SchemaVersion != 2 {
+		t.Fatalf("expected schema version 2, got %d", info.SchemaVersion)
+	}
+
+	got, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	name := got.Column(1).(*array.String)
+	score := got.Column(2).(*array.Float64)
+	if got.NumRows() != 4 || name.Value(1) != "b" || !name.IsNull(2) || !score.IsNull(0) || score.Value(3) != 1.5 {
+		t.Fatalf("expected backfilled nulls, got %v", got)
+	}
+	got.Release()
+
+	seg, err := lb.ReadSegment(ctx, 0, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	if seg.NumCols() != 3 || seg.Column(2).NullN() != 2 {
+		t.Fatalf("expected the old segment to read score as null, got %v", seg)
+	}
+	seg.Release()
+
+	stats, err := lb.Stats(WithPassword(password))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if cs := stats.Columns["score"]; cs.Nulls != 2 {
+		t.Fatalf("expected 2 null scores in the stats, got %+v", cs)
+	}
+	if _, err := lb.Verify(ctx, WithPassword(password)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// Breaking changes still fail
+	breaking := []*arrow.Schema{
+		arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.BinaryTypes.String, Nullable: false}}, nil),
+		arrow.NewSchema([]arrow.Field{{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true}}, nil),
+		arrow.NewSchema([]arrow.Field{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+			{Name: "flag", Type: arrow.FixedWidthTypes.Boolean, Nullable: false},
+		}, nil),
+	}
+	for _, s := range breaking {
+		if _, err := EvolveSchema(lb.Schema(), s); err == nil {
+			t.Fatalf("expected evolving to %v to fail", s)
+		}
+	}
+	lb.Close()
+}
+
+func TestCompact(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_compact.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Ten appends of three rows, each in descending id order, with one null
+	for w := 0; w < 10; w++ {
+		ib := array.NewInt64Builder(mem)
+		sb := array.NewStringBuilder(mem)
+		for k := 2; k >= 0; k-- {
+			id := int64(w*3 + k)
+			if id == 13 {
+				ib.AppendNull()
+			} else {
+				ib.Append(id)
+			}
+			sb.Append(fmt.Sprintf("row%d", id))
+		}
+		ids, names := ib.NewArray(), sb.NewArray()
+		rec := array.NewRecord(schema, []arrow.Array{ids, names}, 3)
+		ids.Release()
+		names.Release()
+		ib.Release()
+		sb.Release()
+		if err := lb.Write(ctx, rec, WithPassword(password), WithMetadata(map[string]string{"source": "crm"})); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	lb.Close()
+
+	if _, err := Compact(ctx, tmpFile, WithPassword(password), WithSortBy("missing")); err == nil {
+		t.Fatalf("expected an unknown sort column to be rejected")
+	}
+	report, err := Compact(ctx, tmpFile, WithPassword(password), WithBlockSize(8), WithSortBy("id"), WithCompression("zstd"))
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if report.Rows != 30 || report.SegmentsBefore != 10 || report.SegmentsAfter != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open compacted file: %v", err)
+	}
+	defer lb.Close()
+	if lb.SegmentCount() != 4 {
+		t.Fatalf("expected 4 segments, got %d", lb.SegmentCount())
+	}
+	props, err := lb.Metadata(WithPassword(password))
+	if err != nil || props["source"] != "crm" {
+		t.Fatalf("expected properties to survive compaction, got %v, %v", props, err)
+	}
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer rec.Release()
+	ids := rec.Column(0).(*array.Int64)
+	names := rec.Column(1).(*array.String)
+	for i := 0; i < 29; i++ {
+		want := int64(i)
+		if i >= 13 {
+			want++
+		}
+		if ids.IsNull(i) || ids.Value(i) != want || names.Value(i) != fmt.Sprintf("row%d", want) {
+			t.Fatalf("row %d: expected id %d, got %v %s", i, want, ids.GetOneForMarshal(i), names.Value(i))
+		}
+	}
+	if !ids.IsNull(29) || names.Value(29) != "row13" {
+		t.Fatalf("expected the null id sorted last")
+	}
+	for _, block := range lb.file.Metadata().BlockInfo {
+		if block.Codec != "zstd" {
+			t.Fatalf("expected zstd blocks, got %s for %s", block.Codec, block.ColumnName)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "status", Type: DictionaryStringType, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_update.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Two segments of five rows, ids 0-9, all open
+	for w := 0; w < 2; w++ {
+		b := array.NewRecordBuilder(mem, schema)
+		for k := 0; k < 5; k++ {
+			b.Field(0).(*array.Int64Builder).Append(int64(w*5 + k))
+			b.Field(1).(*array.BinaryDictionaryBuilder).AppendString("open")
+			b.Field(2).(*array.Float64Builder).Append(float64(k))
+		}
+		rec := b.NewRecord()
+		b.Release()
+		if err := lb.Write(ctx, rec, WithPassword(password), WithSortBy("id")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	lb.Close()
+
+	if _, err := Update(ctx, tmpFile, map[string]string{"missing": "x"}, WithPassword(password)); err == nil {
+		t.Fatalf("expected an unknown column to be rejected")
+	}
+	if _, err := Update(ctx, tmpFile, map[string]string{"score": "high"}, WithPassword(password)); err == nil {
+		t.Fatalf("expected an unparsable value to be rejected")
+	}
+
+	report, err := Update(ctx, tmpFile, map[string]string{"status": "closed", "score": "9.5"},
+		WithPassword(password), WithFilter("id", ">=", 3), WithFilter("id", "<", 6))
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if report.Matched != 3 || report.Rows != 10 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open updated file: %v", err)
+	}
+	defer lb.Close()
+	if lb.SegmentCount() != 2 {
+		t.Fatalf("expected segments to keep their sizes, got %d", lb.SegmentCount())
+	}
+	if order := lb.file.Metadata().SortOrder; !slices.Equal(order, []string{"id"}) {
+		t.Fatalf("expected the sort order on id to survive, got %v", order)
+	}
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer rec.Release()
+	status := rec.Column(1).(*array.Dictionary)
+	values := status.Dictionary().(*array.String)
+	scores := rec.Column(2).(*array.Float64)
+	for i := 0; i < 10; i++ {
+		want, wantScore := "open", float64(i%5)
+		if i >= 3 && i < 6 {
+			want, wantScore = "closed", 9.5
+		}
+		if got := values.Value(status.GetValueIndex(i)); got != want || scores.Value(i) != wantScore {
+			t.Fatalf("row %d: expected %s/%v, got %s/%v", i, want, wantScore, got, scores.Value(i))
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "created", Type: arrow.FixedWidthTypes.Timestamp_s, Nullable: true},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_delete.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// Two segments: ids 0-3 created in 2019, ids 4-7 in 2021, one null
+	for w, year := range []int{2019, 2021} {
+		b := array.NewRecordBuilder(mem, schema)
+		for k := 0; k < 4; k++ {
+			id := w*4 + k
+			b.Field(0).(*array.Int64Builder).Append(int64(id))
+			if id == 5 {
+				b.Field(1).AppendNull()
+				continue
+			}
+			ts := time.Date(year, time.Month(k+1), 1, 0, 0, 0, 0, time.UTC)
+			b.Field(1).(*array.TimestampBuilder).Append(arrow.Timestamp(ts.Unix()))
+		}
+		rec := b.NewRecord()
+		b.Release()
+		if err := lb.Write(ctx, rec, WithPassword(password)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	lb.Close()
+
+	if _, err := Delete(ctx, tmpFile, WithPassword(password)); err == nil {
+		t.Fatalf("expected a delete without filters to be rejected")
+	}
+
+	// Everything from 2019 and id 6
+	report, err := Delete(ctx, tmpFile, WithPassword(password), WithFilter("created", "<", "2020-01-01"))
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if report.Matched != 4 || report.Rows != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	report, err = Delete(ctx, tmpFile, WithPassword(password), WithFilter("id", "=", 6))
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if report.Matched != 1 || report.Rows != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lb.Close()
+	if lb.SegmentCount() != 1 {
+		t.Fatalf("expected the emptied segment to be dropped, got %d segments", lb.SegmentCount())
+	}
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer rec.Release()
+	ids := rec.Column(0).(*array.Int64)
+	if !slices.Equal(ids.Int64Values(), []int64{4, 5, 7}) || !rec.Column(1).IsNull(1) {
+		t.Fatalf("unexpected rows left: %v", rec)
+	}
+}
+
+func TestWriteSortBy(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_sort_by.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	newRecord := func(ids ...int64) arrow.Record {
+		ib := array.NewInt64Builder(mem)
+		defer ib.Release()
+		sb := array.NewStringBuilder(mem)
+		defer sb.Release()
+		for _, id := range ids {
+			ib.Append(id)
+			sb.Append(fmt.Sprintf("row%d", id))
+		}
+		idArr, nameArr := ib.NewArray(), sb.NewArray()
+		defer idArr.Release()
+		defer nameArr.Release()
+		return array.NewRecord(schema, []arrow.Array{idArr, nameArr}, int64(len(ids)))
+	}
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+	if err := lb.Write(ctx, newRecord(3, 1, 2), WithPassword(password), WithSortBy("id", "name")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := lb.Write(ctx, newRecord(9, 7), WithPassword(password), WithSortBy("id")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, _ := lb.Info()
+	if len(info.SortOrder) != 1 || info.SortOrder[0] != "id" {
+		t.Fatalf("expected the shared sort order [id], got %v", info.SortOrder)
+	}
+
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	ids := rec.Column(0).(*array.Int64).Int64Values()
+	names := rec.Column(1).(*array.String)
+	want := []int64{1, 2, 3, 7, 9}
+	for i := range want {
+		if ids[i] != want[i] || names.Value(i) != fmt.Sprintf("row%d", want[i]) {
+			t.Fatalf("expected ids %v with their names, got %v", want, ids)
+		}
+	}
+	rec.Release()
+
+	if err := lb.Write(ctx, newRecord(5, 4), WithPassword(password), WithSortBy("missing")); err == nil {
+		t.Fatalf("expected an unknown sort column to be rejected")
+	}
+	if err := lb.Write(ctx, newRecord(5, 4), WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if info, _ := lb.Info(); len(info.SortOrder) != 0 {
+		t.Fatalf("expected an unsorted write to clear the sort order, got %v", info.SortOrder)
+	}
+}
+
+// countingAllocator counts the allocations made through it
+type countingAllocator struct {
+	*memory.CheckedAllocator
+	allocs int
+}
+
+func (a *countingAllocator) Allocate(size int) []byte {
+	a.allocs++
+	return a.CheckedAllocator.Allocate(size)
+}
+
+func TestWriteAllocator(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	input := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_write_allocator.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+
+	// The coerced and sorted copies come from the configured allocator
+	// and are freed once written
+	mem := &countingAllocator{CheckedAllocator: memory.NewCheckedAllocator(memory.NewGoAllocator())}
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), input)
+	defer b.Release()
+	b.Field(0).(*array.Int32Builder).AppendValues([]int32{3, 1, 2}, nil)
+	if err := lb.Write(ctx, b.NewRecord(), WithPassword(password), WithCoerce(true), WithSortBy("id"), WithAllocator(mem)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if mem.allocs == 0 {
+		t.Fatalf("expected Write to allocate from the configured allocator")
+	}
+	if n := mem.CurrentAlloc(); n != 0 {
+		t.Fatalf("expected Write to free its copies, %d bytes still allocated", n)
+	}
+
+	rec, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer rec.Release()
+	if ids := rec.Column(0).(*array.Int64).Int64Values(); !slices.Equal(ids, []int64{1, 2, 3}) {
+		t.Fatalf("expected sorted ids [1 2 3], got %v", ids)
+	}
+}
+
+func TestWriteOwnership(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_write_ownership.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+
+	src := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	newRecord := func(dt arrow.DataType, values ...string) arrow.Record {
+		b := array.NewRecordBuilder(src, arrow.NewSchema([]arrow.Field{{Name: "id", Type: dt}}, nil))
+		defer b.Release()
+		for _, v := range values {
+			if err := b.Field(0).AppendValueFromString(v); err != nil {
+				t.Fatalf("append %s: %v", v, err)
+			}
+		}
+		return b.NewRecord()
+	}
+
+	// A failed write leaves the record with the caller and frees any copy
+	bad := newRecord(arrow.BinaryTypes.String, "1", "x")
+	if err := lb.Write(ctx, bad, WithPassword(password), WithCoerce(true), WithAllocator(mem)); err == nil {
+		t.Fatalf("expected coercing x to int64 to fail")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	rec := newRecord(arrow.PrimitiveTypes.Int64, "2", "1")
+	if err := lb.Write(cancelled, rec, WithPassword(password), WithSortBy("id"), WithAllocator(mem)); err == nil {
+		t.Fatalf("expected a cancelled write to fail")
+	}
+	if n := mem.CurrentAlloc(); n != 0 {
+		t.Fatalf("expected failed writes to free their copies, %d bytes still allocated", n)
+	}
+	if bad.NumRows() != 2 || rec.Column(0).(*array.Int64).Value(0) != 2 {
+		t.Fatalf("expected failed writes to leave the records intact")
+	}
+	bad.Release()
+
+	// A successful write releases the record
+	if err := lb.Write(ctx, rec, WithPassword(password), WithSortBy("id"), WithAllocator(mem)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if n := src.CurrentAlloc() + mem.CurrentAlloc(); n != 0 {
+		t.Fatalf("expected Write to release the record, %d bytes still allocated", n)
+	}
+}
+
+func TestSortSpilled(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "key", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "seq", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+	dir := "/tmp/test_lockbox_spill"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mem := memory.NewGoAllocator()
+
+	// Keys repeat so stability is visible through seq; every 97th is null
+	const n = 10000
+	kb := array.NewInt64Builder(mem)
+	sb := array.NewInt64Builder(mem)
+	for i := 0; i < n; i++ {
+		if i%97 == 0 {
+			kb.AppendNull()
+		} else {
+			kb.Append(int64((i * 7919) % 50))
+		}
+		sb.Append(int64(i))
+	}
+	keys, seqs := kb.NewArray(), sb.NewArray()
+	kb.Release()
+	sb.Release()
+	rec := array.NewRecord(schema, []arrow.Array{keys, seqs}, n)
+	keys.Release()
+	seqs.Release()
+
+	// Input batches that do not line up with the runs
+	var batches []arrow.Record
+	for off := int64(0); off < n; off += 1234 {
+		batches = append(batches, rec.NewSlice(off, min(off+1234, n)))
+	}
+	rec.Release()
+	input, err := array.NewRecordReader(schema, batches)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	for _, b := range batches {
+		b.Release()
+	}
+	rr, err := SortSpilled(context.Background(), input, []string{"key"}, 3000, dir)
+	input.Release()
+	if err != nil {
+		t.Fatalf("sort: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 spilled runs, got %d", len(entries))
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		st, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if st.Mode().Perm() != 0o600 {
+			t.Fatalf("expected spill file mode 0600, got %v", st.Mode().Perm())
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if r, err := ipc.NewReader(f); err == nil {
+			r.Release()
+			t.Fatalf("expected the spill file not to be readable as Arrow IPC")
+		}
+		f.Close()
+	}
+
+	var rows int
+	var prevNull bool
+	var prevKey, prevSeq int64 = -1, -1
+	for rr.Next() {
+		r := rr.Record()
+		if r.NumRows() > 3000 {
+			t.Fatalf("expected records of at most 3000 rows, got %d", r.NumRows())
+		}
+		k := r.Column(0).(*array.Int64)
+		s := r.Column(1).(*array.Int64)
+		for i := 0; i < int(r.NumRows()); i++ {
+			null, key, seq := k.IsNull(i), k.Value(i), s.Value(i)
+			if null {
+				key = 0
+			}
+			if rows > 0 {
+				switch {
+				case prevNull && !null:
+					t.Fatalf("row %d: value after a null", rows)
+				case !null && !prevNull && key < prevKey:
+					t.Fatalf("row %d: key %d after %d", rows, key, prevKey)
+				case null == prevNull && key == prevKey && seq < prevSeq:
+					t.Fatalf("row %d: equal keys out of input order", rows)
+				}
+			}
+			prevNull, prevKey, prevSeq = null, key, seq
+			rows++
+		}
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	rr.Release()
+	if rows != n {
+		t.Fatalf("expected %d rows, got %d", n, rows)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the spill files to be removed, %d left", len(entries))
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: false},
+	}, nil)
+	tmpFile := "/tmp/test_lockbox_typed_errors.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	b := array.NewRecordBuilder(mem, schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	rec := b.NewRecord()
+	b.Release()
+	if err := lb.Write(ctx, rec, WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// A column that cannot be converted is both a mismatch and an
+	// unsupported type
+	other := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.FixedWidthTypes.Boolean, Nullable: false},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: false},
+	}, nil)
+	ob := array.NewRecordBuilder(mem, other)
+	ob.Field(0).(*array.BooleanBuilder).Append(true)
+	ob.Field(1).(*array.StringBuilder).Append("c")
+	bad := ob.NewRecord()
+	ob.Release()
+	err = lb.Write(ctx, bad, WithPassword(password), WithCoerce(true))
+	bad.Release()
+	if !errors.Is(err, ErrSchemaMismatch) || !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrSchemaMismatch and ErrUnsupportedType, got %v", err)
+	}
+	if _, err := lb.NewReader(WithPassword(password), WithFilter("name", "<", "a")); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType for an ordered string filter, got %v", err)
+	}
+	blockOffset := lb.file.Metadata().BlockInfo[0].Offset
+	lb.Close()
+
+	if _, err := Open(tmpFile, WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+
+	// Damage the first data block
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	data[blockOffset+8] ^= 0xff
+	if err := os.WriteFile(tmpFile, data, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = lb.Read(ctx, WithPassword(password))
+	lb.Close()
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt for a damaged block, got %v", err)
+	}
+
+	// A truncated file is corrupt too
+	if err := os.WriteFile(tmpFile, data[:10], 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := Open(tmpFile, WithPassword(password)); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt for a truncated file, got %v", err)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	tmpFile := "/tmp/test_lockbox_block_size.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+
+	ids := func(n int) arrow.Record {
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		for i := 0; i < n; i++ {
+			b.Append(int64(i))
+		}
+		arr := b.NewArray()
+		defer arr.Release()
+		return array.NewRecord(schema, []arrow.Array{arr}, int64(n))
+	}
+
+	if _, err := Create(tmpFile, schema, WithPassword(password), WithBlockSize(0)); err == nil {
+		t.Fatalf("expected a zero block size to be rejected")
+	}
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithBlockSize(2))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := lb.Write(ctx, ids(5), WithPassword(password)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if lb.SegmentCount() != 3 {
+		t.Fatalf("expected the file's block size to split 5 rows into 3 segments, got %d", lb.SegmentCount())
+	}
+	// A per-write block size overrides the file's
+	if err := lb.Write(ctx, ids(5), WithPassword(password), WithBlockSize(4)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if lb.SegmentCount() != 5 {
+		t.Fatalf("expected 2 more segments, got %d in total", lb.SegmentCount())
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer lb.Close()
+	info, _ := lb.Info()
+	if info.BlockSize != 2 || info.RowCount != 10 {
+		t.Fatalf("expected block size 2 and 10 rows, got %d and %d", info.BlockSize, info.RowCount)
+	}
+	seg, err := lb.ReadSegment(ctx, 4, WithPassword(password))
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	defer seg.Release()
+	if seg.NumRows() != 1 || seg.Column(0).(*array.Int64).Value(0) != 4 {
+		t.Fatalf("expected the last segment to hold row 4, got %v", seg)
+	}
+}
+
+func TestWriteEmptyRecord(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_empty.lbx"
+	defer os.Remove(tmpFile)
+
+	password := "test_password_123"
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+
+	// Concatenating no records yields an empty record, which still commits
+	// the ingest progress written with it
+	rec, err := ConcatRecords(nil, schema)
+	if err != nil || rec == nil || rec.NumRows() != 0 {
+		t.Fatalf("expected an empty record, got %v (%v)", rec, err)
+	}
+	ctx := context.Background()
+	state := IngestState{Fingerprint: "empty", Complete: true}
+	if err := lb.Write(ctx, rec, WithPassword(password), WithIngestState(state)); err != nil {
+		t.Fatalf("Failed to write an empty record: %v", err)
+	}
+	if got, ok := lb.IngestState(); !ok || got.Fingerprint != "empty" {
+		t.Fatalf("expected the ingest state to be committed, got %+v", got)
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer lb.Close()
+	n, err := lb.Count(ctx, WithPassword(password))
+	if err != nil || n != 0 {
+		t.Fatalf("expected 0 rows, got %d (%v)", n, err)
+	}
+	read, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if read.NumRows() != 0 {
+		t.Fatalf("expected an empty read, got %d rows", read.NumRows())
+	}
+	read.Release()
+}
+
+func TestCheckCoercible(t *testing.T) {
+	dict := &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "country", Type: dict},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	ok := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "country", Type: arrow.BinaryTypes.String},
+		{Name: "score", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "extra", Type: arrow.BinaryTypes.Binary},
+	}, nil)
+	if err := CheckCoercible(schema, ok); err != nil {
+		t.Fatalf("expected a coercible schema, got %v", err)
+	}
+
+	// Every problem is reported at once
+	bad := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+	err := CheckCoercible(schema, bad)
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	for _, want := range []string{"column id: cannot convert utf8 to int64", "column country: cannot convert float64", "missing column score"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+
+	swapped := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "country", Type: dict},
+	}, nil)
+	if err := CheckCoercible(schema, swapped); err == nil || !strings.Contains(err.Error(), "column country is at position 3, expected 2") {
+		t.Fatalf("expected a misplaced column error, got %v", err)
+	}
+}
+
+func TestWrongPasswordKeepsData(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_wrong_password.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	newRecord := func() arrow.Record {
+		idb := array.NewInt64Builder(memory.NewGoAllocator())
+		defer idb.Release()
+		idb.AppendValues([]int64{1, 2, 3}, nil)
+		idArr := idb.NewArray()
+		defer idArr.Release()
+		return array.NewRecord(schema, []arrow.Array{idArr}, 3)
+	}
+
+	ctx := context.Background()
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	if err := lb.Write(ctx, newRecord(), WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	before, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	unchanged := func() {
+		t.Helper()
+		after, err := os.ReadFile(tmpFile)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Fatalf("wrong password modified the file")
+		}
+	}
+
+	if _, err := Open(tmpFile, WithPassword("wrong"), WithMode(ReadWrite)); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	unchanged()
+
+	lb, err = Open(tmpFile, WithPassword(password), WithMode(ReadWrite))
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if err := lb.Write(ctx, newRecord(), WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+
+	// Files without a password slot derive a key from any password, so the
+	// key is checked against the first block instead
+	enc := &lb.file.Metadata().Encryption
+	slot := enc.PasswordSlot
+	enc.PasswordSlot = nil
+	if err := lb.Write(ctx, newRecord(), WithPassword("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword without a password slot, got %v", err)
+	}
+	enc.PasswordSlot = slot
+	lb.Close()
+	unchanged()
+
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer lb.Close()
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	want := newRecord()
+	defer want.Release()
+	if !array.RecordEqual(want, out) {
+		t.Fatalf("data changed after wrong password attempts")
+	}
+}
+
+func TestBlockNoncesUnique(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_nonces.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	lb.Close()
+
+	// Several sessions, each with its own encryptors, write one-row blocks
+	// from parallel workers
+	mem := memory.NewGoAllocator()
+	for session := 0; session < 4; session++ {
+		lb, err := Open(tmpFile, WithPassword(password))
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		b := array.NewRecordBuilder(mem, schema)
+		for i := 0; i < 64; i++ {
+			b.Field(0).(*array.Int64Builder).Append(int64(session*64 + i))
+			b.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("row %d", i))
+			b.Field(2).(*array.Float64Builder).Append(float64(i) / 2)
+		}
+		record := b.NewRecord()
+		b.Release()
+		if err := lb.Write(ctx, record, WithPassword(password), WithBlockSize(1), WithParallelism(4)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		lb.Close()
+	}
+
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	lb, err = Open(tmpFile, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer lb.Close()
+	blocks := lb.file.Metadata().BlockInfo
+	if len(blocks) != 4*64*3 {
+		t.Fatalf("expected %d blocks, got %d", 4*64*3, len(blocks))
+	}
+	seen := make(map[string]bool, len(blocks))
+	for _, bi := range blocks {
+		nonce, err := crypto.BlockNonce(data[bi.Offset : bi.Offset+bi.Length])
+		if err != nil {
+			t.Fatalf("block at %d: %v", bi.Offset, err)
+		}
+		if seen[string(nonce)] {
+			t.Fatalf("nonce %x reused by the block at %d", nonce, bi.Offset)
+		}
+		seen[string(nonce)] = true
+	}
+	if _, err := lb.Verify(ctx, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	// A block whose nonce repeats an earlier one fails verification
+	meta := lb.file.Metadata()
+	meta.BlockInfo = append(meta.BlockInfo, meta.BlockInfo[0])
+	if _, err := lb.Verify(ctx, WithPassword(password)); !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "nonce reused") {
+		t.Fatalf("expected a reused nonce error, got %v", err)
+	}
+}
+
+func TestWithAAD(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_aad.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password), WithAAD([]byte("tenant-a")))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	idb := array.NewInt64Builder(memory.NewGoAllocator())
+	idb.AppendValues([]int64{1, 2, 3}, nil)
+	idArr := idb.NewArray()
+	idb.Release()
+	record := array.NewRecord(schema, []arrow.Array{idArr}, 3)
+	idArr.Release()
+	defer record.Release()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	raw, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if bytes.Contains(raw, []byte("tenant-a")) {
+		t.Fatalf("the associated data itself was stored in the file")
+	}
+
+	for _, opts := range [][]Option{
+		{WithPassword(password), WithAAD([]byte("tenant-b"))},
+		{WithPassword(password)},
+	} {
+		if _, err := Open(tmpFile, opts...); !errors.Is(err, ErrWrongAAD) {
+			t.Fatalf("expected ErrWrongAAD, got %v", err)
+		}
+	}
+
+	lb, err = OpenRead(tmpFile, WithAAD([]byte("tenant-b")))
+	if err != nil {
+		t.Fatalf("Failed to open read-only: %v", err)
+	}
+	if _, err := lb.Read(ctx, WithPassword(password)); !errors.Is(err, ErrWrongAAD) {
+		t.Fatalf("expected ErrWrongAAD reading, got %v", err)
+	}
+
+	// Without the hint the blocks themselves still fail authentication
+	lb.file.Metadata().Encryption.AADHint = nil
+	lb.file.SetAAD(nil)
+	if _, err := lb.Read(ctx, WithPassword(password)); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected blocks to fail authentication, got %v", err)
+	}
+	lb.Close()
+
+	lb, err = Open(tmpFile, WithPassword(password), WithAAD([]byte("tenant-a")))
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer lb.Close()
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(record, out) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	plain := "/tmp/test_lockbox_aad_plain.lbx"
+	defer os.Remove(plain)
+	lb2, err := Create(plain, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	lb2.Close()
+	if _, err := Open(plain, WithPassword(password), WithAAD([]byte("tenant-a"))); !errors.Is(err, ErrWrongAAD) {
+		t.Fatalf("expected ErrWrongAAD for a file without associated data, got %v", err)
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_open_reader.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+	ctx := context.Background()
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3, 4}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "c", "d"}, nil)
+	record := b.NewRecord()
+	b.Release()
+	defer record.Release()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password), WithBlockSize(2)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	lb.Close()
+
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	var buf bytes.Buffer
+	buf.Write(data)
+	os.Remove(tmpFile)
+
+	lb, err = OpenReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer lb.Close()
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(record, out) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	rr, err := lb.NewReader(WithPassword(password), WithColumns("name"))
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	var names []string
+	for rr.Next() {
+		col := rr.Record().Column(0).(*array.String)
+		for i := 0; i < col.Len(); i++ {
+			names = append(names, col.Value(i))
+		}
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	rr.Release()
+	if !slices.Equal(names, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("unexpected streamed names %v", names)
+	}
+
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password)); err == nil {
+		t.Fatalf("expected writing an in-memory lockbox to fail")
+	}
+
+	// Without credentials only the plaintext metadata is available
+	meta, err := OpenReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open reader without credentials: %v", err)
+	}
+	if !meta.Schema().Equal(schema) {
+		t.Fatalf("unexpected schema %v", meta.Schema())
+	}
+	if _, err := meta.Read(ctx); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+	meta.Close()
+
+	if _, err := OpenReader(bytes.NewReader(buf.Bytes()[:10]), 10, WithPassword(password)); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt for truncated data, got %v", err)
+	}
+}
+
+func TestCreateTo(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+
+	password := "test_password_123"
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	lb, err := CreateTo(&buf, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to create lockbox: %v", err)
+	}
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "c"}, nil)
+	record := b.NewRecord()
+	b.Release()
+	defer record.Release()
+	record.Retain()
+	if err := lb.Write(ctx, record, WithPassword(password)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing written before Close, got %d bytes", buf.Len())
+	}
+	if err := lb.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	lb, err = OpenReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer lb.Close()
+	out, err := lb.Read(ctx, WithPassword(password))
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	defer out.Release()
+	if !array.RecordEqual(record, out) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	if _, err := CreateTo(&buf, schema, WithPassword(password), WithCipher("rot13")); err == nil {
+		t.Fatalf("expected an unknown cipher to be rejected")
+	}
+}
@@ -0,0 +1,771 @@
+package lockbox
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/rs/zerolog/log"
+)
+
+// Query is a SELECT parsed by ParseQuery:
+//
+//	SELECT * | col, ... | AGG(col), ... [FROM name]
+//	    [WHERE cond [AND cond ...]]
+//	    [ORDER BY col [ASC|DESC], ...] [LIMIT n]
+type Query struct {
+	// Columns is the projection in SELECT order, empty for *
+	Columns []string
+	// Aggregates replaces Columns for a query such as SELECT COUNT(*)
+	Aggregates []Aggregate
+	// Where holds the conditions, all of which must match
+	Where []Filter
+	// OrderBy lists the sort keys, earlier keys first
+	OrderBy []OrderKey
+	// Limit is the LIMIT row count, or 0 without one
+	Limit int64
+}
+
+// Aggregate is an aggregate call in a SELECT list
+type Aggregate struct {
+	// Func is COUNT, SUM, AVG, MIN or MAX
+	Func string
+	// Column is the argument, empty for COUNT(*)
+	Column string
+}
+
+// Name returns the result column name: count for COUNT(*), otherwise the
+// function and column, as in sum_score
+func (a Aggregate) Name() string {
+	if a.Column == "" {
+		return "count"
+	}
+	return strings.ToLower(a.Func) + "_" + a.Column
+}
+
+// OrderKey is an ORDER BY column
+type OrderKey struct {
+	Column string
+	Desc   bool
+}
+
+// aggregateFuncs lists the supported aggregate functions
+var aggregateFuncs = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// clauseRank is the order clauses must appear in
+var clauseRank = map[string]int{"FROM": 0, "WHERE": 1, "ORDER": 2, "LIMIT": 3}
+
+// ParseQuery parses a SELECT; see Query for the grammar. Keywords are
+// case-insensitive, while column names and values are kept as written.
+// FROM is optional and its name ignored, since a query covers one file.
+// WHERE conditions are those of ParseFilter joined by AND, and quoted
+// values may contain spaces. Aggregates cannot be mixed with columns or
+// ORDER BY, as there is no GROUP BY.
+func ParseQuery(q string) (*Query, error) {
+	tokens, err := queryTokens(q)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", q, err)
+	}
+	if len(tokens) == 0 || !strings.EqualFold(tokens[0], "SELECT") {
+		return nil, fmt.Errorf("invalid query %q: expected SELECT", q)
+	}
+
+	// clauses maps each keyword to the tokens that follow it
+	clauses := map[string][]string{}
+	var order []string
+	clause := "SELECT"
+	for i := 1; i < len(tokens); i++ {
+		switch kw := strings.ToUpper(tokens[i]); kw {
+		case "FROM", "WHERE", "ORDER", "LIMIT":
+			if _, seen := clauses[kw]; seen {
+				return nil, fmt.Errorf("invalid query %q: repeated %s", q, kw)
+			}
+			if kw == "ORDER" {
+				if i+1 == len(tokens) || !strings.EqualFold(tokens[i+1], "BY") {
+					return nil, fmt.Errorf("invalid query %q: expected BY after ORDER", q)
+				}
+				i++
+			}
+			clause = kw
+			order = append(order, kw)
+			clauses[kw] = []string{}
+			continue
+		}
+		clauses[clause] = append(clauses[clause], tokens[i])
+	}
+	for i, kw := range order {
+		if i > 0 && clauseRank[kw] < clauseRank[order[i-1]] {
+			return nil, fmt.Errorf("invalid query %q: %s before %s", q, order[i-1], kw)
+		}
+	}
+
+	pq := &Query{}
+	if err := pq.parseSelectList(clauses["SELECT"]); err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", q, err)
+	}
+
+	if from, ok := clauses["FROM"]; ok && len(from) != 1 {
+		return nil, fmt.Errorf("invalid query %q: FROM takes one name", q)
+	}
+
+	if where, ok := clauses["WHERE"]; ok {
+		for _, cond := range splitTokens(where, "AND") {
+			for _, tok := range cond {
+				if strings.EqualFold(tok, "OR") || strings.EqualFold(tok, "NOT") {
+					return nil, fmt.Errorf("invalid query %q: only AND is supported in WHERE", q)
+				}
+			}
+			if len(cond) == 0 {
+				return nil, fmt.Errorf("invalid query %q: expected a condition", q)
+			}
+			f, err := ParseFilter(strings.Join(cond, " "))
+			if err != nil {
+				return nil, fmt.Errorf("invalid query %q: %w", q, err)
+			}
+			pq.Where = append(pq.Where, f)
+		}
+	}
+
+	if orderBy, ok := clauses["ORDER"]; ok {
+		if len(pq.Aggregates) > 0 {
+			return nil, fmt.Errorf("invalid query %q: ORDER BY cannot be used with aggregates", q)
+		}
+		for _, key := range splitTokens(orderBy, ",") {
+			switch {
+			case len(key) == 1:
+				pq.OrderBy = append(pq.OrderBy, OrderKey{Column: key[0]})
+			case len(key) == 2 && (strings.EqualFold(key[1], "ASC") || strings.EqualFold(key[1], "DESC")):
+				pq.OrderBy = append(pq.OrderBy, OrderKey{Column: key[0], Desc: strings.EqualFold(key[1], "DESC")})
+			default:
+				return nil, fmt.Errorf("invalid query %q: expected ORDER BY col [ASC|DESC], ...", q)
+			}
+		}
+	}
+
+	if limit, ok := clauses["LIMIT"]; ok {
+		if len(limit) != 1 {
+			return nil, fmt.Errorf("invalid query %q: LIMIT takes one number", q)
+		}
+		n, err := strconv.ParseInt(limit[0], 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid query %q: LIMIT must be a positive integer", q)
+		}
+		pq.Limit = n
+	}
+	return pq, nil
+}
+
+// parseSelectList fills in the columns or aggregates of a SELECT list
+func (q *Query) parseSelectList(tokens []string) error {
+	if len(tokens) == 1 && tokens[0] == "*" {
+		return nil
+	}
+	for _, item := range splitTokens(tokens, ",") {
+		switch {
+		case len(item) == 1 && item[0] != "*" && item[0] != "(" && item[0] != ")":
+			if contains(q.Columns, item[0]) {
+				return fmt.Errorf("duplicate column %s", item[0])
+			}
+			q.Columns = append(q.Columns, item[0])
+		case len(item) == 4 && item[1] == "(" && item[3] == ")":
+			fn := strings.ToUpper(item[0])
+			if !aggregateFuncs[fn] {
+				return fmt.Errorf("unknown function %s", item[0])
+			}
+			agg := Aggregate{Func: fn, Column: item[2]}
+			if item[2] == "*" {
+				if fn != "COUNT" {
+					return fmt.Errorf("%s requires a column", fn)
+				}
+				agg.Column = ""
+			}
+			q.Aggregates = append(q.Aggregates, agg)
+		default:
+			return fmt.Errorf("expected *, a column list or aggregates after SELECT")
+		}
+	}
+	if len(q.Columns) > 0 && len(q.Aggregates) > 0 {
+		return fmt.Errorf("aggregates cannot be mixed with columns")
+	}
+	return nil
+}
+
+// queryTokens splits q at whitespace, with commas and parentheses as tokens
+// of their own. Quoted text stays in its token, quotes included.
+func queryTokens(q string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; c {
+		case ' ', '\t', '\n', '\r':
+			flush()
+		case ',', '(', ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case '\'', '"':
+			end := strings.IndexByte(q[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			cur.WriteString(q[i : i+end+2])
+			i += end + 1
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// splitTokens splits tokens at each separator, matched case-insensitively
+func splitTokens(tokens []string, sep string) [][]string {
+	parts := [][]string{{}}
+	for _, tok := range tokens {
+		if strings.EqualFold(tok, sep) {
+			parts = append(parts, []string{})
+			continue
+		}
+		parts[len(parts)-1] = append(parts[len(parts)-1], tok)
+	}
+	return parts
+}
+
+// Query runs a SELECT parsed by ParseQuery and returns the whole result as
+// one record
+func (lb *Lockbox) Query(ctx context.Context, query string, opts ...Option) (arrow.Record, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := lb.NewQueryReader(ctx, q, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+
+	recs, err := readAll(ctx, rr)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRecords(recs)
+	result, err := ConcatRecords(nil, rr.Schema(), recs...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Str("query", query).Int64("rows", result.NumRows()).Msg("Executed query on lockbox")
+
+	return result, nil
+}
+
+// NewQueryReader returns a reader over the result of q. Plain queries
+// stream like NewReader: only the selected and filtered columns are
+// decrypted, WHERE skips segments the statistics rule out and LIMIT stops
+// reading early. Aggregates are computed over the filtered rows one segment
+// at a time. ORDER BY reads the filtered rows of the needed columns into
+// memory and sorts them, nulls last in either direction.
+func (lb *Lockbox) NewQueryReader(ctx context.Context, q *Query, opts ...Option) (array.RecordReader, error) {
+	opts = slices.Clip(opts)
+	for _, f := range q.Where {
+		opts = append(opts, WithFilter(f.Column, f.Op, f.Value))
+	}
+
+	var result arrow.Record
+	var err error
+	switch {
+	case len(q.Aggregates) > 0:
+		result, err = lb.aggregateQuery(ctx, q, opts)
+	case len(q.OrderBy) > 0:
+		result, err = lb.sortedQuery(ctx, q, opts)
+	default:
+		return lb.selectReader(q, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer result.Release()
+	return array.NewRecordReader(result.Schema(), []arrow.Record{result})
+}
+
+// selectReader streams a query without aggregates or ORDER BY
+func (lb *Lockbox) selectReader(q *Query, opts []Option) (array.RecordReader, error) {
+	if len(q.Columns) > 0 {
+		opts = append(opts, WithColumns(q.Columns...))
+	}
+	if q.Limit > 0 {
+		opts = append(opts, WithHead(q.Limit))
+	}
+	rr, err := lb.NewReader(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Columns) == 0 {
+		return rr, nil
+	}
+	return newColumnReader(rr, q.Columns), nil
+}
+
+// sortedQuery reads the rows matching q into memory and sorts them
+func (lb *Lockbox) sortedQuery(ctx context.Context, q *Query, opts []Option) (arrow.Record, error) {
+	columns := q.Columns
+	if len(columns) == 0 {
+		for _, f := range lb.Schema().Fields() {
+			columns = append(columns, f.Name)
+		}
+	}
+	needed := append([]string(nil), columns...)
+	keys := make([]string, len(q.OrderBy))
+	for i, k := range q.OrderBy {
+		keys[i] = k.Column
+		if !contains(needed, k.Column) {
+			needed = append(needed, k.Column)
+		}
+	}
+	if err := lb.checkColumns(needed); err != nil {
+		return nil, err
+	}
+	if err := checkSortColumns(lb.Schema(), keys); err != nil {
+		return nil, err
+	}
+
+	rr, err := lb.NewReader(append(opts, WithColumns(needed...))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+	recs, err := readAll(ctx, rr)
+	if err != nil {
+		return nil, err
+	}
+	mem := memory.DefaultAllocator
+	all, err := ConcatRecords(mem, rr.Schema(), recs...)
+	releaseRecords(recs)
+	if err != nil {
+		return nil, err
+	}
+	defer all.Release()
+
+	cmps := make([]func(i, j int) int, len(q.OrderBy))
+	for k, key := range q.OrderBy {
+		cmps[k] = orderCompare(all.Column(all.Schema().FieldIndices(key.Column)[0]), key.Desc)
+	}
+	perm := make([]int64, all.NumRows())
+	for i := range perm {
+		perm[i] = int64(i)
+	}
+	slices.SortStableFunc(perm, func(a, b int64) int {
+		for _, c := range cmps {
+			if r := c(int(a), int(b)); r != 0 {
+				return r
+			}
+		}
+		return 0
+	})
+	if q.Limit > 0 && q.Limit < int64(len(perm)) {
+		perm = perm[:q.Limit]
+	}
+
+	sorted, err := reorderRecord(ctx, mem, all, perm)
+	if err != nil {
+		return nil, err
+	}
+	defer sorted.Release()
+	return projectRecord(sorted, columns), nil
+}
+
+// orderCompare orders rows of col ascending, or descending with desc, with
+// nulls last either way
+func orderCompare(col arrow.Array, desc bool) func(i, j int) int {
+	c := compareFunc(col, col)
+	if !desc {
+		return c
+	}
+	return func(i, j int) int {
+		if col.IsNull(i) || col.IsNull(j) {
+			return c(i, j)
+		}
+		return -c(i, j)
+	}
+}
+
+// projectRecord returns the named columns of rec in the given order
+func projectRecord(rec arrow.Record, columns []string) arrow.Record {
+	fields := make([]arrow.Field, len(columns))
+	cols := make([]arrow.Array, len(columns))
+	for i, name := range columns {
+		idx := rec.Schema().FieldIndices(name)[0]
+		fields[i] = rec.Schema().Field(idx)
+		cols[i] = rec.Column(idx)
+	}
+	return array.NewRecord(arrow.NewSchema(fields, nil), cols, rec.NumRows())
+}
+
+// aggregateQuery computes the aggregates of q one segment at a time
+func (lb *Lockbox) aggregateQuery(ctx context.Context, q *Query, opts []Option) (arrow.Record, error) {
+	schema := lb.Schema()
+	var columns []string
+	for _, agg := range q.Aggregates {
+		if agg.Column != "" && !contains(columns, agg.Column) {
+			columns = append(columns, agg.Column)
+		}
+	}
+	if err := lb.checkColumns(columns); err != nil {
+		return nil, err
+	}
+	for _, agg := range q.Aggregates {
+		if agg.Column == "" {
+			continue
+		}
+		dt := schema.Field(schema.FieldIndices(agg.Column)[0]).Type
+		switch agg.Func {
+		case "SUM", "AVG":
+			if !numeric(dt) {
+				return nil, fmt.Errorf("%w: %s on column %s of type %s", ErrUnsupportedType, agg.Func, agg.Column, dt)
+			}
+		case "MIN", "MAX":
+			if !sortable(dt) {
+				return nil, fmt.Errorf("%w: %s on column %s of type %s", ErrUnsupportedType, agg.Func, agg.Column, dt)
+			}
+		}
+	}
+	// COUNT(*) alone reads one column, as Count does
+	if len(columns) == 0 {
+		switch {
+		case len(q.Where) > 0:
+			columns = []string{q.Where[0].Column}
+		case schema.NumFields() > 0:
+			columns = []string{schema.Field(0).Name}
+		}
+	}
+
+	rr, err := lb.NewReader(append(opts, WithColumns(columns...))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+
+	mem := memory.DefaultAllocator
+	accs := make([]*accumulator, len(q.Aggregates))
+	for i, agg := range q.Aggregates {
+		accs[i] = &accumulator{agg: agg, index: -1}
+		if agg.Column != "" {
+			accs[i].index = rr.Schema().FieldIndices(agg.Column)[0]
+			accs[i].dt = rr.Schema().Field(accs[i].index).Type
+		}
+	}
+	defer func() {
+		for _, a := range accs {
+			if a.best != nil {
+				a.best.Release()
+			}
+		}
+	}()
+
+	for rr.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, a := range accs {
+			if err := a.add(mem, rr.Record()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := rr.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	fields := make([]arrow.Field, len(accs))
+	cols := make([]arrow.Array, len(accs))
+	for i, a := range accs {
+		cols[i] = a.result(mem)
+		defer cols[i].Release()
+		fields[i] = arrow.Field{Name: a.agg.Name(), Type: cols[i].DataType(), Nullable: a.agg.Func != "COUNT"}
+	}
+	return array.NewRecord(arrow.NewSchema(fields, nil), cols, 1), nil
+}
+
+// numeric reports whether SUM and AVG accept values of dt
+func numeric(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT32, arrow.FLOAT64:
+		return true
+	}
+	return false
+}
+
+// accumulator holds the running state of one aggregate
+type accumulator struct {
+	agg Aggregate
+	// index is the column in the records read, or -1 for COUNT(*)
+	index int
+	dt    arrow.DataType
+	// count is the number of rows, or of non-null values for a column
+	count int64
+	// sum is the SUM of an integer column
+	sum int64
+	// fsum is the SUM of a float column and the total for AVG
+	fsum float64
+	// best is the MIN or MAX so far as a one-row array, nil until a
+	// non-null value is seen
+	best arrow.Array
+}
+
+// add feeds the rows of rec to the aggregate
+func (a *accumulator) add(mem memory.Allocator, rec arrow.Record) error {
+	if a.index < 0 {
+		a.count += rec.NumRows()
+		return nil
+	}
+	col := rec.Column(a.index)
+	switch a.agg.Func {
+	case "COUNT":
+		a.count += int64(col.Len() - col.NullN())
+	case "SUM", "AVG":
+		return a.addNumbers(col)
+	case "MIN", "MAX":
+		return a.addExtreme(mem, col)
+	}
+	return nil
+}
+
+// addNumbers adds the non-null values of a numeric column
+func (a *accumulator) addNumbers(col arrow.Array) error {
+	switch c := col.(type) {
+	case *array.Int8:
+		return addInts(a, col, c.Value)
+	case *array.Int16:
+		return addInts(a, col, c.Value)
+	case *array.Int32:
+		return addInts(a, col, c.Value)
+	case *array.Int64:
+		return addInts(a, col, c.Value)
+	case *array.Uint8:
+		return addInts(a, col, c.Value)
+	case *array.Uint16:
+		return addInts(a, col, c.Value)
+	case *array.Uint32:
+		return addInts(a, col, c.Value)
+	case *array.Uint64:
+		return addInts(a, col, c.Value)
+	case *array.Float32:
+		addFloats(a, col, c.Value)
+	case *array.Float64:
+		addFloats(a, col, c.Value)
+	}
+	return nil
+}
+
+// addInts adds integer values, failing once SUM overflows int64
+func addInts[T int8 | int16 | int32 | int64 | uint8 | uint16 | uint32 | uint64](a *accumulator, col arrow.Array, value func(int) T) error {
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			continue
+		}
+		v := value(i)
+		a.count++
+		a.fsum += float64(v)
+		if a.agg.Func != "SUM" {
+			continue
+		}
+		n := int64(v)
+		s := a.sum + n
+		if (v > 0 && (n < 0 || s < a.sum)) || (v < 0 && s > a.sum) {
+			return fmt.Errorf("SUM(%s) overflows int64", a.agg.Column)
+		}
+		a.sum = s
+	}
+	return nil
+}
+
+// addFloats adds floating point values
+func addFloats[T float32 | float64](a *accumulator, col arrow.Array, value func(int) T) {
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) {
+			a.count++
+			a.fsum += float64(value(i))
+		}
+	}
+}
+
+// addExtreme keeps the smallest or largest non-null value of col. The
+// value is copied so best does not hold on to the whole segment.
+func (a *accumulator) addExtreme(mem memory.Allocator, col arrow.Array) error {
+	better := -1
+	if a.agg.Func == "MAX" {
+		better = 1
+	}
+	cmp := compareFunc(col, col)
+	found := -1
+	for i := 0; i < col.Len(); i++ {
+		if !col.IsNull(i) && (found < 0 || cmp(i, found) == better) {
+			found = i
+		}
+	}
+	if found < 0 || (a.best != nil && compareFunc(col, a.best)(found, 0) != better) {
+		return nil
+	}
+	slice := array.NewSlice(col, int64(found), int64(found+1))
+	defer slice.Release()
+	best, err := array.Concatenate([]arrow.Array{slice}, mem)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s(%s): %w", a.agg.Func, a.agg.Column, err)
+	}
+	if a.best != nil {
+		a.best.Release()
+	}
+	a.best = best
+	return nil
+}
+
+// result returns the aggregate as a one-row array. SUM, AVG, MIN and MAX
+// are null when no non-null value was seen.
+func (a *accumulator) result(mem memory.Allocator) arrow.Array {
+	switch a.agg.Func {
+	case "MIN", "MAX":
+		if a.best == nil {
+			return array.MakeArrayOfNull(mem, a.dt, 1)
+		}
+		a.best.Retain()
+		return a.best
+	case "COUNT":
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		b.Append(a.count)
+		return b.NewArray()
+	case "SUM":
+		if a.dt.ID() != arrow.FLOAT32 && a.dt.ID() != arrow.FLOAT64 {
+			b := array.NewInt64Builder(mem)
+			defer b.Release()
+			if a.count == 0 {
+				b.AppendNull()
+			} else {
+				b.Append(a.sum)
+			}
+			return b.NewArray()
+		}
+	}
+	b := array.NewFloat64Builder(mem)
+	defer b.Release()
+	switch {
+	case a.count == 0:
+		b.AppendNull()
+	case a.agg.Func == "AVG":
+		b.Append(a.fsum / float64(a.count))
+	default:
+		b.Append(a.fsum)
+	}
+	return b.NewArray()
+}
+
+// readAll returns every record of rr, retained, stopping with ctx's error
+// once ctx is cancelled
+func readAll(ctx context.Context, rr array.RecordReader) ([]arrow.Record, error) {
+	var recs []arrow.Record
+	for rr.Next() {
+		if err := ctx.Err(); err != nil {
+			releaseRecords(recs)
+			return nil, err
+		}
+		rec := rr.Record()
+		rec.Retain()
+		recs = append(recs, rec)
+	}
+	if err := rr.Err(); err != nil {
+		releaseRecords(recs)
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+	return recs, nil
+}
+
+// releaseRecords releases each record
+func releaseRecords(recs []arrow.Record) {
+	for _, rec := range recs {
+		rec.Release()
+	}
+}
+
+// columnReader returns the records of another reader with their columns
+// in SELECT order, since NewReader keeps schema order
+type columnReader struct {
+	refCount int64
+	rr       array.RecordReader
+	schema   *arrow.Schema
+	indices  []int
+	cur      arrow.Record
+}
+
+// newColumnReader reorders the columns of rr, taking over its reference
+func newColumnReader(rr array.RecordReader, columns []string) *columnReader {
+	fields := make([]arrow.Field, len(columns))
+	indices := make([]int, len(columns))
+	for i, name := range columns {
+		indices[i] = rr.Schema().FieldIndices(name)[0]
+		fields[i] = rr.Schema().Field(indices[i])
+	}
+	return &columnReader{refCount: 1, rr: rr, schema: arrow.NewSchema(fields, nil), indices: indices}
+}
+
+// Schema returns the reordered schema
+func (cr *columnReader) Schema() *arrow.Schema {
+	return cr.schema
+}
+
+// Next advances to the next record, returning false at the end or on error
+func (cr *columnReader) Next() bool {
+	if cr.cur != nil {
+		cr.cur.Release()
+		cr.cur = nil
+	}
+	if !cr.rr.Next() {
+		return false
+	}
+	rec := cr.rr.Record()
+	cols := make([]arrow.Array, len(cr.indices))
+	for i, idx := range cr.indices {
+		cols[i] = rec.Column(idx)
+	}
+	cr.cur = array.NewRecord(cr.schema, cols, rec.NumRows())
+	return true
+}
+
+// Record returns the current record, valid until the next call to Next
+func (cr *columnReader) Record() arrow.Record {
+	return cr.cur
+}
+
+// Err returns the error of the underlying reader
+func (cr *columnReader) Err() error {
+	return cr.rr.Err()
+}
+
+// Retain increases the reference count of the reader
+func (cr *columnReader) Retain() {
+	atomic.AddInt64(&cr.refCount, 1)
+}
+
+// Release decreases the reference count and releases the underlying
+// reader once it reaches zero
+func (cr *columnReader) Release() {
+	if atomic.AddInt64(&cr.refCount, -1) == 0 {
+		if cr.cur != nil {
+			cr.cur.Release()
+			cr.cur = nil
+		}
+		cr.rr.Release()
+	}
+}
@@ -0,0 +1,264 @@
+package lockbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery("select id, Name from data where age >= 18 AND ts<'2024-01-01T00:00:00Z' AND note = 'a and b' order by Name desc, id limit 5")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !slices.Equal(q.Columns, []string{"id", "Name"}) {
+		t.Fatalf("unexpected columns %v", q.Columns)
+	}
+	want := []Filter{
+		{Column: "age", Op: ">=", Value: "18"},
+		{Column: "ts", Op: "<", Value: "2024-01-01T00:00:00Z"},
+		{Column: "note", Op: "=", Value: "a and b"},
+	}
+	if !slices.Equal(q.Where, want) {
+		t.Fatalf("unexpected conditions %v", q.Where)
+	}
+	if !slices.Equal(q.OrderBy, []OrderKey{{Column: "Name", Desc: true}, {Column: "id"}}) {
+		t.Fatalf("unexpected order %v", q.OrderBy)
+	}
+	if q.Limit != 5 {
+		t.Fatalf("expected limit 5, got %d", q.Limit)
+	}
+
+	q, err = ParseQuery("SELECT *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(q.Columns) != 0 || len(q.Aggregates) != 0 || len(q.Where) != 0 || len(q.OrderBy) != 0 || q.Limit != 0 {
+		t.Fatalf("expected an unrestricted query, got %+v", q)
+	}
+
+	q, err = ParseQuery("SELECT count(*), Sum( score ) WHERE score>=80")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !slices.Equal(q.Aggregates, []Aggregate{{Func: "COUNT"}, {Func: "SUM", Column: "score"}}) {
+		t.Fatalf("unexpected aggregates %v", q.Aggregates)
+	}
+	if q.Aggregates[0].Name() != "count" || q.Aggregates[1].Name() != "sum_score" {
+		t.Fatalf("unexpected names %s, %s", q.Aggregates[0].Name(), q.Aggregates[1].Name())
+	}
+
+	for _, bad := range []string{
+		"",
+		"DELETE FROM data",
+		"SELECT",
+		"SELECT id,",
+		"SELECT id, id",
+		"SELECT *, id",
+		"SELECT id FROM",
+		"SELECT id WHERE a=1 OR b=2",
+		"SELECT id WHERE a=1 AND",
+		"SELECT id WHERE name='bob",
+		"SELECT id LIMIT 0",
+		"SELECT id LIMIT ten",
+		"SELECT id LIMIT 5 WHERE a=1",
+		"SELECT id ORDER id",
+		"SELECT id ORDER BY",
+		"SELECT id ORDER BY id UP",
+		"SELECT id, COUNT(*)",
+		"SELECT COUNT(*) ORDER BY id",
+		"SELECT SUM(*)",
+		"SELECT MEDIAN(id)",
+	} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Fatalf("%q: expected a parse error", bad)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr, col, op, value string
+	}{
+		{"age>=18", "age", ">=", "18"},
+		{" score < 0.5 ", "score", "<", "0.5"},
+		{"id=7", "id", "=", "7"},
+		{`ts>"2024-01-01T00:00:00Z"`, "ts", ">", "2024-01-01T00:00:00Z"},
+		{"n<=-3", "n", "<=", "-3"},
+		{"username='bob'", "username", "=", "bob"},
+		{"status != 'open'", "status", "!=", "open"},
+		{"note=''", "note", "=", ""},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+		}
+		if f.Column != tt.col || f.Op != tt.op || f.Value != tt.value {
+			t.Fatalf("ParseFilter(%q) = %q %q %q", tt.expr, f.Column, f.Op, f.Value)
+		}
+	}
+
+	for _, expr := range []string{"age", ">=18", "age>=", "age=>18", "age==18", "age!18", "age!==18"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestQueryEngine(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "user_id", Type: arrow.PrimitiveTypes.Int64, Nullable: false},
+		{Name: "username", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	tmpFile := "/tmp/test_lockbox_query_engine.lbx"
+	defer os.Remove(tmpFile)
+	password := "test_password_123"
+
+	lb, err := Create(tmpFile, schema, WithPassword(password))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer lb.Close()
+
+	ctx := context.Background()
+	mem := memory.NewGoAllocator()
+	segments := []struct {
+		userIDs    []int64
+		names      []string
+		nameValid  []bool
+		scores     []float64
+		scoreValid []bool
+	}{
+		{[]int64{1, 4, 5}, []string{"alice", "bob", ""}, []bool{true, true, false}, []float64{90, 85, 0}, []bool{true, true, false}},
+		{[]int64{7, 6, 2}, []string{"bob smith", "bob", "carol"}, nil, []float64{0, 70, 95}, []bool{false, true, true}},
+	}
+	for i, seg := range segments {
+		b := array.NewRecordBuilder(mem, schema)
+		b.Field(0).(*array.Int64Builder).AppendValues([]int64{int64(i*3 + 1), int64(i*3 + 2), int64(i*3 + 3)}, nil)
+		b.Field(1).(*array.Int64Builder).AppendValues(seg.userIDs, nil)
+		b.Field(2).(*array.StringBuilder).AppendValues(seg.names, seg.nameValid)
+		b.Field(3).(*array.Float64Builder).AppendValues(seg.scores, seg.scoreValid)
+		if err := lb.Write(ctx, b.NewRecord(), WithPassword(password)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		b.Release()
+	}
+
+	query := func(sql string) arrow.Record {
+		t.Helper()
+		res, err := lb.Query(ctx, sql, WithPassword(password))
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return res
+	}
+	ids := func(sql string) []int64 {
+		t.Helper()
+		res := query(sql)
+		defer res.Release()
+		idx := res.Schema().FieldIndices("id")
+		if len(idx) == 0 {
+			t.Fatalf("%s: no id column in %s", sql, res.Schema())
+		}
+		return slices.Clone(res.Column(idx[0]).(*array.Int64).Int64Values())
+	}
+
+	// FROM is optional for aggregates too
+	res := query("SELECT COUNT(*), COUNT(score), SUM(user_id), AVG(score), MIN(username), MAX(username)")
+	if res.NumRows() != 1 || res.NumCols() != 6 {
+		t.Fatalf("unexpected result dims %d x %d", res.NumRows(), res.NumCols())
+	}
+	if got := res.ColumnName(0); got != "count" {
+		t.Fatalf("expected column count, got %s", got)
+	}
+	if got := res.Column(0).(*array.Int64).Value(0); got != 6 {
+		t.Fatalf("expected COUNT(*) 6, got %d", got)
+	}
+	if got := res.Column(1).(*array.Int64).Value(0); got != 4 {
+		t.Fatalf("expected COUNT(score) 4, got %d", got)
+	}
+	if got := res.Column(2).(*array.Int64).Value(0); got != 25 {
+		t.Fatalf("expected SUM(user_id) 25, got %d", got)
+	}
+	if got := res.Column(3).(*array.Float64).Value(0); got != 85 {
+		t.Fatalf("expected AVG(score) 85, got %f", got)
+	}
+	if got := res.Column(4).(*array.String).Value(0); got != "alice" {
+		t.Fatalf("expected MIN(username) alice, got %s", got)
+	}
+	if got := res.Column(5).(*array.String).Value(0); got != "carol" {
+		t.Fatalf("expected MAX(username) carol, got %s", got)
+	}
+	res.Release()
+
+	// Every AND'd condition applies to aggregates
+	res = query("SELECT MAX(score) FROM t WHERE score >= 80 AND user_id > 3")
+	if got := res.Column(0).(*array.Float64).Value(0); got != 85 {
+		t.Fatalf("expected MAX(score) 85, got %f", got)
+	}
+	res.Release()
+
+	// Aggregates over no rows are null, except COUNT
+	res = query("SELECT COUNT(*), SUM(user_id), MIN(score) WHERE id > 100")
+	if res.Column(0).(*array.Int64).Value(0) != 0 || !res.Column(1).IsNull(0) || !res.Column(2).IsNull(0) {
+		t.Fatalf("unexpected aggregates over no rows: %v", res)
+	}
+	res.Release()
+
+	if got := ids("SELECT id WHERE score>=80 ORDER BY score"); !slices.Equal(got, []int64{2, 1, 6}) {
+		t.Fatalf("unexpected ids for WHERE ... ORDER BY: %v", got)
+	}
+
+	// Nulls sort last in either direction
+	if got := ids("SELECT id, score ORDER BY score"); !slices.Equal(got, []int64{5, 2, 1, 6, 3, 4}) {
+		t.Fatalf("unexpected ascending order: %v", got)
+	}
+	if got := ids("SELECT id, score ORDER BY score DESC"); !slices.Equal(got, []int64{6, 1, 2, 5, 3, 4}) {
+		t.Fatalf("unexpected descending order: %v", got)
+	}
+	if got := ids("SELECT id ORDER BY score DESC LIMIT 2"); !slices.Equal(got, []int64{6, 1}) {
+		t.Fatalf("unexpected ORDER BY with LIMIT: %v", got)
+	}
+
+	// Values keep their case and quoted values may contain spaces
+	if got := ids("SELECT id WHERE username = 'bob'"); !slices.Equal(got, []int64{2, 5}) {
+		t.Fatalf("unexpected ids for username = 'bob': %v", got)
+	}
+	if got := ids("SELECT id WHERE username = 'bob smith'"); !slices.Equal(got, []int64{4}) {
+		t.Fatalf("unexpected ids for username = 'bob smith': %v", got)
+	}
+	if got := ids("SELECT id WHERE username = 'BOB'"); len(got) != 0 {
+		t.Fatalf("expected no match for username = 'BOB', got %v", got)
+	}
+
+	// Columns come back in SELECT order
+	res = query("SELECT score, id WHERE id <= 2")
+	if res.ColumnName(0) != "score" || res.ColumnName(1) != "id" || res.NumRows() != 2 {
+		t.Fatalf("unexpected projection %s with %d rows", res.Schema(), res.NumRows())
+	}
+	res.Release()
+
+	for _, sql := range []string{
+		"SELECT missing",
+		"SELECT id ORDER BY missing",
+		"SELECT MAX(missing)",
+		"SELECT id WHERE missing = 1",
+	} {
+		if _, err := lb.Query(ctx, sql, WithPassword(password)); err == nil {
+			t.Fatalf("%s: expected an unknown column error", sql)
+		}
+	}
+	if _, err := lb.Query(ctx, "SELECT SUM(username)", WithPassword(password)); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType for SUM of a string column, got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package lockbox
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+// RecordReader iterates over the decrypted contents of a lockbox one stored
+// segment at a time, so large files never need to be materialized in full.
+//
+// The record returned by Record is owned by the reader and is only valid
+// until the next call to Next or Release. Callers that need to keep a record
+// beyond that point must call Retain on it and Release it when done.
+// The reader itself must be released with Release once iteration finishes.
+type RecordReader struct {
+	refCount int64
+	reader   *format.Reader
+	schema   *arrow.Schema
+	columns  []string
+	preds    []predicate
+	stats    *metadata.FileStats
+	count    int
+	next     int
+	// head is the number of rows WithHead still allows, or -1 without it
+	head int64
+	// skip is the number of leading rows of the next segment WithTail drops
+	skip int64
+	// tail is the WithTail row count when filters force buffering
+	tail     int64
+	tailRead bool
+	buffered []arrow.Record
+	cur      arrow.Record
+	err      error
+}
+
+// NewReader returns a streaming reader over all segments of the lockbox.
+// With WithColumns only those columns are decrypted. With WithFilter only
+// matching rows are returned, and segments the statistics footer rules out
+// are never decrypted; files without a footer are filtered row by row.
+// WithHead and WithTail limit the reader to the first or last rows.
+func (lb *Lockbox) NewReader(opts ...Option) (*RecordReader, error) {
+	options := &Options{
+		Password:     "",
+		Columns:      []string{},
+		CryptoModule: "",
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.err != nil {
+		return nil, options.err
+	}
+
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w for reading", ErrPasswordRequired)
+	}
+
+	if options.Head > 0 && options.Tail > 0 {
+		return nil, fmt.Errorf("head and tail cannot be combined")
+	}
+
+	if err := lb.checkColumns(options.Columns); err != nil {
+		return nil, err
+	}
+
+	preds, err := compilePredicates(lb.Schema(), options.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := lb.Schema()
+	columns := append([]string(nil), options.Columns...)
+	if len(options.Columns) > 0 {
+		schema = projectSchema(schema, options.Columns)
+		// Filter columns are decrypted too and dropped after filtering
+		for _, p := range preds {
+			if !contains(columns, p.column) {
+				columns = append(columns, p.column)
+			}
+		}
+	}
+
+	var stats *metadata.FileStats
+	if len(preds) > 0 {
+		stats, err = reader.Stats()
+		if errors.Is(err, format.ErrNoStats) {
+			stats = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read stats: %w", err)
+		}
+	}
+
+	rr := &RecordReader{
+		refCount: 1,
+		reader:   reader,
+		schema:   schema,
+		columns:  columns,
+		preds:    preds,
+		stats:    stats,
+		count:    lb.file.SegmentCount(),
+		head:     -1,
+	}
+	switch {
+	case options.Head > 0:
+		rr.head = options.Head
+	case options.Tail > 0 && len(preds) == 0:
+		rr.next, rr.skip = tailStart(lb.file.SegmentRows(), options.Tail)
+	case options.Tail > 0:
+		rr.tail = options.Tail
+	}
+	return rr, nil
+}
+
+// Schema returns the schema of the records produced by the reader
+func (rr *RecordReader) Schema() *arrow.Schema {
+	return rr.schema
+}
+
+// Next decrypts the next segment with matching rows, returning false at the
+// end of the file or on error. Check Err after Next returns false.
+func (rr *RecordReader) Next() bool {
+	if rr.cur != nil {
+		rr.cur.Release()
+		rr.cur = nil
+	}
+	if rr.err != nil {
+		return false
+	}
+	if rr.tail > 0 {
+		return rr.nextTail()
+	}
+	if rr.head == 0 {
+		return false
+	}
+
+	rec, ok := rr.nextSegment()
+	if !ok {
+		return false
+	}
+	if rr.skip > 0 {
+		sliced := rec.NewSlice(rr.skip, rec.NumRows())
+		rec.Release()
+		rec, rr.skip = sliced, 0
+	}
+	rr.cur = rr.limitHead(rec)
+	return true
+}
+
+// nextSegment decrypts the next segment with matching rows and returns it
+// filtered, or false at the end of the file or on error
+func (rr *RecordReader) nextSegment() (arrow.Record, bool) {
+	for rr.next < rr.count {
+		index := rr.next
+		rr.next++
+		if !rr.mayMatch(index) {
+			continue
+		}
+
+		rec, err := rr.reader.ReadSegmentColumns(index, rr.columns)
+		if err != nil {
+			rr.err = err
+			return nil, false
+		}
+		if len(rr.preds) > 0 {
+			filtered, err := filterRecord(rec, rr.preds, rr.schema)
+			rec.Release()
+			if err != nil {
+				rr.err = err
+				return nil, false
+			}
+			if filtered.NumRows() == 0 {
+				filtered.Release()
+				continue
+			}
+			rec = filtered
+		}
+		return rec, true
+	}
+	return nil, false
+}
+
+// mayMatch consults the statistics footer to decide whether a segment can
+// hold rows matching every filter
+func (rr *RecordReader) mayMatch(index int) bool {
+	if rr.stats == nil {
+		return true
+	}
+	for i := range rr.preds {
+		if !rr.preds[i].mayMatch(rr.stats.Segments[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Record returns the current record. See RecordReader for ownership rules.
+func (rr *RecordReader) Record() arrow.Record {
+	return rr.cur
+}
+
+// Err returns the first error encountered during iteration
+func (rr *RecordReader) Err() error {
+	return rr.err
+}
+
+// Retain increases the reference count of the reader
+func (rr *RecordReader) Retain() {
+	atomic.AddInt64(&rr.refCount, 1)
+}
+
+// Release decreases the reference count of the reader and releases the
+// current record once it reaches zero.
+func (rr *RecordReader) Release() {
+	if atomic.AddInt64(&rr.refCount, -1) == 0 {
+		if rr.cur != nil {
+			rr.cur.Release()
+			rr.cur = nil
+		}
+		rr.releaseBuffered()
+	}
+}
+
+// projectSchema keeps the fields named in columns, in schema order
+func projectSchema(schema *arrow.Schema, columns []string) *arrow.Schema {
+	var fields []arrow.Field
+	for _, f := range schema.Fields() {
+		for _, c := range columns {
+			if f.Name == c {
+				fields = append(fields, f)
+				break
+			}
+		}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+var _ array.RecordReader = (*RecordReader)(nil)
@@ -0,0 +1,76 @@
+package lockbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/TFMV/lockbox/pkg/store"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/rs/zerolog/log"
+)
+
+// remoteFile ties a lockbox opened from an object store to its local
+// working copy. The format needs random access and in-place header updates,
+// which object stores lack, so the object is downloaded on open and
+// uploaded again on Close if it changed.
+type remoteFile struct {
+	store store.Store
+	path  string
+	local string
+}
+
+// createRemote creates a lockbox at an object store URI
+func createRemote(uri string, schema *arrow.Schema, opts ...Option) (*Lockbox, error) {
+	s, path, err := store.Resolve(context.Background(), uri)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "lockbox-*.lbx")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	local := f.Name()
+	f.Close()
+
+	lb, err := Create(local, schema, opts...)
+	if err != nil {
+		os.Remove(local)
+		return nil, err
+	}
+	lb.remote = &remoteFile{store: s, path: path, local: local}
+	return lb, nil
+}
+
+// openRemote downloads a lockbox from an object store URI and opens it
+func openRemote(uri string, opts ...Option) (*Lockbox, error) {
+	s, path, err := store.Resolve(context.Background(), uri)
+	if err != nil {
+		return nil, err
+	}
+	local, err := store.Download(s, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockbox file: %w", err)
+	}
+
+	lb, err := Open(local, opts...)
+	if err != nil {
+		os.Remove(local)
+		return nil, err
+	}
+	lb.remote = &remoteFile{store: s, path: path, local: local}
+	return lb, nil
+}
+
+// sync uploads the working copy if it was written, then removes it
+func (rf *remoteFile) sync(modified bool) error {
+	defer os.Remove(rf.local)
+	if !modified {
+		return nil
+	}
+	if err := store.Upload(rf.store, rf.local, rf.path); err != nil {
+		return err
+	}
+	log.Info().Str("path", rf.path).Msg("Uploaded lockbox file")
+	return nil
+}
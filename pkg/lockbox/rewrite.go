@@ -0,0 +1,333 @@
+package lockbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/store"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/arrow/scalar"
+	"github.com/rs/zerolog/log"
+)
+
+// RewriteReport describes the rows an Update or Delete changed
+type RewriteReport struct {
+	// Matched counts the rows the filters selected, updated or deleted
+	Matched int64
+	// Rows is the row count of the rewritten file
+	Rows int64
+}
+
+// Update sets columns to new values in every row matching the WithFilter
+// conditions, or in every row without one. values maps column names to
+// the text of their new value, parsed for the column type: numbers,
+// RFC3339 timestamps, decimals or strings.
+//
+// Lockbox blocks are immutable, so the whole file is decrypted and
+// rewritten like Compact: a failure leaves the file as it was. Segments
+// keep their sizes, and the recorded sort order is kept up to the first
+// updated column.
+func Update(ctx context.Context, filename string, values map[string]string, opts ...Option) (*RewriteReport, error) {
+	options := &Options{
+		CreatedBy: "system",
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("update needs at least one column to set")
+	}
+
+	report := &RewriteReport{}
+	_, err := rewrite("update", filename, options, opts, func(lb *Lockbox, out *format.LockboxFile) error {
+		preds, err := compilePredicates(lb.Schema(), options.Filters)
+		if err != nil {
+			return err
+		}
+		mem := memory.NewGoAllocator()
+		consts, err := updateValues(lb.Schema(), values)
+		if err != nil {
+			return err
+		}
+
+		sortOrder := lb.file.Metadata().SortOrder
+		for i, col := range sortOrder {
+			if _, ok := values[col]; ok {
+				sortOrder = sortOrder[:i]
+				break
+			}
+		}
+
+		report.Rows, err = lb.rewriteSegments(ctx, out, options, sortOrder, func(rec arrow.Record) (arrow.Record, error) {
+			rows := matchingRows(rec, preds)
+			report.Matched += int64(len(rows))
+			return setRows(mem, rec, rows, consts)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("file", filename).Int64("rows", report.Matched).Msg("Updated lockbox")
+	return report, nil
+}
+
+// Delete removes every row matching the WithFilter conditions, of which
+// there must be at least one, rewriting the file like Update. The sort
+// order recorded for the file is kept.
+func Delete(ctx context.Context, filename string, opts ...Option) (*RewriteReport, error) {
+	options := &Options{
+		CreatedBy: "system",
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if len(options.Filters) == 0 {
+		return nil, fmt.Errorf("delete needs at least one filter")
+	}
+
+	report := &RewriteReport{}
+	_, err := rewrite("delete", filename, options, opts, func(lb *Lockbox, out *format.LockboxFile) error {
+		preds, err := compilePredicates(lb.Schema(), options.Filters)
+		if err != nil {
+			return err
+		}
+		report.Rows, err = lb.rewriteSegments(ctx, out, options, lb.file.Metadata().SortOrder, func(rec arrow.Record) (arrow.Record, error) {
+			matched := matchingRows(rec, preds)
+			report.Matched += int64(len(matched))
+			return takeRecordRows(rec, unmatchedRows(int(rec.NumRows()), matched), rec.Schema())
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("file", filename).Int64("rows", report.Matched).Msg("Deleted rows from lockbox")
+	return report, nil
+}
+
+// unmatchedRows returns the rows below n missing from the ascending matched
+func unmatchedRows(n int, matched []int) []int {
+	keep := make([]int, 0, n-len(matched))
+	for row, next := 0, 0; row < n; row++ {
+		if next < len(matched) && matched[next] == row {
+			next++
+			continue
+		}
+		keep = append(keep, row)
+	}
+	return keep
+}
+
+// updateValues parses the new value of each updated column into a scalar
+// of the column type, keyed by field index
+func updateValues(schema *arrow.Schema, values map[string]string) (map[int]scalar.Scalar, error) {
+	consts := make(map[int]scalar.Scalar, len(values))
+	for name, text := range values {
+		idx := schema.FieldIndices(name)
+		if len(idx) == 0 {
+			return nil, fmt.Errorf("unknown column %s", name)
+		}
+		dt := schema.Field(idx[0]).Type
+		sc, err := scalar.ParseScalar(dt, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for column %s (%s): %w", text, name, dt, err)
+		}
+		consts[idx[0]] = sc
+	}
+	return consts, nil
+}
+
+// setRows returns rec with the given ascending rows of each column in
+// consts replaced by its value. rec is not released.
+func setRows(mem memory.Allocator, rec arrow.Record, rows []int, consts map[int]scalar.Scalar) (arrow.Record, error) {
+	if len(rows) == 0 {
+		rec.Retain()
+		return rec, nil
+	}
+	cols := make([]arrow.Array, rec.NumCols())
+	defer func() {
+		for _, c := range cols {
+			if c != nil {
+				c.Release()
+			}
+		}
+	}()
+	for i, col := range rec.Columns() {
+		sc, ok := consts[i]
+		if !ok {
+			col.Retain()
+			cols[i] = col
+			continue
+		}
+		arr, err := replaceRows(mem, col, rows, sc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update column %s: %w", rec.ColumnName(i), err)
+		}
+		cols[i] = arr
+	}
+	return array.NewRecord(rec.Schema(), cols, rec.NumRows()), nil
+}
+
+// replaceRows copies col with the given ascending rows set to sc
+func replaceRows(mem memory.Allocator, col arrow.Array, rows []int, sc scalar.Scalar) (arrow.Array, error) {
+	fill, err := scalar.MakeArrayFromScalar(sc, len(rows), mem)
+	if err != nil {
+		return nil, err
+	}
+	defer fill.Release()
+	if !arrow.TypeEqual(fill.DataType(), col.DataType()) {
+		// Dictionary columns parse to their value type
+		converted, _, err := coerceColumn(mem, col.DataType(), fill, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer converted.Release()
+		fill = converted
+	}
+
+	var parts []arrow.Array
+	defer func() {
+		for _, p := range parts {
+			p.Release()
+		}
+	}()
+	// Alternate unchanged runs of col with runs of the fill values
+	prev, filled := 0, 0
+	for i := 0; i < len(rows); {
+		j := i + 1
+		for j < len(rows) && rows[j] == rows[j-1]+1 {
+			j++
+		}
+		if rows[i] > prev {
+			parts = append(parts, array.NewSlice(col, int64(prev), int64(rows[i])))
+		}
+		parts = append(parts, array.NewSlice(fill, int64(filled), int64(filled+j-i)))
+		filled += j - i
+		prev = rows[j-1] + 1
+		i = j
+	}
+	if prev < col.Len() {
+		parts = append(parts, array.NewSlice(col, int64(prev), int64(col.Len())))
+	}
+	return array.Concatenate(parts, mem)
+}
+
+// rewriteSegments copies every segment of lb into out through transform,
+// which returns a new record and does not release its argument. Each
+// segment stays one segment, empty results are dropped, and columns keep
+// the codec of their latest block. It returns the number of rows written.
+func (lb *Lockbox) rewriteSegments(ctx context.Context, out *format.LockboxFile, options *Options, sortOrder []string, transform func(arrow.Record) (arrow.Record, error)) (int64, error) {
+	reader, err := lb.file.NewReaderWithKey(lb.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create reader: %w", err)
+	}
+	writer, err := out.NewWriterWithKey(lb.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create writer: %w", err)
+	}
+	columns, level := lb.currentCompression()
+	if err := writer.SetCompression("", columns, level); err != nil {
+		return 0, fmt.Errorf("invalid compression: %w", err)
+	}
+	writer.SetParallelism(options.Parallelism)
+
+	var rows int64
+	for i := 0; i < lb.SegmentCount(); i++ {
+		if err := ctx.Err(); err != nil {
+			return rows, err
+		}
+		rec, err := reader.ReadSegment(i)
+		if err != nil {
+			return rows, fmt.Errorf("failed to read segment %d: %w", i, err)
+		}
+		next, err := transform(rec)
+		rec.Release()
+		if err != nil {
+			return rows, err
+		}
+		if next.NumRows() == 0 {
+			next.Release()
+			continue
+		}
+		// A segment is never split, whatever the recorded block size
+		writer.SetBlockSize(int(next.NumRows()))
+		writer.SetSortOrder(sortOrder)
+		n := next.NumRows()
+		if err := writer.WriteRecord(next); err != nil {
+			return rows, fmt.Errorf("failed to write segment %d: %w", i, err)
+		}
+		rows += n
+	}
+	return rows, nil
+}
+
+// rewrite replaces the local lockbox file at filename with a copy that fill
+// writes, sharing its key slots, properties and schema version so the same
+// credentials open it. op names the operation in errors. The copy is built
+// in a temporary file in the same directory and renamed over the original
+// only once fill succeeds, while the original stays exclusively locked, so
+// a failure leaves the file as it was. It returns the size of the original.
+func rewrite(op, filename string, options *Options, opts []Option, fill func(lb *Lockbox, out *format.LockboxFile) error) (int64, error) {
+	if store.IsRemote(filename) {
+		return 0, fmt.Errorf("%s needs a local file, got %s", op, filename)
+	}
+
+	st, err := os.Stat(filename)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", filename, err)
+	}
+	lb, err := Open(filename, append(opts, WithMode(ReadWrite))...)
+	if err != nil {
+		return 0, err
+	}
+	defer lb.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+"."+op+"-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmpName)
+		}
+	}()
+
+	out, err := format.CreateCopy(tmpName, lb.file, options.CreatedBy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create rewritten file: %w", err)
+	}
+	err = fill(lb, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Chmod(tmpName, st.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := lb.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return 0, fmt.Errorf("failed to replace %s: %w", filename, err)
+	}
+	committed = true
+	return st.Size(), nil
+}
@@ -2,17 +2,33 @@ package lockbox
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
 )
 
+// DictionaryStringType is the type inferred for low-cardinality string columns
+var DictionaryStringType = &arrow.DictionaryType{
+	IndexType: arrow.PrimitiveTypes.Int32,
+	ValueType: arrow.BinaryTypes.String,
+}
+
 // DetectCSVSchema reads a CSV file and attempts to infer an Arrow schema.
 // It reads up to sample records to determine column types.
 func DetectCSVSchema(path string, sample int) (*arrow.Schema, error) {
+	return DetectCSVSchemaWithDictionary(path, sample, 0)
+}
+
+// DetectCSVSchemaWithDictionary behaves like DetectCSVSchema but additionally
+// infers a dictionary-encoded string type for columns that have at most
+// threshold distinct values across the sample and repeat at least one value.
+// A threshold of zero disables dictionary inference.
+func DetectCSVSchemaWithDictionary(path string, sample, threshold int) (*arrow.Schema, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -28,6 +44,11 @@ func DetectCSVSchema(path string, sample int) (*arrow.Schema, error) {
 		sample = 10
 	}
 	types := make([]arrow.DataType, len(headers))
+	distinct := make([]map[string]struct{}, len(headers))
+	counts := make([]int, len(headers))
+	for i := range distinct {
+		distinct[i] = make(map[string]struct{})
+	}
 	for i := 0; i < sample; i++ {
 		row, err := r.Read()
 		if err != nil {
@@ -39,6 +60,10 @@ func DetectCSVSchema(path string, sample int) (*arrow.Schema, error) {
 		for j, val := range row {
 			t := detectValueType(val)
 			types[j] = mergeArrowType(types[j], t)
+			if val != "" && len(distinct[j]) <= threshold {
+				distinct[j][val] = struct{}{}
+				counts[j]++
+			}
 		}
 	}
 	fields := make([]arrow.Field, len(headers))
@@ -47,11 +72,91 @@ func DetectCSVSchema(path string, sample int) (*arrow.Schema, error) {
 		if typ == nil {
 			typ = arrow.BinaryTypes.String
 		}
+		if typ.ID() == arrow.STRING && isLowCardinality(len(distinct[i]), counts[i], threshold) {
+			typ = DictionaryStringType
+		}
 		fields[i] = arrow.Field{Name: name, Type: typ, Nullable: true}
 	}
 	return arrow.NewSchema(fields, nil), nil
 }
 
+// RenameFields returns a copy of schema with its field names transformed.
+// Fields listed in renames (keyed by original name) take the given name;
+// all other names have headerCase applied, which may be "", "lower" or
+// "upper". It fails if two distinct fields end up with the same name.
+func RenameFields(schema *arrow.Schema, headerCase string, renames map[string]string) (*arrow.Schema, error) {
+	var transform func(string) string
+	switch headerCase {
+	case "", "none":
+		transform = func(s string) string { return s }
+	case "lower":
+		transform = strings.ToLower
+	case "upper":
+		transform = strings.ToUpper
+	default:
+		return nil, fmt.Errorf("unsupported header case %q (expected none, lower or upper)", headerCase)
+	}
+
+	for from := range renames {
+		if len(schema.FieldIndices(from)) == 0 {
+			return nil, fmt.Errorf("cannot rename unknown field %s", from)
+		}
+	}
+
+	seen := make(map[string]string, len(schema.Fields()))
+	fields := make([]arrow.Field, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		name, ok := renames[field.Name]
+		if !ok {
+			name = transform(field.Name)
+		}
+		if prev, dup := seen[name]; dup {
+			return nil, fmt.Errorf("field names %q and %q collide as %q", prev, field.Name, name)
+		}
+		seen[name] = field.Name
+		field.Name = name
+		fields[i] = field
+	}
+
+	md := schema.Metadata()
+	return arrow.NewSchema(fields, &md), nil
+}
+
+// DictionaryEncode returns schema with the named string fields changed to
+// DictionaryStringType. Fields that are already dictionary encoded are left
+// as they are; unknown and non-string fields are an error.
+func DictionaryEncode(schema *arrow.Schema, names ...string) (*arrow.Schema, error) {
+	if len(names) == 0 {
+		return schema, nil
+	}
+
+	fields := schema.Fields()
+	for _, name := range names {
+		idx := schema.FieldIndices(name)
+		if len(idx) == 0 {
+			return nil, fmt.Errorf("cannot dictionary encode unknown field %s", name)
+		}
+		for _, i := range idx {
+			switch fields[i].Type.(type) {
+			case *arrow.StringType:
+				fields[i].Type = DictionaryStringType
+			case *arrow.DictionaryType:
+			default:
+				return nil, fmt.Errorf("cannot dictionary encode field %s: %w: %s (only strings are supported)", name, ErrUnsupportedType, fields[i].Type)
+			}
+		}
+	}
+
+	md := schema.Metadata()
+	return arrow.NewSchema(fields, &md), nil
+}
+
+// isLowCardinality reports whether a column with the given number of distinct
+// and total sampled values should be dictionary encoded.
+func isLowCardinality(distinct, count, threshold int) bool {
+	return threshold > 0 && distinct > 0 && distinct <= threshold && distinct < count
+}
+
 func detectValueType(v string) arrow.DataType {
 	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
 		return arrow.PrimitiveTypes.Int64
@@ -1,6 +1,12 @@
 package lockbox
 
-import "testing"
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
 
 func TestDetectCSVSchema(t *testing.T) {
 	schema, err := DetectCSVSchema("../../data.csv", 2)
@@ -11,3 +17,68 @@ func TestDetectCSVSchema(t *testing.T) {
 		t.Fatalf("expected schema")
 	}
 }
+
+func TestDetectCSVSchemaDictionary(t *testing.T) {
+	tmpFile := "/tmp/test_detect_dict.csv"
+	defer os.Remove(tmpFile)
+
+	data := "id,status,note\n1,open,a\n2,closed,b\n3,open,c\n4,pending,d\n5,closed,e\n"
+	if err := os.WriteFile(tmpFile, []byte(data), 0644); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+
+	schema, err := DetectCSVSchemaWithDictionary(tmpFile, 10, 3)
+	if err != nil {
+		t.Fatalf("detect error: %v", err)
+	}
+
+	if !arrow.TypeEqual(schema.Field(1).Type, DictionaryStringType) {
+		t.Fatalf("expected status to be dictionary encoded, got %s", schema.Field(1).Type)
+	}
+	if schema.Field(2).Type.ID() != arrow.STRING {
+		t.Fatalf("expected note to remain a string, got %s", schema.Field(2).Type)
+	}
+	if schema.Field(0).Type.ID() != arrow.INT64 {
+		t.Fatalf("expected id to be int64, got %s", schema.Field(0).Type)
+	}
+
+	plain, err := DetectCSVSchema(tmpFile, 10)
+	if err != nil {
+		t.Fatalf("detect error: %v", err)
+	}
+	if plain.Field(1).Type.ID() != arrow.STRING {
+		t.Fatalf("expected dictionary inference to be disabled by default, got %s", plain.Field(1).Type)
+	}
+}
+
+func TestRenameFieldsCollision(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ID", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "Name", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	_, err := RenameFields(schema, "lower", nil)
+	if err == nil {
+		t.Fatalf("expected collision error")
+	}
+	if !strings.Contains(err.Error(), `"ID"`) || !strings.Contains(err.Error(), `"id"`) {
+		t.Fatalf("expected error to name both columns, got %v", err)
+	}
+
+	_, err = RenameFields(schema, "none", map[string]string{"Name": "id"})
+	if err == nil {
+		t.Fatalf("expected collision error for rename")
+	}
+
+	renamed, err := RenameFields(schema, "lower", map[string]string{"ID": "legacy_id"})
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	want := []string{"legacy_id", "id", "name"}
+	for i, name := range want {
+		if renamed.Field(i).Name != name {
+			t.Fatalf("field %d: expected %s, got %s", i, name, renamed.Field(i).Name)
+		}
+	}
+}
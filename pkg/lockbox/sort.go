@@ -0,0 +1,208 @@
+package lockbox
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/compute"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// WithSortBy orders rows by the given columns, ascending with nulls last.
+// Later columns break ties in earlier ones. Write sorts each record before
+// encrypting it and records the order in the metadata, where Info reports
+// it for as long as every segment is sorted that way.
+func WithSortBy(columns ...string) Option {
+	return func(o *Options) {
+		o.SortBy = columns
+	}
+}
+
+// checkSortColumns rejects sort columns missing from schema or of a type
+// that has no ordering
+func checkSortColumns(schema *arrow.Schema, columns []string) error {
+	for _, name := range columns {
+		idx := schema.FieldIndices(name)
+		if len(idx) == 0 {
+			return fmt.Errorf("unknown sort column %s", name)
+		}
+		if !sortable(schema.Field(idx[0]).Type) {
+			return fmt.Errorf("cannot sort by column %s: %w: %s", name, ErrUnsupportedType, schema.Field(idx[0]).Type)
+		}
+	}
+	return nil
+}
+
+// sortable reports whether compareFunc can order values of dt
+func sortable(dt arrow.DataType) bool {
+	if d, ok := dt.(*arrow.DictionaryType); ok {
+		return sortable(d.ValueType)
+	}
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT32, arrow.FLOAT64, arrow.BOOL,
+		arrow.STRING, arrow.LARGE_STRING, arrow.BINARY, arrow.LARGE_BINARY,
+		arrow.DATE32, arrow.DATE64, arrow.TIMESTAMP, arrow.TIME32, arrow.TIME64,
+		arrow.DURATION, arrow.DECIMAL128:
+		return true
+	}
+	return false
+}
+
+// sortRecord returns the rows of rec ordered by columns. The sort is
+// stable, so rows with equal keys keep their order, and a record that is
+// already sorted is returned as is.
+func sortRecord(ctx context.Context, mem memory.Allocator, rec arrow.Record, columns []string) (arrow.Record, error) {
+	if err := checkSortColumns(rec.Schema(), columns); err != nil {
+		return nil, err
+	}
+	cmps := make([]func(i, j int) int, len(columns))
+	for k, name := range columns {
+		col := rec.Column(rec.Schema().FieldIndices(name)[0])
+		cmps[k] = compareFunc(col, col)
+	}
+
+	perm := make([]int64, rec.NumRows())
+	for i := range perm {
+		perm[i] = int64(i)
+	}
+	slices.SortStableFunc(perm, func(a, b int64) int {
+		for _, c := range cmps {
+			if r := c(int(a), int(b)); r != 0 {
+				return r
+			}
+		}
+		return 0
+	})
+
+	if slices.IsSorted(perm) {
+		rec.Retain()
+		return rec, nil
+	}
+	return reorderRecord(ctx, mem, rec, perm)
+}
+
+// reorderRecord returns the rows of rec at the given indices, in that
+// order. rec is not released.
+func reorderRecord(ctx context.Context, mem memory.Allocator, rec arrow.Record, perm []int64) (arrow.Record, error) {
+	ib := array.NewInt64Builder(mem)
+	defer ib.Release()
+	ib.AppendValues(perm, nil)
+	indices := ib.NewArray()
+	defer indices.Release()
+
+	ectx := compute.WithAllocator(ctx, mem)
+	cols := make([]arrow.Array, rec.NumCols())
+	defer func() {
+		for _, c := range cols {
+			if c != nil {
+				c.Release()
+			}
+		}
+	}()
+	for i, col := range rec.Columns() {
+		taken, err := compute.TakeArray(ectx, col, indices)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reorder column %s: %w", rec.ColumnName(i), err)
+		}
+		cols[i] = taken
+	}
+	return array.NewRecord(rec.Schema(), cols, int64(len(perm))), nil
+}
+
+// compareFunc orders row i of a against row j of b, with nulls after every
+// value. a and b must have the same type, one accepted by sortable.
+func compareFunc(a, b arrow.Array) func(i, j int) int {
+	var values func(i, j int) int
+	switch x := a.(type) {
+	case *array.Int8:
+		values = orderedCompare(x.Value, b.(*array.Int8).Value)
+	case *array.Int16:
+		values = orderedCompare(x.Value, b.(*array.Int16).Value)
+	case *array.Int32:
+		values = orderedCompare(x.Value, b.(*array.Int32).Value)
+	case *array.Int64:
+		values = orderedCompare(x.Value, b.(*array.Int64).Value)
+	case *array.Uint8:
+		values = orderedCompare(x.Value, b.(*array.Uint8).Value)
+	case *array.Uint16:
+		values = orderedCompare(x.Value, b.(*array.Uint16).Value)
+	case *array.Uint32:
+		values = orderedCompare(x.Value, b.(*array.Uint32).Value)
+	case *array.Uint64:
+		values = orderedCompare(x.Value, b.(*array.Uint64).Value)
+	case *array.Float32:
+		values = orderedCompare(x.Value, b.(*array.Float32).Value)
+	case *array.Float64:
+		values = orderedCompare(x.Value, b.(*array.Float64).Value)
+	case *array.String:
+		values = orderedCompare(x.Value, b.(*array.String).Value)
+	case *array.LargeString:
+		values = orderedCompare(x.Value, b.(*array.LargeString).Value)
+	case *array.Date32:
+		values = orderedCompare(x.Value, b.(*array.Date32).Value)
+	case *array.Date64:
+		values = orderedCompare(x.Value, b.(*array.Date64).Value)
+	case *array.Timestamp:
+		values = orderedCompare(x.Value, b.(*array.Timestamp).Value)
+	case *array.Time32:
+		values = orderedCompare(x.Value, b.(*array.Time32).Value)
+	case *array.Time64:
+		values = orderedCompare(x.Value, b.(*array.Time64).Value)
+	case *array.Duration:
+		values = orderedCompare(x.Value, b.(*array.Duration).Value)
+	case *array.Boolean:
+		y := b.(*array.Boolean)
+		values = func(i, j int) int {
+			u, v := x.Value(i), y.Value(j)
+			switch {
+			case u == v:
+				return 0
+			case v:
+				return -1
+			}
+			return 1
+		}
+	case *array.Binary:
+		y := b.(*array.Binary)
+		values = func(i, j int) int { return bytes.Compare(x.Value(i), y.Value(j)) }
+	case *array.LargeBinary:
+		y := b.(*array.LargeBinary)
+		values = func(i, j int) int { return bytes.Compare(x.Value(i), y.Value(j)) }
+	case *array.Decimal128:
+		y := b.(*array.Decimal128)
+		values = func(i, j int) int { return x.Value(i).Cmp(y.Value(j)) }
+	case *array.Dictionary:
+		y := b.(*array.Dictionary)
+		dict := compareFunc(x.Dictionary(), y.Dictionary())
+		values = func(i, j int) int { return dict(x.GetValueIndex(i), y.GetValueIndex(j)) }
+	default:
+		values = func(i, j int) int { return 0 }
+	}
+
+	return func(i, j int) int {
+		ni, nj := a.IsNull(i), b.IsNull(j)
+		switch {
+		case ni && nj:
+			return 0
+		case ni:
+			return 1
+		case nj:
+			return -1
+		}
+		return values(i, j)
+	}
+}
+
+// orderedCompare compares values read through x and y
+func orderedCompare[T cmp.Ordered](x, y func(int) T) func(i, j int) int {
+	return func(i, j int) int {
+		return cmp.Compare(x(i), y(j))
+	}
+}
@@ -0,0 +1,547 @@
+package lockbox
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/compute"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// spillBatchRows is the size of the batches a spilled run is stored in, and
+// so how much of each run the merge holds in memory at once
+const spillBatchRows = 4096
+
+// SortSpilled sorts the records of rr by columns with an external merge
+// sort. Runs of runRows rows are read from rr, sorted one at a time and
+// spilled to files in dir; the returned reader merges them back into sorted
+// records of runRows rows (the last may be shorter). Only one run is held
+// while spilling and one batch per run while merging, so the input never
+// has to fit in memory. SortSpilled reads rr to the end but does not
+// release it. The spill files are encrypted with a key that is never
+// stored, readable only by the owner, and removed when the reader is
+// released. WithAllocator sets the allocator for the sorted records.
+func SortSpilled(ctx context.Context, rr array.RecordReader, columns []string, runRows int, dir string, opts ...Option) (array.RecordReader, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if runRows <= 0 {
+		return nil, fmt.Errorf("run size must be positive, got %d", runRows)
+	}
+	schema := rr.Schema()
+	if err := checkSortColumns(schema, columns); err != nil {
+		return nil, err
+	}
+	keys := make([]int, len(columns))
+	for k, name := range columns {
+		keys[k] = schema.FieldIndices(name)[0]
+	}
+
+	m := &mergeReader{
+		refCount: 1,
+		mem:      allocatorOrDefault(options.Allocator),
+		schema:   schema,
+		keys:     keys,
+		size:     int64(runRows),
+		ctx:      ctx,
+	}
+	// pending holds the input rows of the next run
+	var pending []arrow.Record
+	var pendingRows int64
+	release := func() {
+		for _, rec := range pending {
+			rec.Release()
+		}
+		pending, pendingRows = nil, 0
+	}
+	spill := func() error {
+		defer release()
+		rec, err := ConcatRecords(m.mem, schema, pending...)
+		if err != nil {
+			return err
+		}
+		run, err := spillRun(ctx, m.mem, rec, columns, dir)
+		if err != nil {
+			return err
+		}
+		m.runs = append(m.runs, run)
+		return nil
+	}
+	fail := func(err error) (array.RecordReader, error) {
+		release()
+		m.Release()
+		return nil, err
+	}
+	for rr.Next() {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+		rec := rr.Record()
+		for off, n := int64(0), rec.NumRows(); off < n; {
+			end := min(off+int64(runRows)-pendingRows, n)
+			pending = append(pending, rec.NewSlice(off, end))
+			pendingRows += end - off
+			off = end
+			if pendingRows == int64(runRows) {
+				if err := spill(); err != nil {
+					return fail(err)
+				}
+			}
+		}
+	}
+	if err := rr.Err(); err != nil {
+		return fail(err)
+	}
+	if pendingRows > 0 {
+		if err := spill(); err != nil {
+			return fail(err)
+		}
+	}
+	release()
+
+	m.cmps = make([][][]func(i, j int) int, len(m.runs))
+	for i, run := range m.runs {
+		m.cmps[i] = make([][]func(i, j int) int, len(m.runs))
+		if err := run.open(); err != nil {
+			m.Release()
+			return nil, err
+		}
+		if run.batch != nil {
+			m.heads = append(m.heads, i)
+		}
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// sortedRun is one sorted run spilled to disk, read back a batch at a time
+type sortedRun struct {
+	path  string
+	id    uint32
+	file  *os.File
+	r     *ipc.Reader
+	batch arrow.Record
+	row   int
+	// source is the index of batch among the sources of the record being
+	// assembled, or -1 if it has none yet
+	source int
+}
+
+// spillRun sorts slice, which it releases, and writes it to a new file in
+// dir
+func spillRun(ctx context.Context, mem memory.Allocator, slice arrow.Record, columns []string, dir string) (*sortedRun, error) {
+	sorted, err := sortRecord(ctx, mem, slice, columns)
+	slice.Release()
+	if err != nil {
+		return nil, err
+	}
+	defer sorted.Release()
+
+	aead, err := spillCipher()
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp makes the file with mode 0600
+	f, err := os.CreateTemp(dir, "lockbox-sort-*.spill")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	run := &sortedRun{path: f.Name(), id: spillRuns.Add(1), source: -1}
+	sw := &spillWriter{w: bufio.NewWriter(f), aead: aead, run: run.id}
+	w := ipc.NewWriter(sw, ipc.WithSchema(sorted.Schema()), ipc.WithAllocator(mem))
+	n := sorted.NumRows()
+	for off := int64(0); off < n && err == nil; off += spillBatchRows {
+		batch := sorted.NewSlice(off, min(off+spillBatchRows, n))
+		err = w.Write(batch)
+		batch.Release()
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := sw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(run.path)
+		return nil, fmt.Errorf("failed to spill sorted run: %w", err)
+	}
+	return run, nil
+}
+
+// open starts reading the run from its first batch
+func (run *sortedRun) open() error {
+	f, err := os.Open(run.path)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	run.file = f
+	aead, err := spillCipher()
+	if err != nil {
+		return err
+	}
+	sr := &spillReader{r: bufio.NewReader(f), aead: aead, run: run.id}
+	if run.r, err = ipc.NewReader(sr); err != nil {
+		return fmt.Errorf("failed to read spill file: %w", err)
+	}
+	return run.advance()
+}
+
+// advance moves to the run's next batch, leaving batch nil at the end
+func (run *sortedRun) advance() error {
+	if run.batch != nil {
+		run.batch.Release()
+		run.batch = nil
+	}
+	run.row = 0
+	run.source = -1
+	if !run.r.Next() {
+		return run.r.Err()
+	}
+	run.batch = run.r.Record()
+	run.batch.Retain()
+	return nil
+}
+
+// close releases the run and removes its file
+func (run *sortedRun) close() {
+	if run.batch != nil {
+		run.batch.Release()
+		run.batch = nil
+	}
+	if run.r != nil {
+		run.r.Release()
+	}
+	if run.file != nil {
+		run.file.Close()
+	}
+	os.Remove(run.path)
+}
+
+// mergeReader merges sorted runs. It is a heap of the runs that still have
+// rows, ordered by their current row.
+type mergeReader struct {
+	refCount int64
+	mem      memory.Allocator
+	ctx      context.Context
+	schema   *arrow.Schema
+	keys     []int
+	size     int64
+	runs     []*sortedRun
+	heads    []int
+	// cmps[a][b] holds the key comparators between the current batches of
+	// runs a and b, built when first needed
+	cmps [][][]func(i, j int) int
+	cur  arrow.Record
+	err  error
+}
+
+func (m *mergeReader) Len() int { return len(m.heads) }
+
+func (m *mergeReader) Less(i, j int) bool {
+	a, b := m.heads[i], m.heads[j]
+	ra, rb := m.runs[a], m.runs[b]
+	cmps := m.cmps[a][b]
+	if cmps == nil {
+		cmps = make([]func(i, j int) int, len(m.keys))
+		for k, col := range m.keys {
+			cmps[k] = compareFunc(ra.batch.Column(col), rb.batch.Column(col))
+		}
+		m.cmps[a][b] = cmps
+	}
+	for _, c := range cmps {
+		if r := c(ra.row, rb.row); r != 0 {
+			return r < 0
+		}
+	}
+	// Earlier runs hold earlier input rows, keeping the sort stable
+	return a < b
+}
+
+func (m *mergeReader) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+
+func (m *mergeReader) Push(x any) { m.heads = append(m.heads, x.(int)) }
+
+func (m *mergeReader) Pop() any {
+	last := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return last
+}
+
+// Schema returns the schema of the sorted records
+func (m *mergeReader) Schema() *arrow.Schema {
+	return m.schema
+}
+
+// Next assembles the next size rows in sorted order, returning false when
+// every run is exhausted or on error
+func (m *mergeReader) Next() bool {
+	if m.cur != nil {
+		m.cur.Release()
+		m.cur = nil
+	}
+	if m.err != nil || len(m.heads) == 0 {
+		return false
+	}
+	if m.err = m.ctx.Err(); m.err != nil {
+		return false
+	}
+
+	// The rows taken come from the current batches of the runs, plus any
+	// batch a run moved past while this record was assembled
+	var sources []arrow.Record
+	var bases []int64
+	var total int64
+	defer func() {
+		for _, src := range sources {
+			src.Release()
+		}
+	}()
+	indices := make([]int64, 0, m.size)
+	for int64(len(indices)) < m.size && len(m.heads) > 0 {
+		idx := m.heads[0]
+		run := m.runs[idx]
+		if run.source < 0 {
+			run.batch.Retain()
+			run.source = len(sources)
+			sources = append(sources, run.batch)
+			bases = append(bases, total)
+			total += run.batch.NumRows()
+		}
+		indices = append(indices, bases[run.source]+int64(run.row))
+		run.row++
+		if int64(run.row) < run.batch.NumRows() {
+			heap.Fix(m, 0)
+			continue
+		}
+		if m.err = run.advance(); m.err != nil {
+			return false
+		}
+		for other := range m.cmps {
+			m.cmps[idx][other] = nil
+			m.cmps[other][idx] = nil
+		}
+		if run.batch == nil {
+			heap.Pop(m)
+		} else {
+			heap.Fix(m, 0)
+		}
+	}
+	for _, run := range m.runs {
+		run.source = -1
+	}
+
+	m.cur, m.err = m.take(sources, indices)
+	return m.err == nil
+}
+
+// take gathers the rows at indices, which address sources as if they were
+// concatenated in order
+func (m *mergeReader) take(sources []arrow.Record, indices []int64) (arrow.Record, error) {
+	ib := array.NewInt64Builder(m.mem)
+	defer ib.Release()
+	ib.AppendValues(indices, nil)
+	idx := ib.NewArray()
+	defer idx.Release()
+
+	ctx := compute.WithAllocator(m.ctx, m.mem)
+	cols := make([]arrow.Array, len(m.schema.Fields()))
+	defer func() {
+		for _, c := range cols {
+			if c != nil {
+				c.Release()
+			}
+		}
+	}()
+	for i := range cols {
+		parts := make([]arrow.Array, len(sources))
+		for k, src := range sources {
+			parts[k] = src.Column(i)
+		}
+		all, err := array.Concatenate(parts, m.mem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge column %s: %w", m.schema.Field(i).Name, err)
+		}
+		cols[i], err = compute.TakeArray(ctx, all, idx)
+		all.Release()
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge column %s: %w", m.schema.Field(i).Name, err)
+		}
+	}
+	return array.NewRecord(m.schema, cols, int64(len(indices))), nil
+}
+
+// Record returns the current record, valid until the next call to Next
+func (m *mergeReader) Record() arrow.Record {
+	return m.cur
+}
+
+// Err returns the first error encountered while merging
+func (m *mergeReader) Err() error {
+	return m.err
+}
+
+// Retain increases the reference count of the reader
+func (m *mergeReader) Retain() {
+	atomic.AddInt64(&m.refCount, 1)
+}
+
+// Release decreases the reference count of the reader, removing the spill
+// files once it reaches zero
+func (m *mergeReader) Release() {
+	if atomic.AddInt64(&m.refCount, -1) != 0 {
+		return
+	}
+	if m.cur != nil {
+		m.cur.Release()
+		m.cur = nil
+	}
+	for _, run := range m.runs {
+		run.close()
+	}
+	m.runs = nil
+}
+
+// spillFrameSize is how much plaintext a spill file seals per frame
+const spillFrameSize = 64 << 10
+
+// spillKey seals the runs this process spills. The key is drawn on first
+// use and never stored, so spill files left behind when the process is
+// killed cannot be read.
+var spillKey struct {
+	once sync.Once
+	aead cipher.AEAD
+	err  error
+}
+
+// spillRuns numbers the runs spilled by this process. A frame's nonce is
+// its run number and its index in the run, so no nonce repeats under the
+// key.
+var spillRuns atomic.Uint32
+
+// spillCipher returns the AES-256-GCM cipher of the process spill key
+func spillCipher() (cipher.AEAD, error) {
+	spillKey.once.Do(func() {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			spillKey.err = fmt.Errorf("failed to generate spill key: %w", err)
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			spillKey.err = err
+			return
+		}
+		spillKey.aead, spillKey.err = cipher.NewGCM(block)
+	})
+	return spillKey.aead, spillKey.err
+}
+
+// spillNonce returns the nonce of frame seq of run
+func spillNonce(aead cipher.AEAD, run uint32, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, run)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// spillWriter seals what is written to it in frames of a one-byte final
+// flag, a four-byte length and the ciphertext. The flag is authenticated,
+// so a truncated file fails to read rather than ending early.
+type spillWriter struct {
+	w    *bufio.Writer
+	aead cipher.AEAD
+	run  uint32
+	seq  uint64
+	buf  []byte
+}
+
+func (sw *spillWriter) Write(p []byte) (int, error) {
+	sw.buf = append(sw.buf, p...)
+	for len(sw.buf) >= spillFrameSize {
+		if err := sw.seal(sw.buf[:spillFrameSize], false); err != nil {
+			return 0, err
+		}
+		sw.buf = sw.buf[spillFrameSize:]
+	}
+	return len(p), nil
+}
+
+// Close seals the rest as the final frame and flushes the file
+func (sw *spillWriter) Close() error {
+	if err := sw.seal(sw.buf, true); err != nil {
+		return err
+	}
+	sw.buf = nil
+	return sw.w.Flush()
+}
+
+func (sw *spillWriter) seal(plaintext []byte, final bool) error {
+	var head [5]byte
+	if final {
+		head[0] = 1
+	}
+	sealed := sw.aead.Seal(nil, spillNonce(sw.aead, sw.run, sw.seq), plaintext, head[:1])
+	sw.seq++
+	binary.BigEndian.PutUint32(head[1:], uint32(len(sealed)))
+	if _, err := sw.w.Write(head[:]); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(sealed)
+	return err
+}
+
+// spillReader opens the frames of a spillWriter
+type spillReader struct {
+	r    *bufio.Reader
+	aead cipher.AEAD
+	run  uint32
+	seq  uint64
+	buf  []byte
+	done bool
+}
+
+func (sr *spillReader) Read(p []byte) (int, error) {
+	for len(sr.buf) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		var head [5]byte
+		if _, err := io.ReadFull(sr.r, head[:]); err != nil {
+			return 0, fmt.Errorf("spill file truncated: %w", err)
+		}
+		sealed := make([]byte, binary.BigEndian.Uint32(head[1:]))
+		if _, err := io.ReadFull(sr.r, sealed); err != nil {
+			return 0, fmt.Errorf("spill file truncated: %w", err)
+		}
+		plaintext, err := sr.aead.Open(sealed[:0], spillNonce(sr.aead, sr.run, sr.seq), sealed, head[:1])
+		if err != nil {
+			return 0, fmt.Errorf("spill file corrupted: %w", err)
+		}
+		sr.seq++
+		sr.buf = plaintext
+		sr.done = head[0] == 1
+	}
+	n := copy(p, sr.buf)
+	sr.buf = sr.buf[n:]
+	return n, nil
+}
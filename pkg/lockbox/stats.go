@@ -0,0 +1,176 @@
+package lockbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/TFMV/lockbox/pkg/format"
+	"github.com/TFMV/lockbox/pkg/metadata"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/rs/zerolog/log"
+)
+
+// Stats summarizes a lockbox from its encrypted statistics footer, without
+// decrypting any data blocks
+type Stats struct {
+	Rows     int64                  `json:"rows"`
+	Segments int                    `json:"segments"`
+	Columns  map[string]ColumnStats `json:"columns"`
+}
+
+// ColumnStats holds the null count of a column and the bounds of its
+// non-null values. Min and Max are nil for columns without an ordering;
+// timestamps and dates are reported as time.Time.
+type ColumnStats struct {
+	Nulls int64       `json:"nulls"`
+	Min   interface{} `json:"min,omitempty"`
+	Max   interface{} `json:"max,omitempty"`
+}
+
+// Stats decrypts the statistics footer. Files written before the footer
+// existed return an error wrapping format.ErrNoStats until RecomputeStats
+// is run.
+func (lb *Lockbox) Stats(opts ...Option) (*Stats, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return nil, options.err
+	}
+	if !options.hasCredentials() {
+		return nil, fmt.Errorf("%w for statistics", ErrPasswordRequired)
+	}
+
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := reader.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats: %w", err)
+	}
+
+	total := fs.Total()
+	stats := &Stats{
+		Rows:     total.Rows,
+		Segments: len(fs.Segments),
+		Columns:  make(map[string]ColumnStats, len(total.Columns)),
+	}
+	for _, field := range lb.Schema().Fields() {
+		cs, ok := total.Columns[field.Name]
+		if !ok {
+			continue
+		}
+		stats.Columns[field.Name] = ColumnStats{
+			Nulls: cs.Nulls,
+			Min:   statsValue(field.Type, cs.Min),
+			Max:   statsValue(field.Type, cs.Max),
+		}
+	}
+	return stats, nil
+}
+
+// RecomputeStats decrypts every segment and rewrites the statistics footer
+func (lb *Lockbox) RecomputeStats(opts ...Option) error {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return options.err
+	}
+	if !options.hasCredentials() {
+		return fmt.Errorf("%w to recompute statistics", ErrPasswordRequired)
+	}
+
+	reader, err := lb.newReader(options)
+	if err != nil {
+		return err
+	}
+	if err := reader.RecomputeStats(); err != nil {
+		return fmt.Errorf("failed to recompute stats: %w", err)
+	}
+
+	log.Info().Int("segments", lb.SegmentCount()).Msg("Recomputed lockbox statistics")
+	return nil
+}
+
+// Count returns the number of rows. Without filters the statistics footer
+// answers without decrypting any block; files without a footer, and
+// counts with WithFilter, stream the segments instead, decrypting only the
+// columns the count needs.
+func (lb *Lockbox) Count(ctx context.Context, opts ...Option) (int64, error) {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.err != nil {
+		return 0, options.err
+	}
+	if !options.hasCredentials() {
+		return 0, fmt.Errorf("%w for counting", ErrPasswordRequired)
+	}
+
+	if len(options.Filters) == 0 {
+		stats, err := lb.Stats(opts...)
+		if err == nil {
+			return stats.Rows, nil
+		}
+		if !errors.Is(err, format.ErrNoStats) {
+			return 0, err
+		}
+	}
+
+	var columns []string
+	for _, f := range options.Filters {
+		if !contains(columns, f.Column) {
+			columns = append(columns, f.Column)
+		}
+	}
+	if len(columns) == 0 && lb.Schema().NumFields() > 0 {
+		columns = []string{lb.Schema().Field(0).Name}
+	}
+
+	rr, err := lb.NewReader(append(opts, WithColumns(columns...))...)
+	if err != nil {
+		return 0, err
+	}
+	defer rr.Release()
+
+	var rows int64
+	for rr.Next() {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		rows += rr.Record().NumRows()
+	}
+	if err := rr.Err(); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return rows, nil
+}
+
+// statsValue converts a stored bound to the Go value for the column type
+func statsValue(dt arrow.DataType, v *metadata.StatsValue) interface{} {
+	switch {
+	case v == nil:
+		return nil
+	case v.Int != nil:
+		switch t := dt.(type) {
+		case *arrow.TimestampType:
+			return arrow.Timestamp(*v.Int).ToTime(t.Unit)
+		case *arrow.Date32Type:
+			return arrow.Date32(*v.Int).ToTime()
+		case *arrow.Date64Type:
+			return arrow.Date64(*v.Int).ToTime()
+		}
+		return *v.Int
+	case v.Float != nil:
+		return *v.Float
+	case v.String != nil:
+		return *v.String
+	}
+	return nil
+}
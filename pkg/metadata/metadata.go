@@ -33,6 +33,40 @@ type EncryptionParams struct {
 	SaltSize      int               `json:"saltSize"`
 	ColumnSalts   map[string][]byte `json:"columnSalts"` // Column name -> salt
 	MasterSalt    []byte            `json:"masterSalt"`
+	// Recipients holds the master key wrapped for each public-key recipient
+	Recipients []RecipientSlot `json:"recipients,omitempty"`
+	// PasswordDisabled is set when the file can only be opened by a recipient
+	PasswordDisabled bool `json:"passwordDisabled,omitempty"`
+	// PasswordSlot holds the master key sealed under the current password.
+	// Files written before key slots existed derive the master key directly
+	// from the password and have no slot.
+	PasswordSlot *PasswordSlot `json:"passwordSlot,omitempty"`
+	// AADHint is a keyed hash of the associated data the blocks are bound
+	// to, empty when they are bound to none. It lets a wrong context be
+	// reported as such rather than as failed decryption.
+	AADHint []byte `json:"aadHint,omitempty"`
+}
+
+// PasswordSlot is the master key sealed under a password-derived key
+type PasswordSlot struct {
+	Salt       []byte `json:"salt"`
+	WrappedKey []byte `json:"wrappedKey"`
+	// KDF holds the Argon2id cost; nil means PBKDF2
+	KDF *KDFParams `json:"kdf,omitempty"`
+}
+
+// KDFParams records the Argon2id cost used for a password slot
+type KDFParams struct {
+	Memory      uint32 `json:"memoryKiB"`
+	Iterations  uint32 `json:"iterations"`
+	Parallelism uint32 `json:"parallelism"`
+}
+
+// RecipientSlot is the master key sealed for one X25519 recipient
+type RecipientSlot struct {
+	PublicKey    []byte `json:"publicKey"`
+	EphemeralKey []byte `json:"ephemeralKey"`
+	WrappedKey   []byte `json:"wrappedKey"`
 }
 
 // AccessPolicy represents access control rules
@@ -84,6 +118,15 @@ type AccessEntry struct {
 	Details   string    `json:"details,omitempty"`
 }
 
+// ProvenanceEntry records one write: when it committed, how many rows it
+// added and who wrote them with what
+type ProvenanceEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Rows      int64     `json:"rows"`
+	Tool      string    `json:"tool,omitempty"`
+	User      string    `json:"user,omitempty"`
+}
+
 // Metadata represents the complete lockbox metadata
 type Metadata struct {
 	Header       FileHeader       `json:"header"`
@@ -93,6 +136,42 @@ type Metadata struct {
 	AccessPolicy *AccessPolicy    `json:"accessPolicy,omitempty"`
 	AuditTrail   AuditTrail       `json:"auditTrail"`
 	BlockInfo    []BlockInfo      `json:"blockInfo"`
+	// Stats is the encrypted FileStats footer. Files written before the
+	// footer existed have none until their stats are recomputed.
+	Stats []byte `json:"stats,omitempty"`
+	// Ingest tracks the latest chunked ingest, committed with its blocks
+	Ingest *IngestManifest `json:"ingest,omitempty"`
+	// SchemaVersion counts schema upgrades, starting at 1. Files written
+	// before versions were tracked have 0; see CurrentSchemaVersion.
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// ColumnStarts maps each column added by a schema upgrade to the first
+	// segment that stores it. Earlier segments read the column as null.
+	ColumnStarts map[string]int `json:"columnStarts,omitempty"`
+	// SortOrder lists the columns every segment is sorted by, ascending
+	// with nulls last. Empty when any segment was written unsorted.
+	SortOrder []string `json:"sortOrder,omitempty"`
+	// BlockSize is the number of rows per segment writers default to, or
+	// zero to store each written record as one segment
+	BlockSize int `json:"blockSize,omitempty"`
+	// Properties are user key-value pairs such as provenance. They are
+	// stored in plaintext and authenticated by PropertiesMAC.
+	Properties    map[string]string `json:"properties,omitempty"`
+	PropertiesMAC []byte            `json:"propertiesMac,omitempty"`
+	// Provenance holds one entry per write, oldest first. It is stored in
+	// plaintext and authenticated by ProvenanceMAC, which is set when the
+	// file is created, even while the log is empty.
+	Provenance    []ProvenanceEntry `json:"provenance,omitempty"`
+	ProvenanceMAC []byte            `json:"provenanceMac,omitempty"`
+}
+
+// IngestManifest records how far a chunked ingest got. The source is
+// identified by a fingerprint rather than its path, so the plaintext
+// metadata does not name the input.
+type IngestManifest struct {
+	Fingerprint string `json:"fingerprint"`
+	// Rows is the number of input rows committed so far
+	Rows     int64 `json:"rows"`
+	Complete bool  `json:"complete"`
 }
 
 // BlockInfo describes an encrypted data block
@@ -102,6 +181,8 @@ type BlockInfo struct {
 	Length     int64  `json:"length"`
 	RowCount   int64  `json:"rowCount"`
 	Compressed bool   `json:"compressed"`
+	Codec      string `json:"codec,omitempty"`
+	Level      int    `json:"level,omitempty"`
 	Checksum   []byte `json:"checksum"`
 	OrigSize   int64  `json:"origSize,omitempty"`
 	MimeType   string `json:"mimeType,omitempty"`
@@ -192,19 +273,47 @@ func Deserialize(data []byte) (*Metadata, error) {
 }
 
 // AddBlockInfo adds information about an encrypted block
-func (m *Metadata) AddBlockInfo(columnName string, offset, length, rowCount int64, checksum []byte, origSize int64, mime string) {
+func (m *Metadata) AddBlockInfo(columnName string, offset, length, rowCount int64, checksum []byte, origSize int64, mime string, codec string, level int) {
+	compressed := codec != "" && codec != "none"
+	if !compressed {
+		codec = ""
+		level = 0
+	}
 	m.BlockInfo = append(m.BlockInfo, BlockInfo{
 		ColumnName: columnName,
 		Offset:     offset,
 		Length:     length,
 		RowCount:   rowCount,
-		Compressed: false,
+		Compressed: compressed,
+		Codec:      codec,
+		Level:      level,
 		Checksum:   checksum,
 		OrigSize:   origSize,
 		MimeType:   mime,
 	})
 }
 
+// CurrentSchemaVersion returns the schema version, treating 0 as 1
+func (m *Metadata) CurrentSchemaVersion() int {
+	if m.SchemaVersion == 0 {
+		return 1
+	}
+	return m.SchemaVersion
+}
+
+// ColumnBlocks returns the blocks stored for a column in write order. Each
+// call to the writer appends one block per column, so the i-th block of every
+// column together form the i-th row group of the file.
+func (m *Metadata) ColumnBlocks(columnName string) []BlockInfo {
+	var blocks []BlockInfo
+	for _, block := range m.BlockInfo {
+		if block.ColumnName == columnName {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
 // LogAccess logs an access event
 func (m *Metadata) LogAccess(principal, action, resource string, success bool, details string) {
 	entry := AccessEntry{
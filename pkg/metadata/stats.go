@@ -0,0 +1,67 @@
+package metadata
+
+// FileStats is the statistics footer. It holds one entry per segment in
+// write order and is stored encrypted in Metadata.Stats.
+type FileStats struct {
+	Segments []SegmentStats `json:"segments"`
+}
+
+// SegmentStats summarizes the rows of one segment
+type SegmentStats struct {
+	Rows    int64                  `json:"rows"`
+	Columns map[string]ColumnStats `json:"columns"`
+}
+
+// ColumnStats holds the null count of a column and, for sortable primitive
+// columns, the bounds of its non-null values
+type ColumnStats struct {
+	Nulls int64       `json:"nulls"`
+	Min   *StatsValue `json:"min,omitempty"`
+	Max   *StatsValue `json:"max,omitempty"`
+}
+
+// StatsValue is a typed bound. Integers and timestamps (in the column's
+// unit) use Int, floating point columns use Float and strings use String.
+type StatsValue struct {
+	Int    *int64   `json:"int,omitempty"`
+	Float  *float64 `json:"float,omitempty"`
+	String *string  `json:"string,omitempty"`
+}
+
+// Less reports whether v sorts before o. Values of different kinds are
+// never ordered.
+func (v *StatsValue) Less(o *StatsValue) bool {
+	switch {
+	case v.Int != nil && o.Int != nil:
+		return *v.Int < *o.Int
+	case v.Float != nil && o.Float != nil:
+		return *v.Float < *o.Float
+	case v.String != nil && o.String != nil:
+		return *v.String < *o.String
+	}
+	return false
+}
+
+// Total merges every segment into file-wide statistics
+func (s *FileStats) Total() SegmentStats {
+	total := SegmentStats{Columns: make(map[string]ColumnStats)}
+	for _, seg := range s.Segments {
+		total.Rows += seg.Rows
+		for name, cs := range seg.Columns {
+			acc, ok := total.Columns[name]
+			if !ok {
+				total.Columns[name] = cs
+				continue
+			}
+			acc.Nulls += cs.Nulls
+			if cs.Min != nil && (acc.Min == nil || cs.Min.Less(acc.Min)) {
+				acc.Min = cs.Min
+			}
+			if cs.Max != nil && (acc.Max == nil || acc.Max.Less(cs.Max)) {
+				acc.Max = cs.Max
+			}
+			total.Columns[name] = acc
+		}
+	}
+	return total
+}
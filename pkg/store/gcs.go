@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+func init() {
+	Register("gs", NewGCS)
+}
+
+// GCS stores objects in a Google Cloud Storage bucket
+type GCS struct {
+	bucket *storage.BucketHandle
+}
+
+// NewGCS returns the store for a GCS bucket. Credentials come from
+// Application Default Credentials.
+func NewGCS(ctx context.Context, bucket string) (Store, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &GCS{bucket: client.Bucket(bucket)}, nil
+}
+
+// Reader returns a seekable reader that fetches byte ranges on demand
+func (g *GCS) Reader(path string) (io.ReadSeekCloser, error) {
+	ctx := context.Background()
+	obj := g.bucket.Object(path)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rangeReader{
+		size: attrs.Size,
+		open: func(offset int64) (io.ReadCloser, error) {
+			return obj.NewRangeReader(ctx, offset, -1)
+		},
+	}, nil
+}
+
+// Writer streams to a resumable upload, which only creates the object when
+// the writer closes
+func (g *GCS) Writer(path string) (io.WriteCloser, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := g.bucket.Object(path).NewWriter(ctx)
+	return &gcsWriter{Writer: w, cancel: cancel}, nil
+}
+
+// gcsWriter cancels its upload on CloseWithError
+type gcsWriter struct {
+	*storage.Writer
+	cancel context.CancelFunc
+}
+
+func (w *gcsWriter) Close() error {
+	defer w.cancel()
+	return w.Writer.Close()
+}
+
+// CloseWithError aborts the upload so no partial object is committed
+func (w *gcsWriter) CloseWithError(err error) error {
+	w.cancel()
+	w.Writer.Close()
+	return err
+}
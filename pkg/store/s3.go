@@ -0,0 +1,136 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// s3PartSize is the multipart upload part size; S3 requires at least 5MiB
+// for every part but the last
+const s3PartSize = 8 << 20
+
+func init() {
+	Register("s3", NewS3)
+}
+
+// S3 stores objects in an Amazon S3 bucket
+type S3 struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3 returns the store for an S3 bucket. Credentials and region come from
+// the standard AWS SDK chain: environment, shared config and instance roles.
+func NewS3(ctx context.Context, bucket string) (Store, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &S3{client: s3.NewFromConfig(cfg), bucket: bucket}, nil
+}
+
+// Reader returns a seekable reader that fetches byte ranges on demand
+func (s *S3) Reader(path string) (io.ReadSeekCloser, error) {
+	ctx := context.Background()
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rangeReader{
+		size: aws.ToInt64(head.ContentLength),
+		open: func(offset int64) (io.ReadCloser, error) {
+			out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(path),
+				Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return out.Body, nil
+		},
+	}, nil
+}
+
+// Writer streams to a multipart upload, which only creates the object when
+// the writer closes
+func (s *S3) Writer(path string) (io.WriteCloser, error) {
+	return newPipeWriter(func(r io.Reader) error {
+		return s.upload(context.Background(), path, r)
+	}), nil
+}
+
+// upload sends r as a single PUT when it fits in one part, otherwise as a
+// multipart upload that is aborted on failure
+func (s *S3) upload(ctx context.Context, path string, r io.Reader) error {
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(path),
+			Body:   bytes.NewReader(buf[:n]),
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return err
+	}
+	abort := func(err error) error {
+		s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(path),
+			UploadId: created.UploadId,
+		})
+		return err
+	}
+
+	var parts []types.CompletedPart
+	for part := int32(1); n > 0; part++ {
+		out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(path),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(part),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(part)})
+
+		n, err = io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(path),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return abort(err)
+	}
+	return nil
+}
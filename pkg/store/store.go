@@ -0,0 +1,149 @@
+// Package store abstracts where lockbox files and input data live. The local
+// filesystem is the default; object stores are selected by URI scheme, e.g.
+// s3://bucket/key or gs://bucket/object.
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store opens objects for reading and writing. Paths are relative to the
+// store, e.g. the object key within a bucket.
+type Store interface {
+	Reader(path string) (io.ReadSeekCloser, error)
+	Writer(path string) (io.WriteCloser, error)
+}
+
+// Factory creates the store for one bucket of a scheme
+type Factory func(ctx context.Context, bucket string) (Store, error)
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Factory{}
+)
+
+// Register makes a scheme available to Resolve. Registering a scheme again
+// replaces the previous factory.
+func Register(scheme string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[scheme] = f
+}
+
+// IsRemote reports whether uri names an object in a registered store rather
+// than a local path
+func IsRemote(uri string) bool {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok || scheme == "file" {
+		return false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	_, found := registry[scheme]
+	return found
+}
+
+// Resolve returns the store for uri and the path within it. Plain paths and
+// file:// URIs resolve to the local filesystem.
+func Resolve(ctx context.Context, uri string) (Store, string, error) {
+	if !strings.Contains(uri, "://") {
+		return Local{}, uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid URI %q: %w", uri, err)
+	}
+	if u.Scheme == "file" {
+		return Local{}, u.Path, nil
+	}
+
+	mu.RLock()
+	f, ok := registry[u.Scheme]
+	mu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, "", fmt.Errorf("invalid URI %q: expected %s://bucket/path", uri, u.Scheme)
+	}
+	s, err := f(ctx, u.Host)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open %s store: %w", u.Scheme, err)
+	}
+	return s, key, nil
+}
+
+// Download copies an object to a new local temporary file and returns its
+// path. The caller removes the file.
+func Download(s Store, path string) (string, error) {
+	r, err := s.Reader(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "lockbox-*"+filepath.Ext(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Upload copies a local file to an object. The object is only replaced
+// once the writer closes successfully.
+func Upload(s Store, local, path string) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := s.Writer(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for writing: %w", path, err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		// Abort rather than commit a truncated object where the writer
+		// supports it
+		if a, ok := w.(interface{ CloseWithError(error) error }); ok {
+			a.CloseWithError(err)
+		} else {
+			w.Close()
+		}
+		return fmt.Errorf("failed to upload %s: %w", path, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", path, err)
+	}
+	return nil
+}
+
+// Local is the local filesystem
+type Local struct{}
+
+// Reader opens a local file
+func (Local) Reader(path string) (io.ReadSeekCloser, error) {
+	return os.Open(path)
+}
+
+// Writer creates or truncates a local file
+func (Local) Writer(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
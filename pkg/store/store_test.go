@@ -0,0 +1,63 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func TestRangeReader(t *testing.T) {
+	data := []byte("0123456789")
+	requests := 0
+	r := &rangeReader{
+		size: int64(len(data)),
+		open: func(offset int64) (io.ReadCloser, error) {
+			requests++
+			return io.NopCloser(bytes.NewReader(data[offset:])), nil
+		},
+	}
+	defer r.Close()
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "012" {
+		t.Fatalf("read %q (%v)", buf, err)
+	}
+	if _, err := r.Seek(-2, io.SeekEnd); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if _, err := io.ReadFull(r, buf[:2]); err != nil || string(buf[:2]) != "89" {
+		t.Fatalf("read after seek %q (%v)", buf[:2], err)
+	}
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF, got %d, %v", n, err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 range requests, got %d", requests)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	Register("resolvetest", func(ctx context.Context, bucket string) (Store, error) {
+		return Local{}, nil
+	})
+
+	if IsRemote("/tmp/data.lbx") || IsRemote("file:///tmp/data.lbx") || IsRemote("unknown://b/k") {
+		t.Fatalf("local paths and unknown schemes are not remote")
+	}
+	if !IsRemote("resolvetest://bucket/key") {
+		t.Fatalf("expected registered scheme to be remote")
+	}
+
+	if _, path, err := Resolve(context.Background(), "file:///tmp/data.lbx"); err != nil || path != "/tmp/data.lbx" {
+		t.Fatalf("file URI resolved to %q (%v)", path, err)
+	}
+	if _, path, err := Resolve(context.Background(), "resolvetest://bucket/dir/key.lbx"); err != nil || path != "dir/key.lbx" {
+		t.Fatalf("object URI resolved to %q (%v)", path, err)
+	}
+	for _, bad := range []string{"resolvetest://bucket", "resolvetest:///key", "unknown://bucket/key"} {
+		if _, _, err := Resolve(context.Background(), bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}